@@ -0,0 +1,543 @@
+package gomigration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const migrationsTable = "schema_migrations"
+
+type Logger interface {
+	Printf(format string, args ...any)
+}
+
+type ApplyOptions struct {
+	Logger Logger
+	// Target stops Apply after the migrations of this version and makes
+	// Rollback revert every applied version after it, e.g. "0" to revert
+	// them all. The default applies every pending migration and rolls back
+	// only the latest applied version.
+	Target string
+}
+
+type migrationFile struct {
+	Version  string
+	Name     string
+	UpPath   string
+	DownPath string
+}
+
+// migrationBlock is one generated operation: the statements of its up side
+// and the statements that undo it.
+type migrationBlock struct {
+	up   []string
+	down []string
+	// paired is false when nothing in the down file undoes the operation.
+	paired bool
+}
+
+func Apply(db *gorm.DB, dir string) error {
+	return ApplyWithOptions(db, dir, ApplyOptions{})
+}
+
+func ApplyWithOptions(db *gorm.DB, dir string, opts ApplyOptions) error {
+	return ApplyContext(context.Background(), db, dir, opts)
+}
+
+// ApplyContext is ApplyWithOptions with cancellation. ctx is checked before
+// every statement; once it is done no further migration runs, the operations
+// of the interrupted migration are reverted as after a failed statement and
+// the returned error wraps ctx.Err().
+func ApplyContext(ctx context.Context, db *gorm.DB, dir string, opts ApplyOptions) error {
+	if db == nil {
+		return fmt.Errorf("db is required")
+	}
+	if err := validateVersion(opts.Target); err != nil {
+		return fmt.Errorf("target: %w", err)
+	}
+	files, err := listMigrationFiles(dir)
+	if err != nil {
+		return err
+	}
+	// Session settings, such as the sql_mode a generated file switches to,
+	// only hold on the connection they were made on. The new session keeps
+	// a failed statement from failing every statement after it.
+	return db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		conn = conn.Session(&gorm.Session{})
+		return keepSQLiteForeignKeys(ctx, conn, func() error {
+			return applyMigrationFiles(ctx, conn, files, opts)
+		})
+	})
+}
+
+func applyMigrationFiles(ctx context.Context, db *gorm.DB, files []migrationFile, opts ApplyOptions) error {
+	// Reverting and recording a version must still run after ctx is done.
+	cleanup := db.WithContext(context.WithoutCancel(ctx))
+	if err := EnsureMigrationsTable(db); err != nil {
+		return err
+	}
+	recorded, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	applied := make(map[string]appliedMigration, len(recorded))
+	for _, m := range recorded {
+		applied[m.Version] = m
+	}
+	groups := groupMigrationFiles(files)
+	checksums := make([]string, len(groups))
+	for i, group := range groups {
+		if checksums[i], err = versionChecksum(group); err != nil {
+			return err
+		}
+		m, ok := applied[group[0].Version]
+		if !ok || m.Checksum == "" || m.Checksum == checksums[i] {
+			continue
+		}
+		// A Squash baseline keeps the version of the newest migration it
+		// replaces, whose checksum databases that ran it recorded.
+		squashed, err := squashedChecksum(group)
+		if err != nil {
+			return err
+		}
+		if m.Checksum != squashed {
+			return fmt.Errorf("migration %s was changed after it was applied: its up files have checksum %s, %s recorded %s", group[0].Version, checksums[i], migrationsTable, m.Checksum)
+		}
+	}
+
+	for i, group := range groups {
+		version := group[0].Version
+		if opts.Target != "" && compareVersions(version, opts.Target) > 0 {
+			break
+		}
+		if _, ok := applied[version]; ok {
+			continue
+		}
+		record := func(db *gorm.DB) error {
+			return RecordApplied(db, version, versionName(group), checksums[i])
+		}
+		if inTransaction, err := applyVersionInTransaction(ctx, db, group, record, opts.Logger); inTransaction || err != nil {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		for i, file := range group {
+			if err := applyMigrationFile(ctx, db, cleanup, file, opts.Logger); err != nil {
+				return revertMigrationFiles(cleanup, group[:i], err, opts.Logger)
+			}
+			logf(opts.Logger, "applied migration %s_%s", file.Version, file.Name)
+		}
+		if err := record(cleanup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyVersionInTransaction applies the files of one version and records it
+// in a single transaction when the database can roll back DDL, as Postgres
+// and SQLite can. It reports false without running anything for MySQL, and
+// for files that manage transactions themselves or create indexes
+// CONCURRENTLY, which cannot run inside one.
+func applyVersionInTransaction(ctx context.Context, db *gorm.DB, group []migrationFile, record func(*gorm.DB) error, logger Logger) (bool, error) {
+	if !transactionalDDL(dialectOf(db)) {
+		return false, nil
+	}
+	stmts := make([][]string, len(group))
+	for i, file := range group {
+		upSQL, err := readSQLFile(file.UpPath)
+		if err != nil {
+			return true, err
+		}
+		stmts[i] = splitSQLStatements(upSQL)
+		if !transactionSafe(stmts[i]) {
+			return false, nil
+		}
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for i, file := range group {
+			if n, err := execStatements(ctx, tx, stmts[i]); err != nil {
+				return fmt.Errorf("migration %s_%s failed at statement %d: %w", file.Version, file.Name, n+1, err)
+			}
+		}
+		return record(tx)
+	})
+	if err != nil {
+		logf(logger, "%v", err)
+		return true, fmt.Errorf("%w (transaction rolled back)", err)
+	}
+	for _, file := range group {
+		logf(logger, "applied migration %s_%s", file.Version, file.Name)
+	}
+	return true, nil
+}
+
+// transactionalDDL reports whether the dialect rolls back DDL with the
+// transaction it runs in. MySQL commits implicitly around every DDL
+// statement.
+func transactionalDDL(dialect Dialect) bool {
+	return dialect == DialectPostgres || dialect == DialectSQLite
+}
+
+// transactionSafe reports whether stmts can run inside a transaction: they
+// do not begin or end one themselves, as files generated with
+// Options.WrapInTransaction do, create no index CONCURRENTLY and do not set
+// PRAGMA foreign_keys, which SQLite ignores inside a transaction.
+func transactionSafe(stmts []string) bool {
+	for _, stmt := range stmts {
+		upper := strings.ToUpper(strings.TrimSpace(stmt))
+		for _, prefix := range []string{"BEGIN", "START TRANSACTION", "COMMIT", "ROLLBACK", "END"} {
+			if upper == prefix+";" || strings.HasPrefix(upper, prefix+" ") {
+				return false
+			}
+		}
+		if strings.Contains(upper, " CONCURRENTLY ") || strings.HasPrefix(upper, "PRAGMA FOREIGN_KEYS") {
+			return false
+		}
+	}
+	return true
+}
+
+// execStatements runs stmts in order, checking ctx before each, and returns
+// the index of the statement that failed.
+func execStatements(ctx context.Context, db *gorm.DB, stmts []string) (int, error) {
+	for i, stmt := range stmts {
+		err := ctx.Err()
+		if err == nil {
+			err = execStatement(db, stmt)
+		}
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(stmts), nil
+}
+
+// groupMigrationFiles splits the sorted files into the files of each
+// version.
+func groupMigrationFiles(files []migrationFile) [][]migrationFile {
+	groups := make([][]migrationFile, 0)
+	for start := 0; start < len(files); {
+		end := start + 1
+		for end < len(files) && files[end].Version == files[start].Version {
+			end++
+		}
+		groups = append(groups, files[start:end])
+		start = end
+	}
+	return groups
+}
+
+// compareVersions orders versions numerically, so sequential versions of
+// different widths compare as numbers. Both are all digits.
+func compareVersions(a, b string) int {
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		return len(a) - len(b)
+	}
+	return strings.Compare(a, b)
+}
+
+// revertMigrationFiles runs the down files of the already applied files of a
+// version, newest first, after a later file of the same version failed.
+func revertMigrationFiles(db *gorm.DB, done []migrationFile, failure error, logger Logger) error {
+	if len(done) == 0 {
+		return failure
+	}
+	for i := len(done) - 1; i >= 0; i-- {
+		downSQL, err := readSQLFile(done[i].DownPath)
+		if err == nil {
+			for _, stmt := range splitSQLStatements(downSQL) {
+				if err = execStatement(db, stmt); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			logf(logger, "migration %s_%s: reverting failed: %v", done[i].Version, done[i].Name, err)
+			return fmt.Errorf("%w (files not reverted: %s_%s and earlier)", failure, done[i].Version, done[i].Name)
+		}
+		logf(logger, "migration %s_%s: reverted", done[i].Version, done[i].Name)
+	}
+	return fmt.Errorf("%w (reverted %d earlier files of version %s)", failure, len(done), done[0].Version)
+}
+
+func listMigrationFiles(dir string) ([]migrationFile, error) {
+	upPaths, err := filepath.Glob(filepath.Join(dir, "*.up.sql"))
+	if err != nil {
+		return nil, err
+	}
+	// Versions run in numeric order, as Apply and Rollback compare them, so
+	// 10 runs after 9. Files of one version run in name order, except that
+	// the cross-table foreign key file of a per-table migration runs last.
+	sort.Slice(upPaths, func(i, j int) bool {
+		vi, _, _ := strings.Cut(filepath.Base(upPaths[i]), "_")
+		vj, _, _ := strings.Cut(filepath.Base(upPaths[j]), "_")
+		if c := compareVersions(vi, vj); c != 0 {
+			return c < 0
+		}
+		if vi != vj {
+			return vi < vj
+		}
+		fi := strings.HasSuffix(upPaths[i], foreignKeysFileSuffix+".up.sql")
+		fj := strings.HasSuffix(upPaths[j], foreignKeysFileSuffix+".up.sql")
+		if fi != fj {
+			return fj
+		}
+		return upPaths[i] < upPaths[j]
+	})
+	files := make([]migrationFile, 0, len(upPaths))
+	for _, upPath := range upPaths {
+		base := strings.TrimSuffix(filepath.Base(upPath), ".up.sql")
+		version, name, _ := strings.Cut(base, "_")
+		if version == "" {
+			return nil, fmt.Errorf("migration file %s has no version prefix", filepath.Base(upPath))
+		}
+		files = append(files, migrationFile{
+			Version:  version,
+			Name:     name,
+			UpPath:   upPath,
+			DownPath: filepath.Join(dir, base+".down.sql"),
+		})
+	}
+	return files, nil
+}
+
+// applyMigrationFile runs the up statements of one migration. MySQL DDL is
+// not transactional, so when a statement fails the statements of the failed
+// operation that already ran and the down blocks of the operations that
+// completed are run in reverse order as a best-effort compensation before
+// the failure is reported. The compensation runs on cleanup, which is not
+// canceled with ctx.
+func applyMigrationFile(ctx context.Context, db, cleanup *gorm.DB, file migrationFile, logger Logger) error {
+	upSQL, err := readSQLFile(file.UpPath)
+	if err != nil {
+		return err
+	}
+	downSQL, err := readSQLFile(file.DownPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	blocks := pairMigrationBlocks(upSQL, downSQL)
+	online := runsOnlineDDL(splitSQLStatements(upSQL))
+	for i, block := range blocks {
+		for j, stmt := range block.up {
+			err := ctx.Err()
+			if err == nil {
+				err = execStatement(db, stmt)
+			}
+			if err != nil {
+				failure := fmt.Errorf("migration %s_%s failed at operation %d statement %d: %w", file.Version, file.Name, i+1, j+1, err)
+				logf(logger, "%v", failure)
+				if online {
+					// The statements that returned were only queued, so
+					// their downs could run before them.
+					return fmt.Errorf("%w (not reverted: the file runs Vitess online DDL, which applies statements asynchronously)", failure)
+				}
+				return compensate(cleanup, file, blocks[:i], block.up[:j], block.down, failure, logger)
+			}
+		}
+	}
+	return nil
+}
+
+// compensate reverts the statements ran of the failed operation, then the
+// done operations, newest first. It stops at the first operation it cannot
+// revert, because the operations before it may be what it depends on, and
+// reports that one and every earlier one as not reverted.
+func compensate(db *gorm.DB, file migrationFile, done []migrationBlock, ran, failedDown []string, failure error, logger Logger) error {
+	if len(ran) > 0 {
+		undo, err := undoStatements(dialectOf(db), ran, failedDown)
+		if err == nil {
+			err = execAll(db, undo)
+		}
+		if err != nil {
+			logf(logger, "migration %s: operation %d was partially applied and cannot be reverted: %v", file.Version, len(done)+1, err)
+			return notRevertedError(failure, len(done)+1)
+		}
+		logf(logger, "migration %s: reverted the partially applied operation %d", file.Version, len(done)+1)
+	}
+	for i := len(done) - 1; i >= 0; i-- {
+		err := errNoDown
+		if done[i].paired {
+			err = execAll(db, done[i].down)
+		}
+		if err != nil {
+			logf(logger, "migration %s: reverting operation %d failed: %v", file.Version, i+1, err)
+			return notRevertedError(failure, i+1)
+		}
+		logf(logger, "migration %s: reverted operation %d", file.Version, i+1)
+	}
+	return fmt.Errorf("%w (reverted %d completed operations)", failure, len(done))
+}
+
+var errNoDown = errors.New("the down file has no statements that undo it")
+
+// notRevertedError reports operation n and every operation before it as
+// not reverted.
+func notRevertedError(failure error, n int) error {
+	numbers := make([]string, 0, n)
+	for i := n; i >= 1; i-- {
+		numbers = append(numbers, strconv.Itoa(i))
+	}
+	return fmt.Errorf("%w (operations not reverted: %s)", failure, strings.Join(numbers, ", "))
+}
+
+func execAll(db *gorm.DB, stmts []string) error {
+	for _, stmt := range stmts {
+		if err := execStatement(db, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execStatement runs one statement. A PRAGMA foreign_key_check, which ends
+// a SQLite table rebuild, reports violations as rows instead of failing, so
+// it fails here when it returns any.
+func execStatement(db *gorm.DB, stmt string) error {
+	if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(stmt)), "PRAGMA FOREIGN_KEY_CHECK") {
+		return db.Exec(stmt).Error
+	}
+	var violations []map[string]any
+	if err := db.Raw(stmt).Scan(&violations).Error; err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("%s: foreign key violations: %d", strings.TrimSuffix(strings.TrimSpace(stmt), ";"), len(violations))
+	}
+	return nil
+}
+
+// keepSQLiteForeignKeys runs fn and then restores the foreign_keys setting
+// of the SQLite connection db, which the table rebuilds fn runs turn off and
+// on again. Other dialects run fn unchanged.
+func keepSQLiteForeignKeys(ctx context.Context, db *gorm.DB, fn func() error) error {
+	if dialectOf(db) != DialectSQLite {
+		return fn()
+	}
+	var enabled int
+	if err := db.Raw("PRAGMA foreign_keys").Scan(&enabled).Error; err != nil {
+		return err
+	}
+	err := fn()
+	restore := db.WithContext(context.WithoutCancel(ctx)).Exec(fmt.Sprintf("PRAGMA foreign_keys = %d", enabled)).Error
+	if err == nil {
+		err = restore
+	}
+	return err
+}
+
+// pairMigrationBlocks splits generated up and down files into operations.
+// A block that starts with an operationMarker pairs with the down blocks of
+// the same operation, in down file order. Unmarked blocks, the file-level
+// SET and transaction statements and every block of files written by hand
+// or by older releases, pair by position: the generator writes the down
+// file in reverse order, so unmarked block i of the up file is undone by
+// unmarked block n-1-i of the down file when both files have n of them.
+// Any other block has no down and cannot be reverted.
+func pairMigrationBlocks(up, down string) []migrationBlock {
+	upBlocks := splitMarkedSQLBlocks(up)
+	downBlocks := splitMarkedSQLBlocks(down)
+	marked := map[int][]string{}
+	unmarked := make([][]string, 0)
+	for _, block := range downBlocks {
+		if block.op == 0 {
+			unmarked = append(unmarked, block.stmts)
+			continue
+		}
+		marked[block.op] = append(marked[block.op], block.stmts...)
+	}
+	unmarkedUp := 0
+	for _, block := range upBlocks {
+		if block.op == 0 {
+			unmarkedUp++
+		}
+	}
+	blocks := make([]migrationBlock, 0, len(upBlocks))
+	seen := 0
+	for _, block := range upBlocks {
+		b := migrationBlock{up: block.stmts}
+		if block.op != 0 {
+			b.down, b.paired = marked[block.op], len(marked[block.op]) > 0
+		} else {
+			if unmarkedUp == len(unmarked) {
+				b.down, b.paired = unmarked[len(unmarked)-1-seen], true
+			}
+			seen++
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks
+}
+
+// markedSQLBlock is one blank-line separated block of a migration file and
+// the number its operationMarker gives it, 0 for none.
+type markedSQLBlock struct {
+	op    int
+	stmts []string
+}
+
+func splitMarkedSQLBlocks(text string) []markedSQLBlock {
+	blocks := make([]markedSQLBlock, 0)
+	for _, chunk := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		stmts := splitSQLStatements(chunk)
+		if len(stmts) == 0 {
+			continue
+		}
+		block := markedSQLBlock{stmts: stmts}
+		for _, line := range strings.Split(chunk, "\n") {
+			rest, ok := strings.CutPrefix(strings.TrimSpace(line), operationMarker)
+			if n, err := strconv.Atoi(rest); ok && err == nil && n > 0 {
+				block.op = n
+				break
+			}
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+func splitSQLBlocks(text string) [][]string {
+	blocks := make([][]string, 0)
+	for _, block := range splitMarkedSQLBlocks(text) {
+		blocks = append(blocks, block.stmts)
+	}
+	return blocks
+}
+
+func splitSQLStatements(text string) []string {
+	stmts := make([]string, 0)
+	var current []string
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current = append(current, line)
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSpace(strings.Join(current, "\n")))
+			current = nil
+		}
+	}
+	if len(current) > 0 {
+		stmts = append(stmts, strings.TrimSpace(strings.Join(current, "\n")))
+	}
+	return stmts
+}
+
+func logf(logger Logger, format string, args ...any) {
+	if logger == nil {
+		return
+	}
+	logger.Printf(format, args...)
+}
@@ -0,0 +1,405 @@
+package gomigration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type recordingLogger struct {
+	lines []string
+}
+
+func (l *recordingLogger) Printf(format string, args ...any) {
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func newMockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	sqlDB, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("sqlmock.New failed: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      sqlDB,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("gorm.Open failed: %v", err)
+	}
+	return db, mock
+}
+
+func writeMigrationPair(t *testing.T, dir, base string, up, down []string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, base+".up.sql"), []byte(strings.Join(up, "\n\n")+"\n"), 0o644); err != nil {
+		t.Fatalf("write up file failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, base+".down.sql"), []byte(strings.Join(down, "\n\n")+"\n"), 0o644); err != nil {
+		t.Fatalf("write down file failed: %v", err)
+	}
+}
+
+func expectMigrationsTable(mock sqlmock.Sqlmock, applied ...string) {
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS `schema_migrations` (`version` varchar(64) NOT NULL, `name` varchar(255) NOT NULL DEFAULT '', `checksum` varchar(64) NOT NULL DEFAULT '', PRIMARY KEY (`version`))").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SELECT `schema_migrations`.`name` FROM `schema_migrations` WHERE 1 = 0").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SELECT `schema_migrations`.`checksum` FROM `schema_migrations` WHERE 1 = 0").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"version", "name", "checksum"})
+	for _, v := range applied {
+		rows.AddRow(v, "", "")
+	}
+	mock.ExpectQuery("SELECT `version`, `name`, `checksum` FROM `schema_migrations`").WillReturnRows(rows)
+}
+
+func TestApplyRunsPendingMigrationsInOrder(t *testing.T) {
+	dir := t.TempDir()
+	writeMigrationPair(t, dir, "20240101000000_init",
+		[]string{"CREATE TABLE `a` (\n  `id` bigint\n);"},
+		[]string{"DROP TABLE IF EXISTS `a`;"})
+	writeMigrationPair(t, dir, "20240102000000_add_b",
+		[]string{"ALTER TABLE `a` ADD COLUMN `b` int;"},
+		[]string{"ALTER TABLE `a` DROP COLUMN `b`;"})
+
+	db, mock := newMockDB(t)
+	expectMigrationsTable(mock, "20240101000000")
+	mock.ExpectExec("ALTER TABLE `a` ADD COLUMN `b` int;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO `schema_migrations` (`version`, `name`, `checksum`) VALUES (?, ?, ?)").
+		WithArgs("20240102000000", "add_b", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if err := Apply(db, dir); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestApplyCompensatesCompletedOperationsOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	writeMigrationPair(t, dir, "20240101000000_three_steps",
+		[]string{
+			"ALTER TABLE `a` ADD COLUMN `x` int;",
+			"ALTER TABLE `a` ADD COLUMN `y` int;",
+			"ALTER TABLE `a` ADD COLUMN `z` int;",
+		},
+		[]string{
+			"ALTER TABLE `a` DROP COLUMN `z`;",
+			"ALTER TABLE `a` DROP COLUMN `y`;",
+			"ALTER TABLE `a` DROP COLUMN `x`;",
+		})
+
+	db, mock := newMockDB(t)
+	expectMigrationsTable(mock)
+	mock.ExpectExec("ALTER TABLE `a` ADD COLUMN `x` int;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE `a` ADD COLUMN `y` int;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE `a` ADD COLUMN `z` int;").WillReturnError(errors.New("boom"))
+	mock.ExpectExec("ALTER TABLE `a` DROP COLUMN `y`;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE `a` DROP COLUMN `x`;").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	logger := &recordingLogger{}
+	err := ApplyWithOptions(db, dir, ApplyOptions{Logger: logger})
+	if err == nil {
+		t.Fatalf("expected Apply to fail")
+	}
+	if !strings.Contains(err.Error(), "operation 3 statement 1") || !strings.Contains(err.Error(), "reverted 2 completed operations") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+	logs := strings.Join(logger.lines, "\n")
+	assertContainsAll(t, logs, []string{"reverted operation 2", "reverted operation 1"})
+}
+
+func TestApplyContextStopsAndRevertsWhenCanceled(t *testing.T) {
+	dir := t.TempDir()
+	writeMigrationPair(t, dir, "20240101000000_two_steps",
+		[]string{
+			"ALTER TABLE `a` ADD COLUMN `x` int;",
+			"ALTER TABLE `a` ADD COLUMN `y` int;",
+		},
+		[]string{
+			"ALTER TABLE `a` DROP COLUMN `y`;",
+			"ALTER TABLE `a` DROP COLUMN `x`;",
+		})
+	writeMigrationPair(t, dir, "20240102000000_later",
+		[]string{"ALTER TABLE `a` ADD COLUMN `z` int;"},
+		[]string{"ALTER TABLE `a` DROP COLUMN `z`;"})
+
+	db, mock := newMockDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := db.Callback().Raw().After("gorm:raw").Register("test:cancel", func(tx *gorm.DB) {
+		if strings.Contains(tx.Statement.SQL.String(), "ADD COLUMN `x`") {
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatalf("register callback failed: %v", err)
+	}
+	expectMigrationsTable(mock)
+	mock.ExpectExec("ALTER TABLE `a` ADD COLUMN `x` int;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE `a` DROP COLUMN `x`;").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = ApplyContext(ctx, db, dir, ApplyOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a canceled error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "operation 2 statement 1") || !strings.Contains(err.Error(), "reverted 1 completed operations") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestApplyReportsOperationsThatCouldNotBeReverted(t *testing.T) {
+	dir := t.TempDir()
+	writeMigrationPair(t, dir, "20240101000000_two_steps",
+		[]string{
+			"ALTER TABLE `a` ADD COLUMN `x` int;",
+			"ALTER TABLE `a` ADD COLUMN `y` int;",
+		},
+		[]string{
+			"ALTER TABLE `a` DROP COLUMN `y`;",
+			"ALTER TABLE `a` DROP COLUMN `x`;",
+		})
+
+	db, mock := newMockDB(t)
+	expectMigrationsTable(mock)
+	mock.ExpectExec("ALTER TABLE `a` ADD COLUMN `x` int;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE `a` ADD COLUMN `y` int;").WillReturnError(errors.New("boom"))
+	mock.ExpectExec("ALTER TABLE `a` DROP COLUMN `x`;").WillReturnError(errors.New("locked"))
+
+	err := Apply(db, dir)
+	if err == nil || !strings.Contains(err.Error(), "operations not reverted: 1") {
+		t.Fatalf("expected not-reverted report, got: %v", err)
+	}
+}
+
+func TestPairMigrationBlocks(t *testing.T) {
+	up := "CREATE TABLE `a` (\n  `id` bigint\n);\n\nDROP INDEX `i` ON `a`;\nCREATE INDEX `i` ON `a` (`id`);\n"
+	down := "DROP INDEX `i` ON `a`;\nCREATE INDEX `i` ON `a` (`x`);\n\nDROP TABLE IF EXISTS `a`;\n"
+	blocks := pairMigrationBlocks(up, down)
+	if len(blocks) != 2 || !blocks[0].paired || !blocks[1].paired {
+		t.Fatalf("expected two paired blocks, got %#v", blocks)
+	}
+	if len(blocks[1].up) != 2 || len(blocks[1].down) != 2 {
+		t.Fatalf("expected index recreate block with two statements each way, got %#v", blocks[1])
+	}
+	if blocks[0].down[0] != "DROP TABLE IF EXISTS `a`;" {
+		t.Fatalf("unexpected pairing for create table: %#v", blocks[0])
+	}
+
+	for _, block := range pairMigrationBlocks(up, "DROP TABLE IF EXISTS `a`;\n") {
+		if block.paired {
+			t.Fatalf("expected mismatched block counts to be unpaired, got %#v", block)
+		}
+	}
+}
+
+func TestPairMigrationBlocksByOperationMarker(t *testing.T) {
+	// Operation 1 has no down; operation 2 restores a foreign key after
+	// creating its table again.
+	up := "SET @old_sql_mode = @@SESSION.sql_mode;\nSET SESSION sql_mode = '';\n\n" +
+		"-- operation 1\nALTER TABLE `a` ENGINE=MyISAM;\n\n" +
+		"-- operation 2\nDROP TABLE IF EXISTS `b`;\n\n" +
+		"SET SESSION sql_mode = @old_sql_mode;\n"
+	down := "SET @old_sql_mode = @@SESSION.sql_mode;\nSET SESSION sql_mode = '';\n\n" +
+		"-- operation 2\nCREATE TABLE `b` (\n  `a_id` bigint\n);\n\n" +
+		"-- operation 2\nALTER TABLE `b` ADD CONSTRAINT `fk_b_a` FOREIGN KEY (`a_id`) REFERENCES `a` (`id`);\n\n" +
+		"SET SESSION sql_mode = @old_sql_mode;\n"
+	blocks := pairMigrationBlocks(up, down)
+	if len(blocks) != 4 {
+		t.Fatalf("expected four blocks, got %#v", blocks)
+	}
+	if !blocks[0].paired || blocks[0].down[0] != "SET SESSION sql_mode = @old_sql_mode;" {
+		t.Fatalf("expected the mode switch to pair with the restore, got %#v", blocks[0])
+	}
+	if blocks[1].paired {
+		t.Fatalf("expected the operation without a down to be unpaired, got %#v", blocks[1])
+	}
+	if !blocks[2].paired || len(blocks[2].down) != 2 || !strings.HasPrefix(blocks[2].down[1], "ALTER TABLE `b` ADD CONSTRAINT") {
+		t.Fatalf("expected the drop to pair with the create and the restored foreign key, got %#v", blocks[2])
+	}
+}
+
+func TestApplyStopsCompensatingAtAnOperationWithoutDown(t *testing.T) {
+	dir := t.TempDir()
+	writeMigrationPair(t, dir, "20240101000000_engine",
+		[]string{
+			"-- operation 1\nALTER TABLE `a` ADD COLUMN `x` int;",
+			"-- operation 2\nALTER TABLE `a` ENGINE=MyISAM;",
+			"-- operation 3\nALTER TABLE `a` ADD COLUMN `y` int;",
+			"-- operation 4\nALTER TABLE `a` ADD COLUMN `z` int;",
+		},
+		[]string{
+			"-- operation 4\nALTER TABLE `a` DROP COLUMN `z`;",
+			"-- operation 3\nALTER TABLE `a` DROP COLUMN `y`;",
+			"-- operation 1\nALTER TABLE `a` DROP COLUMN `x`;",
+		})
+
+	db, mock := newMockDB(t)
+	expectMigrationsTable(mock)
+	mock.ExpectExec("ALTER TABLE `a` ADD COLUMN `x` int;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE `a` ENGINE=MyISAM;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE `a` ADD COLUMN `y` int;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE `a` ADD COLUMN `z` int;").WillReturnError(errors.New("boom"))
+	mock.ExpectExec("ALTER TABLE `a` DROP COLUMN `y`;").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := Apply(db, dir)
+	if err == nil || !strings.Contains(err.Error(), "operations not reverted: 2, 1") {
+		t.Fatalf("expected operations 2 and 1 to stay applied, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestApplyRevertsThePartiallyAppliedOperation(t *testing.T) {
+	dir := t.TempDir()
+	writeMigrationPair(t, dir, "20240101000000_index",
+		[]string{
+			"-- operation 1\nALTER TABLE `a` ADD COLUMN `x` int;",
+			"-- operation 2\nDROP INDEX `i` ON `a`;\nCREATE INDEX `i` ON `a` (`x`);",
+		},
+		[]string{
+			"-- operation 2\nDROP INDEX `i` ON `a`;\nCREATE INDEX `i` ON `a` (`id`);",
+			"-- operation 1\nALTER TABLE `a` DROP COLUMN `x`;",
+		})
+
+	db, mock := newMockDB(t)
+	expectMigrationsTable(mock)
+	mock.ExpectExec("ALTER TABLE `a` ADD COLUMN `x` int;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DROP INDEX `i` ON `a`;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE INDEX `i` ON `a` (`x`);").WillReturnError(errors.New("boom"))
+	mock.ExpectExec("CREATE INDEX `i` ON `a` (`id`);").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE `a` DROP COLUMN `x`;").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := Apply(db, dir)
+	if err == nil || !strings.Contains(err.Error(), "operation 2 statement 2") || !strings.Contains(err.Error(), "reverted 1 completed operations") {
+		t.Fatalf("expected the partial index change to be undone, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestUndoStatements(t *testing.T) {
+	down := []string{
+		"ALTER TABLE `a` ADD COLUMN `old` int;",
+		"CREATE INDEX `i` ON `a` (`id`);",
+	}
+	undo, err := undoStatements(DialectMySQL, []string{
+		"CREATE TABLE `b` (\n  `id` bigint\n);",
+		"ALTER TABLE `a` ADD COLUMN `x` int, ADD INDEX `idx_x` (`x`);",
+		"ALTER TABLE `a` DROP COLUMN `old`;",
+		"ALTER TABLE `a` RENAME COLUMN `y` TO `z`;",
+		"DROP INDEX `i` ON `a`;",
+	}, down)
+	if err != nil {
+		t.Fatalf("undoStatements failed: %v", err)
+	}
+	want := []string{
+		"CREATE INDEX `i` ON `a` (`id`);",
+		"ALTER TABLE `a` RENAME COLUMN `z` TO `y`;",
+		"ALTER TABLE `a` ADD COLUMN `old` int;",
+		"DROP INDEX `idx_x` ON `a`;",
+		"ALTER TABLE `a` DROP COLUMN `x`;",
+		"DROP TABLE `b`;",
+	}
+	if strings.Join(undo, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected undo:\n%s", strings.Join(undo, "\n"))
+	}
+
+	undo, err = undoStatements(DialectPostgres, []string{
+		`ALTER TABLE "b" ADD CONSTRAINT "fk_b_a" FOREIGN KEY ("a_id") REFERENCES "a" ("id");`,
+		`CREATE INDEX "idx_b" ON "b" ("a_id");`,
+	}, nil)
+	if err != nil {
+		t.Fatalf("undoStatements failed: %v", err)
+	}
+	if want := `DROP INDEX "idx_b";` + "\n" + `ALTER TABLE "b" DROP CONSTRAINT "fk_b_a";`; strings.Join(undo, "\n") != want {
+		t.Fatalf("unexpected Postgres undo:\n%s", strings.Join(undo, "\n"))
+	}
+
+	if _, err := undoStatements(DialectMySQL, []string{"ALTER TABLE `a` MODIFY COLUMN `x` bigint;"}, nil); err == nil {
+		t.Fatalf("expected MODIFY COLUMN to have no inverse")
+	}
+	if _, err := undoStatements(DialectMySQL, []string{"ALTER TABLE `a` DROP COLUMN `gone`;"}, down); err == nil {
+		t.Fatalf("expected a drop without a matching create in the down block to have no inverse")
+	}
+}
+
+func TestApplyRunsFilesOfOneVersionTogether(t *testing.T) {
+	dir := t.TempDir()
+	writeMigrationPair(t, dir, "20240101000000_init_foreign_keys",
+		[]string{"ALTER TABLE `b` ADD CONSTRAINT `fk_b_a` FOREIGN KEY (`a_id`) REFERENCES `a` (`id`);"},
+		[]string{"ALTER TABLE `b` DROP FOREIGN KEY `fk_b_a`;"})
+	writeMigrationPair(t, dir, "20240101000000_init_zebras",
+		[]string{"CREATE TABLE `zebras` (\n  `id` bigint\n);"},
+		[]string{"DROP TABLE IF EXISTS `zebras`;"})
+	writeMigrationPair(t, dir, "20240101000000_init_b",
+		[]string{"CREATE TABLE `b` (\n  `a_id` bigint\n);"},
+		[]string{"DROP TABLE IF EXISTS `b`;"})
+
+	db, mock := newMockDB(t)
+	expectMigrationsTable(mock)
+	mock.ExpectExec("CREATE TABLE `b` (\n  `a_id` bigint\n);").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE `zebras` (\n  `id` bigint\n);").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE `b` ADD CONSTRAINT `fk_b_a` FOREIGN KEY (`a_id`) REFERENCES `a` (`id`);").
+		WillReturnError(errors.New("missing table a"))
+	mock.ExpectExec("DROP TABLE IF EXISTS `zebras`;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DROP TABLE IF EXISTS `b`;").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := Apply(db, dir)
+	if err == nil || !strings.Contains(err.Error(), "reverted 2 earlier files of version 20240101000000") {
+		t.Fatalf("expected failure with reverted earlier files, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestApplyRunsSQLModeGuardOnOneConnection(t *testing.T) {
+	dir := t.TempDir()
+	writeMigrationPair(t, dir, "20240101000000_strict",
+		withSQLMode([]string{
+			"ALTER TABLE `a` ADD COLUMN `x` int NOT NULL;",
+			"ALTER TABLE `a` ADD COLUMN `y` int NOT NULL;",
+		}, "STRICT_TRANS_TABLES"),
+		withSQLMode([]string{
+			"ALTER TABLE `a` DROP COLUMN `y`;",
+			"ALTER TABLE `a` DROP COLUMN `x`;",
+		}, "STRICT_TRANS_TABLES"))
+
+	db, mock := newMockDB(t)
+	expectMigrationsTable(mock)
+	mock.ExpectExec("SET @old_sql_mode = @@SESSION.sql_mode;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SET SESSION sql_mode = 'STRICT_TRANS_TABLES';").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE `a` ADD COLUMN `x` int NOT NULL;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE `a` ADD COLUMN `y` int NOT NULL;").WillReturnError(errors.New("boom"))
+	mock.ExpectExec("ALTER TABLE `a` DROP COLUMN `x`;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SET SESSION sql_mode = @old_sql_mode;").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := Apply(db, dir)
+	if err == nil || !strings.Contains(err.Error(), "reverted 2 completed operations") {
+		t.Fatalf("expected compensation to revert the column and restore the mode, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
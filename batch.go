@@ -0,0 +1,96 @@
+package gomigration
+
+import "strings"
+
+// batchForeignKeyOps merges runs of foreign key additions, and runs of
+// foreign key drops, on the same table into one op whose up and down are
+// each a single ALTER TABLE statement. Ops whose SQL is not a plain
+// one-line ALTER TABLE of that table, e.g. because it carries a warning,
+// are left alone.
+func batchForeignKeyOps(ops []migrationOp) []migrationOp {
+	out := make([]migrationOp, 0, len(ops))
+	for i := 0; i < len(ops); {
+		op := ops[i]
+		j := i + 1
+		if op.kind == opAddForeignKey || op.kind == opDropForeignKey {
+			for j < len(ops) && ops[j].kind == op.kind && ops[j].table == op.table {
+				j++
+			}
+		}
+		if j-i < 2 {
+			out = append(out, op)
+			i++
+			continue
+		}
+		if merged, ok := mergeForeignKeyOps(ops[i:j]); ok {
+			out = append(out, merged)
+		} else {
+			out = append(out, ops[i:j]...)
+		}
+		i = j
+	}
+	return out
+}
+
+func mergeForeignKeyOps(ops []migrationOp) (migrationOp, bool) {
+	ups := make([]string, 0, len(ops))
+	downs := make([]string, 0, len(ops))
+	names := make([]string, 0, len(ops))
+	var warnings []SafetyWarning
+	for _, op := range ops {
+		ups = append(ups, op.up)
+		downs = append(downs, op.down)
+		names = append(names, op.name)
+		warnings = append(warnings, op.warnings...)
+	}
+	up, ok := mergeAlterTableStatements(ups)
+	if !ok {
+		return migrationOp{}, false
+	}
+	down, ok := mergeAlterTableStatements(downs)
+	if !ok {
+		return migrationOp{}, false
+	}
+	return migrationOp{
+		kind:     ops[0].kind,
+		table:    ops[0].table,
+		name:     strings.Join(names, ", "),
+		up:       up,
+		down:     down,
+		warnings: warnings,
+		apply: func(tables map[string]tableState) {
+			for _, op := range ops {
+				if op.apply != nil {
+					op.apply(tables)
+				}
+			}
+		},
+	}, true
+}
+
+// mergeAlterTableStatements joins "ALTER TABLE t <clause>;" statements on
+// the same table into "ALTER TABLE t <clause>, <clause>;". Empty statements
+// are skipped.
+func mergeAlterTableStatements(stmts []string) (string, bool) {
+	prefix := ""
+	clauses := make([]string, 0, len(stmts))
+	for _, stmt := range stmts {
+		if stmt == "" {
+			continue
+		}
+		if !strings.HasPrefix(stmt, "ALTER TABLE ") || !strings.HasSuffix(stmt, ";") || strings.Contains(stmt, "\n") {
+			return "", false
+		}
+		rest := strings.TrimPrefix(stmt, "ALTER TABLE ")
+		table, clause, ok := strings.Cut(rest, " ")
+		if !ok || (prefix != "" && prefix != table) {
+			return "", false
+		}
+		prefix = table
+		clauses = append(clauses, strings.TrimSuffix(clause, ";"))
+	}
+	if len(clauses) == 0 {
+		return "", true
+	}
+	return "ALTER TABLE " + prefix + " " + strings.Join(clauses, ", ") + ";", true
+}
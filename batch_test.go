@@ -0,0 +1,77 @@
+package gomigration
+
+import "testing"
+
+type batchCustomer struct {
+	ID uint `gorm:"primaryKey"`
+}
+
+func (batchCustomer) TableName() string { return "batch_customers" }
+
+type batchProduct struct {
+	ID uint `gorm:"primaryKey"`
+}
+
+func (batchProduct) TableName() string { return "batch_products" }
+
+type batchOrder struct {
+	ID         uint `gorm:"primaryKey"`
+	CustomerID uint
+	Customer   batchCustomer `gorm:"foreignKey:CustomerID"`
+	ProductID  uint
+	Product    batchProduct `gorm:"foreignKey:ProductID"`
+}
+
+func (batchOrder) TableName() string { return "batch_orders" }
+
+func TestDiffSchemasBatchAlterForeignKeys(t *testing.T) {
+	cur, err := buildCurrentState([]any{&batchCustomer{}, &batchProduct{}, &batchOrder{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState failed: %v", err)
+	}
+	prev := cloneSchemaState(cur)
+	delete(prev.Tables["batch_orders"].ForeignKeys, "fk_batch_orders_customer")
+	delete(prev.Tables["batch_orders"].ForeignKeys, "fk_batch_orders_product")
+
+	if ops := diffSchemas(prev, cur, Options{}); len(ops) != 2 {
+		t.Fatalf("expected one op per foreign key by default, got %#v", ops)
+	}
+
+	opts := Options{BatchAlter: true}
+	ops := diffSchemas(prev, cur, opts)
+	if len(ops) != 1 {
+		t.Fatalf("expected the additions to be batched, got %#v", ops)
+	}
+	wantUp := "ALTER TABLE `batch_orders` ADD CONSTRAINT `fk_batch_orders_customer` FOREIGN KEY (`customer_id`) REFERENCES `batch_customers` (`id`), " +
+		"ADD CONSTRAINT `fk_batch_orders_product` FOREIGN KEY (`product_id`) REFERENCES `batch_products` (`id`);"
+	if ops[0].up != wantUp {
+		t.Fatalf("unexpected up SQL:\n got %s\nwant %s", ops[0].up, wantUp)
+	}
+	wantDown := "ALTER TABLE `batch_orders` DROP FOREIGN KEY `fk_batch_orders_customer`, DROP FOREIGN KEY `fk_batch_orders_product`;"
+	if ops[0].down != wantDown {
+		t.Fatalf("unexpected down SQL:\n got %s\nwant %s", ops[0].down, wantDown)
+	}
+	if err := verifyMigrationOps(prev, cur, ops, opts); err != nil {
+		t.Fatalf("unexpected self-check failure: %v", err)
+	}
+
+	ops = diffSchemas(cur, prev, opts)
+	if len(ops) != 1 || ops[0].up != wantDown || ops[0].down != wantUp {
+		t.Fatalf("expected the drops to be batched, got %#v", ops)
+	}
+	if err := verifyMigrationOps(cur, prev, ops, opts); err != nil {
+		t.Fatalf("unexpected self-check failure: %v", err)
+	}
+}
+
+func TestMergeAlterTableStatementsRejectsOtherTables(t *testing.T) {
+	if _, ok := mergeAlterTableStatements([]string{"ALTER TABLE `a` DROP FOREIGN KEY `x`;", "ALTER TABLE `b` DROP FOREIGN KEY `y`;"}); ok {
+		t.Fatalf("expected statements on different tables not to merge")
+	}
+	if _, ok := mergeAlterTableStatements([]string{"-- note\nALTER TABLE `a` DROP FOREIGN KEY `x`;", "ALTER TABLE `a` DROP FOREIGN KEY `y`;"}); ok {
+		t.Fatalf("expected annotated statements not to merge")
+	}
+	if got, ok := mergeAlterTableStatements([]string{"", ""}); !ok || got != "" {
+		t.Fatalf("expected empty statements to merge to nothing, got %q", got)
+	}
+}
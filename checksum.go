@@ -0,0 +1,44 @@
+package gomigration
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// StateChecksum returns a hex SHA-256 of the schema state models produce, as
+// MakeMigrations would save it. It changes whenever a migration would be
+// generated for the models, so CI can compare it with a stored value to catch
+// models changed without running MakeMigrations.
+func StateChecksum(models []any) (string, error) {
+	return StateChecksumWithOptions(models, Options{})
+}
+
+func StateChecksumWithOptions(models []any, opts Options) (string, error) {
+	if err := opts.validate(); err != nil {
+		return "", err
+	}
+	state, err := buildCurrentStateContext(context.Background(), models, opts)
+	if err != nil {
+		return "", err
+	}
+	return stateChecksum(state)
+}
+
+// stateChecksum hashes the JSON of state. encoding/json writes map keys in
+// sorted order, and the slices of a state are ordered by declaration (primary
+// keys, column order, index fields), so the same models always give the same
+// bytes regardless of the order they are passed in.
+func stateChecksum(state schemaState) (string, error) {
+	state.Version = stateVersion
+	if state.Tables == nil {
+		state.Tables = map[string]tableState{}
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
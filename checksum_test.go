@@ -0,0 +1,53 @@
+package gomigration
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStateChecksum(t *testing.T) {
+	models := migrationModels()
+	sum, err := StateChecksum(models)
+	if err != nil {
+		t.Fatalf("StateChecksum failed: %v", err)
+	}
+	if len(sum) != 64 {
+		t.Fatalf("expected a hex sha256, got %q", sum)
+	}
+
+	reversed := make([]any, 0, len(models))
+	for i := len(models) - 1; i >= 0; i-- {
+		reversed = append(reversed, models[i])
+	}
+	for i := 0; i < 3; i++ {
+		again, err := StateChecksum(reversed)
+		if err != nil {
+			t.Fatalf("StateChecksum failed: %v", err)
+		}
+		if again != sum {
+			t.Fatalf("expected a stable checksum, got %s and %s", sum, again)
+		}
+	}
+
+	// The state MakeMigrations saves has the same checksum.
+	dir := t.TempDir()
+	stateFile := filepath.Join(dir, ".schema_state.json")
+	if _, err := MakeMigrations(models, dir, "init", stateFile); err != nil {
+		t.Fatalf("MakeMigrations failed: %v", err)
+	}
+	saved, err := loadState(stateFile)
+	if err != nil {
+		t.Fatalf("loadState failed: %v", err)
+	}
+	if got, err := stateChecksum(saved); err != nil || got != sum {
+		t.Fatalf("expected the saved state checksum %s, got %s (%v)", sum, got, err)
+	}
+
+	changed, err := StateChecksum(append(models, &commentBefore{}))
+	if err != nil {
+		t.Fatalf("StateChecksum failed: %v", err)
+	}
+	if changed == sum {
+		t.Fatalf("expected the checksum to change with the models")
+	}
+}
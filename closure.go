@@ -0,0 +1,76 @@
+package gomigration
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ClosureOf returns the roots and every model in models they transitively
+// reference through foreign keys or many2many relations, in the order of
+// models. Join tables are not listed; MakeMigrations derives them from the
+// models that declare them. Models that fail to parse are left for
+// MakeMigrations to report. It fails when the models cannot be parsed at
+// all, rather than return a closure that misses referenced tables.
+func ClosureOf(models, roots []any) ([]any, error) {
+	db, cleanup, err := newDryRunMySQL()
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	reached := map[string]bool{}
+	var visit func(sc *schema.Schema)
+	visit = func(sc *schema.Schema) {
+		if sc == nil || reached[sc.Table] {
+			return
+		}
+		reached[sc.Table] = true
+		walkRelationships(&sc.Relationships, func(rel *schema.Relationship) {
+			if rel == nil {
+				return
+			}
+			if rel.JoinTable != nil {
+				visit(rel.FieldSchema)
+				return
+			}
+			if c := rel.ParseConstraint(); c != nil && c.Schema == sc {
+				visit(c.ReferenceSchema)
+			}
+		})
+	}
+	for _, root := range roots {
+		visit(parseModelSchema(db, root))
+	}
+
+	out := make([]any, 0, len(models)+len(roots))
+	included := map[string]bool{}
+	add := func(m any, fromRoots bool) {
+		sc := parseModelSchema(db, m)
+		if sc == nil {
+			if fromRoots {
+				out = append(out, m)
+			}
+			return
+		}
+		if !reached[sc.Table] || included[sc.Table] {
+			return
+		}
+		included[sc.Table] = true
+		out = append(out, m)
+	}
+	for _, m := range models {
+		add(m, false)
+	}
+	for _, root := range roots {
+		add(root, true)
+	}
+	return out, nil
+}
+
+func parseModelSchema(db *gorm.DB, model any) *schema.Schema {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil
+	}
+	return stmt.Schema
+}
@@ -0,0 +1,65 @@
+package gomigration
+
+import (
+	"reflect"
+	"testing"
+)
+
+type closureAuthor struct {
+	ID uint `gorm:"primaryKey"`
+}
+
+func (closureAuthor) TableName() string { return "closure_authors" }
+
+type closurePost struct {
+	ID       uint             `gorm:"primaryKey"`
+	AuthorID uint             `gorm:"index"`
+	Author   closureAuthor    `gorm:"foreignKey:AuthorID"`
+	Comments []closureComment `gorm:"foreignKey:PostID"`
+	Tags     []*closureTag    `gorm:"many2many:closure_post_tags;"`
+}
+
+func (closurePost) TableName() string { return "closure_posts" }
+
+type closureComment struct {
+	ID     uint `gorm:"primaryKey"`
+	PostID uint `gorm:"index"`
+}
+
+func (closureComment) TableName() string { return "closure_comments" }
+
+type closureTag struct {
+	ID uint `gorm:"primaryKey"`
+}
+
+func (closureTag) TableName() string { return "closure_tags" }
+
+type closureAudit struct {
+	ID uint `gorm:"primaryKey"`
+}
+
+func (closureAudit) TableName() string { return "closure_audits" }
+
+func TestClosureOfFollowsReferencedModels(t *testing.T) {
+	author, post, comment, tag, audit := &closureAuthor{}, &closurePost{}, &closureComment{}, &closureTag{}, &closureAudit{}
+	models := []any{audit, comment, tag, author, post}
+
+	got, err := ClosureOf(models, []any{post})
+	if err != nil {
+		t.Fatalf("ClosureOf failed: %v", err)
+	}
+	if want := []any{tag, author, post}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected closure of posts: %#v", got)
+	}
+	if got, err := ClosureOf(models, []any{comment}); err != nil || !reflect.DeepEqual(got, []any{comment}) {
+		t.Fatalf("expected comments to reference nothing without a belongs-to, got %#v, %v", got, err)
+	}
+
+	state, err := buildCurrentState(got)
+	if err != nil {
+		t.Fatalf("buildCurrentState failed: %v", err)
+	}
+	if tables := sortedKeys(state.Tables); !reflect.DeepEqual(tables, []string{"closure_authors", "closure_post_tags", "closure_posts", "closure_tags"}) {
+		t.Fatalf("unexpected tables for the closure: %v", tables)
+	}
+}
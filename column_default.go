@@ -0,0 +1,62 @@
+package gomigration
+
+import (
+	"strings"
+)
+
+// withoutDefault removes the DEFAULT attribute from a column definition.
+func withoutDefault(definition string) string {
+	tokens := tokenizeDefinition(definition)
+	out := make([]string, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		if i > 0 && strings.EqualFold(tokens[i], "DEFAULT") && i+1 < len(tokens) {
+			i++
+			continue
+		}
+		out = append(out, tokens[i])
+	}
+	return strings.Join(out, " ")
+}
+
+// defaultOnlyChange reports whether two MySQL definitions differ only in
+// their literal DEFAULT. Any other default, such as CURRENT_TIMESTAMP(3) or
+// an expression, is left to MODIFY COLUMN, since ALTER COLUMN SET DEFAULT
+// takes only a literal or NULL.
+func defaultOnlyChange(prev, cur string, opts Options) bool {
+	prevDefault, curDefault := definitionDefault(prev), definitionDefault(cur)
+	if prevDefault == curDefault || !isLiteralDefault(prevDefault) || !isLiteralDefault(curDefault) {
+		return false
+	}
+	return opts.columnEqual(withoutDefault(prev), withoutDefault(cur))
+}
+
+// isLiteralDefault reports whether a DEFAULT value is absent, NULL, a quoted
+// string, a number, a boolean or a bit or hex literal such as b'1'.
+func isLiteralDefault(value string) bool {
+	switch {
+	case value == "", strings.EqualFold(value, "NULL"), strings.EqualFold(value, "TRUE"), strings.EqualFold(value, "FALSE"):
+		return true
+	case len(value) >= 2 && (value[0] == '\'' || value[0] == '"') && value[len(value)-1] == value[0]:
+		return true
+	case len(value) >= 3 && strings.ContainsRune("bBxX", rune(value[0])) && value[1] == '\'' && value[len(value)-1] == '\'':
+		return true
+	}
+	return decimalLiteralPattern.MatchString(value)
+}
+
+// columnDefaultOp changes only the default of a column with ALTER COLUMN,
+// which MySQL applies to the table metadata without rewriting the rows that
+// MODIFY COLUMN copies.
+func columnDefaultOp(tableName, column string, prev, cur columnState, opts Options) (migrationOp, bool) {
+	if !opts.Dialect.isMySQL() || !defaultOnlyChange(prev.Definition, cur.Definition, opts) {
+		return migrationOp{}, false
+	}
+	return migrationOp{
+		kind:  opChangeDefault,
+		table: tableName,
+		name:  column,
+		up:    opts.emitter().SetColumnDefault(tableName, column, definitionDefault(cur.Definition)),
+		down:  opts.emitter().SetColumnDefault(tableName, column, definitionDefault(prev.Definition)),
+		apply: setColumnChange(tableName, column, cur),
+	}, true
+}
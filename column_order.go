@@ -0,0 +1,193 @@
+package gomigration
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// reorderColumnsOp detects a pure reordering of a table's columns and moves
+// the columns that left their relative position with MODIFY COLUMN ... AFTER.
+// The longest run of columns that kept their relative order stays put, so the
+// number of moved columns is minimal.
+func reorderColumnsOp(tableName string, prev, cur tableState, em Emitter) (migrationOp, bool) {
+	if len(prev.ColumnOrder) == 0 || len(cur.ColumnOrder) == 0 {
+		return migrationOp{}, false
+	}
+	if !sameColumnSet(prev.ColumnOrder, cur.ColumnOrder) || !sameColumnSet(prev.ColumnOrder, sortedKeys(cur.Columns)) {
+		return migrationOp{}, false
+	}
+	if reflect.DeepEqual(prev.ColumnOrder, cur.ColumnOrder) {
+		return migrationOp{}, false
+	}
+	up := columnMoveStatements(tableName, prev.ColumnOrder, cur.ColumnOrder, cur.Columns, em)
+	down := columnMoveStatements(tableName, cur.ColumnOrder, prev.ColumnOrder, cur.Columns, em)
+	return migrationOp{
+		kind:  opReorderColumns,
+		table: tableName,
+		name:  tableName,
+		up:    strings.Join(up, "\n"),
+		down:  strings.Join(down, "\n"),
+		apply: columnOrderChange(tableName, cur.ColumnOrder),
+	}, true
+}
+
+// declaredColumnOrder sorts columns by order; columns missing from it come
+// last, in the order given.
+func declaredColumnOrder(columns, order []string) []string {
+	position := make(map[string]int, len(order))
+	for i, col := range order {
+		position[col] = i
+	}
+	out := append([]string{}, columns...)
+	sort.SliceStable(out, func(i, j int) bool {
+		pi, iok := position[out[i]]
+		pj, jok := position[out[j]]
+		if iok != jok {
+			return iok
+		}
+		return iok && pi < pj
+	})
+	return out
+}
+
+// placeColumn puts column after the nearest column before it in order for
+// which exists is true, or first when there is none. A column missing from
+// order is left without a placement.
+func placeColumn(column ColumnDefinition, order []string, exists func(string) bool) ColumnDefinition {
+	at := -1
+	for i, col := range order {
+		if col == column.Name {
+			at = i
+			break
+		}
+	}
+	if at < 0 {
+		return column
+	}
+	for i := at - 1; i >= 0; i-- {
+		if exists(order[i]) {
+			column.After = order[i]
+			return column
+		}
+	}
+	column.First = true
+	return column
+}
+
+func columnMoveStatements(tableName string, from, to []string, columns map[string]columnState, em Emitter) []string {
+	position := make(map[string]int, len(from))
+	for i, col := range from {
+		position[col] = i
+	}
+	sequence := make([]int, len(to))
+	for i, col := range to {
+		sequence[i] = position[col]
+	}
+	keep := longestIncreasingSubsequence(sequence)
+
+	stmts := make([]string, 0)
+	for i, col := range to {
+		if keep[i] {
+			continue
+		}
+		column := ColumnDefinition{Name: col, Definition: columns[col].Definition, First: i == 0}
+		if i > 0 {
+			column.After = to[i-1]
+		}
+		stmts = append(stmts, em.MoveColumn(tableName, column))
+	}
+	return stmts
+}
+
+// longestIncreasingSubsequence marks the indexes of seq that belong to one
+// longest strictly increasing subsequence.
+func longestIncreasingSubsequence(seq []int) []bool {
+	keep := make([]bool, len(seq))
+	if len(seq) == 0 {
+		return keep
+	}
+	tails := make([]int, 0, len(seq))
+	prevIndex := make([]int, len(seq))
+	for i, v := range seq {
+		pos := sort.Search(len(tails), func(j int) bool { return seq[tails[j]] >= v })
+		if pos > 0 {
+			prevIndex[i] = tails[pos-1]
+		} else {
+			prevIndex[i] = -1
+		}
+		if pos == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[pos] = i
+		}
+	}
+	for i := tails[len(tails)-1]; i >= 0; i = prevIndex[i] {
+		keep[i] = true
+	}
+	return keep
+}
+
+func sameColumnSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[string]bool, len(a))
+	for _, col := range a {
+		set[col] = true
+	}
+	for _, col := range b {
+		if !set[col] {
+			return false
+		}
+	}
+	return true
+}
+
+// ColumnOrdering controls the column order of CREATE TABLE statements.
+type ColumnOrdering string
+
+const (
+	ColumnOrderingAlphabetical ColumnOrdering = "alphabetical"
+	// ColumnOrderingDeclared follows the struct field order, falling back to
+	// alphabetical order for state captured before column order was recorded.
+	ColumnOrderingDeclared ColumnOrdering = "declared"
+	// ColumnOrderingPKFirst puts the primary key columns first, in key order,
+	// and the remaining columns alphabetically after them.
+	ColumnOrderingPKFirst ColumnOrdering = "pk-first"
+)
+
+func validateColumnOrdering(ordering ColumnOrdering) error {
+	switch ordering {
+	case "", ColumnOrderingAlphabetical, ColumnOrderingDeclared, ColumnOrderingPKFirst:
+		return nil
+	default:
+		return fmt.Errorf("unsupported column ordering %q", ordering)
+	}
+}
+
+func orderedColumns(table tableState, ordering ColumnOrdering) []string {
+	switch ordering {
+	case ColumnOrderingDeclared:
+		if sameColumnSet(table.ColumnOrder, sortedKeys(table.Columns)) {
+			return append([]string{}, table.ColumnOrder...)
+		}
+	case ColumnOrderingPKFirst:
+		cols := make([]string, 0, len(table.Columns))
+		seen := map[string]bool{}
+		for _, col := range table.PrimaryKeys {
+			if _, ok := table.Columns[col]; ok && !seen[col] {
+				seen[col] = true
+				cols = append(cols, col)
+			}
+		}
+		for _, col := range sortedKeys(table.Columns) {
+			if !seen[col] {
+				cols = append(cols, col)
+			}
+		}
+		return cols
+	}
+	return sortedKeys(table.Columns)
+}
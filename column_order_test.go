@@ -0,0 +1,209 @@
+package gomigration
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+type reorderBefore struct {
+	ID    uint   `gorm:"primaryKey"`
+	Name  string `gorm:"size:32"`
+	Email string `gorm:"size:64"`
+	Age   int
+}
+
+func (reorderBefore) TableName() string { return "reorder_people" }
+
+type reorderAfter struct {
+	ID    uint `gorm:"primaryKey"`
+	Age   int
+	Name  string `gorm:"size:32"`
+	Email string `gorm:"size:64"`
+}
+
+func (reorderAfter) TableName() string { return "reorder_people" }
+
+var columnMovePattern = regexp.MustCompile("MODIFY COLUMN `([^`]+)` .* (FIRST|AFTER `([^`]+)`);$")
+
+// replayColumnMoves applies generated MODIFY ... FIRST/AFTER statements to an
+// in-memory column order.
+func replayColumnMoves(t *testing.T, order []string, sql string) []string {
+	t.Helper()
+	out := append([]string{}, order...)
+	for _, stmt := range strings.Split(sql, "\n") {
+		m := columnMovePattern.FindStringSubmatch(stmt)
+		if m == nil {
+			t.Fatalf("unexpected move statement: %s", stmt)
+		}
+		col := m[1]
+		for i, c := range out {
+			if c == col {
+				out = append(out[:i], out[i+1:]...)
+				break
+			}
+		}
+		at := 0
+		if m[2] != "FIRST" {
+			for i, c := range out {
+				if c == m[3] {
+					at = i + 1
+					break
+				}
+			}
+		}
+		out = append(out[:at], append([]string{col}, out[at:]...)...)
+	}
+	return out
+}
+
+func TestDiffTableReorderOnly(t *testing.T) {
+	before, err := buildCurrentState([]any{&reorderBefore{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState before failed: %v", err)
+	}
+	after, err := buildCurrentState([]any{&reorderAfter{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState after failed: %v", err)
+	}
+	prev := before.Tables["reorder_people"]
+	cur := after.Tables["reorder_people"]
+	if !reflect.DeepEqual(prev.ColumnOrder, []string{"id", "name", "email", "age"}) {
+		t.Fatalf("unexpected captured column order: %v", prev.ColumnOrder)
+	}
+
+	if ops := diffTable("reorder_people", prev, cur); len(ops) != 0 {
+		t.Fatalf("expected reordering to be ignored by default, got %#v", ops)
+	}
+
+	ops := diffTableWithOptions("reorder_people", prev, cur, Options{TrackColumnOrder: true})
+	if len(ops) != 1 {
+		t.Fatalf("expected one reorder op, got %#v", ops)
+	}
+	if ops[0].up != "ALTER TABLE `reorder_people` MODIFY COLUMN `age` bigint AFTER `id`;" {
+		t.Fatalf("unexpected up SQL: %s", ops[0].up)
+	}
+	if got := replayColumnMoves(t, prev.ColumnOrder, ops[0].up); !reflect.DeepEqual(got, cur.ColumnOrder) {
+		t.Fatalf("up moves produce %v, want %v", got, cur.ColumnOrder)
+	}
+	if got := replayColumnMoves(t, cur.ColumnOrder, ops[0].down); !reflect.DeepEqual(got, prev.ColumnOrder) {
+		t.Fatalf("down moves produce %v, want %v", got, prev.ColumnOrder)
+	}
+}
+
+func TestColumnMoveStatementsReachTargetOrder(t *testing.T) {
+	columns := map[string]columnState{}
+	for _, c := range []string{"a", "b", "c", "d", "e"} {
+		columns[c] = columnState{Definition: "int"}
+	}
+	from := []string{"a", "b", "c", "d", "e"}
+	targets := [][]string{
+		{"e", "d", "c", "b", "a"},
+		{"b", "a", "d", "c", "e"},
+		{"c", "a", "b", "e", "d"},
+		{"a", "c", "e", "b", "d"},
+	}
+	for _, to := range targets {
+		stmts := columnMoveStatements("t", from, to, columns, MySQLEmitter{})
+		if got := replayColumnMoves(t, from, strings.Join(stmts, "\n")); !reflect.DeepEqual(got, to) {
+			t.Fatalf("moves %v produce %v, want %v", stmts, got, to)
+		}
+	}
+}
+
+func TestCreateTableSQLColumnOrdering(t *testing.T) {
+	state, err := buildCurrentState([]any{&reorderAfter{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState failed: %v", err)
+	}
+	table := state.Tables["reorder_people"]
+
+	columnPattern := regexp.MustCompile("(?m)^  `([^`]+)` ")
+	cases := []struct {
+		ordering ColumnOrdering
+		want     []string
+	}{
+		{"", []string{"age", "email", "id", "name"}},
+		{ColumnOrderingAlphabetical, []string{"age", "email", "id", "name"}},
+		{ColumnOrderingDeclared, []string{"id", "age", "name", "email"}},
+		{ColumnOrderingPKFirst, []string{"id", "age", "email", "name"}},
+	}
+	for _, tc := range cases {
+		sql := createTableSQLWithOptions("reorder_people", table, Options{ColumnOrdering: tc.ordering})
+		got := make([]string, 0, len(tc.want))
+		for _, m := range columnPattern.FindAllStringSubmatch(sql, -1) {
+			got = append(got, m[1])
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("ordering %q: got columns %v, want %v in:\n%s", tc.ordering, got, tc.want, sql)
+		}
+	}
+
+	table.ColumnOrder = nil
+	if got := orderedColumns(table, ColumnOrderingDeclared); !reflect.DeepEqual(got, []string{"age", "email", "id", "name"}) {
+		t.Fatalf("expected alphabetical fallback without a recorded order, got %v", got)
+	}
+	if err := validateColumnOrdering("random"); err == nil {
+		t.Fatalf("expected error for unknown column ordering")
+	}
+}
+
+type placeBefore struct {
+	ID    uint   `gorm:"primaryKey"`
+	Name  string `gorm:"size:32"`
+	Nick  string `gorm:"size:16"`
+	Alias string `gorm:"size:16"`
+	Email string `gorm:"size:64"`
+}
+
+func (placeBefore) TableName() string { return "place_people" }
+
+type placeAfter struct {
+	ID    uint   `gorm:"primaryKey"`
+	Name  string `gorm:"size:32"`
+	Title string `gorm:"size:16"`
+	Phone string `gorm:"size:16"`
+	Email string `gorm:"size:64"`
+}
+
+func (placeAfter) TableName() string { return "place_people" }
+
+func TestDiffTableAddColumnAfterDeclaredPredecessor(t *testing.T) {
+	before, err := buildCurrentState([]any{&placeBefore{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState before failed: %v", err)
+	}
+	after, err := buildCurrentState([]any{&placeAfter{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState after failed: %v", err)
+	}
+	prev, cur := before.Tables["place_people"], after.Tables["place_people"]
+
+	up, _ := splitMigrationOps(diffTable("place_people", prev, cur))
+	if !strings.HasSuffix(up[0], "ADD COLUMN `phone` varchar(16);") {
+		t.Fatalf("expected plain ADD COLUMN by default, got %s", up[0])
+	}
+
+	up, down := splitMigrationOps(diffTableWithOptions("place_people", prev, cur, Options{TrackColumnOrder: true}))
+	wantUp := []string{
+		"ALTER TABLE `place_people` ADD COLUMN `title` varchar(16) AFTER `name`;",
+		"ALTER TABLE `place_people` ADD COLUMN `phone` varchar(16) AFTER `title`;",
+		"ALTER TABLE `place_people` DROP COLUMN `nick`;",
+		"ALTER TABLE `place_people` DROP COLUMN `alias`;",
+	}
+	if !reflect.DeepEqual(up, wantUp) {
+		t.Fatalf("unexpected up SQL:\n%s", strings.Join(up, "\n"))
+	}
+	// alias goes back first and nick before it, so both end up after name
+	// in their original order.
+	wantDown := []string{
+		"ALTER TABLE `place_people` ADD COLUMN `alias` varchar(16) AFTER `name`;",
+		"ALTER TABLE `place_people` ADD COLUMN `nick` varchar(16) AFTER `name`;",
+		"ALTER TABLE `place_people` DROP COLUMN `phone`;",
+		"ALTER TABLE `place_people` DROP COLUMN `title`;",
+	}
+	if !reflect.DeepEqual(down, wantDown) {
+		t.Fatalf("unexpected down SQL:\n%s", strings.Join(down, "\n"))
+	}
+}
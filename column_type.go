@@ -0,0 +1,256 @@
+package gomigration
+
+import (
+	"strconv"
+	"strings"
+)
+
+// TypeChange classifies how a column's type changes between two
+// definitions.
+type TypeChange string
+
+const (
+	// TypeUnchanged marks a change that keeps the type, including a change
+	// of integer display width only, such as int(11) to int.
+	TypeUnchanged TypeChange = ""
+	// TypeWiden marks a type that holds every value of the old one.
+	TypeWiden TypeChange = "widen"
+	// TypeNarrow marks a type that may truncate or reject existing values.
+	TypeNarrow TypeChange = "narrow"
+	// TypeIncompatible marks a conversion between unrelated types.
+	TypeIncompatible TypeChange = "incompatible"
+)
+
+// columnType is the type part of a column definition, e.g. varchar(64) or
+// int unsigned.
+type columnType struct {
+	base     string
+	params   []string
+	unsigned bool
+}
+
+func parseColumnType(definition string) columnType {
+	tokens := tokenizeDefinition(definition)
+	if len(tokens) == 0 {
+		return columnType{}
+	}
+	t := columnType{base: columnBaseType(tokens[0])}
+	if isBooleanType(t.base) {
+		return columnType{base: "tinyint", params: []string{"1"}}
+	}
+	if t.base == "enum" || t.base == "set" {
+		tokens[0] = canonicalValueListType(tokens[0])
+	}
+	if _, rest, ok := strings.Cut(tokens[0], "("); ok {
+		for _, p := range splitTypeParams(strings.TrimSuffix(rest, ")")) {
+			t.params = append(t.params, strings.TrimSpace(p))
+		}
+	}
+	t.unsigned = len(tokens) > 1 && strings.EqualFold(tokens[1], "unsigned")
+	return t
+}
+
+// splitTypeParams splits a type parameter list on commas outside quotes.
+func splitTypeParams(s string) []string {
+	params := make([]string, 0)
+	var b strings.Builder
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\'':
+			if inQuote && i+1 < len(s) && s[i+1] == '\'' {
+				b.WriteString("''")
+				i++
+				continue
+			}
+			inQuote = !inQuote
+			b.WriteByte(c)
+		case c == ',' && !inQuote:
+			params = append(params, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return append(params, b.String())
+}
+
+func (t columnType) param(i int) (int, bool) {
+	if i >= len(t.params) {
+		return 0, false
+	}
+	n, err := strconv.Atoi(t.params[i])
+	return n, err == nil
+}
+
+func (t columnType) equal(o columnType) bool {
+	return t.base == o.base && t.unsigned == o.unsigned && strings.Join(t.params, ",") == strings.Join(o.params, ",")
+}
+
+var integerBytes = map[string]int{"tinyint": 1, "smallint": 2, "mediumint": 3, "int": 4, "integer": 4, "bigint": 8}
+
+// Maximum length in bytes of the TEXT and BLOB types, by base type.
+var lobCapacity = map[string]int{
+	"tinytext": 255, "text": 65535, "mediumtext": 16777215, "longtext": 4294967295,
+	"tinyblob": 255, "blob": 65535, "mediumblob": 16777215, "longblob": 4294967295,
+}
+
+// classifyTypeChange reports whether changing a column from prev to cur keeps
+// every value the old type can hold (widen), may lose some (narrow), or
+// converts between unrelated types (incompatible). Attributes other than the
+// type, such as NULL or DEFAULT, are ignored.
+func classifyTypeChange(prev, cur string) TypeChange {
+	from, to := parseColumnType(prev), parseColumnType(cur)
+	if from.base == "" || to.base == "" || from.equal(to) {
+		return TypeUnchanged
+	}
+	switch {
+	case integerBytes[from.base] > 0 && integerBytes[to.base] > 0:
+		return classifyIntegerChange(from, to)
+	case isDecimalType(from.base) && isDecimalType(to.base):
+		return classifyDecimalChange(from, to)
+	case isFloatType(from.base) && isFloatType(to.base):
+		return widenIf(floatBytes(from.base) <= floatBytes(to.base) && (!to.unsigned || from.unsigned))
+	case isCharType(from.base) && (isCharType(to.base) || isTextType(to.base)),
+		isBinaryType(from.base) && (isBinaryType(to.base) || isBlobType(to.base)),
+		isTextType(from.base) && (isCharType(to.base) || isTextType(to.base)),
+		isBlobType(from.base) && (isBinaryType(to.base) || isBlobType(to.base)):
+		return widenIf(typeCapacity(from) <= typeCapacity(to))
+	case isTemporalType(from.base) && isTemporalType(to.base):
+		return classifyTemporalChange(from, to)
+	case (from.base == "enum" || from.base == "set") && from.base == to.base:
+		return widenIf(containsAll(to.params, from.params))
+	}
+	return TypeIncompatible
+}
+
+func classifyIntegerChange(from, to columnType) TypeChange {
+	fromBytes, toBytes := integerBytes[from.base], integerBytes[to.base]
+	switch {
+	case from.unsigned == to.unsigned && fromBytes == toBytes:
+		// The display width, as in int(11), does not limit the values.
+		return TypeUnchanged
+	case from.unsigned == to.unsigned:
+		return widenIf(fromBytes < toBytes)
+	case from.unsigned:
+		// An unsigned value fits in a signed type twice as wide.
+		return widenIf(fromBytes < toBytes)
+	default:
+		return TypeNarrow
+	}
+}
+
+func classifyDecimalChange(from, to columnType) TypeChange {
+	fromPrecision, fromScale := decimalPrecision(from)
+	toPrecision, toScale := decimalPrecision(to)
+	return widenIf(toScale >= fromScale && toPrecision-toScale >= fromPrecision-fromScale && (!to.unsigned || from.unsigned))
+}
+
+func decimalPrecision(t columnType) (int, int) {
+	precision, ok := t.param(0)
+	if !ok {
+		precision = 10
+	}
+	scale, _ := t.param(1)
+	return precision, scale
+}
+
+func classifyTemporalChange(from, to columnType) TypeChange {
+	fromFSP, _ := from.param(0)
+	toFSP, _ := to.param(0)
+	switch {
+	case from.base == to.base:
+		return widenIf(fromFSP <= toFSP)
+	case from.base == "date" && (to.base == "datetime" || to.base == "timestamp"):
+		return TypeWiden
+	case from.base == "timestamp" && to.base == "datetime":
+		return widenIf(fromFSP <= toFSP)
+	case (from.base == "datetime" || from.base == "timestamp") && (to.base == "date" || to.base == "datetime" || to.base == "timestamp"):
+		// Dropping the time part, or moving into the narrower TIMESTAMP
+		// range, loses values.
+		return TypeNarrow
+	}
+	return TypeIncompatible
+}
+
+// typeCapacity is the maximum length of a string type: characters for CHAR
+// and VARCHAR, bytes for the TEXT and BLOB types.
+func typeCapacity(t columnType) int {
+	if n, ok := lobCapacity[t.base]; ok {
+		return n
+	}
+	n, ok := t.param(0)
+	if !ok {
+		return 1
+	}
+	return n
+}
+
+func widenIf(ok bool) TypeChange {
+	if ok {
+		return TypeWiden
+	}
+	return TypeNarrow
+}
+
+func floatBytes(base string) int {
+	if base == "float" {
+		return 4
+	}
+	return 8
+}
+
+func isDecimalType(base string) bool {
+	return base == "decimal" || base == "numeric" || base == "dec" || base == "fixed"
+}
+
+func isFloatType(base string) bool {
+	return base == "float" || base == "double" || base == "real"
+}
+
+func isCharType(base string) bool { return base == "char" || base == "varchar" }
+
+func isBinaryType(base string) bool { return base == "binary" || base == "varbinary" }
+
+func isTextType(base string) bool { return strings.HasSuffix(base, "text") && lobCapacity[base] > 0 }
+
+func isBlobType(base string) bool { return strings.HasSuffix(base, "blob") && lobCapacity[base] > 0 }
+
+func isTemporalType(base string) bool {
+	switch base {
+	case "date", "datetime", "timestamp", "time", "year":
+		return true
+	}
+	return false
+}
+
+func containsAll(values, subset []string) bool {
+	for _, v := range subset {
+		if !containsString(values, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// typeChangeNote returns the comment line annotating a MODIFY COLUMN
+// statement with its classification.
+func typeChangeNote(change TypeChange) string {
+	switch change {
+	case TypeWiden:
+		return "-- safe widen"
+	case TypeNarrow:
+		return "-- WARNING: narrowing may truncate"
+	case TypeIncompatible:
+		return "-- WARNING: incompatible type change may fail or lose data"
+	}
+	return ""
+}
+
+func withTypeChangeNote(sql string, change TypeChange) string {
+	if note := typeChangeNote(change); note != "" {
+		return note + "\n" + sql
+	}
+	return sql
+}
@@ -0,0 +1,72 @@
+package gomigration
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClassifyTypeChange(t *testing.T) {
+	cases := []struct {
+		prev, cur string
+		want      TypeChange
+	}{
+		{"int", "bigint", TypeWiden},
+		{"bigint", "int", TypeNarrow},
+		{"int unsigned", "bigint", TypeWiden},
+		{"int unsigned", "int", TypeNarrow},
+		{"int", "int unsigned", TypeNarrow},
+		{"varchar(64)", "varchar(255)", TypeWiden},
+		{"varchar(255) NOT NULL", "varchar(64) NOT NULL", TypeNarrow},
+		{"char(10)", "varchar(10)", TypeWiden},
+		{"varchar(255)", "text", TypeWiden},
+		{"text", "varchar(255)", TypeNarrow},
+		{"varbinary(16)", "blob", TypeWiden},
+		{"decimal(10,2)", "decimal(12,2)", TypeWiden},
+		{"decimal(10,2)", "decimal(10,4)", TypeNarrow},
+		{"float", "double", TypeWiden},
+		{"datetime(3)", "datetime", TypeNarrow},
+		{"date", "datetime", TypeWiden},
+		{"enum('a','b')", "enum('a','b','c')", TypeWiden},
+		{"enum('a','b')", "enum('a')", TypeNarrow},
+		{"varchar(64)", "int", TypeIncompatible},
+		{"varchar(64)", "varchar(64) NOT NULL", TypeUnchanged},
+		{"boolean", "tinyint(1)", TypeUnchanged},
+		{"int(11)", "int", TypeUnchanged},
+		{"int(11) unsigned", "integer(10) unsigned", TypeUnchanged},
+	}
+	for _, tc := range cases {
+		if got := classifyTypeChange(tc.prev, tc.cur); got != tc.want {
+			t.Fatalf("classifyTypeChange(%q, %q) = %q, want %q", tc.prev, tc.cur, got, tc.want)
+		}
+	}
+}
+
+func TestDiffTableAnnotatesTypeChanges(t *testing.T) {
+	prev := tableState{Columns: map[string]columnState{
+		"id":   {Definition: "int"},
+		"name": {Definition: "varchar(255)"},
+	}}
+	cur := tableState{Columns: map[string]columnState{
+		"id":   {Definition: "bigint"},
+		"name": {Definition: "varchar(64)"},
+	}}
+
+	ops := diffTable("people", prev, cur)
+	if len(ops) != 2 || ops[0].typeChange != TypeWiden || ops[1].typeChange != TypeNarrow {
+		t.Fatalf("unexpected classification: %#v", ops)
+	}
+	if strings.Contains(ops[0].up, "--") {
+		t.Fatalf("expected no annotation by default, got %q", ops[0].up)
+	}
+
+	ops = diffTableWithOptions("people", prev, cur, Options{AnnotateTypeChanges: true})
+	if ops[0].up != "-- safe widen\nALTER TABLE `people` MODIFY COLUMN `id` bigint;" {
+		t.Fatalf("unexpected widen up SQL: %q", ops[0].up)
+	}
+	if ops[0].down != "-- WARNING: narrowing may truncate\nALTER TABLE `people` MODIFY COLUMN `id` int;" {
+		t.Fatalf("unexpected widen down SQL: %q", ops[0].down)
+	}
+	if !strings.HasPrefix(ops[1].up, "-- WARNING: narrowing may truncate\n") || !strings.HasPrefix(ops[1].down, "-- safe widen\n") {
+		t.Fatalf("unexpected narrow SQL: %q / %q", ops[1].up, ops[1].down)
+	}
+}
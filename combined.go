@@ -0,0 +1,113 @@
+package gomigration
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// FileMarkers are the comment lines that introduce each direction of a
+// combined migration file.
+type FileMarkers struct {
+	Up   string
+	Down string
+	// StatementBegin and StatementEnd, when set, enclose every block of more
+	// than one statement, such as the DROP INDEX and CREATE INDEX of a
+	// changed index, so the runner executes the block as one unit. The
+	// runner sends such a block to the driver in one call, so on MySQL the
+	// DSN needs multiStatements=true.
+	StatementBegin string
+	StatementEnd   string
+}
+
+var (
+	GooseMarkers = FileMarkers{
+		Up:             "-- +goose Up",
+		Down:           "-- +goose Down",
+		StatementBegin: "-- +goose StatementBegin",
+		StatementEnd:   "-- +goose StatementEnd",
+	}
+	DbmateMarkers = FileMarkers{Up: "-- migrate:up", Down: "-- migrate:down"}
+)
+
+func (o Options) combinedFileMarkers() FileMarkers {
+	if o.CombinedFileMarkers == (FileMarkers{}) {
+		return GooseMarkers
+	}
+	return o.CombinedFileMarkers
+}
+
+func (o Options) validateCombinedFile() error {
+	if !o.CombinedFile {
+		if o.CombinedFileMarkers != (FileMarkers{}) {
+			return fmt.Errorf("CombinedFileMarkers requires CombinedFile")
+		}
+		return nil
+	}
+	if o.PerTableFiles {
+		return fmt.Errorf("CombinedFile cannot be used with PerTableFiles")
+	}
+	markers := o.combinedFileMarkers()
+	if (markers.StatementBegin == "") != (markers.StatementEnd == "") {
+		return fmt.Errorf("combined file markers must set both StatementBegin and StatementEnd or neither")
+	}
+	lines := []string{markers.Up, markers.Down}
+	if markers.StatementBegin != "" {
+		lines = append(lines, markers.StatementBegin, markers.StatementEnd)
+	}
+	for _, marker := range lines {
+		if !strings.HasPrefix(strings.TrimSpace(marker), "--") || strings.Contains(marker, "\n") {
+			return fmt.Errorf("combined file marker %q must be a single SQL comment line", marker)
+		}
+	}
+	if strings.TrimSpace(markers.Up) == strings.TrimSpace(markers.Down) {
+		return fmt.Errorf("combined file markers must differ, both are %q", markers.Up)
+	}
+	return nil
+}
+
+func writeCombinedMigrationFile(absDir, version string, file generatedFile, markers FileMarkers, encoding FileEncoding) (string, error) {
+	path := filepath.Join(absDir, fmt.Sprintf("%s_%s.sql", version, sanitizeName(file.name)))
+	content := strings.TrimSpace(markers.Up) + "\n" + strings.Join(file.up, "\n\n") + "\n\n" + strings.TrimSpace(markers.Down) + "\n"
+	if len(file.down) > 0 {
+		content += strings.Join(file.down, "\n\n") + "\n"
+	}
+	if err := writeSQLFile(path, content, encoding); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func (m FileMarkers) enclose(blocks []string) []string {
+	if m.StatementBegin == "" {
+		return blocks
+	}
+	out := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		if len(splitSQLStatements(block)) > 1 {
+			block = strings.TrimSpace(m.StatementBegin) + "\n" + block + "\n" + strings.TrimSpace(m.StatementEnd)
+		}
+		out = append(out, block)
+	}
+	return out
+}
+
+// combinedMigrationFiles lists the VERSION_name.sql files of dir, the files
+// CombinedFile writes.
+func combinedMigrationFiles(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0)
+	for _, path := range paths {
+		base := filepath.Base(path)
+		if strings.HasSuffix(base, ".up.sql") || strings.HasSuffix(base, ".down.sql") {
+			continue
+		}
+		if version, _, ok := strings.Cut(base, "_"); ok && version != "" && validateVersion(version) == nil {
+			files = append(files, path)
+		}
+	}
+	return files, nil
+}
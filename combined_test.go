@@ -0,0 +1,136 @@
+package gomigration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pressly/goose/v3"
+)
+
+func TestMakeMigrationsCombinedFile(t *testing.T) {
+	dir := t.TempDir()
+	result, err := MakeMigrationsWithOptions(migrationModels(), dir, "init", "", Options{
+		Version:      "20240101000000",
+		CombinedFile: true,
+	})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	if filepath.Base(result.Path) != "20240101000000_init.sql" || result.UpPath != result.Path || result.DownPath != result.Path {
+		t.Fatalf("unexpected result paths: %#v", result)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.up.sql")); len(matches) != 0 {
+		t.Fatalf("expected no up/down pair, found %v", matches)
+	}
+	data, err := os.ReadFile(result.Path)
+	if err != nil {
+		t.Fatalf("read combined file failed: %v", err)
+	}
+	content := string(data)
+	up, down, found := strings.Cut(content, "-- +goose Down\n")
+	if !found || !strings.HasPrefix(up, "-- +goose Up\nCREATE TABLE `test_groups`") {
+		t.Fatalf("expected goose markers around both directions, got:\n%s", content)
+	}
+	if !strings.Contains(up, "ADD CONSTRAINT") || !strings.HasPrefix(down, "ALTER TABLE") || !strings.Contains(down, "DROP TABLE IF EXISTS `test_groups`;") {
+		t.Fatalf("unexpected directions:\n%s", content)
+	}
+
+	dbmate, err := MakeMigrationsWithOptions(migrationModels(), t.TempDir(), "init", "", Options{
+		CombinedFile:        true,
+		CombinedFileMarkers: DbmateMarkers,
+	})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions with dbmate markers failed: %v", err)
+	}
+	if got := readMigration(t, dbmate.Path); !strings.HasPrefix(got, "-- migrate:up\n") || !strings.Contains(got, "\n\n-- migrate:down\n") {
+		t.Fatalf("expected dbmate markers, got:\n%s", got)
+	}
+}
+
+func TestCombinedFileOptionsValidation(t *testing.T) {
+	cases := []Options{
+		{CombinedFile: true, PerTableFiles: true},
+		{CombinedFile: true, CombinedFileMarkers: FileMarkers{Up: "up", Down: "-- down"}},
+		{CombinedFile: true, CombinedFileMarkers: FileMarkers{Up: "-- x", Down: "-- x"}},
+		{CombinedFile: true, CombinedFileMarkers: FileMarkers{Up: "-- up", Down: "-- down", StatementBegin: "-- begin"}},
+		{CombinedFileMarkers: GooseMarkers},
+	}
+	for _, opts := range cases {
+		if _, err := MakeMigrationsWithOptions(migrationModels(), t.TempDir(), "init", "", opts); err == nil {
+			t.Fatalf("expected options %#v to be rejected", opts)
+		}
+	}
+}
+
+type gooseItemBefore struct {
+	ID   uint   `gorm:"primaryKey"`
+	Code string `gorm:"size:32;index:idx_goose_items_code"`
+}
+
+func (gooseItemBefore) TableName() string { return "goose_items" }
+
+type gooseItemAfter struct {
+	ID   uint   `gorm:"primaryKey"`
+	Code string `gorm:"size:32;uniqueIndex:idx_goose_items_code"`
+	Name string `gorm:"size:64"`
+}
+
+func (gooseItemAfter) TableName() string { return "goose_items" }
+
+// TestGooseRunsCombinedFiles hands the generated files to goose itself,
+// which parses the annotations and runs both directions against SQLite.
+func TestGooseRunsCombinedFiles(t *testing.T) {
+	dir := t.TempDir()
+	opts := Options{Dialect: DialectSQLite, CombinedFile: true, Version: "20240101000000"}
+	if _, err := MakeMigrationsWithOptions([]any{&gooseItemBefore{}}, dir, "init", "", opts); err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	opts.Version = "20240102000000"
+	result, err := MakeMigrationsWithOptions([]any{&gooseItemAfter{}}, dir, "unique_code", "", opts)
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	if content := readMigration(t, result.Path); strings.Count(content, "-- +goose StatementBegin") != 2 || strings.Count(content, "-- +goose StatementEnd") != 2 {
+		t.Fatalf("expected the index change enclosed in both directions, got:\n%s", content)
+	}
+
+	db := openMigrationsTableDB(t)
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("db.DB failed: %v", err)
+	}
+	provider, err := goose.NewProvider(goose.DialectSQLite3, sqlDB, os.DirFS(dir))
+	if err != nil {
+		t.Fatalf("goose.NewProvider failed: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := provider.Up(ctx); err != nil {
+		t.Fatalf("goose up failed: %v", err)
+	}
+	var unique int
+	if err := db.Raw(`SELECT "unique" FROM pragma_index_list('goose_items') WHERE name = 'idx_goose_items_code'`).Scan(&unique).Error; err != nil || unique != 1 {
+		t.Fatalf("expected goose to make the index unique, got %d (%v)", unique, err)
+	}
+	if !db.Migrator().HasColumn("goose_items", "name") {
+		t.Fatalf("expected goose to add the name column")
+	}
+
+	if _, err := provider.DownTo(ctx, 20240101000000); err != nil {
+		t.Fatalf("goose down failed: %v", err)
+	}
+	if err := db.Raw(`SELECT "unique" FROM pragma_index_list('goose_items') WHERE name = 'idx_goose_items_code'`).Scan(&unique).Error; err != nil || unique != 0 {
+		t.Fatalf("expected goose to restore the plain index, got %d (%v)", unique, err)
+	}
+	if db.Migrator().HasColumn("goose_items", "name") {
+		t.Fatalf("expected goose to drop the name column")
+	}
+	if _, err := provider.DownTo(ctx, 0); err != nil {
+		t.Fatalf("goose down failed: %v", err)
+	}
+	if db.Migrator().HasTable("goose_items") {
+		t.Fatalf("expected goose to drop goose_items")
+	}
+}
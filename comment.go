@@ -0,0 +1,119 @@
+package gomigration
+
+import (
+	"fmt"
+	"strings"
+)
+
+// definitionComment returns the text of a COMMENT 'text' attribute of a
+// column definition, as MySQL definitions carry it.
+func definitionComment(definition string) string {
+	tokens := tokenizeDefinition(definition)
+	for i := 0; i+1 < len(tokens); i++ {
+		if strings.EqualFold(tokens[i], "COMMENT") {
+			return unquoteSQLString(tokens[i+1])
+		}
+	}
+	return ""
+}
+
+func unquoteSQLString(v string) string {
+	if len(v) < 2 || v[0] != '\'' || v[len(v)-1] != '\'' {
+		return v
+	}
+	v = v[1 : len(v)-1]
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		if (v[i] == '\\' || v[i] == '\'') && i+1 < len(v) {
+			i++
+		}
+		b.WriteByte(v[i])
+	}
+	return b.String()
+}
+
+// columnComment is the comment of a column. States saved before comments
+// were recorded only have it in the definition.
+func columnComment(col columnState) string {
+	if col.Comment != "" {
+		return col.Comment
+	}
+	return definitionComment(col.Definition)
+}
+
+func withDefinitionComment(definition, comment string) string {
+	definition = stripDefinitionComment(definition)
+	if comment == "" {
+		return definition
+	}
+	return definition + " COMMENT " + quoteSQLString(comment)
+}
+
+// commentOnlyChange reports whether two MySQL definitions differ only in
+// their COMMENT.
+func commentOnlyChange(prev, cur string, opts Options) bool {
+	return definitionComment(prev) != definitionComment(cur) &&
+		opts.columnEqual(stripDefinitionComment(prev), stripDefinitionComment(cur))
+}
+
+// columnCommentOp changes the comment of a column whose definition is
+// otherwise unchanged.
+func columnCommentOp(tableName, column string, prev, cur columnState, opts Options) (migrationOp, bool) {
+	prevComment, curComment := columnComment(prev), columnComment(cur)
+	if prevComment == curComment {
+		return migrationOp{}, false
+	}
+	switch {
+	case opts.Dialect == DialectPostgres:
+	case opts.Dialect.isMySQL():
+		// When both definitions carry their comment, the column comparison
+		// has already judged it.
+		if definitionComment(prev.Definition) == prevComment && definitionComment(cur.Definition) == curComment {
+			return migrationOp{}, false
+		}
+	default:
+		return migrationOp{}, false
+	}
+	em := opts.emitter()
+	return migrationOp{
+		kind:  opColumnComment,
+		table: tableName,
+		name:  column,
+		up:    em.SetColumnComment(tableName, ColumnDefinition{Name: column, Definition: cur.Definition, Comment: curComment}),
+		down:  em.SetColumnComment(tableName, ColumnDefinition{Name: column, Definition: prev.Definition, Comment: prevComment}),
+		apply: setColumnChange(tableName, column, cur),
+	}, true
+}
+
+// diffTableComment sets the table comment the model declares, clearing it
+// when the model no longer declares one.
+func diffTableComment(tableName string, prev, cur tableState, opts Options) []migrationOp {
+	if prev.Comment == cur.Comment || opts.Dialect == DialectSQLite {
+		return nil
+	}
+	em := opts.emitter()
+	return []migrationOp{{
+		kind:  opTableComment,
+		table: tableName,
+		name:  tableName,
+		up:    em.SetTableComment(tableName, cur.Comment),
+		down:  em.SetTableComment(tableName, prev.Comment),
+		apply: tableCommentChange(tableName, cur.Comment),
+	}}
+}
+
+func (e PostgresEmitter) commentOnTable(table, comment string) string {
+	return fmt.Sprintf("COMMENT ON TABLE %s IS %s;", e.table(table), commentLiteral(comment))
+}
+
+func (e PostgresEmitter) commentOnColumn(table, column, comment string) string {
+	return fmt.Sprintf("COMMENT ON COLUMN %s.%s IS %s;", e.table(table), e.quote(column), commentLiteral(comment))
+}
+
+// commentLiteral is the Postgres comment value; NULL removes a comment.
+func commentLiteral(comment string) string {
+	if comment == "" {
+		return "NULL"
+	}
+	return quoteSQLString(comment)
+}
@@ -0,0 +1,120 @@
+package gomigration
+
+import (
+	"strings"
+	"testing"
+)
+
+type commentBefore struct {
+	ID   uint   `gorm:"primaryKey"`
+	Name string `gorm:"size:64;comment:display name"`
+}
+
+func (commentBefore) TableName() string { return "comment_people" }
+
+type commentAfter struct {
+	ID   uint   `gorm:"primaryKey"`
+	Name string `gorm:"size:64;comment:the person's name"`
+}
+
+func (commentAfter) TableName() string { return "comment_people" }
+
+func (commentAfter) TableOptions() TableOptions {
+	return TableOptions{Comment: "people we know"}
+}
+
+func TestDiffTableCommentOnlyColumnChange(t *testing.T) {
+	for _, tc := range []struct {
+		opts     Options
+		wantUp   []string
+		wantDown []string
+	}{
+		{
+			opts: Options{},
+			wantUp: []string{
+				"ALTER TABLE `comment_people` COMMENT = 'people we know';",
+				"ALTER TABLE `comment_people` MODIFY COLUMN `name` varchar(64) COMMENT 'the person\\'s name';",
+			},
+			wantDown: []string{
+				"ALTER TABLE `comment_people` MODIFY COLUMN `name` varchar(64) COMMENT 'display name';",
+				"ALTER TABLE `comment_people` COMMENT = '';",
+			},
+		},
+		{
+			opts: Options{Dialect: DialectPostgres},
+			wantUp: []string{
+				`COMMENT ON TABLE "comment_people" IS 'people we know';`,
+				`COMMENT ON COLUMN "comment_people"."name" IS 'the person''s name';`,
+			},
+			wantDown: []string{
+				`COMMENT ON COLUMN "comment_people"."name" IS 'display name';`,
+				`COMMENT ON TABLE "comment_people" IS NULL;`,
+			},
+		},
+	} {
+		before, err := buildCurrentStateWithOptions([]any{&commentBefore{}}, tc.opts)
+		if err != nil {
+			t.Fatalf("buildCurrentStateWithOptions before failed: %v", err)
+		}
+		after, err := buildCurrentStateWithOptions([]any{&commentAfter{}}, tc.opts)
+		if err != nil {
+			t.Fatalf("buildCurrentStateWithOptions after failed: %v", err)
+		}
+		prev, cur := before.Tables["comment_people"], after.Tables["comment_people"]
+		if cur.Columns["name"].Comment != "the person's name" || cur.Comment != "people we know" {
+			t.Fatalf("expected comments to be captured, got %#v", cur)
+		}
+
+		ops := diffTableWithOptions("comment_people", prev, cur, tc.opts)
+		up, down := splitMigrationOps(ops)
+		if strings.Join(up, "\n") != strings.Join(tc.wantUp, "\n") || strings.Join(down, "\n") != strings.Join(tc.wantDown, "\n") {
+			t.Fatalf("dialect %q: unexpected SQL:\n%s\n---\n%s", tc.opts.Dialect, strings.Join(up, "\n"), strings.Join(down, "\n"))
+		}
+		if ops[1].kind != opColumnComment || ops[0].kind != opTableComment {
+			t.Fatalf("dialect %q: expected comment op kinds, got %d and %d", tc.opts.Dialect, ops[0].kind, ops[1].kind)
+		}
+		if err := verifyMigrationOps(before, after, ops, tc.opts); err != nil {
+			t.Fatalf("dialect %q: unexpected self-check failure: %v", tc.opts.Dialect, err)
+		}
+	}
+}
+
+func TestDiffTableCommentFromStateWithoutRecordedComment(t *testing.T) {
+	// States saved before comments were recorded only carry them in the
+	// definition.
+	prev := tableState{Columns: map[string]columnState{"name": {Definition: "varchar(64) COMMENT 'the name'"}}}
+	cur := tableState{Columns: map[string]columnState{"name": {Definition: "varchar(64) COMMENT 'the name'", Comment: "the name"}}}
+	if ops := diffTable("people", prev, cur); len(ops) != 0 {
+		t.Fatalf("expected no ops, got %#v", ops)
+	}
+
+	// A driver that does not fold the comment into the definition still
+	// gets a MODIFY carrying it.
+	prev = tableState{Columns: map[string]columnState{"name": {Definition: "varchar(64)", Comment: "old"}}}
+	cur = tableState{Columns: map[string]columnState{"name": {Definition: "varchar(64)", Comment: "new"}}}
+	up, down := splitMigrationOps(diffTable("people", prev, cur))
+	if strings.Join(up, "\n") != "ALTER TABLE `people` MODIFY COLUMN `name` varchar(64) COMMENT 'new';" ||
+		strings.Join(down, "\n") != "ALTER TABLE `people` MODIFY COLUMN `name` varchar(64) COMMENT 'old';" {
+		t.Fatalf("unexpected SQL:\n%s\n%s", strings.Join(up, "\n"), strings.Join(down, "\n"))
+	}
+}
+
+func TestCreateTableComments(t *testing.T) {
+	state, err := buildCurrentState([]any{&commentAfter{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState failed: %v", err)
+	}
+	if create := createTableSQL("comment_people", state.Tables["comment_people"]); !strings.HasSuffix(create, ") COMMENT='people we know';") {
+		t.Fatalf("expected MySQL table comment, got: %s", create)
+	}
+
+	pg := Options{Dialect: DialectPostgres}
+	state, err = buildCurrentStateWithOptions([]any{&commentAfter{}}, pg)
+	if err != nil {
+		t.Fatalf("buildCurrentStateWithOptions failed: %v", err)
+	}
+	assertContainsAll(t, createTableSQLWithOptions("comment_people", state.Tables["comment_people"], pg), []string{
+		`COMMENT ON TABLE "comment_people" IS 'people we know';`,
+		`COMMENT ON COLUMN "comment_people"."name" IS 'the person''s name';`,
+	})
+}
@@ -0,0 +1,395 @@
+package gomigration
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var versionedSRIDPattern = regexp.MustCompile(`^/\*!\d+\s+SRID\s+(\d+)\s*\*/$`)
+
+// decimalLiteralPattern matches the SQL numeric literals a default can be
+// written as. strconv.ParseFloat also accepts inf, nan, hex floats and
+// underscores, which are strings in SQL.
+var decimalLiteralPattern = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)([eE][+-]?\d+)?$`)
+
+// tokenizeDefinition splits a column definition on whitespace while keeping
+// quoted strings, backquoted identifiers, parenthesized groups and /* */
+// comments together as single tokens.
+func tokenizeDefinition(definition string) []string {
+	tokens := make([]string, 0)
+	var b strings.Builder
+	depth := 0
+	var quote rune
+	inComment := false
+	runes := []rune(definition)
+	flush := func() {
+		if b.Len() > 0 {
+			tokens = append(tokens, b.String())
+			b.Reset()
+		}
+	}
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case inComment:
+			b.WriteRune(r)
+			if r == '*' && i+1 < len(runes) && runes[i+1] == '/' {
+				b.WriteRune('/')
+				i++
+				inComment = false
+			}
+		case quote != 0:
+			b.WriteRune(r)
+			if r == '\\' && quote != '`' && i+1 < len(runes) {
+				b.WriteRune(runes[i+1])
+				i++
+				continue
+			}
+			if r == quote {
+				if i+1 < len(runes) && runes[i+1] == quote {
+					b.WriteRune(runes[i+1])
+					i++
+					continue
+				}
+				quote = 0
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			if depth == 0 {
+				flush()
+			}
+			b.WriteString("/*")
+			i++
+			inComment = true
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+			b.WriteRune(r)
+		case r == '(':
+			depth++
+			b.WriteRune(r)
+		case r == ')':
+			if depth > 0 {
+				depth--
+			}
+			b.WriteRune(r)
+		case depth == 0 && (r == ' ' || r == '\t' || r == '\n' || r == '\r'):
+			flush()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// columnBaseType returns the lower-cased type name of a definition without
+// its length or value list, e.g. "varchar" for "varchar(64) NOT NULL".
+func columnBaseType(definition string) string {
+	tokens := tokenizeDefinition(definition)
+	if len(tokens) == 0 {
+		return ""
+	}
+	name, _, _ := strings.Cut(tokens[0], "(")
+	return strings.ToLower(name)
+}
+
+func isBooleanType(baseType string) bool {
+	return baseType == "bool" || baseType == "boolean"
+}
+
+func isNumericType(baseType string) bool {
+	switch baseType {
+	case "bool", "boolean", "bit", "tinyint", "smallint", "mediumint", "int", "integer", "bigint",
+		"decimal", "numeric", "dec", "fixed", "float", "double", "real":
+		return true
+	default:
+		return false
+	}
+}
+
+// canonicalDefinition rewrites a normalized definition into the form used for
+// comparisons: boolean columns are spelled tinyint(1) the way MySQL reports
+// them, numeric defaults drop quoting and use 1/0 for true/false, and string
+// defaults use single quotes, also inside the parentheses of an expression
+// default. Enum and set value lists are spelled as canonicalValueListType
+// does, and a generation clause as canonicalGeneratedClause does. An empty
+// string default stays distinct from no default.
+func canonicalDefinition(definition string) string {
+	tokens := tokenizeDefinition(normalizeDefinition(definition))
+	if len(tokens) == 0 {
+		return ""
+	}
+	baseType := columnBaseType(tokens[0])
+	if isBooleanType(baseType) {
+		tokens[0] = "tinyint(1)"
+		baseType = "tinyint"
+	}
+	if baseType == "enum" || baseType == "set" {
+		tokens[0] = canonicalValueListType(tokens[0])
+	}
+	for i := 1; i+1 < len(tokens); i++ {
+		if !strings.EqualFold(tokens[i], "DEFAULT") {
+			continue
+		}
+		switch {
+		case isExpressionDefault(tokens[i+1]):
+			tokens[i+1] = canonicalExpressionDefault(tokens[i+1])
+		case isNumericType(baseType):
+			tokens[i+1] = canonicalNumericDefault(tokens[i+1])
+		default:
+			tokens[i+1] = singleQuotedLiteral(tokens[i+1])
+		}
+		break
+	}
+	tokens = canonicalGeneratedClause(tokens)
+	if srid, rest := splitSRID(tokens); srid != "" {
+		tokens = append(rest, spatialSRIDClause(srid))
+	}
+	return strings.Join(tokens, " ")
+}
+
+// canonicalValueListType respells an enum or set type with a lower-cased name
+// and its values single-quoted without spaces. The order of the values is
+// kept: MySQL stores enum values by position, so a reorder is a real change.
+func canonicalValueListType(token string) string {
+	name, rest, ok := strings.Cut(token, "(")
+	if !ok {
+		return strings.ToLower(token)
+	}
+	values := valueListItems(strings.TrimSuffix(rest, ")"))
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = quoteSQLString(v)
+	}
+	return strings.ToLower(name) + "(" + strings.Join(quoted, ",") + ")"
+}
+
+// valueListItems returns the unquoted values of an enum or set value list,
+// whichever quotes and escapes they are written with.
+func valueListItems(list string) []string {
+	if strings.TrimSpace(list) == "" {
+		return nil
+	}
+	items := make([]string, 0)
+	var b strings.Builder
+	var quote byte
+	for i := 0; i < len(list); i++ {
+		c := list[i]
+		switch {
+		case quote != 0 && c == '\\' && i+1 < len(list):
+			i++
+			b.WriteByte(list[i])
+		case quote != 0 && c == quote:
+			if i+1 < len(list) && list[i+1] == quote {
+				i++
+				b.WriteByte(c)
+				continue
+			}
+			quote = 0
+		case quote != 0:
+			b.WriteByte(c)
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ',':
+			items = append(items, b.String())
+			b.Reset()
+		case c != ' ':
+			b.WriteByte(c)
+		}
+	}
+	return append(items, b.String())
+}
+
+func canonicalNumericDefault(value string) string {
+	unquoted := value
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		unquoted = value[1 : len(value)-1]
+	}
+	switch strings.ToLower(unquoted) {
+	case "true":
+		return "1"
+	case "false":
+		return "0"
+	}
+	if decimalLiteralPattern.MatchString(unquoted) {
+		return unquoted
+	}
+	return value
+}
+
+// singleQuotedLiteral respells a double-quoted string literal with single
+// quotes, the way MySQL reports defaults. Other values are returned as is.
+func singleQuotedLiteral(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+	inner := strings.ReplaceAll(value[1:len(value)-1], `""`, `"`)
+	return "'" + strings.ReplaceAll(inner, "'", "''") + "'"
+}
+
+// isExpressionDefault reports whether a DEFAULT value is an expression, which
+// MySQL 8 writes in parentheses.
+func isExpressionDefault(value string) bool {
+	return len(value) >= 2 && value[0] == '(' && value[len(value)-1] == ')'
+}
+
+func canonicalExpressionDefault(value string) string {
+	return "(" + singleQuotedLiteral(strings.TrimSpace(value[1:len(value)-1])) + ")"
+}
+
+// definitionDefault returns the DEFAULT value of a definition, or "" when it
+// has none.
+func definitionDefault(definition string) string {
+	tokens := tokenizeDefinition(definition)
+	for i := 1; i+1 < len(tokens); i++ {
+		if strings.EqualFold(tokens[i], "DEFAULT") {
+			return tokens[i+1]
+		}
+	}
+	return ""
+}
+
+func isBlobOrTextType(baseType string) bool {
+	switch baseType {
+	case "tinyblob", "blob", "mediumblob", "longblob", "tinytext", "text", "mediumtext", "longtext", "json":
+		return true
+	default:
+		return false
+	}
+}
+
+// validateColumnDefault rejects a literal default on a BLOB, TEXT or JSON
+// column; MySQL 8 only accepts an expression default there.
+func validateColumnDefault(table, column, definition string) error {
+	value := definitionDefault(definition)
+	if value == "" || isExpressionDefault(value) || strings.EqualFold(value, "NULL") {
+		return nil
+	}
+	if baseType := columnBaseType(definition); isBlobOrTextType(baseType) {
+		return fmt.Errorf("table `%s` column `%s` has literal default %s, which MySQL does not allow on %s columns; write it as an expression, e.g. default:(%s)", table, column, value, baseType, value)
+	}
+	return nil
+}
+
+func columnDefinitionsEqual(prev, cur string) bool {
+	return canonicalDefinition(prev) == canonicalDefinition(cur)
+}
+
+func isTextualType(baseType string) bool {
+	switch baseType {
+	case "char", "varchar", "tinytext", "text", "mediumtext", "longtext", "enum", "set":
+		return true
+	default:
+		return false
+	}
+}
+
+// definitionCharset returns the explicit CHARACTER SET (or CHARSET) of a
+// column definition, or "" when the column inherits the table default.
+func definitionCharset(definition string) string {
+	tokens := tokenizeDefinition(definition)
+	for i := 1; i < len(tokens); i++ {
+		switch {
+		case strings.EqualFold(tokens[i], "CHARSET") && i+1 < len(tokens):
+			return tokens[i+1]
+		case strings.EqualFold(tokens[i], "CHARACTER") && i+2 < len(tokens) && strings.EqualFold(tokens[i+1], "SET"):
+			return tokens[i+2]
+		}
+	}
+	return ""
+}
+
+// splitSRID removes the SRID attribute of a spatial column from its tokens.
+// MySQL reports it as a versioned comment (/*!80003 SRID 4326 */) after the
+// other attributes, while models usually write a bare SRID 4326 after the
+// type; both spellings are recognized.
+func splitSRID(tokens []string) (string, []string) {
+	srid := ""
+	rest := make([]string, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		if m := versionedSRIDPattern.FindStringSubmatch(tokens[i]); m != nil {
+			srid = m[1]
+			continue
+		}
+		if strings.EqualFold(tokens[i], "SRID") && i+1 < len(tokens) {
+			if _, err := strconv.Atoi(tokens[i+1]); err == nil {
+				srid = tokens[i+1]
+				i++
+				continue
+			}
+		}
+		rest = append(rest, tokens[i])
+	}
+	return srid, rest
+}
+
+func definitionSRID(definition string) string {
+	srid, _ := splitSRID(tokenizeDefinition(definition))
+	return srid
+}
+
+func spatialSRIDClause(srid string) string {
+	return "/*!80003 SRID " + srid + " */"
+}
+
+// generatedColumnStorage reports VIRTUAL or STORED for a generated column and
+// an empty string otherwise. MySQL defaults to VIRTUAL when neither is given.
+func generatedColumnStorage(definition string) string {
+	tokens := tokenizeDefinition(definition)
+	for i := 0; i+1 < len(tokens); i++ {
+		if !strings.EqualFold(tokens[i], "AS") || !strings.HasPrefix(tokens[i+1], "(") {
+			continue
+		}
+		if i+2 < len(tokens) && strings.EqualFold(tokens[i+2], "STORED") {
+			return "STORED"
+		}
+		return "VIRTUAL"
+	}
+	return ""
+}
+
+// stripDefinitionComment removes a COMMENT 'text' attribute from a column
+// definition.
+func stripDefinitionComment(definition string) string {
+	tokens := tokenizeDefinition(definition)
+	out := make([]string, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		if strings.EqualFold(tokens[i], "COMMENT") && i+1 < len(tokens) {
+			i++
+			continue
+		}
+		out = append(out, tokens[i])
+	}
+	return strings.Join(out, " ")
+}
+
+func hasAutoIncrement(definition string) bool {
+	for _, token := range tokenizeDefinition(definition) {
+		if strings.EqualFold(token, "AUTO_INCREMENT") {
+			return true
+		}
+	}
+	return false
+}
+
+func withoutAutoIncrement(definition string) string {
+	tokens := tokenizeDefinition(definition)
+	out := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if !strings.EqualFold(token, "AUTO_INCREMENT") {
+			out = append(out, token)
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+func isNullableDefinition(definition string) bool {
+	tokens := tokenizeDefinition(definition)
+	for i := 0; i+1 < len(tokens); i++ {
+		if strings.EqualFold(tokens[i], "NOT") && strings.EqualFold(tokens[i+1], "NULL") {
+			return false
+		}
+	}
+	return true
+}
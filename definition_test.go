@@ -0,0 +1,422 @@
+package gomigration
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type booleanDefaultModel struct {
+	ID       uint `gorm:"primaryKey"`
+	Enabled  bool `gorm:"default:true"`
+	Archived bool `gorm:"default:false"`
+}
+
+func (booleanDefaultModel) TableName() string { return "boolean_default_models" }
+
+func TestTokenizeDefinition(t *testing.T) {
+	got := tokenizeDefinition("enum('a', 'b c') NOT NULL DEFAULT 'it''s x' COMMENT \"q\" /*!80003 SRID 4326 */")
+	want := []string{"enum('a', 'b c')", "NOT", "NULL", "DEFAULT", "'it''s x'", "COMMENT", "\"q\"", "/*!80003 SRID 4326 */"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected tokens.\nwant=%q\ngot=%q", want, got)
+	}
+}
+
+func TestBooleanDefaultsCompareEqualAcrossQuoting(t *testing.T) {
+	state, err := buildCurrentState([]any{&booleanDefaultModel{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState failed: %v", err)
+	}
+	modelTable := state.Tables["boolean_default_models"]
+
+	// The same table as a live MySQL server would report it.
+	dbTable := tableState{
+		Columns: map[string]columnState{
+			"id":       modelTable.Columns["id"],
+			"enabled":  {Definition: "tinyint(1) DEFAULT '1'"},
+			"archived": {Definition: "tinyint(1) DEFAULT '0'"},
+		},
+		PrimaryKeys: modelTable.PrimaryKeys,
+	}
+	if ops := diffTable("boolean_default_models", dbTable, modelTable); len(ops) != 0 {
+		t.Fatalf("expected no churn between quoted and unquoted boolean defaults, got %#v", ops)
+	}
+
+	flipped := tableState{
+		Columns: map[string]columnState{
+			"id":       modelTable.Columns["id"],
+			"enabled":  {Definition: "tinyint(1) DEFAULT '0'"},
+			"archived": {Definition: "tinyint(1) DEFAULT '0'"},
+		},
+		PrimaryKeys: modelTable.PrimaryKeys,
+	}
+	if ops := diffTable("boolean_default_models", flipped, modelTable); len(ops) != 1 {
+		t.Fatalf("expected one modify for a real default change, got %d", len(ops))
+	}
+}
+
+func TestCanonicalDefinition(t *testing.T) {
+	cases := map[string]string{
+		"boolean DEFAULT true":             "tinyint(1) DEFAULT 1",
+		"tinyint(1) DEFAULT '0'":           "tinyint(1) DEFAULT 0",
+		"bigint  NOT NULL DEFAULT '42'":    "bigint NOT NULL DEFAULT 42",
+		"varchar(8) DEFAULT '0'":           "varchar(8) DEFAULT '0'",
+		"decimal(10,2) DEFAULT '1.50'":     "decimal(10,2) DEFAULT 1.50",
+		"point SRID 4326 NOT NULL":         "point NOT NULL /*!80003 SRID 4326 */",
+		"varchar(8) NOT NULL DEFAULT \"\"": "varchar(8) NOT NULL DEFAULT ''",
+		"varchar(8) DEFAULT \"it's\"":      "varchar(8) DEFAULT 'it''s'",
+		"varchar(8) DEFAULT ''":            "varchar(8) DEFAULT ''",
+		"text DEFAULT ( \"a  b\" )":        "text DEFAULT ('a  b')",
+		"json DEFAULT (json_array())":      "json DEFAULT (json_array())",
+		"ENUM('a', 'b c') NOT NULL":        "enum('a','b c') NOT NULL",
+		"enum(\"it's\",'x''y')":            "enum('it''s','x''y')",
+		"set( 'r','w' ) DEFAULT 'r'":       "set('r','w') DEFAULT 'r'",
+	}
+	for in, want := range cases {
+		if got := canonicalDefinition(in); got != want {
+			t.Fatalf("canonicalDefinition(%q) mismatch: want=%q got=%q", in, want, got)
+		}
+	}
+}
+
+func TestDiffTableEnumValues(t *testing.T) {
+	table := func(definition string) tableState {
+		return tableState{Columns: map[string]columnState{"status": {Definition: definition}}}
+	}
+	prev := table("enum('a','b') NOT NULL DEFAULT 'a'")
+
+	if ops := diffTable("orders", prev, table(`ENUM("a", "b") NOT NULL DEFAULT 'a'`)); len(ops) != 0 {
+		t.Fatalf("expected no ops for a respelled enum, got %#v", ops)
+	}
+
+	ops := diffTable("orders", prev, table("enum('a','b','c') NOT NULL DEFAULT 'a'"))
+	if len(ops) != 1 || ops[0].typeChange != TypeWiden ||
+		ops[0].up != "ALTER TABLE `orders` MODIFY COLUMN `status` enum('a','b','c') NOT NULL DEFAULT 'a';" {
+		t.Fatalf("expected a widening modify for an added enum value, got %#v", ops)
+	}
+
+	ops = diffTable("orders", prev, table("enum('b','a') NOT NULL DEFAULT 'a'"))
+	if len(ops) != 1 || ops[0].up != "ALTER TABLE `orders` MODIFY COLUMN `status` enum('b','a') NOT NULL DEFAULT 'a';" ||
+		ops[0].down != "ALTER TABLE `orders` MODIFY COLUMN `status` enum('a','b') NOT NULL DEFAULT 'a';" {
+		t.Fatalf("expected a modify for reordered enum values, got %#v", ops)
+	}
+}
+
+func TestDiffTableUsesCustomColumnComparator(t *testing.T) {
+	prev := tableState{Columns: map[string]columnState{
+		"name": {Definition: "varchar(64) COMMENT 'old'"},
+		"age":  {Definition: "int"},
+	}}
+	cur := tableState{Columns: map[string]columnState{
+		"name": {Definition: "varchar(64) COMMENT 'new'"},
+		"age":  {Definition: "bigint"},
+	}}
+	if ops := diffTable("people", prev, cur); len(ops) != 2 {
+		t.Fatalf("expected the default comparator to see both changes, got %d ops", len(ops))
+	}
+
+	ignoreComments := func(prev, cur string) bool {
+		strip := func(def string) string {
+			tokens := tokenizeDefinition(def)
+			out := make([]string, 0, len(tokens))
+			for i := 0; i < len(tokens); i++ {
+				if strings.EqualFold(tokens[i], "COMMENT") {
+					i++
+					continue
+				}
+				out = append(out, tokens[i])
+			}
+			return strings.Join(out, " ")
+		}
+		return columnDefinitionsEqual(strip(prev), strip(cur))
+	}
+	ops := diffTableWithOptions("people", prev, cur, Options{ColumnEqual: ignoreComments})
+	if len(ops) != 1 || ops[0].up != "ALTER TABLE `people` MODIFY COLUMN `age` bigint;" {
+		t.Fatalf("expected only the age modify with a comment-blind comparator, got %#v", ops)
+	}
+}
+
+type spatialModel struct {
+	ID       uint   `gorm:"primaryKey"`
+	Location string `gorm:"type:point SRID 4326;not null"`
+}
+
+func (spatialModel) TableName() string { return "spatial_models" }
+
+func TestSpatialSRIDComparesStably(t *testing.T) {
+	state, err := buildCurrentState([]any{&spatialModel{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState failed: %v", err)
+	}
+	modelTable := state.Tables["spatial_models"]
+	if got := definitionSRID(modelTable.Columns["location"].Definition); got != "4326" {
+		t.Fatalf("expected SRID 4326, got %q", got)
+	}
+
+	// MySQL reports the SRID as a versioned comment after the other attributes.
+	dbTable := tableState{
+		Columns: map[string]columnState{
+			"id":       modelTable.Columns["id"],
+			"location": {Definition: "point NOT NULL /*!80003 SRID 4326 */"},
+		},
+		PrimaryKeys: modelTable.PrimaryKeys,
+	}
+	if ops := diffTable("spatial_models", dbTable, modelTable); len(ops) != 0 {
+		t.Fatalf("expected no churn between SRID spellings, got %#v", ops)
+	}
+
+	dbTable.Columns["location"] = columnState{Definition: "point NOT NULL /*!80003 SRID 0 */"}
+	if ops := diffTable("spatial_models", dbTable, modelTable); len(ops) != 1 {
+		t.Fatalf("expected one modify for an SRID change, got %#v", ops)
+	}
+}
+
+func TestSRIDNoteAnnotation(t *testing.T) {
+	state, err := buildCurrentState([]any{&spatialModel{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState failed: %v", err)
+	}
+	table := state.Tables["spatial_models"]
+	if create := createTableSQL("spatial_models", table); strings.HasPrefix(create, "--") {
+		t.Fatalf("expected no note without AnnotateSRID, got: %s", create)
+	}
+	create := createTableSQLWithOptions("spatial_models", table, Options{AnnotateSRID: true})
+	if !strings.HasPrefix(create, "-- requires spatial reference system(s) 4326 ") {
+		t.Fatalf("expected SRID note before CREATE TABLE, got: %s", create)
+	}
+
+	prev := tableState{Columns: map[string]columnState{"id": table.Columns["id"]}, PrimaryKeys: table.PrimaryKeys}
+	ops := diffTableWithOptions("spatial_models", prev, table, Options{AnnotateSRID: true})
+	if len(ops) != 1 || !strings.HasPrefix(ops[0].up, "-- requires spatial reference system(s) 4326 ") {
+		t.Fatalf("expected SRID note before ADD COLUMN, got %#v", ops)
+	}
+	if stmts := splitSQLStatements(ops[0].up); len(stmts) != 1 || strings.HasPrefix(stmts[0], "--") {
+		t.Fatalf("expected the note to be skipped when applying, got %q", stmts)
+	}
+}
+
+func TestGeneratedColumnStorage(t *testing.T) {
+	cases := map[string]string{
+		"varchar(255) GENERATED ALWAYS AS (concat(a,b)) STORED":  "STORED",
+		"varchar(255) GENERATED ALWAYS AS (concat(a,b)) VIRTUAL": "VIRTUAL",
+		"int AS (a + 1) NOT NULL":                                "VIRTUAL",
+		"varchar(255) NOT NULL DEFAULT 'AS'":                     "",
+	}
+	for in, want := range cases {
+		if got := generatedColumnStorage(in); got != want {
+			t.Fatalf("generatedColumnStorage(%q) mismatch: want=%q got=%q", in, want, got)
+		}
+	}
+}
+
+func TestDiffTableGeneratedStorageChangeRecreatesColumn(t *testing.T) {
+	virtual := tableState{Columns: map[string]columnState{
+		"full_name": {Definition: "varchar(255) GENERATED ALWAYS AS (concat(first,last)) VIRTUAL"},
+	}}
+	stored := tableState{Columns: map[string]columnState{
+		"full_name": {Definition: "varchar(255) GENERATED ALWAYS AS (concat(first,last)) STORED"},
+	}}
+	drop := "ALTER TABLE `people` DROP COLUMN `full_name`;"
+	addVirtual := "ALTER TABLE `people` ADD COLUMN `full_name` varchar(255) GENERATED ALWAYS AS (concat(first,last)) VIRTUAL;"
+	addStored := "ALTER TABLE `people` ADD COLUMN `full_name` varchar(255) GENERATED ALWAYS AS (concat(first,last)) STORED;"
+
+	ops := diffTable("people", virtual, stored)
+	if len(ops) != 1 {
+		t.Fatalf("expected one op, got %#v", ops)
+	}
+	if ops[0].up != drop+"\n"+addStored || ops[0].down != drop+"\n"+addVirtual {
+		t.Fatalf("unexpected VIRTUAL to STORED op: %#v", ops[0])
+	}
+
+	ops = diffTable("people", stored, virtual)
+	if len(ops) != 1 {
+		t.Fatalf("expected one op, got %#v", ops)
+	}
+	if ops[0].up != drop+"\n"+addVirtual || ops[0].down != drop+"\n"+addStored {
+		t.Fatalf("unexpected STORED to VIRTUAL op: %#v", ops[0])
+	}
+}
+
+func TestStripDefinitionComment(t *testing.T) {
+	cases := map[string]string{
+		"varchar(64) NOT NULL COMMENT 'it''s a name'": "varchar(64) NOT NULL",
+		"varchar(64) COMMENT 'x' DEFAULT 'y'":         "varchar(64) DEFAULT 'y'",
+		"varchar(64) DEFAULT 'COMMENT'":               "varchar(64) DEFAULT 'COMMENT'",
+	}
+	for in, want := range cases {
+		if got := stripDefinitionComment(in); got != want {
+			t.Fatalf("stripDefinitionComment(%q) mismatch: want=%q got=%q", in, want, got)
+		}
+	}
+}
+
+type emptyDefaultModel struct {
+	ID   uint   `gorm:"primaryKey"`
+	Code string `gorm:"size:32;not null;default:''"`
+	Note string `gorm:"size:32"`
+}
+
+func (emptyDefaultModel) TableName() string { return "empty_default_models" }
+
+func TestCanonicalNumericDefault(t *testing.T) {
+	cases := map[string]string{
+		"'1'":      "1",
+		"'-1.5'":   "-1.5",
+		"'.5'":     ".5",
+		"'1e3'":    "1e3",
+		"'true'":   "1",
+		"'inf'":    "'inf'",
+		"'NaN'":    "'NaN'",
+		"'0x1p-2'": "'0x1p-2'",
+		"'1_000'":  "'1_000'",
+		"'abc'":    "'abc'",
+	}
+	for in, want := range cases {
+		if got := canonicalNumericDefault(in); got != want {
+			t.Fatalf("canonicalNumericDefault(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestEmptyStringDefaultIsStable(t *testing.T) {
+	state, err := buildCurrentState([]any{&emptyDefaultModel{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState failed: %v", err)
+	}
+	table := state.Tables["empty_default_models"]
+	if got := table.Columns["code"].Definition; got != "varchar(32) NOT NULL DEFAULT ''" {
+		t.Fatalf("expected the empty default to be kept, got %q", got)
+	}
+	if strings.Contains(table.Columns["note"].Definition, "DEFAULT") {
+		t.Fatalf("expected no default on note, got %q", table.Columns["note"].Definition)
+	}
+
+	dir := t.TempDir()
+	if _, err := MakeMigrations([]any{&emptyDefaultModel{}}, dir, "init", ""); err != nil {
+		t.Fatalf("MakeMigrations failed: %v", err)
+	}
+	result, err := MakeMigrations([]any{&emptyDefaultModel{}}, dir, "again", "")
+	if err != nil {
+		t.Fatalf("MakeMigrations failed: %v", err)
+	}
+	if result.Changed {
+		t.Fatalf("expected no churn on the second generation")
+	}
+
+	noDefault := table
+	noDefault.Columns = map[string]columnState{
+		"id":   table.Columns["id"],
+		"code": {Definition: "varchar(32) NOT NULL"},
+		"note": table.Columns["note"],
+	}
+	ops := diffTable("empty_default_models", noDefault, table)
+	if len(ops) != 1 || ops[0].up != "ALTER TABLE `empty_default_models` ALTER COLUMN `code` SET DEFAULT '';" {
+		t.Fatalf("expected an empty default to differ from no default, got %#v", ops)
+	}
+}
+
+type textExpressionDefaultModel struct {
+	ID    uint   `gorm:"primaryKey"`
+	Notes string `gorm:"type:text;default:('none  yet')"`
+	Data  []byte `gorm:"type:blob;default:(_utf8mb4'{}')"`
+}
+
+func (textExpressionDefaultModel) TableName() string { return "text_expression_default_models" }
+
+type textLiteralDefaultModel struct {
+	ID    uint   `gorm:"primaryKey"`
+	Notes string `gorm:"type:text;default:'none'"`
+}
+
+func (textLiteralDefaultModel) TableName() string { return "text_literal_default_models" }
+
+func TestDiffTableDefaultOnlyChange(t *testing.T) {
+	table := func(def string) tableState {
+		return tableState{Columns: map[string]columnState{"retries": {Definition: def}}}
+	}
+	zero, one := table("int NOT NULL DEFAULT 0"), table("int NOT NULL DEFAULT '1'")
+
+	ops := diffTable("jobs", zero, one)
+	if len(ops) != 1 || ops[0].kind != opChangeDefault ||
+		ops[0].up != "ALTER TABLE `jobs` ALTER COLUMN `retries` SET DEFAULT '1';" ||
+		ops[0].down != "ALTER TABLE `jobs` ALTER COLUMN `retries` SET DEFAULT 0;" {
+		t.Fatalf("expected a default-only change, got %#v", ops)
+	}
+	ops = diffTable("jobs", table("int NOT NULL"), one)
+	if len(ops) != 1 || ops[0].up != "ALTER TABLE `jobs` ALTER COLUMN `retries` SET DEFAULT '1';" ||
+		ops[0].down != "ALTER TABLE `jobs` ALTER COLUMN `retries` DROP DEFAULT;" {
+		t.Fatalf("expected an added default, got %#v", ops)
+	}
+
+	// Any other change, or an expression default, still needs MODIFY.
+	for _, def := range []string{"bigint NOT NULL DEFAULT 1", "int DEFAULT 1", "int NOT NULL DEFAULT (1 + 1)"} {
+		ops = diffTable("jobs", zero, table(def))
+		if len(ops) != 1 || ops[0].kind != opModifyColumn {
+			t.Fatalf("%s: expected MODIFY COLUMN, got %#v", def, ops)
+		}
+	}
+	// ALTER COLUMN SET DEFAULT takes no function defaults.
+	created := func(def string) tableState {
+		return tableState{Columns: map[string]columnState{"created_at": {Definition: def}}}
+	}
+	for _, def := range []string{"CURRENT_TIMESTAMP(3)", "CURRENT_TIMESTAMP", "NOW()", "LOCALTIME"} {
+		ops = diffTable("t", created("datetime(3) NULL"), created("datetime(3) NULL DEFAULT "+def))
+		if len(ops) != 1 || ops[0].kind != opModifyColumn {
+			t.Fatalf("DEFAULT %s: expected MODIFY COLUMN, got %#v", def, ops)
+		}
+		ops = diffTable("t", created("datetime(3) NULL DEFAULT "+def), created("datetime(3) NULL"))
+		if len(ops) != 1 || ops[0].kind != opModifyColumn {
+			t.Fatalf("dropping DEFAULT %s: expected MODIFY COLUMN, got %#v", def, ops)
+		}
+	}
+	ops = diffTable("t", created("datetime(3) NULL"), created("datetime(3) NULL DEFAULT NULL"))
+	if len(ops) != 1 || ops[0].kind != opChangeDefault {
+		t.Fatalf("expected DEFAULT NULL to stay a default-only change, got %#v", ops)
+	}
+	if ops = diffTableWithOptions("jobs", zero, one, Options{Dialect: DialectPostgres}); len(ops) != 1 || ops[0].kind != opModifyColumn {
+		t.Fatalf("expected Postgres to keep its ALTER COLUMN form, got %#v", ops)
+	}
+	prevState := schemaState{Tables: map[string]tableState{"jobs": zero}}
+	curState := schemaState{Tables: map[string]tableState{"jobs": one}}
+	if err := verifyMigrationOps(prevState, curState, diffSchemas(prevState, curState, Options{}), Options{}); err != nil {
+		t.Fatalf("unexpected self-check failure: %v", err)
+	}
+}
+
+func TestTextExpressionDefaultIsStable(t *testing.T) {
+	state, err := buildCurrentState([]any{&textExpressionDefaultModel{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState failed: %v", err)
+	}
+	table := state.Tables["text_expression_default_models"]
+	if got := table.Columns["notes"].Definition; got != "text DEFAULT ('none  yet')" {
+		t.Fatalf("expected the expression default to be kept verbatim, got %q", got)
+	}
+	if got := table.Columns["data"].Definition; got != "blob DEFAULT (_utf8mb4'{}')" {
+		t.Fatalf("unexpected blob definition %q", got)
+	}
+
+	spaced := table
+	spaced.Columns = map[string]columnState{
+		"id":    table.Columns["id"],
+		"notes": {Definition: `text DEFAULT ( "none  yet" )`},
+		"data":  table.Columns["data"],
+	}
+	if ops := diffTable("text_expression_default_models", spaced, table); len(ops) != 0 {
+		t.Fatalf("expected no churn for an equivalent expression default, got %#v", ops)
+	}
+	spaced.Columns["notes"] = columnState{Definition: "text DEFAULT ('none yet')"}
+	if ops := diffTable("text_expression_default_models", spaced, table); len(ops) != 1 {
+		t.Fatalf("expected a changed expression default to be diffed, got %#v", ops)
+	}
+}
+
+func TestTextLiteralDefaultIsRejected(t *testing.T) {
+	_, err := buildCurrentState([]any{&textLiteralDefaultModel{}})
+	if err == nil || !strings.Contains(err.Error(), "column `notes` has literal default 'none'") {
+		t.Fatalf("expected a literal TEXT default to be rejected, got %v", err)
+	}
+	if _, err := buildCurrentStateWithOptions([]any{&textLiteralDefaultModel{}}, Options{Dialect: DialectPostgres}); err != nil {
+		t.Fatalf("expected Postgres to accept a literal text default, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package gomigration
+
+import (
+	"fmt"
+	"strings"
+)
+
+const deprecatedTablePrefix = "_deprecated_"
+
+// mysqlMaxIdentifierLength is the longest identifier MySQL accepts.
+const mysqlMaxIdentifierLength = 64
+
+// withDeprecatedTables returns the state to migrate to when
+// Options.DeprecateBeforeDrop is set: tables removed from the models since
+// previous are kept under a _deprecated_ name. Tables that were already
+// deprecated stay until they are listed in Options.DropDeprecatedTables, or
+// are renamed back when their model returns.
+func withDeprecatedTables(previous, current schemaState, opts Options) (schemaState, error) {
+	out := schemaState{Tables: make(map[string]tableState, len(current.Tables))}
+	for name, table := range current.Tables {
+		out.Tables[name] = table
+	}
+	drop := map[string]bool{}
+	for _, name := range opts.DropDeprecatedTables {
+		drop[strings.TrimPrefix(strings.TrimSpace(name), deprecatedTablePrefix)] = true
+	}
+	for _, name := range sortedKeys(previous.Tables) {
+		if _, kept := current.Tables[name]; kept {
+			continue
+		}
+		if original, ok := strings.CutPrefix(name, deprecatedTablePrefix); ok {
+			if _, returned := current.Tables[original]; !returned && !drop[original] {
+				out.Tables[name] = previous.Tables[name]
+			}
+			continue
+		}
+		deprecated := deprecatedTablePrefix + name
+		if limit := opts.maxIdentifierLength(); limit > 0 && identifierLength(deprecated) > limit {
+			return schemaState{}, fmt.Errorf("cannot deprecate table `%s`: `%s` exceeds %d characters", name, deprecated, limit)
+		}
+		if _, exists := current.Tables[deprecated]; exists {
+			return schemaState{}, fmt.Errorf("cannot deprecate table `%s`: a model already uses `%s`", name, deprecated)
+		}
+		out.Tables[deprecated] = previous.Tables[name]
+	}
+	return out, nil
+}
+
+// deprecationRenames pairs tables that only exist in previous with tables
+// that only exist in current and differ from them by the _deprecated_
+// prefix: a table being deprecated, or a deprecated table whose model came
+// back. The result maps the previous name to the current one.
+func deprecationRenames(previous, current schemaState) map[string]string {
+	renames := map[string]string{}
+	for _, name := range sortedKeys(previous.Tables) {
+		if _, ok := current.Tables[name]; ok {
+			continue
+		}
+		target := deprecatedTablePrefix + name
+		if restored, ok := strings.CutPrefix(name, deprecatedTablePrefix); ok {
+			target = restored
+		}
+		if _, inPrevious := previous.Tables[target]; inPrevious {
+			continue
+		}
+		if _, ok := current.Tables[target]; ok {
+			renames[name] = target
+		}
+	}
+	return renames
+}
+
+func renameTableOp(from, to string, opts Options) migrationOp {
+	em := opts.emitter()
+	return migrationOp{
+		kind:  opRenameTable,
+		table: to,
+		name:  to,
+		up:    em.RenameTable(from, to),
+		down:  em.RenameTable(to, from),
+		apply: func(tables map[string]tableState) {
+			tables[to] = tables[from]
+			delete(tables, from)
+			for _, table := range tables {
+				renameReferencedTable(table, from, to)
+			}
+		},
+	}
+}
@@ -0,0 +1,108 @@
+package gomigration
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// readMigration returns the SQL of a written migration file without the
+// operation markers Apply pairs its blocks by.
+func readMigration(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s failed: %v", path, err)
+	}
+	lines := make([]string, 0)
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, operationMarker) {
+			lines = append(lines, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func TestMakeMigrationsDeprecateBeforeDrop(t *testing.T) {
+	dir := t.TempDir()
+	both := []any{&e2eUserNoJoin{}, &e2eGroupNoJoin{}}
+	usersOnly := []any{&e2eUserNoJoin{}}
+	if _, err := SyncSchemaState(both, dir, ""); err != nil {
+		t.Fatalf("SyncSchemaState failed: %v", err)
+	}
+	opts := Options{DeprecateBeforeDrop: true}
+
+	opts.Version = "20240101000000"
+	result, err := MakeMigrationsWithOptions(usersOnly, dir, "remove_groups", "", opts)
+	if err != nil {
+		t.Fatalf("deprecate failed: %v", err)
+	}
+	if up := readMigration(t, result.UpPath); up != "RENAME TABLE `e2e_groups` TO `_deprecated_e2e_groups`;" {
+		t.Fatalf("unexpected deprecate up SQL: %s", up)
+	}
+	if down := readMigration(t, result.DownPath); down != "RENAME TABLE `_deprecated_e2e_groups` TO `e2e_groups`;" {
+		t.Fatalf("unexpected deprecate down SQL: %s", down)
+	}
+	state, err := loadState(result.StatePath)
+	if err != nil {
+		t.Fatalf("loadState failed: %v", err)
+	}
+	if _, ok := state.Tables["_deprecated_e2e_groups"]; !ok {
+		t.Fatalf("expected the deprecated table in the saved state, got %v", sortedKeys(state.Tables))
+	}
+
+	opts.Version = "20240102000000"
+	result, err = MakeMigrationsWithOptions(both, dir, "restore_groups", "", opts)
+	if err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if up := readMigration(t, result.UpPath); up != "RENAME TABLE `_deprecated_e2e_groups` TO `e2e_groups`;" {
+		t.Fatalf("expected a returning model to rename the table back, got: %s", up)
+	}
+
+	opts.Version = "20240103000000"
+	if _, err := MakeMigrationsWithOptions(usersOnly, dir, "remove_groups_again", "", opts); err != nil {
+		t.Fatalf("second deprecate failed: %v", err)
+	}
+	opts.Version = "20240104000000"
+	result, err = MakeMigrationsWithOptions(usersOnly, dir, "keep_groups", "", opts)
+	if err != nil {
+		t.Fatalf("keep failed: %v", err)
+	}
+	if result.Changed {
+		t.Fatalf("expected the deprecated table to stay until it is listed in DropDeprecatedTables")
+	}
+	opts.DropDeprecatedTables = []string{"e2e_groups"}
+	result, err = MakeMigrationsWithOptions(usersOnly, dir, "drop_groups", "", opts)
+	if err != nil {
+		t.Fatalf("drop failed: %v", err)
+	}
+	if up := readMigration(t, result.UpPath); up != "DROP TABLE IF EXISTS `_deprecated_e2e_groups`;" {
+		t.Fatalf("expected the deprecated table to be dropped, got: %s", up)
+	}
+	if down := readMigration(t, result.DownPath); !strings.HasPrefix(down, "CREATE TABLE `_deprecated_e2e_groups`") {
+		t.Fatalf("expected the down to recreate the deprecated table, got: %s", down)
+	}
+
+	opts.Version = "20240105000000"
+	result, err = MakeMigrationsWithOptions(usersOnly, dir, "noop", "", opts)
+	if err != nil {
+		t.Fatalf("final run failed: %v", err)
+	}
+	if result.Changed {
+		t.Fatalf("expected no changes once the deprecated table is gone")
+	}
+}
+
+func TestWithDeprecatedTablesUsesTheDialectLengthLimit(t *testing.T) {
+	name := strings.Repeat("t", 52)
+	previous := schemaState{Tables: map[string]tableState{name: {Columns: map[string]columnState{"id": {Definition: "bigint"}}}}}
+	current := schemaState{Tables: map[string]tableState{}}
+	if _, err := withDeprecatedTables(previous, current, Options{}); err != nil {
+		t.Fatalf("expected a 64 character name to fit MySQL, got %v", err)
+	}
+	_, err := withDeprecatedTables(previous, current, Options{Dialect: DialectPostgres})
+	if err == nil || !strings.Contains(err.Error(), "exceeds 63 characters") {
+		t.Fatalf("expected the Postgres limit to apply, got %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package gomigration
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+type Dialect string
+
+const (
+	DialectMySQL    Dialect = "mysql"
+	DialectPostgres Dialect = "postgres"
+	// DialectVitess is MySQL behind Vitess; see VitessEmitter.
+	DialectVitess Dialect = "vitess"
+	DialectSQLite Dialect = "sqlite"
+)
+
+// isMySQL reports whether the dialect speaks MySQL DDL.
+func (d Dialect) isMySQL() bool {
+	return d == "" || d == DialectMySQL || d == DialectVitess
+}
+
+func validateDialect(dialect Dialect) error {
+	switch dialect {
+	case "", DialectMySQL, DialectPostgres, DialectVitess, DialectSQLite:
+		return nil
+	default:
+		return fmt.Errorf("unsupported dialect %q", dialect)
+	}
+}
+
+var operatorClassPattern = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*\.)?[A-Za-z_][A-Za-z0-9_]*_ops$`)
+
+// isOperatorClass reports whether an index option is a bare Postgres operator
+// class such as gin_trgm_ops, which belongs inside the field list rather than
+// after it.
+func isOperatorClass(option string) bool {
+	return operatorClassPattern.MatchString(strings.TrimSpace(option))
+}
+
+// applyIndexOperatorClasses gives each index field the operator class its
+// own tag declares as the option. GORM keeps only the first option it sees
+// for the whole index, which would put that class on every field of a
+// composite index.
+func applyIndexOperatorClasses(table *tableState, stmt *gorm.Statement) error {
+	sc := stmt.Schema
+	namer := stmt.DB.Config.NamingStrategy
+	if namer == nil {
+		namer = schema.NamingStrategy{}
+	}
+	for _, field := range sc.Fields {
+		decls, err := parseFieldIndexTagDecls(sc.Table, field, namer)
+		if err != nil {
+			return err
+		}
+		for _, decl := range decls {
+			idx, ok := table.Indexes[decl.Name]
+			if !ok || !isOperatorClass(decl.Option) {
+				continue
+			}
+			for i, f := range idx.Fields {
+				if (decl.Expression != "" && f.Expression == decl.Expression) || (decl.Expression == "" && f.Column == decl.Column) {
+					idx.Fields[i].OpClass = decl.Option
+				}
+			}
+			table.Indexes[decl.Name] = idx
+		}
+	}
+	for name, idx := range table.Indexes {
+		if isOperatorClass(idx.Option) {
+			idx.Option = ""
+			table.Indexes[name] = idx
+		}
+	}
+	return nil
+}
+
+// validateIndexOperatorClasses rejects operator classes outside Postgres,
+// whose index syntax has no place for them.
+func validateIndexOperatorClasses(tableName string, table tableState, dialect Dialect) error {
+	if dialect == DialectPostgres {
+		return nil
+	}
+	for _, name := range sortedKeys(table.Indexes) {
+		for _, f := range table.Indexes[name].Fields {
+			if f.OpClass != "" {
+				return fmt.Errorf("table `%s` index `%s` uses operator class %q, which is only supported for Postgres migrations", tableName, name, f.OpClass)
+			}
+		}
+	}
+	return nil
+}
+
+func quoteIdentifier(dialect Dialect, name string) string {
+	name = strings.TrimSpace(name)
+	if dialect == DialectPostgres || dialect == DialectSQLite {
+		return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+	}
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func createPostgresIndexSQL(tableName, indexName string, idx indexState, q QuoteMode, ifNotExists bool) string {
+	idx = normalizeIndex(idx)
+	prefix := ""
+	if idx.Class == "UNIQUE" {
+		prefix = "UNIQUE "
+	}
+	sql := fmt.Sprintf("CREATE %sINDEX %s%s ON %s", prefix, ifNotExistsClause(ifNotExists), q.quoteFor(DialectPostgres, indexName), quotePostgresTable(q, tableName))
+	if idx.Type != "" {
+		sql += " USING " + idx.Type
+	}
+	parts := make([]string, 0, len(idx.Fields))
+	for _, field := range idx.Fields {
+		parts = append(parts, postgresIndexFieldSQL(field, q))
+	}
+	sql += " (" + strings.Join(parts, ", ") + ")"
+	if idx.Option != "" {
+		sql += " " + idx.Option
+	}
+	if idx.Tablespace != "" {
+		sql += " TABLESPACE " + q.quoteFor(DialectPostgres, idx.Tablespace)
+	}
+	if idx.Where != "" {
+		sql += " WHERE " + idx.Where
+	}
+	return sql + ";"
+}
+
+func postgresIndexFieldSQL(field indexFieldState, q QuoteMode) string {
+	var base string
+	if field.Expression != "" {
+		base = "(" + field.Expression + ")"
+	} else {
+		base = q.quoteFor(DialectPostgres, field.Column)
+	}
+	if field.Collate != "" {
+		base += " COLLATE " + quoteIdentifier(DialectPostgres, field.Collate)
+	}
+	if field.OpClass != "" {
+		base += " " + field.OpClass
+	}
+	if field.Sort != "" {
+		base += " " + field.Sort
+	}
+	return base
+}
+
+func dialectOf(db *gorm.DB) Dialect {
+	if db == nil || db.Dialector == nil {
+		return DialectMySQL
+	}
+	switch db.Dialector.Name() {
+	case "postgres":
+		return DialectPostgres
+	case "sqlite":
+		return DialectSQLite
+	default:
+		return DialectMySQL
+	}
+}
+
+func maxIndexFields(dialect Dialect) int {
+	switch dialect {
+	case DialectPostgres:
+		return 32
+	case DialectSQLite:
+		return 2000
+	default:
+		return 16
+	}
+}
@@ -0,0 +1,104 @@
+package gomigration
+
+import (
+	"strings"
+	"testing"
+)
+
+type trigramIndexModel struct {
+	ID   uint   `gorm:"primaryKey"`
+	Name string `gorm:"index:idx_trigram_name,type:gin,option:gin_trgm_ops"`
+}
+
+func (trigramIndexModel) TableName() string { return "trigram_models" }
+
+type compositeOperatorClassModel struct {
+	ID    uint   `gorm:"primaryKey"`
+	Name  string `gorm:"index:idx_search,type:gin,option:gin_trgm_ops"`
+	Email string `gorm:"index:idx_search"`
+	Code  string `gorm:"index:idx_search,option:text_pattern_ops"`
+}
+
+func (compositeOperatorClassModel) TableName() string { return "searches" }
+
+func TestBuildCurrentStateCapturesOperatorClass(t *testing.T) {
+	state, err := buildCurrentStateWithOptions([]any{&trigramIndexModel{}}, Options{Dialect: DialectPostgres})
+	if err != nil {
+		t.Fatalf("buildCurrentState failed: %v", err)
+	}
+	idx, ok := state.Tables["trigram_models"].Indexes["idx_trigram_name"]
+	if !ok {
+		t.Fatalf("expected index idx_trigram_name, got %#v", state.Tables["trigram_models"].Indexes)
+	}
+	if idx.Option != "" {
+		t.Fatalf("expected operator class to be moved out of the index option, got %q", idx.Option)
+	}
+	if len(idx.Fields) != 1 || idx.Fields[0].OpClass != "gin_trgm_ops" {
+		t.Fatalf("expected field op class gin_trgm_ops, got %#v", idx.Fields)
+	}
+
+	got := createIndexSQLFor(DialectPostgres, "trigram_models", "idx_trigram_name", idx)
+	want := `CREATE INDEX "idx_trigram_name" ON "trigram_models" USING gin ("name" gin_trgm_ops);`
+	if got != want {
+		t.Fatalf("unexpected postgres index SQL.\nwant=%s\ngot=%s", want, got)
+	}
+}
+
+func TestBuildCurrentStateParsesOperatorClassPerField(t *testing.T) {
+	state, err := buildCurrentStateWithOptions([]any{&compositeOperatorClassModel{}}, Options{Dialect: DialectPostgres})
+	if err != nil {
+		t.Fatalf("buildCurrentStateWithOptions failed: %v", err)
+	}
+	idx := state.Tables["searches"].Indexes["idx_search"]
+	got := make([]string, 0, len(idx.Fields))
+	for _, f := range idx.Fields {
+		got = append(got, f.Column+":"+f.OpClass)
+	}
+	if strings.Join(got, ",") != "name:gin_trgm_ops,email:,code:text_pattern_ops" || idx.Option != "" {
+		t.Fatalf("expected an operator class per field, got %v with option %q", got, idx.Option)
+	}
+
+	_, err = buildCurrentState([]any{&trigramIndexModel{}})
+	if err == nil || !strings.Contains(err.Error(), `uses operator class "gin_trgm_ops", which is only supported for Postgres migrations`) {
+		t.Fatalf("expected MySQL to reject the operator class, got %v", err)
+	}
+}
+
+func TestDiffTableRecreatesIndexOnOperatorClassChange(t *testing.T) {
+	prev := tableState{
+		Columns: map[string]columnState{"name": {Definition: "text"}},
+		Indexes: map[string]indexState{
+			"idx_name": {Type: "gin", Fields: []indexFieldState{{Column: "name", OpClass: "gin_trgm_ops"}}},
+		},
+	}
+	cur := tableState{
+		Columns: map[string]columnState{"name": {Definition: "text"}},
+		Indexes: map[string]indexState{
+			"idx_name": {Type: "gin", Fields: []indexFieldState{{Column: "name", OpClass: "gin_bigm_ops"}}},
+		},
+	}
+	ops := diffTable("docs", prev, cur)
+	if len(ops) != 1 {
+		t.Fatalf("expected one index recreate op, got %d", len(ops))
+	}
+	if !strings.Contains(ops[0].up, "DROP INDEX `idx_name`") || !strings.Contains(ops[0].up, "CREATE INDEX `idx_name`") {
+		t.Fatalf("expected drop+create in up SQL, got: %s", ops[0].up)
+	}
+}
+
+func TestIsOperatorClass(t *testing.T) {
+	cases := map[string]bool{
+		"gin_trgm_ops":         true,
+		"public.gin_trgm_ops":  true,
+		"WITH PARSER ngram":    false,
+		"WITH (fillfactor=70)": false,
+		"":                     false,
+		"text_pattern_ops":     true,
+		"gin_trgm_ops DESC":    false,
+	}
+	for in, want := range cases {
+		if got := isOperatorClass(in); got != want {
+			t.Fatalf("isOperatorClass(%q) mismatch: want=%v got=%v", in, want, got)
+		}
+	}
+}
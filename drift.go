@@ -0,0 +1,59 @@
+package gomigration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// VerifyMigrations fails when MakeMigrations would write a migration for
+// models, i.e. the models changed since stateFile was saved. The error lists
+// each pending change with the up statements it would generate. Nothing is
+// written; an empty dir and stateFile resolve as in MakeMigrations.
+func VerifyMigrations(models []any, dir, stateFile string) error {
+	return VerifyMigrationsWithOptions(models, dir, stateFile, Options{})
+}
+
+func VerifyMigrationsWithOptions(models []any, dir, stateFile string, opts Options) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	if strings.TrimSpace(dir) == "" {
+		dir = filepath.Join("database", "migrations")
+	}
+	if strings.TrimSpace(stateFile) == "" {
+		stateFile = filepath.Join(dir, ".schema_state.json")
+	}
+	absStateFile, err := filepath.Abs(stateFile)
+	if err != nil {
+		return err
+	}
+	ops, _, err := planMigration(context.Background(), models, absStateFile, opts)
+	if err != nil {
+		return err
+	}
+	pending := make([]Operation, 0, len(ops))
+	for _, op := range operationsOf(ops) {
+		if strings.TrimSpace(op.Up) != "" {
+			pending = append(pending, op)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "models have %d change(s) not in %s; run MakeMigrations and commit the result:", len(pending), absStateFile)
+	for _, op := range pending {
+		target := op.Table
+		if op.Name != "" && op.Name != op.Table {
+			target += "." + op.Name
+		}
+		fmt.Fprintf(&b, "\n  %s %s:", op.Kind, target)
+		for _, line := range strings.Split(op.Up, "\n") {
+			b.WriteString("\n    " + line)
+		}
+	}
+	return errors.New(b.String())
+}
@@ -0,0 +1,41 @@
+package gomigration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyMigrations(t *testing.T) {
+	dir := t.TempDir()
+	err := VerifyMigrations([]any{&placeBefore{}}, dir, "")
+	if err == nil {
+		t.Fatalf("expected drift without a state file")
+	}
+	if !strings.Contains(err.Error(), "create_table place_people:") || !strings.Contains(err.Error(), "CREATE TABLE `place_people`") {
+		t.Fatalf("expected the pending create table in the error, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("expected VerifyMigrations to write nothing, found %d entries", len(entries))
+	}
+
+	if _, err := MakeMigrations([]any{&placeBefore{}}, dir, "init", ""); err != nil {
+		t.Fatalf("MakeMigrations failed: %v", err)
+	}
+	if err := VerifyMigrations([]any{&placeBefore{}}, dir, ""); err != nil {
+		t.Fatalf("expected no drift after MakeMigrations, got %v", err)
+	}
+
+	err = VerifyMigrations([]any{&placeAfter{}}, dir, filepath.Join(dir, ".schema_state.json"))
+	if err == nil {
+		t.Fatalf("expected drift after the model changed")
+	}
+	assertContainsAll(t, err.Error(), []string{
+		"models have 4 change(s) not in ",
+		"add_column place_people.phone:\n    ALTER TABLE `place_people` ADD COLUMN `phone` varchar(16);",
+		"add_column place_people.title:",
+		"drop_column place_people.alias:",
+		"drop_column place_people.nick:",
+	})
+}
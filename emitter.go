@@ -0,0 +1,424 @@
+package gomigration
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Emitter renders the DDL of each kind of schema change. Every method returns
+// one or more statements terminated by semicolons and separated by newlines.
+//
+// To change how a single kind of change is rendered, embed MySQLEmitter in a
+// struct, override that method and pass the struct as Options.Emitter; every
+// other method keeps the default rendering.
+type Emitter interface {
+	CreateTable(table TableDefinition) string
+	DropTable(table string) string
+	RenameTable(from, to string) string
+	AddColumn(table string, column ColumnDefinition) string
+	ModifyColumn(table string, column ColumnDefinition) string
+	DropColumn(table, column string) string
+	RenameColumn(table, from string, to ColumnDefinition) string
+	CreateIndex(table string, index IndexDefinition) string
+	DropIndex(table, index string) string
+	RenameIndex(table, from, to string) string
+	AddForeignKey(table string, fk ForeignKeyDefinition) string
+	DropForeignKey(table, constraint string) string
+	// ChangePrimaryKey replaces the primary key columns from with to;
+	// either may be empty.
+	ChangePrimaryKey(table string, from, to []string) string
+	// SetColumnDefault sets the literal default of a column, or drops it
+	// when value is empty.
+	SetColumnDefault(table, column, value string) string
+	// SetColumnComment sets column.Comment on a column whose definition is
+	// column.Definition.
+	SetColumnComment(table string, column ColumnDefinition) string
+	// MoveColumn places a column at column.After or column.First.
+	MoveColumn(table string, column ColumnDefinition) string
+	// SetTableCharset changes the default charset, and with it the
+	// collation, of a table.
+	SetTableCharset(table, charset, collation string) string
+	SetTableCollation(table, collation string) string
+	SetTableEngine(table, engine string) string
+	// SetTableComment sets the table comment, or clears it when comment is
+	// empty.
+	SetTableComment(table, comment string) string
+	// SetTableTablespace moves a table to tablespace, or to the default
+	// tablespace when it is empty.
+	SetTableTablespace(table, tablespace string) string
+	SetIndexTablespace(table, index, tablespace string) string
+	// SetAutoIncrement restarts the counter of a table at value. An empty
+	// result means the dialect cannot, and the generator notes that the
+	// counter starts over instead.
+	SetAutoIncrement(table string, value uint64) string
+}
+
+// TableDefinition describes a table to create. Columns are in the order they
+// should be emitted.
+type TableDefinition struct {
+	Name        string
+	Columns     []ColumnDefinition
+	PrimaryKeys []string
+	Indexes     []IndexDefinition
+	// ForeignKeys lists the foreign keys to declare in CREATE TABLE: all of
+	// them for SQLiteEmitter, and those whose referenced table exists by
+	// then with Options.InlineForeignKeys. The others are added with
+	// AddForeignKey once every table exists.
+	ForeignKeys []ForeignKeyDefinition
+	Charset     string
+	Collation   string
+	Tablespace  string
+	Engine      string
+	Comment     string
+}
+
+type ColumnDefinition struct {
+	Name string
+	// Definition is the column type and attributes, e.g. "varchar(64) NOT NULL".
+	Definition string
+	// Note is an SQL comment to place after the column in CREATE TABLE.
+	Note string
+	// Comment is the column comment. MySQL definitions already carry it
+	// as a COMMENT attribute; PostgresEmitter renders it with COMMENT ON.
+	Comment string
+	// After and First place a column that AddColumn adds. They are only set
+	// for MySQL with Options.TrackColumnOrder.
+	After string
+	First bool
+}
+
+type IndexDefinition struct {
+	Name string
+	// Class is empty or one of UNIQUE, FULLTEXT and SPATIAL.
+	Class   string
+	Type    string
+	Where   string
+	Comment string
+	Option  string
+	Fields  []IndexField
+	// Tablespace is only rendered by PostgresEmitter.
+	Tablespace string
+}
+
+type IndexField struct {
+	Column     string
+	Expression string
+	Sort       string
+	Collate    string
+	Length     int
+	// OpClass is a Postgres operator class such as gin_trgm_ops. Only
+	// PostgresEmitter renders it; models that declare one are rejected for
+	// the other dialects.
+	OpClass string
+}
+
+type ForeignKeyDefinition struct {
+	Name       string
+	Columns    []string
+	RefTable   string
+	RefColumns []string
+	OnDelete   string
+	OnUpdate   string
+}
+
+// MySQLEmitter is the default Emitter.
+type MySQLEmitter struct {
+	// QuoteMode selects which identifiers are quoted; the default quotes
+	// all of them.
+	QuoteMode QuoteMode
+	// IfExists guards CREATE TABLE with IF NOT EXISTS. MySQL has no such
+	// guard for adding or dropping columns and indexes.
+	IfExists bool
+}
+
+func ifNotExistsClause(guard bool) string {
+	if guard {
+		return "IF NOT EXISTS "
+	}
+	return ""
+}
+
+func ifExistsClause(guard bool) string {
+	if guard {
+		return "IF EXISTS "
+	}
+	return ""
+}
+
+func (e MySQLEmitter) CreateTable(table TableDefinition) string {
+	defs := make([]string, 0, len(table.Columns)+len(table.Indexes)+1)
+	notes := map[int]string{}
+	for _, col := range table.Columns {
+		if col.Note != "" {
+			notes[len(defs)] = col.Note
+		}
+		defs = append(defs, fmt.Sprintf("  %s %s", e.QuoteMode.quote(col.Name), col.Definition))
+	}
+	if len(table.PrimaryKeys) > 0 {
+		defs = append(defs, fmt.Sprintf("  PRIMARY KEY (%s)", e.QuoteMode.columns(table.PrimaryKeys)))
+	}
+	for _, idx := range table.Indexes {
+		defs = append(defs, "  "+createTableIndexDefinition(idx.Name, idx.state(), e.QuoteMode))
+	}
+	for _, fk := range table.ForeignKeys {
+		defs = append(defs, "  "+e.foreignKeyConstraint(fk))
+	}
+	lines := make([]string, 0, len(defs))
+	for i, def := range defs {
+		if i < len(defs)-1 {
+			def += ","
+		}
+		if note, ok := notes[i]; ok {
+			def += " " + note
+		}
+		lines = append(lines, def)
+	}
+	options := tableOptionsSQL(tableState{Charset: table.Charset, Collation: table.Collation, Engine: table.Engine, Comment: table.Comment})
+	if table.Tablespace != "" {
+		options += " TABLESPACE " + e.QuoteMode.quote(table.Tablespace)
+	}
+	return fmt.Sprintf("CREATE TABLE %s%s (\n%s\n)%s;", ifNotExistsClause(e.IfExists), e.QuoteMode.quote(table.Name), strings.Join(lines, "\n"), options)
+}
+
+func (e MySQLEmitter) DropTable(table string) string {
+	return fmt.Sprintf("DROP TABLE IF EXISTS %s;", e.QuoteMode.quote(table))
+}
+
+func (e MySQLEmitter) RenameTable(from, to string) string {
+	return fmt.Sprintf("RENAME TABLE %s TO %s;", e.QuoteMode.quote(from), e.QuoteMode.quote(to))
+}
+
+func (e MySQLEmitter) AddColumn(table string, column ColumnDefinition) string {
+	placement := ""
+	switch {
+	case column.First:
+		placement = " FIRST"
+	case column.After != "":
+		placement = " AFTER " + e.QuoteMode.quote(column.After)
+	}
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s%s;", e.QuoteMode.quote(table), e.QuoteMode.quote(column.Name), column.Definition, placement)
+}
+
+func (e MySQLEmitter) ModifyColumn(table string, column ColumnDefinition) string {
+	return fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s;", e.QuoteMode.quote(table), e.QuoteMode.quote(column.Name), column.Definition)
+}
+
+func (e MySQLEmitter) DropColumn(table, column string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", e.QuoteMode.quote(table), e.QuoteMode.quote(column))
+}
+
+func (e MySQLEmitter) RenameColumn(table, from string, to ColumnDefinition) string {
+	return fmt.Sprintf("ALTER TABLE %s CHANGE COLUMN %s %s %s;", e.QuoteMode.quote(table), e.QuoteMode.quote(from), e.QuoteMode.quote(to.Name), to.Definition)
+}
+
+func (e MySQLEmitter) CreateIndex(table string, index IndexDefinition) string {
+	idx := normalizeIndex(index.state())
+	sql := fmt.Sprintf("CREATE %sINDEX %s ON %s (%s)", indexClassPrefix(idx.Class), e.QuoteMode.quote(index.Name), e.QuoteMode.quote(table), indexFieldsSQL(idx.Fields, e.QuoteMode))
+	if idx.Type != "" {
+		sql += " USING " + idx.Type
+	}
+	if idx.Comment != "" {
+		sql += " COMMENT " + quoteSQLString(idx.Comment)
+	}
+	if idx.Option != "" {
+		sql += " " + idx.Option
+	}
+	return sql + ";"
+}
+
+func (e MySQLEmitter) DropIndex(table, index string) string {
+	return fmt.Sprintf("DROP INDEX %s ON %s;", e.QuoteMode.quote(index), e.QuoteMode.quote(table))
+}
+
+// RenameIndex needs MySQL 8.0 or later. Older targets recreate the index
+// with DropIndex and CreateIndex instead, see Options.MySQLVersion.
+func (e MySQLEmitter) RenameIndex(table, from, to string) string {
+	return fmt.Sprintf("ALTER TABLE %s RENAME INDEX %s TO %s;", e.QuoteMode.quote(table), e.QuoteMode.quote(from), e.QuoteMode.quote(to))
+}
+
+func (e MySQLEmitter) AddForeignKey(table string, fk ForeignKeyDefinition) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD %s;", e.QuoteMode.quote(table), e.foreignKeyConstraint(fk))
+}
+
+func (e MySQLEmitter) foreignKeyConstraint(fk ForeignKeyDefinition) string {
+	state := normalizeForeignKey(fk.state())
+	parts := []string{
+		"CONSTRAINT " + e.QuoteMode.quote(fk.Name),
+		fmt.Sprintf("FOREIGN KEY (%s)", e.QuoteMode.columns(state.Columns)),
+		fmt.Sprintf("REFERENCES %s (%s)", e.QuoteMode.quote(state.RefTable), e.QuoteMode.columns(state.RefColumns)),
+	}
+	if state.OnDelete != "" {
+		parts = append(parts, "ON DELETE "+state.OnDelete)
+	}
+	if state.OnUpdate != "" {
+		parts = append(parts, "ON UPDATE "+state.OnUpdate)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (e MySQLEmitter) DropForeignKey(table, constraint string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s;", e.QuoteMode.quote(table), e.QuoteMode.quote(constraint))
+}
+
+func (e MySQLEmitter) ChangePrimaryKey(table string, from, to []string) string {
+	q := e.QuoteMode
+	switch {
+	case len(from) > 0 && len(to) > 0:
+		return fmt.Sprintf("ALTER TABLE %s DROP PRIMARY KEY, ADD PRIMARY KEY (%s);", q.quote(table), q.columns(to))
+	case len(from) > 0:
+		return fmt.Sprintf("ALTER TABLE %s DROP PRIMARY KEY;", q.quote(table))
+	case len(to) > 0:
+		return fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (%s);", q.quote(table), q.columns(to))
+	}
+	return ""
+}
+
+// SetColumnDefault changes the table metadata only, without rewriting the
+// rows as MODIFY COLUMN does.
+func (e MySQLEmitter) SetColumnDefault(table, column, value string) string {
+	if value == "" {
+		return fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP DEFAULT;", e.QuoteMode.quote(table), e.QuoteMode.quote(column))
+	}
+	return fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET DEFAULT %s;", e.QuoteMode.quote(table), e.QuoteMode.quote(column), value)
+}
+
+// SetColumnComment restates the whole definition, since MySQL only changes
+// a comment with MODIFY COLUMN.
+func (e MySQLEmitter) SetColumnComment(table string, column ColumnDefinition) string {
+	column.Definition = withDefinitionComment(column.Definition, column.Comment)
+	return e.ModifyColumn(table, column)
+}
+
+func (e MySQLEmitter) MoveColumn(table string, column ColumnDefinition) string {
+	placement := "FIRST"
+	if !column.First {
+		placement = "AFTER " + e.QuoteMode.quote(column.After)
+	}
+	return fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s %s;", e.QuoteMode.quote(table), e.QuoteMode.quote(column.Name), column.Definition, placement)
+}
+
+func (e MySQLEmitter) SetTableCharset(table, charset, collation string) string {
+	return fmt.Sprintf("ALTER TABLE %s %s;", e.QuoteMode.quote(table), tableCharsetClause(tableState{Charset: charset, Collation: collation}))
+}
+
+func (e MySQLEmitter) SetTableCollation(table, collation string) string {
+	return fmt.Sprintf("ALTER TABLE %s COLLATE = %s;", e.QuoteMode.quote(table), collation)
+}
+
+func (e MySQLEmitter) SetTableEngine(table, engine string) string {
+	return fmt.Sprintf("ALTER TABLE %s ENGINE=%s;", e.QuoteMode.quote(table), engine)
+}
+
+func (e MySQLEmitter) SetTableComment(table, comment string) string {
+	return fmt.Sprintf("ALTER TABLE %s COMMENT = %s;", e.QuoteMode.quote(table), quoteSQLString(comment))
+}
+
+func (e MySQLEmitter) SetTableTablespace(table, tablespace string) string {
+	return fmt.Sprintf("ALTER TABLE %s TABLESPACE %s;", e.QuoteMode.quote(table), e.QuoteMode.quote(orDefault(tablespace, mysqlDefaultTablespace)))
+}
+
+// SetIndexTablespace returns no SQL; MySQL indexes live in the tablespace
+// of their table.
+func (e MySQLEmitter) SetIndexTablespace(table, index, tablespace string) string {
+	return ""
+}
+
+func (e MySQLEmitter) SetAutoIncrement(table string, value uint64) string {
+	return fmt.Sprintf("ALTER TABLE %s AUTO_INCREMENT = %d;", e.QuoteMode.quote(table), value)
+}
+
+func (o Options) emitter() Emitter {
+	if o.Emitter != nil {
+		return o.Emitter
+	}
+	switch o.Dialect {
+	case DialectPostgres:
+		return PostgresEmitter{QuoteMode: o.QuoteMode, IfExists: o.IfExists}
+	case DialectVitess:
+		return VitessEmitter{MySQLEmitter{QuoteMode: o.QuoteMode, IfExists: o.IfExists}}
+	case DialectSQLite:
+		return SQLiteEmitter{QuoteMode: o.QuoteMode, IfExists: o.IfExists}
+	}
+	return MySQLEmitter{QuoteMode: o.QuoteMode, IfExists: o.IfExists}
+}
+
+func tableDefinitionOf(tableName string, table tableState, opts Options) TableDefinition {
+	def := TableDefinition{
+		Name:        tableName,
+		PrimaryKeys: append([]string{}, table.PrimaryKeys...),
+		Charset:     table.Charset,
+		Collation:   table.Collation,
+		Tablespace:  table.Tablespace,
+		Engine:      table.Engine,
+		Comment:     table.Comment,
+	}
+	for _, col := range orderedColumns(table, opts.ColumnOrdering) {
+		column := ColumnDefinition{Name: col, Definition: table.Columns[col].Definition, Comment: columnComment(table.Columns[col])}
+		if opts.AnnotateCreateOnly && table.Columns[col].CreateOnly {
+			column.Note = createOnlyComment
+		}
+		def.Columns = append(def.Columns, column)
+	}
+	for _, name := range orderedIndexNames(table.Indexes) {
+		def.Indexes = append(def.Indexes, indexDefinitionOf(name, table.Indexes[name]))
+	}
+	if opts.Dialect == DialectSQLite {
+		for _, name := range sortedKeys(table.ForeignKeys) {
+			def.ForeignKeys = append(def.ForeignKeys, foreignKeyDefinitionOf(name, table.ForeignKeys[name]))
+		}
+	}
+	return def
+}
+
+func indexDefinitionOf(name string, idx indexState) IndexDefinition {
+	def := IndexDefinition{
+		Name:       name,
+		Class:      idx.Class,
+		Type:       idx.Type,
+		Where:      idx.Where,
+		Comment:    idx.Comment,
+		Option:     idx.Option,
+		Tablespace: idx.Tablespace,
+	}
+	for _, f := range idx.Fields {
+		def.Fields = append(def.Fields, IndexField(f))
+	}
+	return def
+}
+
+func (d IndexDefinition) state() indexState {
+	idx := indexState{
+		Class:      d.Class,
+		Type:       d.Type,
+		Where:      d.Where,
+		Comment:    d.Comment,
+		Option:     d.Option,
+		Fields:     make([]indexFieldState, 0, len(d.Fields)),
+		Tablespace: d.Tablespace,
+	}
+	for _, f := range d.Fields {
+		idx.Fields = append(idx.Fields, indexFieldState(f))
+	}
+	return idx
+}
+
+func foreignKeyDefinitionOf(name string, fk foreignKeyState) ForeignKeyDefinition {
+	return ForeignKeyDefinition{
+		Name:       name,
+		Columns:    append([]string{}, fk.Columns...),
+		RefTable:   fk.RefTable,
+		RefColumns: append([]string{}, fk.RefColumns...),
+		OnDelete:   fk.OnDelete,
+		OnUpdate:   fk.OnUpdate,
+	}
+}
+
+func (d ForeignKeyDefinition) state() foreignKeyState {
+	return foreignKeyState{
+		Columns:    d.Columns,
+		RefTable:   d.RefTable,
+		RefColumns: d.RefColumns,
+		OnDelete:   d.OnDelete,
+		OnUpdate:   d.OnUpdate,
+	}
+}
@@ -0,0 +1,157 @@
+package gomigration
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// onlineIndexEmitter overrides index creation and keeps every other default.
+type onlineIndexEmitter struct {
+	MySQLEmitter
+}
+
+func (onlineIndexEmitter) CreateIndex(table string, index IndexDefinition) string {
+	return fmt.Sprintf("ALTER TABLE `%s` ADD INDEX `%s` (`%s`), ALGORITHM=INPLACE, LOCK=NONE;", table, index.Name, index.Fields[0].Column)
+}
+
+func TestEmitterOverrideReplacesSingleOperation(t *testing.T) {
+	prev := tableState{
+		Columns: map[string]columnState{"id": {Definition: "bigint"}},
+	}
+	cur := tableState{
+		Columns: map[string]columnState{"id": {Definition: "bigint"}, "name": {Definition: "varchar(64)"}},
+		Indexes: map[string]indexState{"idx_name": {Fields: []indexFieldState{{Column: "name"}}}},
+	}
+
+	ops := diffTableWithOptions("people", prev, cur, Options{Emitter: onlineIndexEmitter{}})
+	if len(ops) != 2 {
+		t.Fatalf("expected column and index ops, got %#v", ops)
+	}
+	if ops[0].up != "ALTER TABLE `people` ADD COLUMN `name` varchar(64);" {
+		t.Fatalf("expected default column SQL, got %q", ops[0].up)
+	}
+	if ops[1].up != "ALTER TABLE `people` ADD INDEX `idx_name` (`name`), ALGORITHM=INPLACE, LOCK=NONE;" {
+		t.Fatalf("expected overridden index SQL, got %q", ops[1].up)
+	}
+	if ops[1].down != "DROP INDEX `idx_name` ON `people`;" {
+		t.Fatalf("expected default drop index SQL, got %q", ops[1].down)
+	}
+
+	defaults := diffTableWithOptions("people", prev, cur, Options{})
+	if defaults[1].up != createIndexSQL("people", "idx_name", cur.Indexes["idx_name"]) {
+		t.Fatalf("expected the free function to match the default emitter, got %q", defaults[1].up)
+	}
+}
+
+// onlineTableEmitter overrides table-level changes that used to bypass the
+// Emitter.
+type onlineTableEmitter struct {
+	MySQLEmitter
+}
+
+func (onlineTableEmitter) SetTableEngine(table, engine string) string {
+	return fmt.Sprintf("ALTER TABLE `%s` ENGINE=%s, ALGORITHM=COPY;", table, engine)
+}
+
+func (onlineTableEmitter) ChangePrimaryKey(table string, from, to []string) string {
+	return fmt.Sprintf("ALTER TABLE `%s` DROP PRIMARY KEY, ADD PRIMARY KEY (%s), ALGORITHM=INPLACE;", table, strings.Join(to, ", "))
+}
+
+func (onlineTableEmitter) SetColumnDefault(table, column, value string) string {
+	return fmt.Sprintf("ALTER TABLE `%s` ALTER `%s` SET DEFAULT %s, ALGORITHM=INSTANT;", table, column, value)
+}
+
+func TestEmitterOverrideReachesTableLevelChanges(t *testing.T) {
+	prev := tableState{
+		Columns:     map[string]columnState{"id": {Definition: "bigint NOT NULL"}, "code": {Definition: "int DEFAULT 1"}},
+		PrimaryKeys: []string{"id"},
+		Engine:      "MyISAM",
+	}
+	cur := tableState{
+		Columns:     map[string]columnState{"id": {Definition: "bigint NOT NULL"}, "code": {Definition: "int DEFAULT 2"}},
+		PrimaryKeys: []string{"id", "code"},
+		Engine:      "InnoDB",
+	}
+	up, _ := splitMigrationOps(diffTableWithOptions("items", prev, cur, Options{Emitter: onlineTableEmitter{}}))
+	assertContainsAll(t, strings.Join(up, "\n"), []string{
+		"ALTER TABLE `items` ENGINE=InnoDB, ALGORITHM=COPY;",
+		"ALTER TABLE `items` DROP PRIMARY KEY, ADD PRIMARY KEY (id, code), ALGORITHM=INPLACE;",
+		"ALTER TABLE `items` ALTER `code` SET DEFAULT 2, ALGORITHM=INSTANT;",
+	})
+}
+
+func TestMySQLEmitterCreateTable(t *testing.T) {
+	sql := MySQLEmitter{}.CreateTable(TableDefinition{
+		Name: "people",
+		Columns: []ColumnDefinition{
+			{Name: "id", Definition: "bigint unsigned AUTO_INCREMENT"},
+			{Name: "name", Definition: "varchar(64)", Note: createOnlyComment},
+		},
+		PrimaryKeys: []string{"id"},
+		Indexes:     []IndexDefinition{{Name: "idx_name", Class: "UNIQUE", Fields: []IndexField{{Column: "name"}}}},
+		Charset:     "utf8mb4",
+	})
+	want := strings.Join([]string{
+		"CREATE TABLE `people` (",
+		"  `id` bigint unsigned AUTO_INCREMENT,",
+		"  `name` varchar(64), -- create-only",
+		"  PRIMARY KEY (`id`),",
+		"  UNIQUE KEY `idx_name` (`name`)",
+		") DEFAULT CHARSET=utf8mb4;",
+	}, "\n")
+	if sql != want {
+		t.Fatalf("unexpected CREATE TABLE:\n%s", sql)
+	}
+}
+
+func TestEmittersIfExists(t *testing.T) {
+	prev := tableState{
+		Columns:     map[string]columnState{"id": {Definition: "bigint"}, "legacy": {Definition: "bigint"}},
+		ForeignKeys: map[string]foreignKeyState{"fk_people_legacy": {Columns: []string{"legacy"}, RefTable: "legacies", RefColumns: []string{"id"}}},
+	}
+	cur := tableState{
+		Columns: map[string]columnState{"id": {Definition: "bigint"}, "name": {Definition: "varchar(64)"}},
+		Indexes: map[string]indexState{"idx_name": {Fields: []indexFieldState{{Column: "name"}}}},
+	}
+	cases := []struct {
+		dialect Dialect
+		create  string
+		up      []string
+	}{
+		{
+			dialect: DialectMySQL,
+			create:  "CREATE TABLE IF NOT EXISTS `people` (",
+			up: []string{
+				"ALTER TABLE `people` DROP FOREIGN KEY `fk_people_legacy`;",
+				"ALTER TABLE `people` DROP COLUMN `legacy`;",
+				"ALTER TABLE `people` ADD COLUMN `name` varchar(64);",
+				"CREATE INDEX `idx_name` ON `people` (`name`);",
+			},
+		},
+		{
+			dialect: DialectPostgres,
+			create:  `CREATE TABLE IF NOT EXISTS "people" (`,
+			up: []string{
+				`ALTER TABLE "people" DROP CONSTRAINT IF EXISTS "fk_people_legacy";`,
+				`ALTER TABLE "people" DROP COLUMN IF EXISTS "legacy";`,
+				`ALTER TABLE "people" ADD COLUMN IF NOT EXISTS "name" varchar(64);`,
+				`CREATE INDEX IF NOT EXISTS "idx_name" ON "people" ("name");`,
+			},
+		},
+	}
+	for _, tc := range cases {
+		opts := Options{Dialect: tc.dialect, IfExists: true}
+		if create := createTableSQLWithOptions("people", cur, opts); !strings.HasPrefix(create, tc.create) {
+			t.Fatalf("%s: unexpected CREATE TABLE:\n%s", tc.dialect, create)
+		}
+		up, _ := splitMigrationOps(diffTableWithOptions("people", prev, cur, opts))
+		assertContainsAll(t, strings.Join(up, "\n"), tc.up)
+	}
+
+	create := createTableSQLWithOptions("people", cur, Options{Dialect: DialectSQLite, IfExists: true})
+	assertContainsAll(t, create, []string{`CREATE TABLE IF NOT EXISTS "people" (`, `CREATE INDEX IF NOT EXISTS "idx_name" ON "people" ("name");`})
+	if create := createTableSQL("people", cur); strings.Contains(create, "IF NOT EXISTS") {
+		t.Fatalf("expected no guard by default, got:\n%s", create)
+	}
+}
@@ -0,0 +1,32 @@
+package gomigration
+
+import "fmt"
+
+// maxIdentifierLength is the longest identifier the dialect accepts, or 0
+// when it has no practical limit. Postgres would silently truncate a longer
+// name, leaving the saved state with a name the database does not have.
+func maxIdentifierLength(dialect Dialect) int {
+	switch {
+	case dialect.isMySQL():
+		return mysqlMaxIdentifierLength
+	case dialect == DialectPostgres:
+		return 63
+	}
+	return 0
+}
+
+// validateForeignKeyNames rejects foreign key names longer than limit, so
+// they fail here instead of when the migration runs.
+func validateForeignKeyNames(state schemaState, limit int) error {
+	if limit == 0 {
+		return nil
+	}
+	for _, tableName := range sortedKeys(state.Tables) {
+		for _, name := range sortedKeys(state.Tables[tableName].ForeignKeys) {
+			if identifierLength(name) > limit {
+				return fmt.Errorf("table `%s` foreign key `%s` exceeds %d characters; shorten it with Options.ForeignKeyNamer", tableName, name, limit)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package gomigration
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type fkNamingAccount struct {
+	ID            uint                   `gorm:"primaryKey"`
+	Notifications []fkNamingNotification `gorm:"many2many:account_notification_subscription_preferences"`
+}
+
+func (fkNamingAccount) TableName() string { return "accounts" }
+
+type fkNamingNotification struct {
+	ID uint `gorm:"primaryKey"`
+}
+
+func (fkNamingNotification) TableName() string { return "notification_channels" }
+
+func TestBuildCurrentStateForeignKeyNamer(t *testing.T) {
+	models := []any{&fkNamingAccount{}, &fkNamingNotification{}}
+	// GORM cuts long names to 64 characters ending in a hash, which
+	// Postgres would truncate again.
+	state, err := buildCurrentState(models)
+	if err != nil {
+		t.Fatalf("buildCurrentState failed: %v", err)
+	}
+	for name := range state.Tables["account_notification_subscription_preferences"].ForeignKeys {
+		if len(name) != 64 || !strings.HasPrefix(name, "fk_account_notification_subscription_preferences_fk_nami") {
+			t.Fatalf("expected a hashed 64 character name, got %s", name)
+		}
+	}
+	_, err = buildCurrentStateWithOptions(models, Options{Dialect: DialectPostgres})
+	if err == nil || !strings.Contains(err.Error(), "table `account_notification_subscription_preferences` foreign key `fk_account_notification_subscription_preferences_fk_nami") || !strings.Contains(err.Error(), "exceeds 63 characters") {
+		t.Fatalf("expected the long join table foreign key name to be rejected, got %v", err)
+	}
+
+	namer := func(table string, columns []string, refTable string) string {
+		return "fk_" + refTable + "_" + strings.Join(columns, "_")
+	}
+	state, err = buildCurrentStateWithOptions(models, Options{Dialect: DialectPostgres, ForeignKeyNamer: namer})
+	if err != nil {
+		t.Fatalf("buildCurrentStateWithOptions failed: %v", err)
+	}
+	fks := state.Tables["account_notification_subscription_preferences"].ForeignKeys
+	names := sortedKeys(fks)
+	if want := []string{"fk_accounts_fk_naming_account_id", "fk_notification_channels_fk_naming_notification_id"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("unexpected foreign key names %v", names)
+	}
+	if fk := fks["fk_accounts_fk_naming_account_id"]; fk.RefTable != "accounts" || !reflect.DeepEqual(fk.Columns, []string{"fk_naming_account_id"}) {
+		t.Fatalf("unexpected foreign key %#v", fk)
+	}
+
+	_, err = buildCurrentStateWithOptions(models, Options{ForeignKeyNamer: func(table string, columns []string, refTable string) string {
+		return "fk_" + table + "_" + strings.Join(columns, "_")
+	}})
+	if err == nil || !strings.Contains(err.Error(), "foreign key `fk_account_notification_subscription_preferences_fk_naming_account_id` exceeds 64 characters") {
+		t.Fatalf("expected a long custom name to be rejected, got %v", err)
+	}
+	_, err = buildCurrentStateWithOptions(models, Options{ForeignKeyNamer: func(string, []string, string) string { return "" }})
+	if err == nil || !strings.Contains(err.Error(), "unnamed foreign key constraint") {
+		t.Fatalf("expected an empty name to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package gomigration
+
+import (
+	"fmt"
+	"strings"
+)
+
+// generatedClause locates the generation clause of a column definition: the
+// tokens from GENERATED ALWAYS, or from AS when the short form is used, up to
+// and including the storage keyword. ok is false for an ordinary column.
+func generatedClause(tokens []string) (start, end int, ok bool) {
+	for i := 0; i+1 < len(tokens); i++ {
+		if !strings.EqualFold(tokens[i], "AS") || !strings.HasPrefix(tokens[i+1], "(") {
+			continue
+		}
+		start, end = i, i+2
+		if i >= 2 && strings.EqualFold(tokens[i-2], "GENERATED") && strings.EqualFold(tokens[i-1], "ALWAYS") {
+			start = i - 2
+		}
+		if end < len(tokens) && (strings.EqualFold(tokens[end], "STORED") || strings.EqualFold(tokens[end], "VIRTUAL")) {
+			end++
+		}
+		return start, end, true
+	}
+	return 0, 0, false
+}
+
+// generatedColumnExpression returns the expression of a generated column
+// without its enclosing parentheses, or an empty string for an ordinary
+// column.
+func generatedColumnExpression(definition string) string {
+	tokens := tokenizeDefinition(definition)
+	start, _, ok := generatedClause(tokens)
+	if !ok {
+		return ""
+	}
+	for i := start; i < len(tokens); i++ {
+		if strings.HasPrefix(tokens[i], "(") {
+			return strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(tokens[i], "("), ")"))
+		}
+	}
+	return ""
+}
+
+// canonicalGeneratedClause spells the generation clause in full, so that
+// "AS (expr)" and "GENERATED ALWAYS AS (expr) VIRTUAL" compare equal.
+func canonicalGeneratedClause(tokens []string) []string {
+	start, end, ok := generatedClause(tokens)
+	if !ok {
+		return tokens
+	}
+	expr := tokens[end-1]
+	storage := "VIRTUAL"
+	if !strings.HasPrefix(expr, "(") {
+		expr, storage = tokens[end-2], strings.ToUpper(tokens[end-1])
+	}
+	out := append([]string{}, tokens[:start]...)
+	out = append(out, "GENERATED", "ALWAYS", "AS", expr, storage)
+	return append(out, tokens[end:]...)
+}
+
+// generatedStorageSwitches returns the columns of cur that switch between
+// VIRTUAL and STORED, which MySQL can only do by dropping and adding the
+// column again.
+func generatedStorageSwitches(prev, cur tableState) []string {
+	cols := make([]string, 0)
+	for _, col := range sortedKeys(cur.Columns) {
+		prevCol, ok := prev.Columns[col]
+		if !ok {
+			continue
+		}
+		prevStorage := generatedColumnStorage(prevCol.Definition)
+		curStorage := generatedColumnStorage(cur.Columns[col].Definition)
+		if prevStorage != "" && curStorage != "" && prevStorage != curStorage {
+			cols = append(cols, col)
+		}
+	}
+	return cols
+}
+
+// indexesCovering returns the names of the indexes with a key part on col.
+func indexesCovering(indexes map[string]indexState, col string) []string {
+	names := make([]string, 0)
+	for _, name := range sortedKeys(indexes) {
+		for _, field := range indexes[name].Fields {
+			if field.Column == col {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+// validateGeneratedColumns rejects the keys MySQL refuses on VIRTUAL
+// generated columns: it stores no value for them, so they cannot be part of
+// the primary key or of a FULLTEXT or SPATIAL index.
+func validateGeneratedColumns(tableName string, table tableState) error {
+	for _, col := range sortedKeys(table.Columns) {
+		if table.Columns[col].GeneratedStorage != "VIRTUAL" {
+			continue
+		}
+		if containsString(table.PrimaryKeys, col) {
+			return fmt.Errorf("table `%s` primary key covers VIRTUAL generated column `%s`; make it STORED", tableName, col)
+		}
+		for _, name := range indexesCovering(table.Indexes, col) {
+			if class := normalizeIndexClass(table.Indexes[name].Class); class == "FULLTEXT" || class == "SPATIAL" {
+				return fmt.Errorf("table `%s` %s index `%s` covers VIRTUAL generated column `%s`; make it STORED", tableName, class, name, col)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package gomigration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type generatedPerson struct {
+	ID       uint   `gorm:"primaryKey"`
+	First    string `gorm:"size:64"`
+	Last     string `gorm:"size:64"`
+	FullName string `gorm:"->;type:varchar(130) GENERATED ALWAYS AS (CONCAT(first, ' ', last)) VIRTUAL;index:idx_generated_people_full_name"`
+}
+
+func (generatedPerson) TableName() string { return "generated_people" }
+
+type generatedPersonReversed struct {
+	ID       uint   `gorm:"primaryKey"`
+	First    string `gorm:"size:64"`
+	Last     string `gorm:"size:64"`
+	FullName string `gorm:"->;type:varchar(130) GENERATED ALWAYS AS (CONCAT(last, ', ', first)) VIRTUAL;index:idx_generated_people_full_name"`
+}
+
+func (generatedPersonReversed) TableName() string { return "generated_people" }
+
+type generatedPersonStored struct {
+	ID       uint   `gorm:"primaryKey"`
+	First    string `gorm:"size:64"`
+	Last     string `gorm:"size:64"`
+	FullName string `gorm:"->;type:varchar(130) GENERATED ALWAYS AS (CONCAT(last, ', ', first)) STORED;index:idx_generated_people_full_name"`
+}
+
+func (generatedPersonStored) TableName() string { return "generated_people" }
+
+type generatedFulltextPost struct {
+	ID    uint   `gorm:"primaryKey"`
+	Title string `gorm:"size:64"`
+	Words string `gorm:"->;type:text AS (LOWER(title));index:,class:FULLTEXT"`
+}
+
+func (generatedFulltextPost) TableName() string { return "generated_posts" }
+
+func TestMakeMigrationsGeneratedColumns(t *testing.T) {
+	dir := t.TempDir()
+	step := func(version string, model any) MakeMigrationsResult {
+		t.Helper()
+		result, err := MakeMigrationsWithOptions([]any{model}, dir, "people", "", Options{Version: version, SelfVerify: true})
+		if err != nil {
+			t.Fatalf("MakeMigrationsWithOptions %s failed: %v", version, err)
+		}
+		return result
+	}
+
+	created := step("1", &generatedPerson{})
+	assertContainsAll(t, readMigration(t, created.UpPath), []string{
+		"  `full_name` varchar(130) GENERATED ALWAYS AS (CONCAT(first, ' ', last)) VIRTUAL,\n",
+		"  KEY `idx_generated_people_full_name` (`full_name`)\n",
+	})
+	state, err := loadState(created.StatePath)
+	if err != nil {
+		t.Fatalf("loadState failed: %v", err)
+	}
+	if col := state.Tables["generated_people"].Columns["full_name"]; col.Generated != "CONCAT(first, ' ', last)" || col.GeneratedStorage != "VIRTUAL" {
+		t.Fatalf("expected the generation clause to be saved, got %#v", col)
+	}
+
+	changed := step("2", &generatedPersonReversed{})
+	if got, want := readMigration(t, changed.UpPath), "ALTER TABLE `generated_people` MODIFY COLUMN `full_name` varchar(130) GENERATED ALWAYS AS (CONCAT(last, ', ', first)) VIRTUAL;"; got != want {
+		t.Fatalf("unexpected expression change up:\n%s", got)
+	}
+
+	// The index goes with the dropped column and is created again.
+	stored := step("3", &generatedPersonStored{})
+	wantUp := strings.Join([]string{
+		"DROP INDEX `idx_generated_people_full_name` ON `generated_people`;",
+		"ALTER TABLE `generated_people` DROP COLUMN `full_name`;\nALTER TABLE `generated_people` ADD COLUMN `full_name` varchar(130) GENERATED ALWAYS AS (CONCAT(last, ', ', first)) STORED;",
+		"CREATE INDEX `idx_generated_people_full_name` ON `generated_people` (`full_name`);",
+	}, "\n\n")
+	if got := readMigration(t, stored.UpPath); got != wantUp {
+		t.Fatalf("unexpected storage change up:\n%s", got)
+	}
+	wantDown := strings.Join([]string{
+		"DROP INDEX `idx_generated_people_full_name` ON `generated_people`;",
+		"ALTER TABLE `generated_people` DROP COLUMN `full_name`;\nALTER TABLE `generated_people` ADD COLUMN `full_name` varchar(130) GENERATED ALWAYS AS (CONCAT(last, ', ', first)) VIRTUAL;",
+		"CREATE INDEX `idx_generated_people_full_name` ON `generated_people` (`full_name`);",
+	}, "\n\n")
+	if got := readMigration(t, stored.DownPath); got != wantDown {
+		t.Fatalf("unexpected storage change down:\n%s", got)
+	}
+
+	_, err = buildCurrentState([]any{&generatedFulltextPost{}})
+	if err == nil || !strings.Contains(err.Error(), "FULLTEXT index `idx_generated_posts_words` covers VIRTUAL generated column `words`") {
+		t.Fatalf("expected a FULLTEXT index on a VIRTUAL column to be rejected, got %v", err)
+	}
+}
+
+func TestCanonicalDefinitionGeneratedClause(t *testing.T) {
+	short := "varchar(130) AS (CONCAT(first, ' ', last)) NOT NULL"
+	full := "varchar(130) GENERATED ALWAYS AS (CONCAT(first, ' ', last)) VIRTUAL NOT NULL"
+	if canonicalDefinition(short) != canonicalDefinition(full) {
+		t.Fatalf("expected the short and full generation clauses to match:\n%s\n%s", canonicalDefinition(short), canonicalDefinition(full))
+	}
+	if canonicalDefinition(full) == canonicalDefinition(strings.Replace(full, "VIRTUAL", "STORED", 1)) {
+		t.Fatalf("expected the storage to matter")
+	}
+	if got := generatedColumnExpression(short); got != "CONCAT(first, ' ', last)" {
+		t.Fatalf("unexpected expression %q", got)
+	}
+}
+
+func TestLoadStateUpgradesVersion1(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".schema_state.json")
+	v1 := `{
+  "version": 1,
+  "tables": {
+    "generated_people": {
+      "columns": {
+        "full_name": {"definition": "varchar(130) AS (CONCAT(first, ' ', last)) STORED"}
+      }
+    }
+  }
+}`
+	if err := os.WriteFile(path, []byte(v1), 0o644); err != nil {
+		t.Fatalf("write state: %v", err)
+	}
+	state, err := loadState(path)
+	if err != nil {
+		t.Fatalf("loadState failed: %v", err)
+	}
+	if col := state.Tables["generated_people"].Columns["full_name"]; col.Generated != "CONCAT(first, ' ', last)" || col.GeneratedStorage != "STORED" {
+		t.Fatalf("expected the generation clause to be upgraded, got %#v", col)
+	}
+}
@@ -1,6 +1,8 @@
 package gomigration
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -9,16 +11,21 @@ import (
 	"sort"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"gorm.io/gorm/schema"
 )
 
 type schemaState struct {
-	Tables map[string]tableState `json:"tables"`
+	// Version is the format of a saved state, see stateVersion.
+	Version int                   `json:"version"`
+	Tables  map[string]tableState `json:"tables"`
 }
 
 type tableState struct {
@@ -26,10 +33,26 @@ type tableState struct {
 	Indexes     map[string]indexState      `json:"indexes,omitempty"`
 	ForeignKeys map[string]foreignKeyState `json:"foreign_keys,omitempty"`
 	PrimaryKeys []string                   `json:"primary_keys,omitempty"`
+	Charset     string                     `json:"charset,omitempty"`
+	Collation   string                     `json:"collation,omitempty"`
+	ColumnOrder []string                   `json:"column_order,omitempty"`
+	Tablespace  string                     `json:"tablespace,omitempty"`
+	Engine      string                     `json:"engine,omitempty"`
+	Comment     string                     `json:"comment,omitempty"`
 }
 
 type columnState struct {
 	Definition string `json:"definition"`
+	CreateOnly bool   `json:"create_only,omitempty"`
+	Comment    string `json:"comment,omitempty"`
+	// Generated is the expression of a generated column and
+	// GeneratedStorage is VIRTUAL or STORED. Like Comment, both are also
+	// part of Definition.
+	Generated        string `json:"generated,omitempty"`
+	GeneratedStorage string `json:"generated_storage,omitempty"`
+	// RenamedFrom is the renamed_from tag option of the model field. It is
+	// a hint for the next diff only and is not saved.
+	RenamedFrom string `json:"-"`
 }
 
 type indexState struct {
@@ -39,6 +62,11 @@ type indexState struct {
 	Comment string            `json:"comment,omitempty"`
 	Option  string            `json:"option,omitempty"`
 	Fields  []indexFieldState `json:"fields"`
+	// Tablespace is only set for Postgres and is changed in place rather
+	// than by recreating the index.
+	Tablespace string `json:"tablespace,omitempty"`
+	// CreateOrder only orders index creation and is not compared.
+	CreateOrder int `json:"create_order,omitempty"`
 }
 
 type indexFieldState struct {
@@ -47,6 +75,7 @@ type indexFieldState struct {
 	Sort       string `json:"sort,omitempty"`
 	Collate    string `json:"collate,omitempty"`
 	Length     int    `json:"length,omitempty"`
+	OpClass    string `json:"op_class,omitempty"`
 }
 
 type foreignKeyState struct {
@@ -58,26 +87,330 @@ type foreignKeyState struct {
 }
 
 type indexTagDecl struct {
-	Name       string
-	Column     string
-	Expression string
-	Raw        string
+	Name        string
+	Column      string
+	Expression  string
+	CreateOrder string
+	Tablespace  string
+	Option      string
+	Raw         string
 }
 
+type opKind int
+
+const (
+	opCreateTable opKind = iota
+	opDropTable
+	opRenameTable
+	opAddColumn
+	opModifyColumn
+	opChangeAutoIncrement
+	opColumnComment
+	opChangeDefault
+	opDropColumn
+	opRenameColumn
+	opChangePrimaryKey
+	opReorderColumns
+	opCreateIndex
+	opModifyIndex
+	opDropIndex
+	opRenameIndex
+	opAddForeignKey
+	opDropForeignKey
+	opRenameForeignKey
+	opTableCharset
+	opTableCollation
+	opTableEngine
+	opTableComment
+	opTableTablespace
+	opIndexTablespace
+	opRebuildTable
+	opRecreateTable
+)
+
+// migrationOp is one reversible schema change. name is the column, index or
+// constraint it touches, or the table itself for table-level ops.
 type migrationOp struct {
-	up   string
-	down string
+	kind  opKind
+	table string
+	name  string
+	up    string
+	down  string
+	// typeChange classifies the type change of an opModifyColumn op.
+	typeChange TypeChange
+	// warnings are the SafetyWarnings of this op. Risky ones are also
+	// written as comments before the statements they are about; destructive
+	// ones are only reported, see Options.AnnotateDataLoss and
+	// Options.AnnotateTypeChanges for comments.
+	warnings []SafetyWarning
+	// apply is the logical effect of up on an in-memory schema, used by
+	// Options.SelfVerify. Ops without a schema-level effect leave it nil.
+	apply func(tables map[string]tableState)
 }
 
 type MakeMigrationsResult struct {
-	Changed   bool
-	UpPath    string
-	DownPath  string
+	Changed  bool
+	Version  string
+	UpPath   string
+	DownPath string
+	// UpPaths and DownPaths list every written file in apply order. UpPath
+	// and DownPath are the first of them.
+	UpPaths   []string
+	DownPaths []string
+	// Path is the written file with Options.CombinedFile, which UpPath and
+	// DownPath are set to as well.
+	Path      string
 	StatePath string
+	// Warnings lists generated changes, or their rollbacks, that may fail on
+	// existing data.
+	Warnings []SafetyWarning
+}
+
+// Options configures MakeMigrationsWithOptions and the other WithOptions
+// functions. Every field is optional: the zero value generates MySQL
+// migrations exactly as MakeMigrations does, one up/down file pair per
+// migration with no annotations, and never blocks a change.
+type Options struct {
+	// FileEncoding controls the bytes written for .sql files. The zero value
+	// writes plain UTF-8 without a BOM.
+	FileEncoding FileEncoding
+	// AnnotateCreateOnly marks columns that GORM only writes on create
+	// (`gorm:"<-:create"`) with a "-- create-only" comment.
+	AnnotateCreateOnly bool
+	// Version is used verbatim as the file name prefix instead of the current
+	// time. It must be all digits; 14-digit values must be valid timestamps.
+	Version string
+	// TrackColumnOrder emits MODIFY COLUMN ... AFTER statements when struct
+	// fields are only reordered. Off by default since the order is cosmetic.
+	TrackColumnOrder bool
+	// ColumnEqual decides whether two column definitions are the same. The
+	// default compares them after whitespace, boolean, numeric default and
+	// generation clause canonicalization.
+	ColumnEqual func(prev, cur string) bool
+	// AnnotateSRID prefixes statements that create SRID-restricted spatial
+	// columns with a note naming the spatial reference systems they need.
+	AnnotateSRID bool
+	// SelfVerify replays the generated up SQL onto the previous state in
+	// memory, with the statement parser of ReconstructState, and fails
+	// instead of writing files when the result differs from the current
+	// models. It is not supported for Postgres, whose ALTER COLUMN syntax
+	// the parser does not follow.
+	SelfVerify bool
+	// RebuildTables lists tables to rebuild with ALTER TABLE ... FORCE after
+	// all structural changes, e.g. to reclaim space. A migration is written
+	// for them even when the models did not change.
+	RebuildTables []string
+	// Tables limits the migration to the named tables and ExcludeTables
+	// leaves the named tables out. Tables left out are neither diffed nor
+	// updated in the saved state, so their changes wait for a later
+	// migration. A foreign key between a selected table and one left out
+	// must reference a table the saved state already has.
+	Tables        []string
+	ExcludeTables []string
+	// StateFiles are extra state files merged into the previous state before
+	// diffing, for model sets that share tables. Tables saved in more than
+	// one file must match exactly. The result is saved to the primary state
+	// file, and each extra file gets the new state of the tables it holds.
+	StateFiles []string
+	// StripComments leaves column and index comments out of the captured
+	// state, for teams that manage comments outside of migrations. It applies
+	// to the previous state too, so comment-only differences never produce
+	// SQL.
+	StripComments bool
+	// IndexChangesOnly emits only index creates, changes and drops on tables
+	// and columns that already exist. The saved state records just those
+	// index changes, so everything else is still pending on the next run.
+	IndexChangesOnly bool
+	// RenameColumns maps table name to old column name to new column name.
+	// Listed columns are renamed with CHANGE COLUMN instead of being dropped
+	// and re-added. A field tag such as `gorm:"renamed_from:old_name"` gives
+	// the same hint from the model.
+	RenameColumns map[string]map[string]string
+	// DetectRenames renames a dropped column to an added one of the same
+	// table when they are the only dropped and added columns with that
+	// definition.
+	DetectRenames bool
+	// IndexNamer names indexes declared without an explicit name, e.g.
+	// `gorm:"index"`. column is the snake_case column or composite name. The
+	// default is GORM's idx_<table>_<column>.
+	IndexNamer func(table, column string) string
+	// ForeignKeyNamer names every foreign key constraint from its table, its
+	// columns and the table it references, instead of the fk_<table>_<field>
+	// names GORM derives, which grow long for many2many join tables and are
+	// then cut to 64 characters ending in a hash. Names longer than
+	// MaxIdentifierLength are rejected either way.
+	ForeignKeyNamer func(table string, columns []string, refTable string) string
+	// PerTableFiles writes one VERSION_name_table file pair per affected
+	// table and a final VERSION_name_foreign_keys pair with the foreign key
+	// additions, which Apply runs after the table files of the same version.
+	// A migration that changes a table whose name ends in foreign_keys is
+	// rejected, since its file would be taken for that pair.
+	PerTableFiles bool
+	// CombinedFile writes one VERSION_name.sql file with both directions,
+	// each introduced by a line of CombinedFileMarkers, for runners such as
+	// goose and dbmate. migrations.lock records the file, but Apply only
+	// reads up/down pairs.
+	CombinedFile bool
+	// CombinedFileMarkers defaults to GooseMarkers.
+	CombinedFileMarkers FileMarkers
+	// WrapInTransaction encloses the statements of each generated file in
+	// START TRANSACTION (BEGIN for Postgres and SQLite) and COMMIT, for
+	// runners that execute a file on one connection. MySQL still commits
+	// implicitly around DDL, which the file notes after START TRANSACTION.
+	WrapInTransaction bool
+	// OnOperation is called with each operation of a generated migration in
+	// file order, as soon as the diff is complete and before any file is
+	// written, e.g. to feed an audit trail.
+	OnOperation func(op Operation)
+	// Emitter renders the generated DDL. The default is MySQLEmitter.
+	Emitter Emitter
+	// DeprecateBeforeDrop renames the table of a removed model to
+	// _deprecated_<name> instead of dropping it, keeping its data. The
+	// deprecated table stays until its original name is listed in
+	// DropDeprecatedTables, or is renamed back if the model returns.
+	DeprecateBeforeDrop  bool
+	DropDeprecatedTables []string
+	// RenameTables maps old table names to new ones. A listed table is
+	// renamed instead of being dropped and created again, and foreign keys
+	// referencing it are kept. A rename is ignored once the old table is
+	// gone from the saved state.
+	RenameTables map[string]string
+	// Annotations are written as leading comment lines of every generated
+	// file, e.g. "ticket: PROJ-123". Apply ignores them.
+	Annotations []string
+	// SQLMode, when set, makes every generated file switch the session to
+	// this sql_mode before its statements and restore the previous mode
+	// after them, e.g. "STRICT_TRANS_TABLES,NO_ZERO_DATE".
+	SQLMode string
+	// ShardTables maps a model, e.g. &Event{}, to the concrete tables that
+	// share its structure, e.g. events_2024 and events_2025. Each shard is
+	// generated and diffed as an independent table instead of the table the
+	// model's TableName returns.
+	ShardTables map[any][]string
+	// Logger receives diagnostics while the models are read, such as
+	// relationships that produce no foreign key.
+	Logger Logger
+	// IgnoreIndexComment produces no SQL for an index whose comment is the
+	// only change, instead of recreating it; the new comment is still
+	// recorded and used whenever the index is created.
+	IgnoreIndexComment bool
+	// MySQLVersion is the target server version, e.g. "5.7" or "8.0.36".
+	// Version-specific syntax such as RENAME INDEX, available from 8.0, is
+	// only emitted when it is set high enough. Below 8.0, descending index
+	// key parts are recorded ascending, as the server stores them.
+	MySQLVersion string
+	// AnnotateDataLoss prefixes the down statements that recreate a dropped
+	// column or table with a comment saying the dropped data is not restored.
+	AnnotateDataLoss bool
+	// BlockDestructive makes MakeMigrations fail instead of writing a
+	// migration with changes that discard data, i.e. with SeverityDestructive
+	// warnings, unless AllowDestructive is also set. The error lists each
+	// such change with its statements.
+	BlockDestructive bool
+	AllowDestructive bool
+	// AutoIncrementHighWater gives, by table, the AUTO_INCREMENT counter to
+	// restore when the down of a migration recreates a dropped MySQL table,
+	// so rolled back tables do not hand out IDs again.
+	AutoIncrementHighWater map[string]uint64
+	// AnnotateAutoIncrementReset prefixes the down statements that recreate
+	// a dropped table with an auto-increment column with a comment saying
+	// its counter starts over, unless AutoIncrementHighWater restores it.
+	AnnotateAutoIncrementReset bool
+	// AnnotateTypeChanges prefixes MODIFY COLUMN statements that change a
+	// column's type with a comment saying whether the change widens or
+	// narrows the type, or converts it to an unrelated one.
+	AnnotateTypeChanges bool
+	// Dialect is the database the migrations are generated for. The default
+	// is DialectMySQL. DialectPostgres reads the models through the Postgres
+	// driver and renders Postgres DDL; the MySQL-only options SQLMode and
+	// RebuildTables cannot be combined with it, and TrackColumnOrder and
+	// table charsets and collations are ignored. DialectVitess renders MySQL
+	// DDL as Vitess online DDL and fails on foreign key changes. DialectSQLite
+	// has the same limits as DialectPostgres and rebuilds a table for any
+	// change SQLite cannot make with ALTER TABLE.
+	Dialect Dialect
+	// QuoteMode selects which identifiers the generated SQL quotes. The
+	// default, QuoteAlways, quotes all of them. A custom Emitter does its own
+	// quoting.
+	QuoteMode QuoteMode
+	// ColumnOrdering sets the column order of CREATE TABLE statements. The
+	// default is ColumnOrderingAlphabetical.
+	ColumnOrdering ColumnOrdering
+	// RequireExistingState fails instead of treating a missing state file as
+	// an empty schema. An empty file still counts as an empty schema, so a
+	// fresh project is bootstrapped with SyncSchemaState.
+	RequireExistingState bool
+	// MaxIdentifierLength is the longest table, column, index or foreign key
+	// name the models may produce; longer ones fail generation instead of
+	// the migration. The default is the dialect's limit: 64 characters for
+	// MySQL and Vitess, 63 for Postgres and none for SQLite.
+	MaxIdentifierLength int
+	// BatchAlter adds the new foreign keys of a table with one ALTER TABLE
+	// statement instead of one statement each, and drops them the same way.
+	BatchAlter bool
+	// IfExists adds IF NOT EXISTS and IF EXISTS guards where the dialect
+	// has them, so a migration can be rerun on a partially migrated
+	// database. MySQL and Vitess guard CREATE TABLE only; Postgres also
+	// guards adding and dropping columns, CREATE INDEX and dropping foreign
+	// keys; SQLite guards CREATE TABLE and CREATE INDEX. DROP TABLE, and
+	// DROP INDEX on Postgres and SQLite, are always guarded. A custom
+	// Emitter ignores it.
+	IfExists bool
+	// SequentialVersions numbers migrations 000001, 000002, ... as
+	// golang-migrate expects, continuing from the highest version in the
+	// directory, instead of using the current time. A directory that
+	// already holds timestamp versions is rejected.
+	SequentialVersions bool
+	// SequentialWidth is the number of digits SequentialVersions pads
+	// versions to. The default is 6.
+	SequentialWidth int
+	// InlineForeignKeys declares the foreign keys of a new table in its
+	// CREATE TABLE when the referenced table exists by then: an existing
+	// table, the table itself or a new table created before it. Foreign
+	// keys within a reference cycle are still added with ALTER TABLE once
+	// the tables exist. SQLite always declares them in CREATE TABLE.
+	InlineForeignKeys bool
+}
+
+func (o Options) indexEqual(prev, cur indexState) bool {
+	prev, cur = normalizeIndex(prev), normalizeIndex(cur)
+	if o.IgnoreIndexComment {
+		prev.Comment, cur.Comment = "", ""
+	}
+	prev.CreateOrder, cur.CreateOrder = 0, 0
+	prev.Tablespace, cur.Tablespace = "", ""
+	return reflect.DeepEqual(prev, cur)
+}
+
+func (o Options) columnEqual(prev, cur string) bool {
+	if o.ColumnEqual != nil {
+		return o.ColumnEqual(prev, cur)
+	}
+	return columnDefinitionsEqual(prev, cur)
 }
 
+// MakeMigrations writes a migration for the changes between models and the
+// state saved in stateFile, then saves the new state. name is required; an
+// empty dir is database/migrations and an empty stateFile is
+// .schema_state.json in dir. Settings beyond these go in the Options of
+// MakeMigrationsWithOptions.
 func MakeMigrations(models []any, dir, name, stateFile string) (MakeMigrationsResult, error) {
+	return MakeMigrationsWithOptions(models, dir, name, stateFile, Options{})
+}
+
+func MakeMigrationsWithOptions(models []any, dir, name, stateFile string, opts Options) (MakeMigrationsResult, error) {
+	return MakeMigrationsContext(context.Background(), models, dir, name, stateFile, opts)
+}
+
+// MakeMigrationsContext is MakeMigrationsWithOptions with cancellation. ctx is
+// checked between models and once more before any file is written; a
+// canceled call returns ctx.Err() and leaves the directory and the state file
+// untouched.
+func MakeMigrationsContext(ctx context.Context, models []any, dir, name, stateFile string, opts Options) (MakeMigrationsResult, error) {
 	result := MakeMigrationsResult{}
+	if err := opts.validate(); err != nil {
+		return result, err
+	}
 	if strings.TrimSpace(name) == "" {
 		return result, fmt.Errorf("--name is required")
 	}
@@ -101,42 +434,414 @@ func MakeMigrations(models []any, dir, name, stateFile string) (MakeMigrationsRe
 	}
 	result.StatePath = absStateFile
 
-	previous, err := loadState(absStateFile)
+	ops, saved, err := planMigration(ctx, models, absStateFile, opts)
 	if err != nil {
 		return result, err
 	}
-	current, err := buildCurrentState(models)
+	result.Warnings = collectSafetyWarnings(ops)
+	files, err := generatedFiles(name, ops, opts)
 	if err != nil {
 		return result, err
 	}
-
-	upSQL, downSQL := buildDiff(previous, current)
-	if len(upSQL) == 0 {
+	if upSQL, _ := splitMigrationOps(ops); len(upSQL) == 0 {
 		return result, nil
 	}
 
-	version := time.Now().Format("20060102150405")
-	fileName := fmt.Sprintf("%s_%s", version, sanitizeName(name))
-	upPath := filepath.Join(absDir, fileName+".up.sql")
-	downPath := filepath.Join(absDir, fileName+".down.sql")
-
-	if err := os.WriteFile(upPath, []byte(strings.Join(upSQL, "\n\n")+"\n"), 0o644); err != nil {
+	if err := ctx.Err(); err != nil {
 		return result, err
 	}
-	if err := os.WriteFile(downPath, []byte(strings.Join(downSQL, "\n\n")+"\n"), 0o644); err != nil {
+	version, err := opts.newVersion(absDir)
+	if err != nil {
 		return result, err
 	}
-	if err := saveState(absStateFile, current); err != nil {
+	if opts.CombinedFile {
+		result.Path, err = writeCombinedMigrationFile(absDir, version, files[0], opts.combinedFileMarkers(), opts.FileEncoding)
+		result.UpPaths, result.DownPaths = []string{result.Path}, []string{result.Path}
+	} else {
+		result.UpPaths, result.DownPaths, err = writeMigrationFilePairs(absDir, version, files, opts.FileEncoding)
+	}
+	if err != nil {
+		return result, err
+	}
+	if err := updateManifest(absDir); err != nil {
+		return result, err
+	}
+	if err := saveStateFiles(absStateFile, opts.StateFiles, saved); err != nil {
 		return result, err
 	}
 
 	result.Changed = true
-	result.UpPath = upPath
-	result.DownPath = downPath
+	result.Version = version
+	result.UpPath = result.UpPaths[0]
+	result.DownPath = result.DownPaths[0]
 	return result, nil
 }
 
+// PreviewMigrations returns the statement blocks MakeMigrations would write
+// for models against stateFile, without writing any file or saving the
+// state. An empty stateFile is the default state file of MakeMigrations.
+// The up blocks are those of every up file in the order Apply runs them,
+// the down blocks those of every down file in the order Rollback runs
+// them; with CombinedFile they are the two directions of the one file.
+func PreviewMigrations(models []any, stateFile string) ([]string, []string, bool, error) {
+	return PreviewMigrationsWithOptions(models, stateFile, Options{})
+}
+
+func PreviewMigrationsWithOptions(models []any, stateFile string, opts Options) ([]string, []string, bool, error) {
+	if err := opts.validate(); err != nil {
+		return nil, nil, false, err
+	}
+	if strings.TrimSpace(stateFile) == "" {
+		stateFile = filepath.Join("database", "migrations", ".schema_state.json")
+	}
+	absStateFile, err := filepath.Abs(stateFile)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	ops, _, err := planMigration(context.Background(), models, absStateFile, opts)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	files, err := generatedFiles("", ops, opts)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if upSQL, _ := splitMigrationOps(ops); len(upSQL) == 0 {
+		return nil, nil, false, nil
+	}
+	up := make([]string, 0)
+	down := make([]string, 0)
+	for i := range files {
+		up = append(up, files[i].up...)
+		down = append(down, files[len(files)-1-i].down...)
+	}
+	return up, down, true, nil
+}
+
+func (o Options) validate() error {
+	if err := validateFileEncoding(o.FileEncoding); err != nil {
+		return err
+	}
+	if err := validateVersion(o.Version); err != nil {
+		return err
+	}
+	if err := validateColumnOrdering(o.ColumnOrdering); err != nil {
+		return err
+	}
+	if err := validateMySQLVersion(o.MySQLVersion); err != nil {
+		return err
+	}
+	if err := validateQuoteMode(o.QuoteMode); err != nil {
+		return err
+	}
+	if err := o.validateCombinedFile(); err != nil {
+		return err
+	}
+	if err := o.validateWrapInTransaction(); err != nil {
+		return err
+	}
+	if err := o.validateSequentialVersions(); err != nil {
+		return err
+	}
+	if o.MaxIdentifierLength < 0 {
+		return fmt.Errorf("MaxIdentifierLength must not be negative, got %d", o.MaxIdentifierLength)
+	}
+	return o.validateDialect()
+}
+
+// planMigration diffs the models against the saved state and returns the
+// ops of the migration together with the state to save once it is written.
+func planMigration(ctx context.Context, models []any, absStateFile string, opts Options) ([]migrationOp, schemaState, error) {
+	if opts.RequireExistingState {
+		if _, err := os.Stat(absStateFile); err != nil {
+			if os.IsNotExist(err) {
+				return nil, schemaState{}, fmt.Errorf("state file %s does not exist; run SyncSchemaState to create it", absStateFile)
+			}
+			return nil, schemaState{}, err
+		}
+	}
+
+	previous, err := loadMergedState(append([]string{absStateFile}, opts.StateFiles...))
+	if err != nil {
+		return nil, schemaState{}, err
+	}
+	if opts.StripComments {
+		previous = stripStateComments(previous)
+	}
+	if opts.ignoresDescendingIndexes() {
+		previous = stripDescendingIndexes(previous, opts.MySQLVersion, nil)
+	}
+	current, err := buildCurrentStateContext(ctx, models, opts)
+	if err != nil {
+		return nil, schemaState{}, err
+	}
+	if opts.DeprecateBeforeDrop {
+		if current, err = withDeprecatedTables(previous, current, opts); err != nil {
+			return nil, schemaState{}, err
+		}
+	}
+
+	all := previous
+	if opts.selectsTables() {
+		if err := validateTableSelection(previous, current, opts); err != nil {
+			return nil, schemaState{}, err
+		}
+		previous, current = selectTables(previous, opts), selectTables(current, opts)
+	}
+
+	ops := diffSchemas(previous, current, opts)
+	if opts.SelfVerify {
+		if err := verifyMigrationOps(previous, current, ops, opts); err != nil {
+			return nil, schemaState{}, err
+		}
+	}
+	saved := current
+	if opts.IndexChangesOnly {
+		ops = indexChangeOps(previous, current, ops)
+		saved = replayMigrationOps(previous, ops)
+	}
+	if opts.selectsTables() {
+		saved = withUnselectedTables(all, saved, opts)
+	}
+	rebuildOps, err := rebuildTableOps(previous, current, opts.RebuildTables, opts.QuoteMode)
+	if err != nil {
+		return nil, schemaState{}, err
+	}
+	ops = append(ops, rebuildOps...)
+	if opts.Dialect == DialectVitess {
+		if err := validateVitessOps(ops); err != nil {
+			return nil, schemaState{}, err
+		}
+	}
+	if opts.Dialect == DialectSQLite {
+		if err := validateSQLiteOps(ops); err != nil {
+			return nil, schemaState{}, err
+		}
+	}
+	if opts.OnOperation != nil {
+		for _, op := range operationsOf(ops) {
+			opts.OnOperation(op)
+		}
+	}
+	return ops, saved, nil
+}
+
+const foreignKeysFileSuffix = "_foreign_keys"
+
+// generatedFile is the statement blocks of one file pair of a migration, or
+// of its combined file, as MakeMigrations writes them. name is the
+// migration name the file is named after.
+type generatedFile struct {
+	name     string
+	up, down []string
+}
+
+// generatedFiles lays ops out in the files MakeMigrations writes for opts:
+// one combined file, one pair per table with PerTableFiles, or one pair.
+// With BlockDestructive it refuses destructive ops instead.
+func generatedFiles(name string, ops []migrationOp, opts Options) ([]generatedFile, error) {
+	if opts.BlockDestructive && !opts.AllowDestructive {
+		if err := destructiveOpsError(ops); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case opts.CombinedFile:
+		upSQL, downSQL := splitMigrationOps(ops)
+		markers := opts.combinedFileMarkers()
+		return []generatedFile{{name: name, up: markers.enclose(opts.wrapFileSQL(upSQL)), down: markers.enclose(opts.wrapFileSQL(downSQL))}}, nil
+	case opts.PerTableFiles:
+		return perTableGeneratedFiles(name, ops, opts)
+	}
+	upSQL, downSQL := markedMigrationOps(ops)
+	return []generatedFile{{name: name, up: opts.wrapFileSQL(upSQL), down: opts.wrapFileSQL(downSQL)}}, nil
+}
+
+// perTableGeneratedFiles splits ops by table. Foreign key additions can
+// reference any table, so they go to a separate file applied last.
+func perTableGeneratedFiles(name string, ops []migrationOp, opts Options) ([]generatedFile, error) {
+	byTable := map[string][]migrationOp{}
+	crossTable := make([]migrationOp, 0)
+	for _, op := range ops {
+		if op.kind == opAddForeignKey || op.kind == opRenameForeignKey {
+			crossTable = append(crossTable, op)
+			continue
+		}
+		byTable[op.table] = append(byTable[op.table], op)
+	}
+	groups := make([][]migrationOp, 0, len(byTable)+1)
+	names := make([]string, 0, len(byTable)+1)
+	for _, table := range sortedKeys(byTable) {
+		// Apply tells the foreign key file by its name and runs it last, so
+		// a table file must not end the same way.
+		if strings.HasSuffix(sanitizeName(name+"_"+table), foreignKeysFileSuffix) {
+			return nil, fmt.Errorf("table `%s` would get a file named like the %s file of the migration; PerTableFiles cannot be used while it changes", table, strings.TrimPrefix(foreignKeysFileSuffix, "_"))
+		}
+		groups = append(groups, byTable[table])
+		names = append(names, name+"_"+table)
+	}
+	groups = append(groups, crossTable)
+	names = append(names, name+foreignKeysFileSuffix)
+
+	files := make([]generatedFile, 0, len(groups))
+	for i, group := range groups {
+		upSQL, downSQL := markedMigrationOps(group)
+		if len(upSQL) == 0 && len(downSQL) == 0 {
+			continue
+		}
+		files = append(files, generatedFile{name: names[i], up: opts.wrapFileSQL(upSQL), down: opts.wrapFileSQL(downSQL)})
+	}
+	return files, nil
+}
+
+// writeMigrationFilePairs writes the up and down file of each of files, or
+// none of them if one fails.
+func writeMigrationFilePairs(absDir, version string, files []generatedFile, encoding FileEncoding) ([]string, []string, error) {
+	upPaths := make([]string, 0, len(files))
+	downPaths := make([]string, 0, len(files))
+	for _, file := range files {
+		upPath, downPath, err := writeMigrationFiles(absDir, version, file.name, file.up, file.down, encoding)
+		if err != nil {
+			removeFiles(append(upPaths, downPaths...))
+			return nil, nil, err
+		}
+		upPaths = append(upPaths, upPath)
+		downPaths = append(downPaths, downPath)
+	}
+	return upPaths, downPaths, nil
+}
+
+func writeMigrationFiles(absDir, version, name string, upSQL, downSQL []string, encoding FileEncoding) (string, string, error) {
+	fileName := fmt.Sprintf("%s_%s", version, sanitizeName(name))
+	upPath := filepath.Join(absDir, fileName+".up.sql")
+	downPath := filepath.Join(absDir, fileName+".down.sql")
+
+	if err := writeSQLFile(upPath, strings.Join(upSQL, "\n\n")+"\n", encoding); err != nil {
+		return "", "", err
+	}
+	if err := writeSQLFile(downPath, strings.Join(downSQL, "\n\n")+"\n", encoding); err != nil {
+		removeFiles([]string{upPath})
+		return "", "", err
+	}
+	return upPath, downPath, nil
+}
+
+// removeFiles deletes the files of a migration that could not be written in
+// full, so Apply never sees half of one.
+func removeFiles(paths []string) {
+	for _, path := range paths {
+		_ = os.Remove(path)
+	}
+}
+
+// wrapFileSQL adds the file-level SQL mode guard and annotations around the
+// statement blocks of one generated file.
+func (o Options) wrapFileSQL(sql []string) []string {
+	if o.WrapInTransaction {
+		sql = withTransaction(sql, o.Dialect)
+	}
+	if o.Dialect == DialectVitess {
+		sql = withVitessDDLStrategy(sql)
+	}
+	return withAnnotations(withSQLMode(sql, o.SQLMode), o.Annotations)
+}
+
+// withSQLMode wraps sql in blocks that switch the session sql_mode and
+// restore it. The switch and the restore are written in both files, so in
+// the up file the switch pairs with the restore of the down file; if the up
+// file fails early, Apply's compensation restores the mode too.
+func withSQLMode(sql []string, mode string) []string {
+	mode = strings.TrimSpace(mode)
+	if mode == "" {
+		return sql
+	}
+	set := "SET @old_sql_mode = @@SESSION.sql_mode;\nSET SESSION sql_mode = " + quoteSQLString(mode) + ";"
+	restore := "SET SESSION sql_mode = @old_sql_mode;"
+	out := make([]string, 0, len(sql)+2)
+	out = append(out, set)
+	out = append(out, sql...)
+	return append(out, restore)
+}
+
+// withAnnotations prepends the annotations as a block of comment lines. Each
+// line of an annotation becomes its own comment so none of it can be read as
+// SQL.
+func withAnnotations(sql []string, annotations []string) []string {
+	if len(annotations) == 0 {
+		return sql
+	}
+	lines := make([]string, 0, len(annotations))
+	for _, annotation := range annotations {
+		for _, line := range strings.Split(strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(annotation), "\n") {
+			lines = append(lines, strings.TrimRight("-- "+line, " "))
+		}
+	}
+	return append([]string{strings.Join(lines, "\n")}, sql...)
+}
+
+const versionLayout = "20060102150405"
+
+func validateVersion(version string) error {
+	version = strings.TrimSpace(version)
+	if version == "" {
+		return nil
+	}
+	for _, r := range version {
+		if r < '0' || r > '9' {
+			return fmt.Errorf("version %q must contain only digits", version)
+		}
+	}
+	if len(version) == len(versionLayout) {
+		if _, err := time.Parse(versionLayout, version); err != nil {
+			return fmt.Errorf("version %q is not a valid %s timestamp", version, versionLayout)
+		}
+	}
+	return nil
+}
+
+// newVersion picks the version of the next migration written to dir:
+// Options.Version, the next sequential number with
+// Options.SequentialVersions, or the current time. A time another migration
+// of dir already uses moves on to the next free second, so migrations
+// written within one second keep their order.
+func (o Options) newVersion(dir string) (string, error) {
+	if version := strings.TrimSpace(o.Version); version != "" {
+		if err := ensureVersionUnused(dir, version); err != nil {
+			return "", err
+		}
+		return version, nil
+	}
+	if o.SequentialVersions {
+		return nextSequentialVersion(dir, o.sequentialWidth())
+	}
+	for now := time.Now(); ; now = now.Add(time.Second) {
+		version := now.Format(versionLayout)
+		existing, err := filepath.Glob(filepath.Join(dir, version+"_*.sql"))
+		if err != nil {
+			return "", err
+		}
+		if len(existing) == 0 {
+			return version, nil
+		}
+	}
+}
+
+func ensureVersionUnused(dir, version string) error {
+	existing, err := filepath.Glob(filepath.Join(dir, version+"_*.sql"))
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return fmt.Errorf("version %s is already used by %s", version, filepath.Base(existing[0]))
+	}
+	return nil
+}
+
 func SyncSchemaState(models []any, dir, stateFile string) (string, error) {
+	return SyncSchemaStateWithOptions(models, dir, stateFile, Options{})
+}
+
+func SyncSchemaStateWithOptions(models []any, dir, stateFile string, opts Options) (string, error) {
 	if strings.TrimSpace(dir) == "" {
 		dir = filepath.Join("database", "migrations")
 	}
@@ -155,7 +860,7 @@ func SyncSchemaState(models []any, dir, stateFile string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	current, err := buildCurrentState(models)
+	current, err := buildCurrentStateWithOptions(models, opts)
 	if err != nil {
 		return "", err
 	}
@@ -165,6 +870,24 @@ func SyncSchemaState(models []any, dir, stateFile string) (string, error) {
 	return absStateFile, nil
 }
 
+// DiffStateFiles returns the statements that migrate the schema saved in
+// fromPath to the one saved in toPath, and back. Both files must exist.
+func DiffStateFiles(fromPath, toPath string) ([]string, []string, error) {
+	states := make([]schemaState, 0, 2)
+	for _, path := range []string{fromPath, toPath} {
+		if _, err := os.Stat(path); err != nil {
+			return nil, nil, fmt.Errorf("load state file %s: %w", path, err)
+		}
+		state, err := loadState(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("load state file %s: %w", path, err)
+		}
+		states = append(states, state)
+	}
+	up, down := buildDiff(states[0], states[1])
+	return up, down, nil
+}
+
 func loadState(path string) (schemaState, error) {
 	state := schemaState{Tables: map[string]tableState{}}
 	data, err := os.ReadFile(path)
@@ -183,38 +906,131 @@ func loadState(path string) (schemaState, error) {
 	if state.Tables == nil {
 		state.Tables = map[string]tableState{}
 	}
-	return state, nil
+	return upgradeState(state)
+}
+
+// loadMergedState loads every state file and combines their tables. A table
+// present in several files must be saved identically in each of them.
+func loadMergedState(paths []string) (schemaState, error) {
+	merged := schemaState{Tables: map[string]tableState{}}
+	owners := map[string]string{}
+	for _, path := range paths {
+		if strings.TrimSpace(path) == "" {
+			continue
+		}
+		state, err := loadState(path)
+		if err != nil {
+			return schemaState{}, fmt.Errorf("load state file %s: %w", path, err)
+		}
+		for _, tableName := range sortedKeys(state.Tables) {
+			table := state.Tables[tableName]
+			existing, ok := merged.Tables[tableName]
+			if !ok {
+				merged.Tables[tableName] = table
+				owners[tableName] = path
+				continue
+			}
+			mismatch := tableMismatch(table, existing, Options{})
+			if mismatch == "" {
+				mismatch = tableMismatch(existing, table, Options{})
+			}
+			// tableMismatch leaves out what the database cannot report,
+			// such as column order, but the state records it too.
+			if mismatch == "" && !sameTableState(table, existing) {
+				mismatch = "is saved differently"
+			}
+			if mismatch != "" {
+				return schemaState{}, fmt.Errorf("state file %s conflicts with %s: table `%s` %s", path, owners[tableName], tableName, mismatch)
+			}
+		}
+	}
+	return merged, nil
+}
+
+// sameTableState compares two saved tables as their state files record
+// them.
+func sameTableState(a, b tableState) bool {
+	aJSON, aErr := json.Marshal(a)
+	bJSON, bErr := json.Marshal(b)
+	return aErr == nil && bErr == nil && bytes.Equal(aJSON, bJSON)
+}
+
+// saveStateFiles saves state to the primary state file and updates the
+// tables each extra state file holds, so the files still merge on the next
+// run. Tables state no longer has are removed from them.
+func saveStateFiles(primary string, extra []string, state schemaState) error {
+	if err := saveState(primary, state); err != nil {
+		return err
+	}
+	for _, path := range extra {
+		if strings.TrimSpace(path) == "" {
+			continue
+		}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		held, err := loadState(path)
+		if err != nil {
+			return fmt.Errorf("load state file %s: %w", path, err)
+		}
+		for tableName := range held.Tables {
+			if table, ok := state.Tables[tableName]; ok {
+				held.Tables[tableName] = table
+			} else {
+				delete(held.Tables, tableName)
+			}
+		}
+		if err := saveState(path, held); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func saveState(path string, state schemaState) error {
 	if state.Tables == nil {
 		state.Tables = map[string]tableState{}
 	}
+	state.Version = stateVersion
 	data, err := json.MarshalIndent(state, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, append(data, '\n'), 0o644)
+	return writeFileAtomic(path, append(data, '\n'))
 }
 
 func buildCurrentState(models []any) (schemaState, error) {
-	db, cleanup, err := newDryRunMySQL()
+	return buildCurrentStateWithOptions(models, Options{})
+}
+
+func buildCurrentStateWithOptions(models []any, opts Options) (schemaState, error) {
+	return buildCurrentStateContext(context.Background(), models, opts)
+}
+
+func buildCurrentStateContext(ctx context.Context, models []any, opts Options) (schemaState, error) {
+	db, cleanup, err := newDryRun(opts.Dialect)
 	if err != nil {
 		return schemaState{}, err
 	}
 	defer cleanup()
+	if opts.IndexNamer != nil {
+		db.Config.NamingStrategy = indexNamer{Namer: db.Config.NamingStrategy, name: opts.IndexNamer}
+	}
 
-	schemas, err := collectSchemas(db, models)
+	schemas, err := collectSchemas(ctx, db, models)
 	if err != nil {
 		return schemaState{}, err
 	}
-	foreignKeysByTable, err := collectForeignKeysByTable(schemas)
+	foreignKeysByTable, err := collectForeignKeysByTable(schemas, opts.ForeignKeyNamer, opts.Logger)
 	if err != nil {
 		return schemaState{}, err
 	}
 
 	state := schemaState{Tables: map[string]tableState{}}
 	for _, tableName := range sortedKeys(schemas) {
+		if err := ctx.Err(); err != nil {
+			return schemaState{}, err
+		}
 		table, err := buildTableState(db, schemas[tableName])
 		if err != nil {
 			return schemaState{}, err
@@ -225,14 +1041,62 @@ func buildCurrentState(models []any) (schemaState, error) {
 		if fks := foreignKeysByTable[tableName]; len(fks) > 0 {
 			table.ForeignKeys = fks
 		}
+		if err := validateSetNullForeignKeys(tableName, table); err != nil {
+			return schemaState{}, err
+		}
 		state.Tables[tableName] = table
 	}
+	if len(opts.ShardTables) > 0 {
+		shards, err := shardTablesByBase(db, opts.ShardTables)
+		if err != nil {
+			return schemaState{}, err
+		}
+		if state, err = expandShardTables(state, shards); err != nil {
+			return schemaState{}, err
+		}
+	}
+	if err := validateIdentifierLengths(state, opts); err != nil {
+		return schemaState{}, err
+	}
+	if opts.StripComments {
+		state = stripStateComments(state)
+	}
+	if opts.ignoresDescendingIndexes() {
+		state = stripDescendingIndexes(state, opts.MySQLVersion, opts.Logger)
+	}
 	return state, nil
 }
 
-func collectSchemas(db *gorm.DB, models []any) (map[string]*schema.Schema, error) {
+func stripStateComments(state schemaState) schemaState {
+	out := schemaState{Tables: make(map[string]tableState, len(state.Tables))}
+	for tableName, table := range state.Tables {
+		columns := make(map[string]columnState, len(table.Columns))
+		for name, col := range table.Columns {
+			col.Definition = stripDefinitionComment(col.Definition)
+			col.Comment = ""
+			columns[name] = col
+		}
+		table.Columns = columns
+		table.Comment = ""
+		if table.Indexes != nil {
+			indexes := make(map[string]indexState, len(table.Indexes))
+			for name, idx := range table.Indexes {
+				idx.Comment = ""
+				indexes[name] = idx
+			}
+			table.Indexes = indexes
+		}
+		out.Tables[tableName] = table
+	}
+	return out
+}
+
+func collectSchemas(ctx context.Context, db *gorm.DB, models []any) (map[string]*schema.Schema, error) {
 	schemas := map[string]*schema.Schema{}
 	for _, m := range models {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		stmt := &gorm.Statement{DB: db}
 		if err := stmt.Parse(m); err != nil {
 			return nil, err
@@ -277,25 +1141,55 @@ func buildTableState(db *gorm.DB, sc *schema.Schema) (tableState, error) {
 		return tableState{}, nil
 	}
 	stmt := &gorm.Statement{DB: db, Schema: sc}
+	dialect := dialectOf(db)
 	table := tableState{
 		Columns:     map[string]columnState{},
 		Indexes:     map[string]indexState{},
 		ForeignKeys: map[string]foreignKeyState{},
 		PrimaryKeys: make([]string, 0),
 	}
+	// sc.Fields lists the fields of embedded structs in declaration order,
+	// so the primary key keeps the declared column order. A column declared
+	// by more than one embedded struct is taken from the field GORM maps it
+	// to.
 	for _, field := range sc.Fields {
 		if shouldSkipField(field) {
 			continue
 		}
+		if mapped, ok := sc.FieldsByDBName[field.DBName]; ok && mapped != field {
+			continue
+		}
 		definition := normalizeDefinition(exprToString(db.Migrator().FullDataTypeOf(field)))
 		if definition == "" {
 			continue
 		}
-		table.Columns[field.DBName] = columnState{Definition: definition}
-		if field.PrimaryKey {
+		if dialect.isMySQL() {
+			if err := validateColumnDefault(sc.Table, field.DBName, definition); err != nil {
+				return tableState{}, err
+			}
+		}
+		if _, seen := table.Columns[field.DBName]; !seen {
+			table.ColumnOrder = append(table.ColumnOrder, field.DBName)
+		}
+		table.Columns[field.DBName] = columnState{
+			Definition:       definition,
+			CreateOnly:       field.Creatable && !field.Updatable,
+			Comment:          strings.TrimSpace(field.Comment),
+			Generated:        generatedColumnExpression(definition),
+			GeneratedStorage: generatedColumnStorage(definition),
+			RenamedFrom:      strings.TrimSpace(field.TagSettings["RENAMED_FROM"]),
+		}
+		if field.PrimaryKey && !containsString(table.PrimaryKeys, field.DBName) {
 			table.PrimaryKeys = append(table.PrimaryKeys, field.DBName)
 		}
 	}
+	// GORM builds a many2many join table from whichever side it parses
+	// first, so its columns have no declared order.
+	if sc.ModelType != nil && sc.ModelType.Name() == "" {
+		sort.Strings(table.PrimaryKeys)
+		sort.Strings(table.ColumnOrder)
+	}
+	applyModelTableOptions(&table, sc)
 
 	parsedIndexes := sc.ParseIndexes()
 	if err := validateParsedIndexTags(stmt, parsedIndexes); err != nil {
@@ -306,7 +1200,7 @@ func buildTableState(db *gorm.DB, sc *schema.Schema) (tableState, error) {
 			continue
 		}
 		index := parsedIndexes[indexName]
-		if strings.TrimSpace(index.Where) != "" {
+		if strings.TrimSpace(index.Where) != "" && dialect.isMySQL() {
 			return tableState{}, fmt.Errorf("table `%s` index `%s` uses where=%q, which is unsupported for MySQL migrations", sc.Table, indexName, strings.TrimSpace(index.Where))
 		}
 		idx := indexState{
@@ -335,13 +1229,43 @@ func buildTableState(db *gorm.DB, sc *schema.Schema) (tableState, error) {
 		if len(idx.Fields) == 0 {
 			continue
 		}
+		if limit := maxIndexFields(dialect); len(idx.Fields) > limit {
+			return tableState{}, fmt.Errorf("table `%s` index `%s` has %d fields, exceeding the %s limit of %d", sc.Table, indexName, len(idx.Fields), dialect, limit)
+		}
 		table.Indexes[indexName] = idx
 	}
-	sort.Strings(table.PrimaryKeys)
+	if err := applyIndexOperatorClasses(&table, stmt); err != nil {
+		return tableState{}, err
+	}
+	if err := applyModelTableIndexes(&table, sc, dialect); err != nil {
+		return tableState{}, err
+	}
+	if err := validateIndexOperatorClasses(sc.Table, table, dialect); err != nil {
+		return tableState{}, err
+	}
+	if err := applyIndexCreateOrder(&table, stmt); err != nil {
+		return tableState{}, err
+	}
+	if err := applyIndexTablespaces(&table, stmt, dialect); err != nil {
+		return tableState{}, err
+	}
+	if err := validateAutoIncrementKeys(sc.Table, table); err != nil {
+		return tableState{}, err
+	}
+	if dialect.isMySQL() {
+		if err := validateSpatialIndexes(sc.Table, table); err != nil {
+			return tableState{}, err
+		}
+		if err := validateGeneratedColumns(sc.Table, table); err != nil {
+			return tableState{}, err
+		}
+	}
 	return table, nil
 }
 
-func collectForeignKeysByTable(schemas map[string]*schema.Schema) (map[string]map[string]foreignKeyState, error) {
+// collectForeignKeysByTable reads the foreign keys of every relationship,
+// named by namer when it is set and by GORM otherwise.
+func collectForeignKeysByTable(schemas map[string]*schema.Schema, namer func(table string, columns []string, refTable string) string, logger Logger) (map[string]map[string]foreignKeyState, error) {
 	result := map[string]map[string]foreignKeyState{}
 	signaturesByTable := map[string]map[string]string{}
 	for _, tableName := range sortedKeys(schemas) {
@@ -357,22 +1281,23 @@ func collectForeignKeysByTable(schemas map[string]*schema.Schema) (map[string]ma
 				return
 			}
 			constraint := rel.ParseConstraint()
-			if constraint == nil || constraint.Schema == nil || constraint.ReferenceSchema == nil {
+			if reason := skippedConstraintReason(rel, constraint); reason != "" {
+				logf(logger, "skipping foreign key of relation %s.%s: %s", rel.Schema.Table, rel.Name, reason)
 				return
 			}
-			if strings.TrimSpace(constraint.Schema.Table) == "" {
+			fk, err := foreignKeyFromConstraint(constraint)
+			if err != nil {
+				firstErr = err
 				return
 			}
 			fkName := strings.TrimSpace(constraint.Name)
+			if namer != nil {
+				fkName = strings.TrimSpace(namer(constraint.Schema.Table, append([]string{}, fk.Columns...), fk.RefTable))
+			}
 			if fkName == "" {
 				firstErr = fmt.Errorf("table `%s` has unnamed foreign key constraint", constraint.Schema.Table)
 				return
 			}
-			fk, err := foreignKeyFromConstraint(constraint)
-			if err != nil {
-				firstErr = err
-				return
-			}
 			fkMap := result[constraint.Schema.Table]
 			if fkMap == nil {
 				fkMap = map[string]foreignKeyState{}
@@ -409,6 +1334,22 @@ func collectForeignKeysByTable(schemas map[string]*schema.Schema) (map[string]ma
 	return result, nil
 }
 
+// skippedConstraintReason explains why a relationship yields no foreign key,
+// or returns "" when constraint should be collected.
+func skippedConstraintReason(rel *schema.Relationship, constraint *schema.Constraint) string {
+	switch {
+	case constraint == nil && rel.Field != nil && rel.Field.TagSettings["CONSTRAINT"] == "-":
+		return "disabled with constraint:-"
+	case constraint == nil:
+		return "the constraint is declared by the inverse relation"
+	case constraint.Schema == nil || constraint.ReferenceSchema == nil:
+		return "no reference to a primary key could be resolved"
+	case strings.TrimSpace(constraint.Schema.Table) == "":
+		return "the owning table has no name"
+	}
+	return ""
+}
+
 func foreignKeyFromConstraint(c *schema.Constraint) (foreignKeyState, error) {
 	if c == nil || c.Schema == nil || c.ReferenceSchema == nil {
 		return foreignKeyState{}, fmt.Errorf("invalid foreign key constraint")
@@ -445,6 +1386,70 @@ func foreignKeyFromConstraint(c *schema.Constraint) (foreignKeyState, error) {
 	}), nil
 }
 
+// validateSetNullForeignKeys rejects SET NULL actions on foreign keys whose
+// columns cannot hold NULL, which MySQL refuses when adding the constraint.
+func validateSetNullForeignKeys(tableName string, table tableState) error {
+	for _, name := range sortedKeys(table.ForeignKeys) {
+		fk := normalizeForeignKey(table.ForeignKeys[name])
+		for _, action := range []struct{ clause, value string }{{"ON DELETE", fk.OnDelete}, {"ON UPDATE", fk.OnUpdate}} {
+			if action.value != "SET NULL" {
+				continue
+			}
+			for _, col := range fk.Columns {
+				column, ok := table.Columns[col]
+				if ok && (!isNullableDefinition(column.Definition) || containsString(table.PrimaryKeys, col)) {
+					return fmt.Errorf("table `%s` foreign key `%s` uses %s SET NULL but column `%s` is NOT NULL", tableName, name, action.clause, col)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func newDryRun(dialect Dialect) (*gorm.DB, func(), error) {
+	switch dialect {
+	case DialectPostgres:
+		return newDryRunPostgres()
+	case DialectSQLite:
+		return newDryRunSQLite()
+	}
+	return newDryRunMySQL()
+}
+
+// newDryRunSQLite opens an in-memory database since the SQLite driver
+// cannot wrap a mock connection; DryRun keeps it empty.
+func newDryRunSQLite() (*gorm.DB, func(), error) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		DryRun:                                   true,
+		DisableForeignKeyConstraintWhenMigrating: true,
+		NamingStrategy:                           schema.NamingStrategy{},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, func() { _ = sqlDB.Close() }, nil
+}
+
+func newDryRunPostgres() (*gorm.DB, func(), error) {
+	sqlDB, _, err := sqlmock.New()
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		DisableForeignKeyConstraintWhenMigrating: true,
+		NamingStrategy:                           schema.NamingStrategy{},
+	})
+	if err != nil {
+		_ = sqlDB.Close()
+		return nil, nil, err
+	}
+	return db, func() { _ = sqlDB.Close() }, nil
+}
+
 func newDryRunMySQL() (*gorm.DB, func(), error) {
 	sqlDB, _, err := sqlmock.New()
 	if err != nil {
@@ -464,6 +1469,18 @@ func newDryRunMySQL() (*gorm.DB, func(), error) {
 	return db, func() { _ = sqlDB.Close() }, nil
 }
 
+// indexNamer overrides only the index names of a naming strategy. GORM and
+// validateParsedIndexTags both resolve unnamed index tags through the
+// strategy, so they agree on the result.
+type indexNamer struct {
+	schema.Namer
+	name func(table, column string) string
+}
+
+func (n indexNamer) IndexName(table, column string) string {
+	return n.name(table, n.Namer.ColumnName(table, column))
+}
+
 func shouldSkipField(field *schema.Field) bool {
 	if field == nil {
 		return true
@@ -485,11 +1502,45 @@ func exprToString(expr clause.Expr) string {
 	return sqlText
 }
 
+// normalizeDefinition trims a definition and collapses whitespace outside
+// quoted strings, so string and expression defaults keep their exact value.
 func normalizeDefinition(definition string) string {
-	return strings.Join(strings.Fields(strings.TrimSpace(definition)), " ")
+	var b strings.Builder
+	var quote rune
+	space := false
+	runes := []rune(strings.TrimSpace(definition))
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			b.WriteRune(r)
+			if r == '\\' && i+1 < len(runes) {
+				i++
+				b.WriteRune(runes[i])
+			} else if r == quote {
+				quote = 0
+			}
+		case unicode.IsSpace(r):
+			space = true
+		default:
+			if space {
+				b.WriteByte(' ')
+				space = false
+			}
+			if r == '\'' || r == '"' || r == '`' {
+				quote = r
+			}
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
 }
 
 func buildDiff(previous, current schemaState) ([]string, []string) {
+	return splitMigrationOps(diffSchemas(previous, current, Options{}))
+}
+
+func diffSchemas(previous, current schemaState, opts Options) []migrationOp {
 	ops := make([]migrationOp, 0)
 
 	prevTables := sortedKeys(previous.Tables)
@@ -502,38 +1553,98 @@ func buildDiff(previous, current schemaState) ([]string, []string) {
 	for _, t := range curTables {
 		curSet[t] = true
 	}
+	renames := tableRenames(previous, current, opts)
+	renamedTo := make(map[string]bool, len(renames))
+	for from, to := range renames {
+		renamedTo[to] = true
+		previous = renameTableReferences(previous, from, to)
+	}
+
+	// Tables are renamed first so that foreign keys added below can
+	// reference them under their new names.
+	for _, from := range sortedKeys(renames) {
+		ops = append(ops, renameTableOp(from, renames[from], opts))
+	}
 
+	kept := make(map[string]string, len(curTables))
 	for _, tableName := range curTables {
-		if !prevSet[tableName] {
-			create := createTableSQL(tableName, current.Tables[tableName])
-			drop := fmt.Sprintf("DROP TABLE IF EXISTS `%s`;", tableName)
-			ops = append(ops, migrationOp{up: create, down: drop})
+		if prevSet[tableName] {
+			kept[tableName] = tableName
 		}
 	}
+	for from, to := range renames {
+		kept[to] = from
+	}
+	refDrops, refAdds, previous := referencedColumnRenameOps(previous, current, kept, opts)
+	ops = append(ops, refDrops...)
 
+	created := make([]string, 0)
 	for _, tableName := range curTables {
-		if prevSet[tableName] {
-			continue
+		if !prevSet[tableName] && !renamedTo[tableName] {
+			created = append(created, tableName)
 		}
-		ops = append(ops, addForeignKeyOpsForNewTable(tableName, current.Tables[tableName])...)
+	}
+	// New tables are created after the tables they reference, so that
+	// foreign keys declared in CREATE TABLE find them.
+	creationOrder := tableCreationOrder(current.Tables, created)
+	inlined := inlinedForeignKeys(current.Tables, creationOrder, opts)
+	for _, tableName := range creationOrder {
+		create := createTableSQLInlining(tableName, current.Tables[tableName], inlined[tableName], opts)
+		drop := opts.emitter().DropTable(tableName)
+		ops = append(ops, migrationOp{
+			kind:  opCreateTable,
+			table: tableName,
+			name:  tableName,
+			up:    create,
+			down:  drop,
+			apply: createTableChange(tableName, current.Tables[tableName]),
+		})
+	}
+
+	for _, tableName := range created {
+		ops = append(ops, addForeignKeyOpsForNewTable(tableName, current.Tables[tableName], inlined[tableName], opts)...)
 	}
 
 	for _, tableName := range prevTables {
-		if !curSet[tableName] {
-			ops = append(ops, restoreForeignKeyOpsForDroppedTable(tableName, previous.Tables[tableName])...)
-			drop := fmt.Sprintf("DROP TABLE IF EXISTS `%s`;", tableName)
-			create := createTableSQL(tableName, previous.Tables[tableName])
-			ops = append(ops, migrationOp{up: drop, down: create})
+		if _, renamed := renames[tableName]; !curSet[tableName] && !renamed {
+			ops = append(ops, restoreForeignKeyOpsForDroppedTable(tableName, previous.Tables[tableName], opts)...)
+			drop := opts.emitter().DropTable(tableName)
+			create := createTableSQLWithOptions(tableName, previous.Tables[tableName], opts)
+			create = withAutoIncrementRestore(create, tableName, previous.Tables[tableName], opts)
+			if opts.AnnotateDataLoss {
+				create = droppedTableDataLossNote + "\n" + create
+			}
+			ops = append(ops, migrationOp{
+				kind:     opDropTable,
+				table:    tableName,
+				name:     tableName,
+				up:       drop,
+				down:     create,
+				warnings: []SafetyWarning{droppedTableWarning(tableName)},
+				apply:    dropTableChange(tableName),
+			})
 		}
 	}
 
+	for _, from := range sortedKeys(renames) {
+		to := renames[from]
+		ops = append(ops, diffTableWithOptions(to, previous.Tables[from], current.Tables[to], opts)...)
+	}
+
 	for _, tableName := range curTables {
 		if !prevSet[tableName] {
 			continue
 		}
-		ops = append(ops, diffTable(tableName, previous.Tables[tableName], current.Tables[tableName])...)
+		ops = append(ops, diffTableWithOptions(tableName, previous.Tables[tableName], current.Tables[tableName], opts)...)
+	}
+	ops = append(ops, refAdds...)
+	if opts.BatchAlter {
+		ops = batchForeignKeyOps(ops)
 	}
+	return ops
+}
 
+func splitMigrationOps(ops []migrationOp) ([]string, []string) {
 	up := make([]string, 0, len(ops))
 	down := make([]string, 0, len(ops))
 	for _, op := range ops {
@@ -549,10 +1660,93 @@ func buildDiff(previous, current schemaState) ([]string, []string) {
 	return up, down
 }
 
+// operationMarker starts each block of the up and down files
+// MakeMigrations writes, followed by the number of the operation the block
+// belongs to.
+const operationMarker = "-- operation "
+
+// markedMigrationOps is splitMigrationOps for the files Apply reads: every
+// block starts with the operationMarker of its op in both files, so Apply
+// pairs an up block with the down blocks that undo it however many ops
+// have only one side. An op without an up, such as a foreign key restored
+// after its dropped table is created again, is undone as part of the next
+// op that has one.
+func markedMigrationOps(ops []migrationOp) ([]string, []string) {
+	numbers := make([]int, len(ops))
+	n := 1
+	for i, op := range ops {
+		numbers[i] = n
+		if strings.TrimSpace(op.up) != "" {
+			n++
+		}
+	}
+	up := make([]string, 0, len(ops))
+	down := make([]string, 0, len(ops))
+	for i, op := range ops {
+		if strings.TrimSpace(op.up) != "" {
+			up = append(up, fmt.Sprintf("%s%d\n%s", operationMarker, numbers[i], op.up))
+		}
+	}
+	for i := len(ops) - 1; i >= 0; i-- {
+		if strings.TrimSpace(ops[i].down) != "" {
+			down = append(down, fmt.Sprintf("%s%d\n%s", operationMarker, numbers[i], ops[i].down))
+		}
+	}
+	return up, down
+}
+
+// indexChangeOps keeps the index ops of ops that can run against the previous
+// schema: the table must exist and, for creates and changes, so must every
+// indexed column. Indexes on new tables and columns wait for a full run.
+func indexChangeOps(previous, current schemaState, ops []migrationOp) []migrationOp {
+	out := make([]migrationOp, 0, len(ops))
+	for _, op := range ops {
+		if op.kind != opCreateIndex && op.kind != opModifyIndex && op.kind != opDropIndex && op.kind != opRenameIndex {
+			continue
+		}
+		prevTable, ok := previous.Tables[op.table]
+		if !ok {
+			continue
+		}
+		if op.kind != opDropIndex && !indexColumnsExist(current.Tables[op.table].Indexes[op.name], prevTable) {
+			continue
+		}
+		out = append(out, op)
+	}
+	return out
+}
+
+func indexColumnsExist(idx indexState, table tableState) bool {
+	for _, field := range idx.Fields {
+		if field.Column == "" {
+			continue
+		}
+		if _, ok := table.Columns[field.Column]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
 func diffTable(tableName string, prev, cur tableState) []migrationOp {
-	ops := make([]migrationOp, 0)
-	fkDropOps, fkAddOps := diffForeignKeys(tableName, prev.ForeignKeys, cur.ForeignKeys)
+	return diffTableWithOptions(tableName, prev, cur, Options{})
+}
+
+func diffTableWithOptions(tableName string, prev, cur tableState, opts Options) []migrationOp {
+	em := opts.emitter()
+	ops, prev := renameColumnOps(tableName, prev, cur, opts)
+	if opts.Dialect == DialectSQLite && sqliteNeedsRebuild(prev, cur, opts) {
+		return append(ops, sqliteRebuildTableOp(tableName, prev, cur, opts))
+	}
+	fkDropOps, fkAddOps := diffForeignKeysWithOptions(tableName, prev.ForeignKeys, cur.ForeignKeys, opts)
 	ops = append(ops, fkDropOps...)
+	if opts.Dialect.isMySQL() {
+		ops = append(ops, diffTableCharset(tableName, prev, cur, opts)...)
+		ops = append(ops, diffTableCollation(tableName, prev, cur, opts)...)
+		ops = append(ops, diffTableEngine(tableName, prev, cur, em)...)
+	}
+	ops = append(ops, diffTableTablespace(tableName, prev, cur, opts)...)
+	ops = append(ops, diffTableComment(tableName, prev, cur, opts)...)
 
 	prevCols := sortedKeys(prev.Columns)
 	curCols := sortedKeys(cur.Columns)
@@ -565,30 +1759,180 @@ func diffTable(tableName string, prev, cur tableState) []migrationOp {
 		curSet[c] = true
 	}
 
+	// With TrackColumnOrder, added columns are placed after their declared
+	// predecessor. Dropped columns are dropped in declared order, so the
+	// down adds them back in reverse order, each after the nearest column
+	// that was kept.
+	trackOrder := opts.TrackColumnOrder && opts.Dialect.isMySQL()
+	addOrder, dropOrder := curCols, prevCols
+	if trackOrder {
+		addOrder = declaredColumnOrder(curCols, cur.ColumnOrder)
+		dropOrder = declaredColumnOrder(prevCols, prev.ColumnOrder)
+	}
+
+	pkChanged := primaryKeyChanged(prev, cur)
+	// Columns that only gain AUTO_INCREMENT wait until the indexes exist,
+	// since MySQL requires the column to lead a key and allows only one
+	// AUTO_INCREMENT column, which another column may give up meanwhile.
+	autoIncrementAdds := make([]migrationOp, 0)
+	added := map[string]bool{}
+	for _, col := range addOrder {
+		if !prevSet[col] {
+			def := cur.Columns[col].Definition
+			if pkChanged && isAutoIncrementKey(cur, col) {
+				def = withoutAutoIncrement(def)
+			}
+			column := ColumnDefinition{Name: col, Definition: def, Comment: columnComment(cur.Columns[col])}
+			if trackOrder {
+				column = placeColumn(column, cur.ColumnOrder, func(c string) bool { return prevSet[c] || added[c] })
+			}
+			added[col] = true
+			add := em.AddColumn(tableName, column)
+			if opts.AnnotateCreateOnly && cur.Columns[col].CreateOnly {
+				add = createOnlyComment + "\n" + add
+			}
+			if opts.AnnotateSRID {
+				add = withSRIDNote(add, []columnState{cur.Columns[col]})
+			}
+			drop := em.DropColumn(tableName, col)
+			ops = append(ops, migrationOp{
+				kind:  opAddColumn,
+				table: tableName,
+				name:  col,
+				up:    add,
+				down:  drop,
+				apply: setColumnChange(tableName, col, cur.Columns[col]),
+			})
+		}
+	}
+
+	if pkChanged {
+		ops = append(ops, primaryKeyOp(tableName, prev, cur, opts))
+	}
+
+	droppedEarly := map[string]bool{}
+	storageSwitches := generatedStorageSwitches(prev, cur)
+	if opts.Dialect.isMySQL() {
+		for _, idx := range spatialIndexesLosingNotNull(prev, cur) {
+			droppedEarly[idx] = true
+			ops = append(ops, dropIndexOp(em, tableName, idx, prev.Indexes[idx]))
+		}
+		// Dropping a column drops its indexes too, so the indexes of a
+		// column recreated to switch its storage are dropped first and
+		// created again after it.
+		for _, col := range storageSwitches {
+			for _, idx := range indexesCovering(prev.Indexes, col) {
+				if !droppedEarly[idx] {
+					droppedEarly[idx] = true
+					ops = append(ops, dropIndexOp(em, tableName, idx, prev.Indexes[idx]))
+				}
+			}
+		}
+	}
+
 	for _, col := range curCols {
 		if !prevSet[col] {
-			add := fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `%s` %s;", tableName, col, cur.Columns[col].Definition)
-			drop := fmt.Sprintf("ALTER TABLE `%s` DROP COLUMN `%s`;", tableName, col)
-			ops = append(ops, migrationOp{up: add, down: drop})
 			continue
 		}
-		if normalizeDefinition(prev.Columns[col].Definition) != normalizeDefinition(cur.Columns[col].Definition) {
-			mod := fmt.Sprintf("ALTER TABLE `%s` MODIFY COLUMN `%s` %s;", tableName, col, cur.Columns[col].Definition)
-			rollback := fmt.Sprintf("ALTER TABLE `%s` MODIFY COLUMN `%s` %s;", tableName, col, prev.Columns[col].Definition)
-			ops = append(ops, migrationOp{up: mod, down: rollback})
+		if !opts.columnEqual(prev.Columns[col].Definition, cur.Columns[col].Definition) {
+			if containsString(storageSwitches, col) {
+				// MySQL cannot switch a generated column between VIRTUAL and
+				// STORED in place.
+				drop := em.DropColumn(tableName, col)
+				up := strings.Join([]string{drop, em.AddColumn(tableName, ColumnDefinition{Name: col, Definition: cur.Columns[col].Definition})}, "\n")
+				down := strings.Join([]string{drop, em.AddColumn(tableName, ColumnDefinition{Name: col, Definition: prev.Columns[col].Definition})}, "\n")
+				ops = append(ops, migrationOp{
+					kind:  opModifyColumn,
+					table: tableName,
+					name:  col,
+					up:    up,
+					down:  down,
+					apply: setColumnChange(tableName, col, cur.Columns[col]),
+				})
+				continue
+			}
+			if op, ok := columnDefaultOp(tableName, col, prev.Columns[col], cur.Columns[col], opts); ok {
+				ops = append(ops, op)
+				continue
+			}
+			prevDef := prev.Columns[col].Definition
+			if pkChanged && isAutoIncrementKey(prev, col) && !containsString(cur.PrimaryKeys, col) {
+				prevDef = withoutAutoIncrement(prevDef)
+			}
+			change := classifyTypeChange(prev.Columns[col].Definition, cur.Columns[col].Definition)
+			mod := em.ModifyColumn(tableName, ColumnDefinition{Name: col, Definition: cur.Columns[col].Definition})
+			rollback := em.ModifyColumn(tableName, ColumnDefinition{Name: col, Definition: prevDef})
+			if opts.AnnotateTypeChanges {
+				mod = withTypeChangeNote(mod, change)
+				rollback = withTypeChangeNote(rollback, classifyTypeChange(cur.Columns[col].Definition, prevDef))
+			}
+			op := migrationOp{
+				kind:       opModifyColumn,
+				table:      tableName,
+				name:       col,
+				up:         mod,
+				down:       rollback,
+				typeChange: change,
+				apply:      setColumnChange(tableName, col, cur.Columns[col]),
+			}
+			if warning, ok := narrowingWarning(tableName, col, prev.Columns[col].Definition, cur.Columns[col].Definition, change, opts.Dialect); ok {
+				op.warnings = append(op.warnings, warning)
+			}
+			if warning, ok := enumRollbackWarning(tableName, col, prevDef, cur.Columns[col].Definition, opts.Dialect); ok {
+				op.warnings = append(op.warnings, warning)
+				op.down = withSafetyWarnings(op.down, []SafetyWarning{warning})
+			}
+			if opts.Dialect.isMySQL() && commentOnlyChange(prev.Columns[col].Definition, cur.Columns[col].Definition, opts) {
+				op.kind = opColumnComment
+			}
+			if opts.Dialect.isMySQL() && autoIncrementOnlyChange(prev.Columns[col].Definition, cur.Columns[col].Definition, opts) {
+				op.kind = opChangeAutoIncrement
+				if hasAutoIncrement(cur.Columns[col].Definition) && !pkChanged {
+					autoIncrementAdds = append(autoIncrementAdds, op)
+					continue
+				}
+			}
+			ops = append(ops, op)
+		} else if op, ok := columnCommentOp(tableName, col, prev.Columns[col], cur.Columns[col], opts); ok {
+			ops = append(ops, op)
 		}
 	}
 
-	for _, col := range prevCols {
+	for _, col := range dropOrder {
 		if !curSet[col] {
-			drop := fmt.Sprintf("ALTER TABLE `%s` DROP COLUMN `%s`;", tableName, col)
-			add := fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `%s` %s;", tableName, col, prev.Columns[col].Definition)
-			ops = append(ops, migrationOp{up: drop, down: add})
+			def := prev.Columns[col].Definition
+			if pkChanged && isAutoIncrementKey(prev, col) {
+				def = withoutAutoIncrement(def)
+			}
+			column := ColumnDefinition{Name: col, Definition: def, Comment: columnComment(prev.Columns[col])}
+			if trackOrder {
+				column = placeColumn(column, prev.ColumnOrder, func(c string) bool { return curSet[c] })
+			}
+			drop := em.DropColumn(tableName, col)
+			add := em.AddColumn(tableName, column)
+			if opts.AnnotateDataLoss {
+				add = droppedColumnDataLossNote + "\n" + add
+			}
+			ops = append(ops, migrationOp{
+				kind:     opDropColumn,
+				table:    tableName,
+				name:     col,
+				up:       drop,
+				down:     add,
+				warnings: []SafetyWarning{droppedColumnWarning(tableName, col)},
+				apply:    dropColumnChange(tableName, col),
+			})
+		}
+	}
+
+	if opts.TrackColumnOrder && opts.Dialect.isMySQL() {
+		if op, ok := reorderColumnsOp(tableName, prev, cur, em); ok {
+			ops = append(ops, op)
 		}
 	}
 
 	prevIndexes := sortedKeys(prev.Indexes)
-	curIndexes := sortedKeys(cur.Indexes)
+	curIndexes := orderedIndexNames(cur.Indexes)
 	prevIndexSet := make(map[string]bool, len(prevIndexes))
 	curIndexSet := make(map[string]bool, len(curIndexes))
 	for _, idx := range prevIndexes {
@@ -598,40 +1942,141 @@ func diffTable(tableName string, prev, cur tableState) []migrationOp {
 		curIndexSet[idx] = true
 	}
 
+	renamedTo, renamedFrom := renamedIndexes(prev.Indexes, cur.Indexes, opts)
+	for from, to := range renamedTo {
+		if droppedEarly[from] {
+			delete(renamedTo, from)
+			delete(renamedFrom, to)
+		}
+	}
+	for _, idx := range prevIndexes {
+		if newName, ok := renamedTo[idx]; ok {
+			ops = append(ops, renameIndexOp(tableName, idx, newName, prev.Indexes[idx], cur.Indexes[newName], opts))
+		}
+	}
+
 	for _, idx := range curIndexes {
-		if !prevIndexSet[idx] {
-			create := createIndexSQL(tableName, idx, cur.Indexes[idx])
-			drop := dropIndexSQL(tableName, idx)
-			ops = append(ops, migrationOp{up: create, down: drop})
+		if renamedFrom[idx] {
+			continue
+		}
+		if !prevIndexSet[idx] || droppedEarly[idx] {
+			create := em.CreateIndex(tableName, indexDefinitionOf(idx, cur.Indexes[idx]))
+			drop := em.DropIndex(tableName, idx)
+			ops = append(ops, migrationOp{
+				kind:  opCreateIndex,
+				table: tableName,
+				name:  idx,
+				up:    create,
+				down:  drop,
+				apply: setIndexChange(tableName, idx, cur.Indexes[idx]),
+			})
 			continue
 		}
-		prevIndex := normalizeIndex(prev.Indexes[idx])
-		curIndex := normalizeIndex(cur.Indexes[idx])
-		if !reflect.DeepEqual(prevIndex, curIndex) {
+		if !opts.indexEqual(prev.Indexes[idx], cur.Indexes[idx]) {
 			up := strings.Join([]string{
-				dropIndexSQL(tableName, idx),
-				createIndexSQL(tableName, idx, cur.Indexes[idx]),
+				em.DropIndex(tableName, idx),
+				em.CreateIndex(tableName, indexDefinitionOf(idx, cur.Indexes[idx])),
 			}, "\n")
 			down := strings.Join([]string{
-				dropIndexSQL(tableName, idx),
-				createIndexSQL(tableName, idx, prev.Indexes[idx]),
+				em.DropIndex(tableName, idx),
+				em.CreateIndex(tableName, indexDefinitionOf(idx, prev.Indexes[idx])),
 			}, "\n")
-			ops = append(ops, migrationOp{up: up, down: down})
+			op := migrationOp{
+				kind:  opModifyIndex,
+				table: tableName,
+				name:  idx,
+				up:    up,
+				down:  down,
+				apply: setIndexChange(tableName, idx, cur.Indexes[idx]),
+			}
+			if warning, ok := uniqueIndexWarning(tableName, idx, prev.Indexes[idx], cur.Indexes[idx], opts.Dialect); ok {
+				op.warnings = []SafetyWarning{warning}
+				op.up = withSafetyWarnings(op.up, op.warnings)
+			}
+			ops = append(ops, op)
+			continue
+		}
+		if op, ok := indexTablespaceOp(tableName, idx, prev.Indexes[idx], cur.Indexes[idx], opts); ok {
+			ops = append(ops, op)
 		}
 	}
 
 	for _, idx := range prevIndexes {
-		if !curIndexSet[idx] {
-			drop := dropIndexSQL(tableName, idx)
-			create := createIndexSQL(tableName, idx, prev.Indexes[idx])
-			ops = append(ops, migrationOp{up: drop, down: create})
+		if _, renamed := renamedTo[idx]; !curIndexSet[idx] && !renamed && !droppedEarly[idx] {
+			ops = append(ops, dropIndexOp(em, tableName, idx, prev.Indexes[idx]))
 		}
 	}
+	ops = append(ops, autoIncrementAdds...)
 	ops = append(ops, fkAddOps...)
 	return ops
 }
 
+func dropIndexOp(em Emitter, tableName, name string, idx indexState) migrationOp {
+	return migrationOp{
+		kind:  opDropIndex,
+		table: tableName,
+		name:  name,
+		up:    em.DropIndex(tableName, name),
+		down:  em.CreateIndex(tableName, indexDefinitionOf(name, idx)),
+		apply: dropIndexChange(tableName, name),
+	}
+}
+
+// renamedIndexes pairs indexes that disappeared with new indexes of the same
+// definition, which are renamed instead of being dropped and recreated.
+func renamedIndexes(prev, cur map[string]indexState, opts Options) (map[string]string, map[string]bool) {
+	renamedTo := map[string]string{}
+	renamedFrom := map[string]bool{}
+	for _, prevName := range sortedKeys(prev) {
+		if _, kept := cur[prevName]; kept {
+			continue
+		}
+		for _, curName := range sortedKeys(cur) {
+			if _, existed := prev[curName]; existed || renamedFrom[curName] {
+				continue
+			}
+			if opts.indexEqual(prev[prevName], cur[curName]) {
+				renamedTo[prevName] = curName
+				renamedFrom[curName] = true
+				break
+			}
+		}
+	}
+	return renamedTo, renamedFrom
+}
+
+func renameIndexOp(tableName, oldName, newName string, prev, cur indexState, opts Options) migrationOp {
+	em := opts.emitter()
+	op := migrationOp{
+		kind:  opRenameIndex,
+		table: tableName,
+		name:  newName,
+		apply: func(tables map[string]tableState) {
+			dropIndexChange(tableName, oldName)(tables)
+			setIndexChange(tableName, newName, cur)(tables)
+		},
+	}
+	if opts.Dialect == DialectPostgres || opts.mysqlVersionAtLeast(8, 0) {
+		op.up = em.RenameIndex(tableName, oldName, newName)
+		op.down = em.RenameIndex(tableName, newName, oldName)
+		return op
+	}
+	// The new index is created first so an index backing a foreign key is
+	// never missing.
+	op.up = em.CreateIndex(tableName, indexDefinitionOf(newName, cur)) + "\n" + em.DropIndex(tableName, oldName)
+	op.down = em.CreateIndex(tableName, indexDefinitionOf(oldName, prev)) + "\n" + em.DropIndex(tableName, newName)
+	return op
+}
+
 func diffForeignKeys(tableName string, prev, cur map[string]foreignKeyState) ([]migrationOp, []migrationOp) {
+	return diffForeignKeysWithOptions(tableName, prev, cur, Options{})
+}
+
+func diffForeignKeysWithOptions(tableName string, prev, cur map[string]foreignKeyState, opts Options) ([]migrationOp, []migrationOp) {
+	em := opts.emitter()
+	addSQL := func(name string, fk foreignKeyState) string {
+		return em.AddForeignKey(tableName, foreignKeyDefinitionOf(name, fk))
+	}
 	dropOps := make([]migrationOp, 0)
 	addOps := make([]migrationOp, 0)
 
@@ -646,81 +2091,180 @@ func diffForeignKeys(tableName string, prev, cur map[string]foreignKeyState) ([]
 		curSet[name] = true
 	}
 
+	// A constraint that only changed its name keeps its signature. MySQL
+	// cannot rename foreign keys, so it is still recreated, but as a single op.
+	renamedTo := map[string]string{}
+	renamedFrom := map[string]bool{}
+	for _, prevName := range prevNames {
+		if curSet[prevName] {
+			continue
+		}
+		signature := foreignKeySignature(opts.comparableForeignKey(prev[prevName]))
+		for _, curName := range curNames {
+			if prevSet[curName] || renamedFrom[curName] {
+				continue
+			}
+			if foreignKeySignature(opts.comparableForeignKey(cur[curName])) == signature {
+				renamedTo[prevName] = curName
+				renamedFrom[curName] = true
+				break
+			}
+		}
+	}
+
 	for _, name := range prevNames {
-		if !curSet[name] {
+		if newName, ok := renamedTo[name]; ok {
 			dropOps = append(dropOps, migrationOp{
-				up:   dropForeignKeySQL(tableName, name),
-				down: createForeignKeySQL(tableName, name, prev[name]),
+				kind:  opRenameForeignKey,
+				table: tableName,
+				name:  newName,
+				up:    em.DropForeignKey(tableName, name) + "\n" + addSQL(newName, cur[newName]),
+				down:  em.DropForeignKey(tableName, newName) + "\n" + addSQL(name, prev[name]),
+				apply: func(tables map[string]tableState) {
+					dropForeignKeyChange(tableName, name)(tables)
+					setForeignKeyChange(tableName, newName, cur[newName])(tables)
+				},
 			})
 			continue
 		}
-		if !reflect.DeepEqual(normalizeForeignKey(prev[name]), normalizeForeignKey(cur[name])) {
+		if !curSet[name] {
 			dropOps = append(dropOps, migrationOp{
-				up:   dropForeignKeySQL(tableName, name),
-				down: createForeignKeySQL(tableName, name, prev[name]),
+				kind:  opDropForeignKey,
+				table: tableName,
+				name:  name,
+				up:    em.DropForeignKey(tableName, name),
+				down:  addSQL(name, prev[name]),
+				apply: dropForeignKeyChange(tableName, name),
 			})
-			addOps = append(addOps, migrationOp{
-				up:   createForeignKeySQL(tableName, name, cur[name]),
-				down: dropForeignKeySQL(tableName, name),
+			continue
+		}
+		if !opts.foreignKeyEqual(prev[name], cur[name]) {
+			dropOps = append(dropOps, migrationOp{
+				kind:  opDropForeignKey,
+				table: tableName,
+				name:  name,
+				up:    em.DropForeignKey(tableName, name),
+				down:  addSQL(name, prev[name]),
+				apply: dropForeignKeyChange(tableName, name),
 			})
+			add := migrationOp{
+				kind:  opAddForeignKey,
+				table: tableName,
+				name:  name,
+				up:    addSQL(name, cur[name]),
+				down:  em.DropForeignKey(tableName, name),
+				apply: setForeignKeyChange(tableName, name, cur[name]),
+			}
+			if warning, ok := foreignKeyTargetWarning(tableName, name, prev[name], cur[name], opts.Dialect); ok {
+				add.warnings = []SafetyWarning{warning}
+				add.up = withSafetyWarnings(add.up, add.warnings)
+			}
+			addOps = append(addOps, add)
 		}
 	}
 
 	for _, name := range curNames {
-		if prevSet[name] {
+		if prevSet[name] || renamedFrom[name] {
 			continue
 		}
 		addOps = append(addOps, migrationOp{
-			up:   createForeignKeySQL(tableName, name, cur[name]),
-			down: dropForeignKeySQL(tableName, name),
+			kind:  opAddForeignKey,
+			table: tableName,
+			name:  name,
+			up:    addSQL(name, cur[name]),
+			down:  em.DropForeignKey(tableName, name),
+			apply: setForeignKeyChange(tableName, name, cur[name]),
 		})
 	}
 	return dropOps, addOps
 }
 
-func addForeignKeyOpsForNewTable(tableName string, table tableState) []migrationOp {
+// addForeignKeyOpsForNewTable adds the foreign keys of a new table. Those
+// in inlined are part of its CREATE TABLE and go with its DROP TABLE, so
+// their ops only record them.
+func addForeignKeyOpsForNewTable(tableName string, table tableState, inlined []string, opts Options) []migrationOp {
+	em := opts.emitter()
 	names := sortedKeys(table.ForeignKeys)
 	ops := make([]migrationOp, 0, len(names))
 	for _, name := range names {
-		ops = append(ops, migrationOp{
-			up:   createForeignKeySQL(tableName, name, table.ForeignKeys[name]),
-			down: dropForeignKeySQL(tableName, name),
-		})
+		op := migrationOp{
+			kind:  opAddForeignKey,
+			table: tableName,
+			name:  name,
+			up:    em.AddForeignKey(tableName, foreignKeyDefinitionOf(name, table.ForeignKeys[name])),
+			down:  em.DropForeignKey(tableName, name),
+			apply: setForeignKeyChange(tableName, name, table.ForeignKeys[name]),
+		}
+		if containsString(inlined, name) {
+			op.up, op.down = "", ""
+		}
+		ops = append(ops, op)
 	}
 	return ops
 }
 
-func restoreForeignKeyOpsForDroppedTable(tableName string, table tableState) []migrationOp {
+func restoreForeignKeyOpsForDroppedTable(tableName string, table tableState, opts Options) []migrationOp {
+	em := opts.emitter()
 	names := sortedKeys(table.ForeignKeys)
 	ops := make([]migrationOp, 0, len(names))
 	for _, name := range names {
 		ops = append(ops, migrationOp{
-			up:   "",
-			down: createForeignKeySQL(tableName, name, table.ForeignKeys[name]),
+			kind:  opDropForeignKey,
+			table: tableName,
+			name:  name,
+			up:    "",
+			down:  em.AddForeignKey(tableName, foreignKeyDefinitionOf(name, table.ForeignKeys[name])),
 		})
 	}
 	return ops
 }
 
 func createTableSQL(tableName string, table tableState) string {
-	colNames := sortedKeys(table.Columns)
-	defs := make([]string, 0, len(colNames)+1)
-	for _, col := range colNames {
-		defs = append(defs, fmt.Sprintf("  `%s` %s", col, table.Columns[col].Definition))
-	}
-	if len(table.PrimaryKeys) > 0 {
-		pkCols := make([]string, 0, len(table.PrimaryKeys))
-		for _, pk := range table.PrimaryKeys {
-			pkCols = append(pkCols, fmt.Sprintf("`%s`", pk))
+	return createTableSQLWithOptions(tableName, table, Options{})
+}
+
+func createTableSQLWithOptions(tableName string, table tableState, opts Options) string {
+	return createTableSQLInlining(tableName, table, nil, opts)
+}
+
+// createTableSQLInlining is createTableSQLWithOptions declaring the foreign
+// keys named in inlined as well.
+func createTableSQLInlining(tableName string, table tableState, inlined []string, opts Options) string {
+	def := tableDefinitionOf(tableName, table, opts)
+	for _, name := range inlined {
+		def.ForeignKeys = append(def.ForeignKeys, foreignKeyDefinitionOf(name, table.ForeignKeys[name]))
+	}
+	sql := opts.emitter().CreateTable(def)
+	if opts.AnnotateSRID {
+		columns := make([]columnState, 0, len(table.Columns))
+		for _, col := range sortedKeys(table.Columns) {
+			columns = append(columns, table.Columns[col])
 		}
-		defs = append(defs, fmt.Sprintf("  PRIMARY KEY (%s)", strings.Join(pkCols, ", ")))
+		sql = withSRIDNote(sql, columns)
 	}
+	return sql
+}
 
-	indexNames := sortedKeys(table.Indexes)
-	for _, indexName := range indexNames {
-		defs = append(defs, fmt.Sprintf("  %s", createTableIndexDefinition(indexName, table.Indexes[indexName])))
+const createOnlyComment = "-- create-only"
+
+// withSRIDNote prefixes sql with a comment listing the spatial reference
+// systems its columns are restricted to. MySQL 8 rejects the statement when an
+// SRID is missing from INFORMATION_SCHEMA.ST_SPATIAL_REFERENCE_SYSTEMS.
+func withSRIDNote(sql string, columns []columnState) string {
+	seen := map[string]bool{}
+	srids := make([]string, 0)
+	for _, col := range columns {
+		if srid := definitionSRID(col.Definition); srid != "" && !seen[srid] {
+			seen[srid] = true
+			srids = append(srids, srid)
+		}
+	}
+	if len(srids) == 0 {
+		return sql
 	}
-	return fmt.Sprintf("CREATE TABLE `%s` (\n%s\n);", tableName, strings.Join(defs, ",\n"))
+	sort.Strings(srids)
+	note := fmt.Sprintf("-- requires spatial reference system(s) %s in INFORMATION_SCHEMA.ST_SPATIAL_REFERENCE_SYSTEMS; create missing ones with CREATE SPATIAL REFERENCE SYSTEM", strings.Join(srids, ", "))
+	return note + "\n" + sql
 }
 
 func normalizeIndexClass(class string) string {
@@ -729,12 +2273,13 @@ func normalizeIndexClass(class string) string {
 
 func normalizeIndex(idx indexState) indexState {
 	out := indexState{
-		Class:   normalizeIndexClass(idx.Class),
-		Type:    strings.TrimSpace(idx.Type),
-		Where:   strings.TrimSpace(idx.Where),
-		Comment: strings.TrimSpace(idx.Comment),
-		Option:  strings.TrimSpace(idx.Option),
-		Fields:  make([]indexFieldState, 0, len(idx.Fields)),
+		Class:      normalizeIndexClass(idx.Class),
+		Type:       strings.TrimSpace(idx.Type),
+		Where:      strings.TrimSpace(idx.Where),
+		Comment:    strings.TrimSpace(idx.Comment),
+		Option:     normalizeIndexOption(idx.Option),
+		Fields:     make([]indexFieldState, 0, len(idx.Fields)),
+		Tablespace: strings.TrimSpace(idx.Tablespace),
 	}
 	for _, f := range idx.Fields {
 		out.Fields = append(out.Fields, indexFieldState{
@@ -743,35 +2288,42 @@ func normalizeIndex(idx indexState) indexState {
 			Sort:       strings.ToUpper(strings.TrimSpace(f.Sort)),
 			Collate:    strings.TrimSpace(f.Collate),
 			Length:     f.Length,
+			OpClass:    strings.TrimSpace(f.OpClass),
 		})
 	}
 	return out
 }
 
-func createIndexSQL(tableName, indexName string, idx indexState) string {
-	idx = normalizeIndex(idx)
-	classPrefix := indexClassPrefix(idx.Class)
-	sql := fmt.Sprintf("CREATE %sINDEX `%s` ON `%s` (%s)", classPrefix, indexName, tableName, indexFieldsSQL(idx.Fields))
-	if idx.Type != "" {
-		sql += " USING " + idx.Type
-	}
-	if idx.Comment != "" {
-		sql += " COMMENT " + quoteSQLString(idx.Comment)
+// normalizeIndexOption collapses whitespace and upper-cases a leading WITH
+// PARSER clause, so only a change of the parser itself recreates a FULLTEXT
+// index.
+func normalizeIndexOption(option string) string {
+	fields := strings.Fields(option)
+	if len(fields) >= 2 && strings.EqualFold(fields[0], "WITH") && strings.EqualFold(fields[1], "PARSER") {
+		fields[0], fields[1] = "WITH", "PARSER"
 	}
-	if idx.Option != "" {
-		sql += " " + idx.Option
+	return strings.Join(fields, " ")
+}
+
+func createIndexSQL(tableName, indexName string, idx indexState) string {
+	return createIndexSQLFor(DialectMySQL, tableName, indexName, idx)
+}
+
+func createIndexSQLFor(dialect Dialect, tableName, indexName string, idx indexState) string {
+	if dialect == DialectPostgres {
+		return createPostgresIndexSQL(tableName, indexName, idx, QuoteAlways, false)
 	}
-	return sql + ";"
+	return MySQLEmitter{}.CreateIndex(tableName, indexDefinitionOf(indexName, idx))
 }
 
 func dropIndexSQL(tableName, indexName string) string {
-	return fmt.Sprintf("DROP INDEX `%s` ON `%s`;", indexName, tableName)
+	return MySQLEmitter{}.DropIndex(tableName, indexName)
 }
 
-func createTableIndexDefinition(indexName string, idx indexState) string {
+func createTableIndexDefinition(indexName string, idx indexState, q QuoteMode) string {
 	idx = normalizeIndex(idx)
 	keyPrefix := indexClassKeyPrefix(idx.Class)
-	definition := fmt.Sprintf("%s `%s` (%s)", keyPrefix, indexName, indexFieldsSQL(idx.Fields))
+	definition := fmt.Sprintf("%s %s (%s)", keyPrefix, q.quote(indexName), indexFieldsSQL(idx.Fields, q))
 	if idx.Comment != "" {
 		definition += " COMMENT " + quoteSQLString(idx.Comment)
 	}
@@ -807,20 +2359,21 @@ func indexClassKeyPrefix(class string) string {
 	}
 }
 
-func indexFieldsSQL(fields []indexFieldState) string {
+func indexFieldsSQL(fields []indexFieldState, q QuoteMode) string {
 	parts := make([]string, 0, len(fields))
 	for _, field := range fields {
-		parts = append(parts, indexFieldSQL(field))
+		parts = append(parts, indexFieldSQL(field, q))
 	}
 	return strings.Join(parts, ", ")
 }
 
-func indexFieldSQL(field indexFieldState) string {
+func indexFieldSQL(field indexFieldState, q QuoteMode) string {
 	var base string
 	if strings.TrimSpace(field.Expression) != "" {
-		base = strings.TrimSpace(field.Expression)
+		// MySQL requires a functional key part in its own parentheses.
+		base = "(" + strings.TrimSpace(field.Expression) + ")"
 	} else {
-		base = fmt.Sprintf("`%s`", strings.TrimSpace(field.Column))
+		base = q.quote(field.Column)
 		if field.Length > 0 {
 			base = fmt.Sprintf("%s(%d)", base, field.Length)
 		}
@@ -872,32 +2425,32 @@ func normalizeForeignKeyAction(action string) string {
 	return strings.ToUpper(strings.TrimSpace(action))
 }
 
-func createForeignKeySQL(tableName, constraintName string, fk foreignKeyState) string {
+// foreignKeyEqual reports whether prev and cur are the same constraint once
+// their actions are compared by effect rather than spelling.
+func (o Options) foreignKeyEqual(prev, cur foreignKeyState) bool {
+	return reflect.DeepEqual(o.comparableForeignKey(prev), o.comparableForeignKey(cur))
+}
+
+// comparableForeignKey normalizes fk and spells each action the way the
+// dialect treats it: MySQL and Vitess check RESTRICT and NO ACTION alike
+// and default to them, while Postgres and SQLite only default to NO
+// ACTION and check RESTRICT immediately.
+func (o Options) comparableForeignKey(fk foreignKeyState) foreignKeyState {
 	fk = normalizeForeignKey(fk)
-	parts := []string{
-		fmt.Sprintf("ALTER TABLE `%s` ADD CONSTRAINT `%s`", tableName, constraintName),
-		fmt.Sprintf("FOREIGN KEY (%s)", quotedColumns(fk.Columns)),
-		fmt.Sprintf("REFERENCES `%s` (%s)", fk.RefTable, quotedColumns(fk.RefColumns)),
-	}
-	if fk.OnDelete != "" {
-		parts = append(parts, "ON DELETE "+fk.OnDelete)
-	}
-	if fk.OnUpdate != "" {
-		parts = append(parts, "ON UPDATE "+fk.OnUpdate)
+	for _, action := range []*string{&fk.OnDelete, &fk.OnUpdate} {
+		if *action == "" || *action == "RESTRICT" && o.Dialect != DialectPostgres && o.Dialect != DialectSQLite {
+			*action = "NO ACTION"
+		}
 	}
-	return strings.Join(parts, " ") + ";"
+	return fk
 }
 
-func dropForeignKeySQL(tableName, constraintName string) string {
-	return fmt.Sprintf("ALTER TABLE `%s` DROP FOREIGN KEY `%s`;", tableName, constraintName)
+func createForeignKeySQL(tableName, constraintName string, fk foreignKeyState) string {
+	return MySQLEmitter{}.AddForeignKey(tableName, foreignKeyDefinitionOf(constraintName, fk))
 }
 
-func quotedColumns(columns []string) string {
-	parts := make([]string, 0, len(columns))
-	for _, col := range columns {
-		parts = append(parts, fmt.Sprintf("`%s`", strings.TrimSpace(col)))
-	}
-	return strings.Join(parts, ", ")
+func dropForeignKeySQL(tableName, constraintName string) string {
+	return MySQLEmitter{}.DropForeignKey(tableName, constraintName)
 }
 
 func quoteSQLString(v string) string {
@@ -981,10 +2534,13 @@ func parseFieldIndexTagDecls(tableName string, field *schema.Field, namer schema
 		}
 
 		decls = append(decls, indexTagDecl{
-			Name:       name,
-			Column:     strings.TrimSpace(field.DBName),
-			Expression: strings.TrimSpace(settings["EXPRESSION"]),
-			Raw:        value,
+			Name:        name,
+			Column:      strings.TrimSpace(field.DBName),
+			Expression:  strings.TrimSpace(settings["EXPRESSION"]),
+			CreateOrder: strings.TrimSpace(settings["CREATE_ORDER"]),
+			Tablespace:  strings.TrimSpace(settings["TABLESPACE"]),
+			Option:      strings.TrimSpace(settings["OPTION"]),
+			Raw:         value,
 		})
 	}
 	return decls, nil
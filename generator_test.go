@@ -1,9 +1,12 @@
 package gomigration
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"strings"
 	"testing"
 
@@ -60,6 +63,44 @@ type compositeIndexInvalidModel struct {
 
 func (compositeIndexInvalidModel) TableName() string { return "composite_index_invalid_models" }
 
+type tooWideIndexModel struct {
+	ID  uint `gorm:"primaryKey"`
+	C01 int  `gorm:"index:idx_too_wide"`
+	C02 int  `gorm:"index:idx_too_wide"`
+	C03 int  `gorm:"index:idx_too_wide"`
+	C04 int  `gorm:"index:idx_too_wide"`
+	C05 int  `gorm:"index:idx_too_wide"`
+	C06 int  `gorm:"index:idx_too_wide"`
+	C07 int  `gorm:"index:idx_too_wide"`
+	C08 int  `gorm:"index:idx_too_wide"`
+	C09 int  `gorm:"index:idx_too_wide"`
+	C10 int  `gorm:"index:idx_too_wide"`
+	C11 int  `gorm:"index:idx_too_wide"`
+	C12 int  `gorm:"index:idx_too_wide"`
+	C13 int  `gorm:"index:idx_too_wide"`
+	C14 int  `gorm:"index:idx_too_wide"`
+	C15 int  `gorm:"index:idx_too_wide"`
+	C16 int  `gorm:"index:idx_too_wide"`
+	C17 int  `gorm:"index:idx_too_wide"`
+}
+
+func (tooWideIndexModel) TableName() string { return "too_wide_index_models" }
+
+type permissionTagModel struct {
+	ID               uint   `gorm:"primaryKey"`
+	CreatedBy        uint   `gorm:"<-:create"`
+	UpdatedBy        uint   `gorm:"<-:update"`
+	Writable         string `gorm:"<-;size:16"`
+	ReadOnly         string `gorm:"->;size:16"`
+	NoWrite          string `gorm:"<-:false;size:16"`
+	WriteOnce        string `gorm:"->:false;<-:create;size:16"`
+	Ignored          string `gorm:"-"`
+	IgnoredMigration string `gorm:"-:migration"`
+	IgnoredAll       string `gorm:"-:all"`
+}
+
+func (permissionTagModel) TableName() string { return "permission_tag_models" }
+
 type e2eUserWithJoin struct {
 	ID     uint                `gorm:"primaryKey"`
 	Groups []*e2eGroupWithJoin `gorm:"many2many:e2e_user_groups;"`
@@ -86,6 +127,36 @@ type e2eGroupNoJoin struct {
 
 func (e2eGroupNoJoin) TableName() string { return "e2e_groups" }
 
+type unconstrainedPet struct {
+	ID      uint `gorm:"primaryKey"`
+	OwnerID uint
+	Owner   setNullOwner `gorm:"foreignKey:OwnerID;constraint:-"`
+}
+
+func (unconstrainedPet) TableName() string { return "unconstrained_pets" }
+
+type setNullOwner struct {
+	ID uint `gorm:"primaryKey"`
+}
+
+func (setNullOwner) TableName() string { return "set_null_owners" }
+
+type setNullRequiredPet struct {
+	ID      uint         `gorm:"primaryKey"`
+	OwnerID uint         `gorm:"not null"`
+	Owner   setNullOwner `gorm:"foreignKey:OwnerID;constraint:OnDelete:SET NULL"`
+}
+
+func (setNullRequiredPet) TableName() string { return "set_null_pets" }
+
+type setNullOptionalPet struct {
+	ID      uint `gorm:"primaryKey"`
+	OwnerID *uint
+	Owner   setNullOwner `gorm:"foreignKey:OwnerID;constraint:OnDelete:SET NULL"`
+}
+
+func (setNullOptionalPet) TableName() string { return "set_null_pets" }
+
 func migrationModels() []any {
 	return []any{
 		&relationUser{},
@@ -139,6 +210,25 @@ func TestBuildCurrentStateDeduplicatesEquivalentForeignKeys(t *testing.T) {
 	}
 }
 
+func TestBuildCurrentStateLogsSkippedForeignKeys(t *testing.T) {
+	logger := &recordingLogger{}
+	state, err := buildCurrentStateWithOptions([]any{&setNullOwner{}, &unconstrainedPet{}}, Options{Logger: logger})
+	if err != nil {
+		t.Fatalf("buildCurrentStateWithOptions failed: %v", err)
+	}
+	if fks := state.Tables["unconstrained_pets"].ForeignKeys; len(fks) != 0 {
+		t.Fatalf("expected no foreign keys, got %#v", fks)
+	}
+	logs := strings.Join(logger.lines, "\n")
+	if !strings.Contains(logs, "skipping foreign key of relation unconstrained_pets.Owner: disabled with constraint:-") {
+		t.Fatalf("expected skipped relation to be logged, got %q", logs)
+	}
+
+	if _, err := buildCurrentState([]any{&setNullOwner{}, &unconstrainedPet{}}); err != nil {
+		t.Fatalf("expected a nil logger to be accepted, got %v", err)
+	}
+}
+
 func TestBuildDiffForNewTableIncludesForeignKeyStatements(t *testing.T) {
 	parent := tableState{
 		Columns: map[string]columnState{
@@ -228,6 +318,114 @@ func TestDiffForeignKeysModifyConstraint(t *testing.T) {
 	}
 }
 
+func TestDiffForeignKeysTreatsRestrictAsNoAction(t *testing.T) {
+	withActions := func(onDelete, onUpdate string) map[string]foreignKeyState {
+		return map[string]foreignKeyState{
+			"fk_children_parent": {Columns: []string{"parent_id"}, RefTable: "parents", RefColumns: []string{"id"}, OnDelete: onDelete, OnUpdate: onUpdate},
+		}
+	}
+	restrict := withActions("RESTRICT", "RESTRICT")
+	for _, cur := range []map[string]foreignKeyState{withActions("NO ACTION", "no action"), withActions("", "")} {
+		if dropOps, addOps := diffForeignKeys("children", restrict, cur); len(dropOps) != 0 || len(addOps) != 0 {
+			t.Fatalf("expected no ops for %#v, got drop=%d add=%d", cur, len(dropOps), len(addOps))
+		}
+	}
+	if dropOps, addOps := diffForeignKeys("children", restrict, withActions("CASCADE", "RESTRICT")); len(dropOps) != 1 || len(addOps) != 1 {
+		t.Fatalf("expected RESTRICT to CASCADE to recreate the foreign key, got drop=%d add=%d", len(dropOps), len(addOps))
+	}
+	if dropOps, addOps := diffForeignKeys("children", withActions("CASCADE", ""), withActions("RESTRICT", "")); len(dropOps) != 1 || len(addOps) != 1 {
+		t.Fatalf("expected CASCADE to RESTRICT to recreate the foreign key, got drop=%d add=%d", len(dropOps), len(addOps))
+	}
+
+	postgres := Options{Dialect: DialectPostgres}
+	if dropOps, addOps := diffForeignKeysWithOptions("children", withActions("", ""), withActions("NO ACTION", "NO ACTION"), postgres); len(dropOps) != 0 || len(addOps) != 0 {
+		t.Fatalf("expected the Postgres default to equal NO ACTION, got drop=%d add=%d", len(dropOps), len(addOps))
+	}
+	if _, addOps := diffForeignKeysWithOptions("children", restrict, withActions("NO ACTION", "NO ACTION"), postgres); len(addOps) != 1 {
+		t.Fatalf("expected Postgres to recreate a RESTRICT foreign key as NO ACTION, got add=%d", len(addOps))
+	}
+}
+
+func TestDiffForeignKeysWarnsOnTargetChange(t *testing.T) {
+	prev := map[string]foreignKeyState{
+		"fk_children_parent": {Columns: []string{"parent_id"}, RefTable: "parents", RefColumns: []string{"id"}, OnDelete: "RESTRICT"},
+	}
+	cascade := map[string]foreignKeyState{
+		"fk_children_parent": {Columns: []string{"parent_id"}, RefTable: "parents", RefColumns: []string{"id"}, OnDelete: "CASCADE"},
+	}
+	if _, addOps := diffForeignKeys("children", prev, cascade); len(addOps) != 1 || len(addOps[0].warnings) != 0 {
+		t.Fatalf("expected no warning for an action-only change, got %#v", addOps)
+	}
+
+	retargeted := map[string]foreignKeyState{
+		"fk_children_parent": {Columns: []string{"parent_id"}, RefTable: "guardians", RefColumns: []string{"id"}, OnDelete: "RESTRICT"},
+	}
+	_, addOps := diffForeignKeys("children", prev, retargeted)
+	if len(addOps) != 1 || len(addOps[0].warnings) != 1 {
+		t.Fatalf("expected one warning for a new referenced table, got %#v", addOps)
+	}
+	warning := addOps[0].warnings[0]
+	wantQuery := "SELECT c.* FROM `children` AS c LEFT JOIN `guardians` AS p ON p.`id` = c.`parent_id` WHERE c.`parent_id` IS NOT NULL AND p.`id` IS NULL;"
+	if warning.Table != "children" || warning.Name != "fk_children_parent" || warning.Query != wantQuery {
+		t.Fatalf("unexpected warning: %#v", warning)
+	}
+	if !strings.HasPrefix(addOps[0].up, "-- WARNING: foreign key `fk_children_parent`") || !strings.Contains(addOps[0].up, "-- check with: "+wantQuery+"\n") {
+		t.Fatalf("expected warning comments before the add SQL, got:\n%s", addOps[0].up)
+	}
+	if warnings := collectSafetyWarnings(addOps); len(warnings) != 1 {
+		t.Fatalf("expected collected warning, got %#v", warnings)
+	}
+
+	_, addOps = diffForeignKeysWithOptions("children", prev, retargeted, Options{Dialect: DialectPostgres})
+	wantQuery = `SELECT c.* FROM "children" AS c LEFT JOIN "guardians" AS p ON p."id" = c."parent_id" WHERE c."parent_id" IS NOT NULL AND p."id" IS NULL;`
+	if len(addOps) != 1 || len(addOps[0].warnings) != 1 || addOps[0].warnings[0].Query != wantQuery {
+		t.Fatalf("expected the Postgres query to quote with double quotes, got %#v", addOps)
+	}
+}
+
+func TestBuildCurrentStateRejectsSetNullOnNotNullColumn(t *testing.T) {
+	_, err := buildCurrentState([]any{&setNullOwner{}, &setNullRequiredPet{}})
+	if err == nil || !strings.Contains(err.Error(), "uses ON DELETE SET NULL but column `owner_id` is NOT NULL") {
+		t.Fatalf("expected SET NULL validation error, got %v", err)
+	}
+	if _, err := buildCurrentState([]any{&setNullOwner{}, &setNullOptionalPet{}}); err != nil {
+		t.Fatalf("expected nullable column to accept SET NULL, got %v", err)
+	}
+}
+
+func TestDiffForeignKeysRenamedConstraint(t *testing.T) {
+	fk := foreignKeyState{
+		Columns:    []string{"parent_id"},
+		RefTable:   "parents",
+		RefColumns: []string{"id"},
+		OnDelete:   "CASCADE",
+	}
+	prev := map[string]foreignKeyState{"fk_children_parent": fk}
+	cur := map[string]foreignKeyState{"fk_children_owner": fk}
+
+	dropOps, addOps := diffForeignKeys("children", prev, cur)
+	if len(dropOps) != 1 || len(addOps) != 0 {
+		t.Fatalf("expected a single rename op, got drop=%d add=%d", len(dropOps), len(addOps))
+	}
+	wantUp := "ALTER TABLE `children` DROP FOREIGN KEY `fk_children_parent`;\n" +
+		"ALTER TABLE `children` ADD CONSTRAINT `fk_children_owner` FOREIGN KEY (`parent_id`) REFERENCES `parents` (`id`) ON DELETE CASCADE;"
+	wantDown := "ALTER TABLE `children` DROP FOREIGN KEY `fk_children_owner`;\n" +
+		"ALTER TABLE `children` ADD CONSTRAINT `fk_children_parent` FOREIGN KEY (`parent_id`) REFERENCES `parents` (`id`) ON DELETE CASCADE;"
+	if dropOps[0].up != wantUp {
+		t.Fatalf("unexpected up SQL.\nwant=%s\ngot=%s", wantUp, dropOps[0].up)
+	}
+	if dropOps[0].down != wantDown {
+		t.Fatalf("unexpected down SQL.\nwant=%s\ngot=%s", wantDown, dropOps[0].down)
+	}
+
+	changed := fk
+	changed.OnDelete = "SET NULL"
+	dropOps, addOps = diffForeignKeys("children", prev, map[string]foreignKeyState{"fk_children_owner": changed})
+	if len(dropOps) != 1 || len(addOps) != 1 || dropOps[0].kind != opDropForeignKey {
+		t.Fatalf("expected separate drop and add when the signature changes, got drop=%#v add=%#v", dropOps, addOps)
+	}
+}
+
 func TestBuildCurrentStateParsesIndexTagOptions(t *testing.T) {
 	state, err := buildCurrentState([]any{&indexOptionModel{}})
 	if err != nil {
@@ -262,6 +460,61 @@ func TestBuildCurrentStateParsesIndexTagOptions(t *testing.T) {
 	}
 }
 
+type priorityIndexModel struct {
+	ID       uint   `gorm:"primaryKey"`
+	Region   string `gorm:"size:16;uniqueIndex:idx_priority_lookup,priority:3"`
+	TenantID uint   `gorm:"uniqueIndex:idx_priority_lookup,priority:1"`
+	Code     string `gorm:"size:16;uniqueIndex:idx_priority_lookup,priority:2"`
+}
+
+func (priorityIndexModel) TableName() string { return "priority_index_models" }
+
+func TestBuildCurrentStateOrdersCompositeIndexByPriority(t *testing.T) {
+	state, err := buildCurrentState([]any{&priorityIndexModel{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState failed: %v", err)
+	}
+	idx := state.Tables["priority_index_models"].Indexes["idx_priority_lookup"]
+	got := make([]string, 0, len(idx.Fields))
+	for _, field := range idx.Fields {
+		got = append(got, field.Column)
+	}
+	if !reflect.DeepEqual(got, []string{"tenant_id", "code", "region"}) {
+		t.Fatalf("expected priority order, got %v", got)
+	}
+	want := "CREATE UNIQUE INDEX `idx_priority_lookup` ON `priority_index_models` (`tenant_id`, `code`, `region`);"
+	if sql := createIndexSQL("priority_index_models", "idx_priority_lookup", idx); sql != want {
+		t.Fatalf("unexpected create index SQL.\nwant=%s\ngot=%s", want, sql)
+	}
+}
+
+type unnamedIndexModel struct {
+	ID        uint   `gorm:"primaryKey"`
+	Email     string `gorm:"size:64;uniqueIndex"`
+	FirstName string `gorm:"size:32;index:,composite:full_name"`
+	LastName  string `gorm:"size:32;index:,composite:full_name"`
+	Named     string `gorm:"size:32;index:idx_explicit"`
+}
+
+func (unnamedIndexModel) TableName() string { return "unnamed_index_models" }
+
+func TestBuildCurrentStateUsesIndexNamer(t *testing.T) {
+	state, err := buildCurrentStateWithOptions([]any{&unnamedIndexModel{}}, Options{
+		IndexNamer: func(table, column string) string { return table + "_" + column + "_idx" },
+	})
+	if err != nil {
+		t.Fatalf("buildCurrentStateWithOptions failed: %v", err)
+	}
+	got := sortedKeys(state.Tables["unnamed_index_models"].Indexes)
+	want := []string{"idx_explicit", "unnamed_index_models_email_idx", "unnamed_index_models_full_name_idx"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected index names.\nwant=%v\ngot=%v", want, got)
+	}
+	if fields := state.Tables["unnamed_index_models"].Indexes["unnamed_index_models_full_name_idx"].Fields; len(fields) != 2 {
+		t.Fatalf("expected composite index to keep both columns, got %#v", fields)
+	}
+}
+
 func TestBuildCurrentStateRejectsPartialIndexTag(t *testing.T) {
 	_, err := buildCurrentState([]any{&partialIndexModel{}})
 	if err == nil {
@@ -272,6 +525,198 @@ func TestBuildCurrentStateRejectsPartialIndexTag(t *testing.T) {
 	}
 }
 
+func TestBuildCurrentStateRejectsIndexExceedingFieldLimit(t *testing.T) {
+	_, err := buildCurrentState([]any{&tooWideIndexModel{}})
+	if err == nil {
+		t.Fatalf("expected error for index exceeding the mysql field limit, got nil")
+	}
+	if !strings.Contains(err.Error(), "`idx_too_wide` has 17 fields") || !strings.Contains(err.Error(), "limit of 16") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestBuildCurrentStateKeepsPermissionRestrictedColumns(t *testing.T) {
+	state, err := buildCurrentState([]any{&permissionTagModel{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState failed: %v", err)
+	}
+	table := state.Tables["permission_tag_models"]
+	cases := []struct {
+		column     string
+		present    bool
+		createOnly bool
+	}{
+		{column: "created_by", present: true, createOnly: true},
+		{column: "updated_by", present: true},
+		{column: "writable", present: true},
+		{column: "read_only", present: true},
+		{column: "no_write", present: true},
+		{column: "write_once", present: true, createOnly: true},
+		{column: "ignored"},
+		{column: "ignored_migration"},
+		{column: "ignored_all"},
+	}
+	for _, tc := range cases {
+		col, ok := table.Columns[tc.column]
+		if ok != tc.present {
+			t.Fatalf("column %s present=%v, want %v (columns=%v)", tc.column, ok, tc.present, sortedKeys(table.Columns))
+		}
+		if col.CreateOnly != tc.createOnly {
+			t.Fatalf("column %s createOnly=%v, want %v", tc.column, col.CreateOnly, tc.createOnly)
+		}
+	}
+}
+
+func TestCreateOnlyAnnotation(t *testing.T) {
+	table := tableState{
+		Columns: map[string]columnState{
+			"id":         {Definition: "bigint unsigned AUTO_INCREMENT"},
+			"created_by": {Definition: "bigint unsigned", CreateOnly: true},
+		},
+		PrimaryKeys: []string{"id"},
+	}
+	plain := createTableSQL("audits", table)
+	if strings.Contains(plain, "create-only") {
+		t.Fatalf("expected no annotation by default, got: %s", plain)
+	}
+	annotated := createTableSQLWithOptions("audits", table, Options{AnnotateCreateOnly: true})
+	if !strings.Contains(annotated, "  `created_by` bigint unsigned, -- create-only\n") {
+		t.Fatalf("expected create-only annotation on column line, got: %s", annotated)
+	}
+
+	prev := tableState{Columns: map[string]columnState{"id": table.Columns["id"]}, PrimaryKeys: []string{"id"}}
+	ops := diffTableWithOptions("audits", prev, table, Options{AnnotateCreateOnly: true})
+	if len(ops) != 1 || ops[0].up != "-- create-only\nALTER TABLE `audits` ADD COLUMN `created_by` bigint unsigned;" {
+		t.Fatalf("unexpected annotated add column ops: %#v", ops)
+	}
+	if stmts := splitSQLStatements(ops[0].up); len(stmts) != 1 || strings.HasPrefix(stmts[0], "--") {
+		t.Fatalf("expected annotation to be ignored by statement parsing, got %#v", stmts)
+	}
+}
+
+func TestDiffStateFiles(t *testing.T) {
+	dir := t.TempDir()
+	from := filepath.Join(dir, "from.json")
+	to := filepath.Join(dir, "to.json")
+	if _, err := SyncSchemaState([]any{&e2eUserNoJoin{}, &e2eGroupNoJoin{}}, dir, from); err != nil {
+		t.Fatalf("SyncSchemaState from failed: %v", err)
+	}
+	if _, err := SyncSchemaState([]any{&e2eUserWithJoin{}, &e2eGroupWithJoin{}}, dir, to); err != nil {
+		t.Fatalf("SyncSchemaState to failed: %v", err)
+	}
+
+	up, down, err := DiffStateFiles(from, to)
+	if err != nil {
+		t.Fatalf("DiffStateFiles failed: %v", err)
+	}
+	if len(up) == 0 || !strings.HasPrefix(up[0], "CREATE TABLE `e2e_user_groups`") {
+		t.Fatalf("expected the join table to be created, got %v", up)
+	}
+	if got := down[len(down)-1]; got != "DROP TABLE IF EXISTS `e2e_user_groups`;" {
+		t.Fatalf("expected the join table to be dropped last on down, got %v", down)
+	}
+
+	back, _, err := DiffStateFiles(to, from)
+	if err != nil {
+		t.Fatalf("DiffStateFiles failed: %v", err)
+	}
+	if len(back) != 1 || back[0] != "DROP TABLE IF EXISTS `e2e_user_groups`;" {
+		t.Fatalf("expected the reverse diff to drop the join table, got %v", back)
+	}
+
+	if _, _, err := DiffStateFiles(filepath.Join(dir, "missing.json"), to); err == nil {
+		t.Fatalf("expected error for a missing state file")
+	}
+}
+
+func TestPreviewMigrationsMatchesMakeMigrations(t *testing.T) {
+	dir := t.TempDir()
+	stateFile := filepath.Join(dir, ".schema_state.json")
+	up, down, changed, err := PreviewMigrations(migrationModels(), stateFile)
+	if err != nil {
+		t.Fatalf("PreviewMigrations failed: %v", err)
+	}
+	if !changed || len(up) == 0 || len(down) == 0 {
+		t.Fatalf("expected a preview of the initial migration, got changed=%v up=%v down=%v", changed, up, down)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read dir failed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected the preview to leave the directory untouched, found %d entries", len(entries))
+	}
+
+	result, err := MakeMigrations(migrationModels(), dir, "init_schema", stateFile)
+	if err != nil {
+		t.Fatalf("MakeMigrations failed: %v", err)
+	}
+	if got := readFiles(t, result.UpPath); got != strings.Join(up, "\n\n")+"\n" {
+		t.Fatalf("preview up differs from the written file:\n%s\n---\n%s", strings.Join(up, "\n\n"), got)
+	}
+	if got := readFiles(t, result.DownPath); got != strings.Join(down, "\n\n")+"\n" {
+		t.Fatalf("preview down differs from the written file:\n%s\n---\n%s", strings.Join(down, "\n\n"), got)
+	}
+
+	if _, _, changed, err := PreviewMigrations(migrationModels(), stateFile); err != nil || changed {
+		t.Fatalf("expected no changes once the state is saved, got changed=%v err=%v", changed, err)
+	}
+}
+
+func TestPreviewMigrationsMatchesFileLayouts(t *testing.T) {
+	for _, opts := range []Options{
+		{PerTableFiles: true, SQLMode: "STRICT_ALL_TABLES"},
+		{CombinedFile: true},
+		{CombinedFile: true, CombinedFileMarkers: DbmateMarkers, WrapInTransaction: true},
+	} {
+		dir := t.TempDir()
+		stateFile := filepath.Join(dir, ".schema_state.json")
+		up, down, _, err := PreviewMigrationsWithOptions(migrationModels(), stateFile, opts)
+		if err != nil {
+			t.Fatalf("%+v: PreviewMigrationsWithOptions failed: %v", opts, err)
+		}
+		result, err := MakeMigrationsWithOptions(migrationModels(), dir, "init_schema", stateFile, opts)
+		if err != nil {
+			t.Fatalf("%+v: MakeMigrations failed: %v", opts, err)
+		}
+
+		if opts.CombinedFile {
+			markers := opts.combinedFileMarkers()
+			want := markers.Up + "\n" + strings.Join(up, "\n\n") + "\n\n" + markers.Down + "\n" + strings.Join(down, "\n\n") + "\n"
+			if got := readFiles(t, result.Path); got != want {
+				t.Fatalf("%+v: preview differs from the written file:\n%s\n---\n%s", opts, want, got)
+			}
+			continue
+		}
+		if len(result.UpPaths) < 2 {
+			t.Fatalf("%+v: expected a file pair per table, got %v", opts, result.UpPaths)
+		}
+		downPaths := slices.Clone(result.DownPaths)
+		slices.Reverse(downPaths)
+		if got := readFiles(t, result.UpPaths...); got != strings.Join(up, "\n\n")+"\n" {
+			t.Fatalf("%+v: preview up differs from the written files:\n%s\n---\n%s", opts, strings.Join(up, "\n\n"), got)
+		}
+		if got := readFiles(t, downPaths...); got != strings.Join(down, "\n\n")+"\n" {
+			t.Fatalf("%+v: preview down differs from the written files:\n%s\n---\n%s", opts, strings.Join(down, "\n\n"), got)
+		}
+	}
+}
+
+// readFiles returns the contents of paths separated by a blank line, the
+// way PreviewMigrations joins the blocks of consecutive files.
+func readFiles(t *testing.T, paths ...string) string {
+	t.Helper()
+	contents := make([]string, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read %s failed: %v", path, err)
+		}
+		contents = append(contents, string(data))
+	}
+	return strings.Join(contents, "\n")
+}
+
 func TestStateLoadSaveRoundTrip(t *testing.T) {
 	path := filepath.Join(t.TempDir(), "state.json")
 	loaded, err := loadState(path)
@@ -283,6 +728,7 @@ func TestStateLoadSaveRoundTrip(t *testing.T) {
 	}
 
 	want := schemaState{
+		Version: stateVersion,
 		Tables: map[string]tableState{
 			"t_users": {
 				Columns: map[string]columnState{
@@ -307,6 +753,7 @@ func TestStateLoadSaveRoundTrip(t *testing.T) {
 					},
 				},
 				PrimaryKeys: []string{"id"},
+				ColumnOrder: []string{"id", "name"},
 			},
 		},
 	}
@@ -343,7 +790,7 @@ func TestIndexSQLHelpers(t *testing.T) {
 		t.Fatalf("unexpected create index SQL.\nwant=%s\ngot=%s", wantCreate, gotCreate)
 	}
 
-	gotDef := createTableIndexDefinition("idx_users_name", idx)
+	gotDef := createTableIndexDefinition("idx_users_name", idx, "")
 	wantDef := "UNIQUE KEY `idx_users_name` (`name`(16) COLLATE utf8mb4_bin DESC) COMMENT 'O''Brien' WITH PARSER ngram"
 	if gotDef != wantDef {
 		t.Fatalf("unexpected table index definition.\nwant=%s\ngot=%s", wantDef, gotDef)
@@ -397,6 +844,32 @@ func TestDiffTableWithColumnAndIndexChanges(t *testing.T) {
 	}
 }
 
+func TestDiffTableIndexRecreateKeepsUsingType(t *testing.T) {
+	prev := tableState{
+		Columns: map[string]columnState{"a": {Definition: "int"}, "b": {Definition: "int"}},
+		Indexes: map[string]indexState{
+			"idx_lookup": {Type: "HASH", Fields: []indexFieldState{{Column: "a"}}},
+		},
+	}
+	cur := prev
+	cur.Indexes = map[string]indexState{
+		"idx_lookup": {Type: "HASH", Fields: []indexFieldState{{Column: "a"}, {Column: "b"}}},
+	}
+
+	ops := diffTable("lookups", prev, cur)
+	if len(ops) != 1 {
+		t.Fatalf("expected one index recreate op, got %#v", ops)
+	}
+	wantUp := "DROP INDEX `idx_lookup` ON `lookups`;\nCREATE INDEX `idx_lookup` ON `lookups` (`a`, `b`) USING HASH;"
+	wantDown := "DROP INDEX `idx_lookup` ON `lookups`;\nCREATE INDEX `idx_lookup` ON `lookups` (`a`) USING HASH;"
+	if ops[0].up != wantUp {
+		t.Fatalf("unexpected up SQL.\nwant=%s\ngot=%s", wantUp, ops[0].up)
+	}
+	if ops[0].down != wantDown {
+		t.Fatalf("unexpected down SQL.\nwant=%s\ngot=%s", wantDown, ops[0].down)
+	}
+}
+
 func TestDiffTableAddsForeignKeyWhenPreviousHadNone(t *testing.T) {
 	prev := tableState{
 		Columns: map[string]columnState{
@@ -735,6 +1208,46 @@ func TestMakeMigrationsArgValidation(t *testing.T) {
 	}
 }
 
+func TestMakeMigrationsUsesPinnedVersion(t *testing.T) {
+	dir := t.TempDir()
+	result, err := MakeMigrationsWithOptions(migrationModels(), dir, "init_schema", "", Options{Version: "20240101000000"})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	if result.Version != "20240101000000" {
+		t.Fatalf("expected pinned version in result, got %q", result.Version)
+	}
+	if filepath.Base(result.UpPath) != "20240101000000_init_schema.up.sql" {
+		t.Fatalf("unexpected up file name: %s", result.UpPath)
+	}
+	if filepath.Base(result.DownPath) != "20240101000000_init_schema.down.sql" {
+		t.Fatalf("unexpected down file name: %s", result.DownPath)
+	}
+
+	if err := os.Remove(filepath.Join(dir, ".schema_state.json")); err != nil {
+		t.Fatalf("remove state failed: %v", err)
+	}
+	_, err = MakeMigrationsWithOptions(migrationModels(), dir, "again", "", Options{Version: "20240101000000"})
+	if err == nil || !strings.Contains(err.Error(), "already used") {
+		t.Fatalf("expected reused version error, got: %v", err)
+	}
+}
+
+func TestValidateVersion(t *testing.T) {
+	valid := []string{"", "20240101000000", "000001", "42"}
+	for _, v := range valid {
+		if err := validateVersion(v); err != nil {
+			t.Fatalf("validateVersion(%q) unexpected error: %v", v, err)
+		}
+	}
+	invalid := []string{"2024-01-01", "v1", "20241399000000"}
+	for _, v := range invalid {
+		if err := validateVersion(v); err == nil {
+			t.Fatalf("validateVersion(%q) expected error", v)
+		}
+	}
+}
+
 func TestSanitizeName(t *testing.T) {
 	cases := map[string]string{
 		"Add User Avatar":          "add_user_avatar",
@@ -796,6 +1309,29 @@ func TestRunMakeMigrationsNoChangeAfterSyncState(t *testing.T) {
 	}
 }
 
+func TestMakeMigrationsRequireExistingState(t *testing.T) {
+	dir := t.TempDir()
+	models := migrationModels()
+	opts := Options{RequireExistingState: true}
+	if _, err := MakeMigrationsWithOptions(models, dir, "init_schema", "", opts); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("expected missing state file error, got %v", err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.sql")); len(files) != 0 {
+		t.Fatalf("expected no migration files, got %v", files)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, ".schema_state.json"), nil, 0o644); err != nil {
+		t.Fatalf("write empty state failed: %v", err)
+	}
+	result, err := MakeMigrationsWithOptions(models, dir, "init_schema", "", opts)
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions with empty state failed: %v", err)
+	}
+	if !result.Changed {
+		t.Fatalf("expected an empty state file to produce the full schema")
+	}
+}
+
 func TestLoadStateInvalidJSON(t *testing.T) {
 	path := filepath.Join(t.TempDir(), "state.json")
 	if err := os.WriteFile(path, []byte("{invalid"), 0o644); err != nil {
@@ -806,74 +1342,329 @@ func TestLoadStateInvalidJSON(t *testing.T) {
 	}
 }
 
-func TestRunMakeMigrationsCreatesSQLFiles(t *testing.T) {
+func TestLoadMergedState(t *testing.T) {
 	dir := t.TempDir()
-	result, err := MakeMigrations(migrationModels(), dir, "init_schema", "")
-	if err != nil {
-		t.Fatalf("MakeMigrations failed: %v", err)
-	}
-	if !result.Changed {
-		t.Fatalf("expected initial migration to generate files")
-	}
-	upFiles, err := filepath.Glob(filepath.Join(dir, "*.up.sql"))
-	if err != nil {
-		t.Fatalf("glob up sql failed: %v", err)
+	users := tableState{Columns: map[string]columnState{"id": {Definition: "bigint"}}, PrimaryKeys: []string{"id"}}
+	orders := tableState{Columns: map[string]columnState{"id": {Definition: "bigint"}, "user_id": {Definition: "bigint"}}}
+	write := func(name string, tables map[string]tableState) string {
+		path := filepath.Join(dir, name)
+		if err := saveState(path, schemaState{Tables: tables}); err != nil {
+			t.Fatalf("saveState %s failed: %v", name, err)
+		}
+		return path
 	}
-	downFiles, err := filepath.Glob(filepath.Join(dir, "*.down.sql"))
+	billing := write("billing.json", map[string]tableState{"users": users, "orders": orders})
+	accounts := write("accounts.json", map[string]tableState{"users": users, "sessions": users})
+
+	merged, err := loadMergedState([]string{billing, accounts, filepath.Join(dir, "missing.json")})
 	if err != nil {
-		t.Fatalf("glob down sql failed: %v", err)
+		t.Fatalf("loadMergedState failed: %v", err)
 	}
-	if len(upFiles) != 1 || len(downFiles) != 1 {
-		t.Fatalf("expected one up and one down migration file, got up=%v down=%v", upFiles, downFiles)
+	if got := sortedKeys(merged.Tables); !reflect.DeepEqual(got, []string{"orders", "sessions", "users"}) {
+		t.Fatalf("unexpected merged tables: %v", got)
 	}
-	if _, err := os.Stat(filepath.Join(dir, ".schema_state.json")); err != nil {
-		t.Fatalf("expected schema state file created, got: %v", err)
+
+	changed := users
+	changed.Columns = map[string]columnState{"id": {Definition: "bigint"}, "email": {Definition: "varchar(255)"}}
+	conflicting := write("conflicting.json", map[string]tableState{"users": changed})
+	_, err = loadMergedState([]string{billing, conflicting})
+	if err == nil || !strings.Contains(err.Error(), "conflicts with") || !strings.Contains(err.Error(), "table `users` still has column `email`") {
+		t.Fatalf("expected conflict error for users, got %v", err)
 	}
-}
 
-func assertContainsAll(t *testing.T, sql string, fragments []string) {
-	t.Helper()
-	for _, fragment := range fragments {
-		if strings.Contains(sql, fragment) {
-			continue
-		}
-		t.Fatalf("expected SQL fragment not found: %s\nall SQL:\n%s", fragment, sql)
+	reordered := users
+	reordered.ColumnOrder = []string{"id"}
+	reorderedPath := write("reordered.json", map[string]tableState{"users": reordered})
+	_, err = loadMergedState([]string{billing, reorderedPath})
+	if err == nil || !strings.Contains(err.Error(), "table `users` is saved differently") {
+		t.Fatalf("expected a difference the database cannot report to conflict, got %v", err)
 	}
 }
 
-func TestIndexClassPrefixAndKeyPrefix(t *testing.T) {
-	if got := indexClassPrefix("unique"); got != "UNIQUE " {
-		t.Fatalf("unexpected unique class prefix: %q", got)
+func TestMakeMigrationsMergesExtraStateFiles(t *testing.T) {
+	dir := t.TempDir()
+	usersState := filepath.Join(dir, "users.json")
+	groupsState := filepath.Join(dir, "groups.json")
+	if _, err := SyncSchemaState([]any{&e2eUserNoJoin{}}, dir, usersState); err != nil {
+		t.Fatalf("SyncSchemaState users failed: %v", err)
 	}
-	if got := indexClassPrefix("fulltext"); got != "FULLTEXT " {
-		t.Fatalf("unexpected fulltext class prefix: %q", got)
+	if _, err := SyncSchemaState([]any{&e2eGroupNoJoin{}}, dir, groupsState); err != nil {
+		t.Fatalf("SyncSchemaState groups failed: %v", err)
 	}
-	if got := indexClassPrefix("spatial"); got != "SPATIAL " {
-		t.Fatalf("unexpected spatial class prefix: %q", got)
+
+	result, err := MakeMigrationsWithOptions([]any{&e2eUserNoJoin{}, &e2eGroupNoJoin{}}, dir, "no_change", usersState, Options{StateFiles: []string{groupsState}})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
 	}
-	if got := indexClassPrefix("normal"); got != "" {
-		t.Fatalf("unexpected default class prefix: %q", got)
+	if result.Changed {
+		t.Fatalf("expected no changes when the merged state covers all models")
 	}
 
-	if got := indexClassKeyPrefix("unique"); got != "UNIQUE KEY" {
-		t.Fatalf("unexpected unique key prefix: %q", got)
+	result, err = MakeMigrationsWithOptions([]any{&e2eUserNoJoin{}, &e2eNamedGroup{}}, dir, "group_name", usersState, Options{StateFiles: []string{groupsState}})
+	if err != nil || !result.Changed {
+		t.Fatalf("expected a migration for the new group column, got %+v, %v", result, err)
 	}
-	if got := indexClassKeyPrefix("fulltext"); got != "FULLTEXT KEY" {
-		t.Fatalf("unexpected fulltext key prefix: %q", got)
+	groups, err := loadState(groupsState)
+	if err != nil {
+		t.Fatalf("loadState failed: %v", err)
 	}
-	if got := indexClassKeyPrefix("spatial"); got != "SPATIAL KEY" {
-		t.Fatalf("unexpected spatial key prefix: %q", got)
+	if _, ok := groups.Tables["e2e_groups"].Columns["name"]; !ok || len(groups.Tables) != 1 {
+		t.Fatalf("expected the extra state file to get the new group column, got %#v", groups.Tables)
 	}
-	if got := indexClassKeyPrefix("normal"); got != "KEY" {
-		t.Fatalf("unexpected default key prefix: %q", got)
+	if _, err := loadMergedState([]string{usersState, groupsState}); err != nil {
+		t.Fatalf("expected the state files to merge after the migration: %v", err)
 	}
 }
 
-func TestIndexContainsDeclByColumnAndExpression(t *testing.T) {
-	idx := schema.Index{
-		Name: "idx_demo",
-		Fields: []schema.IndexOption{
-			{
+type e2eNamedGroup struct {
+	ID   uint `gorm:"primaryKey"`
+	Name string
+}
+
+func (e2eNamedGroup) TableName() string { return "e2e_groups" }
+
+type commentedModel struct {
+	ID   uint   `gorm:"primaryKey"`
+	Name string `gorm:"size:64;comment:display name;index:idx_commented_name,comment:lookup"`
+}
+
+func (commentedModel) TableName() string { return "commented_models" }
+
+type uncommentedModel struct {
+	ID   uint   `gorm:"primaryKey"`
+	Name string `gorm:"size:64;index:idx_commented_name"`
+}
+
+func (uncommentedModel) TableName() string { return "commented_models" }
+
+func TestStripCommentsAppliesToSavedAndDiffedState(t *testing.T) {
+	dir := t.TempDir()
+	stateFile := filepath.Join(dir, "state.json")
+	// A state saved by a team that keeps comments.
+	if _, err := SyncSchemaState([]any{&commentedModel{}}, dir, stateFile); err != nil {
+		t.Fatalf("SyncSchemaState failed: %v", err)
+	}
+
+	opts := Options{StripComments: true}
+	result, err := MakeMigrationsWithOptions([]any{&uncommentedModel{}}, dir, "no_comments", stateFile, opts)
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	if result.Changed {
+		t.Fatalf("expected comment-only differences to be ignored")
+	}
+
+	if _, err := SyncSchemaStateWithOptions([]any{&commentedModel{}}, dir, stateFile, opts); err != nil {
+		t.Fatalf("SyncSchemaStateWithOptions failed: %v", err)
+	}
+	data, err := os.ReadFile(stateFile)
+	if err != nil {
+		t.Fatalf("read state failed: %v", err)
+	}
+	if strings.Contains(string(data), "display name") || strings.Contains(string(data), "lookup") {
+		t.Fatalf("expected comment-free state file, got:\n%s", data)
+	}
+	result, err = MakeMigrationsWithOptions([]any{&commentedModel{}}, dir, "comments", stateFile, opts)
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	if result.Changed {
+		t.Fatalf("expected no changes for commented models with StripComments")
+	}
+}
+
+type indexOnlyBefore struct {
+	ID   uint   `gorm:"primaryKey"`
+	Name string `gorm:"size:32"`
+}
+
+func (indexOnlyBefore) TableName() string { return "index_only_models" }
+
+type indexOnlyAfter struct {
+	ID   uint   `gorm:"primaryKey"`
+	Name string `gorm:"size:64;index:idx_index_only_name"`
+	Age  int    `gorm:"index:idx_index_only_age"`
+}
+
+func (indexOnlyAfter) TableName() string { return "index_only_models" }
+
+func TestMakeMigrationsIndexChangesOnly(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := SyncSchemaState([]any{&indexOnlyBefore{}}, dir, ""); err != nil {
+		t.Fatalf("SyncSchemaState failed: %v", err)
+	}
+
+	result, err := MakeMigrationsWithOptions([]any{&indexOnlyAfter{}}, dir, "indexes", "", Options{
+		Version:          "20240101000000",
+		IndexChangesOnly: true,
+	})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	up, err := os.ReadFile(result.UpPath)
+	if err != nil {
+		t.Fatalf("read up failed: %v", err)
+	}
+	if string(up) != "-- operation 1\nCREATE INDEX `idx_index_only_name` ON `index_only_models` (`name`);\n" {
+		t.Fatalf("expected only the index on the existing column, got:\n%s", up)
+	}
+
+	result, err = MakeMigrationsWithOptions([]any{&indexOnlyAfter{}}, dir, "rest", "", Options{Version: "20240102000000"})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	if !result.Changed {
+		t.Fatalf("expected the deferred column changes on the next run")
+	}
+	up, err = os.ReadFile(result.UpPath)
+	if err != nil {
+		t.Fatalf("read up failed: %v", err)
+	}
+	assertContainsAll(t, string(up), []string{
+		"ALTER TABLE `index_only_models` ADD COLUMN `age` bigint;",
+		"ALTER TABLE `index_only_models` MODIFY COLUMN `name` varchar(64);",
+		"CREATE INDEX `idx_index_only_age` ON `index_only_models` (`age`);",
+	})
+	if strings.Contains(string(up), "idx_index_only_name") {
+		t.Fatalf("expected the emitted index to be recorded in state, got:\n%s", up)
+	}
+}
+
+func TestMakeMigrationsPerTableFiles(t *testing.T) {
+	dir := t.TempDir()
+	result, err := MakeMigrationsWithOptions(migrationModels(), dir, "init", "", Options{
+		Version:       "20240101000000",
+		PerTableFiles: true,
+	})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	names := make([]string, 0, len(result.UpPaths))
+	for _, path := range result.UpPaths {
+		names = append(names, filepath.Base(path))
+	}
+	want := []string{
+		"20240101000000_init_test_groups.up.sql",
+		"20240101000000_init_test_user_groups.up.sql",
+		"20240101000000_init_test_users.up.sql",
+		"20240101000000_init_foreign_keys.up.sql",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("unexpected per-table files.\nwant=%v\ngot=%v", want, names)
+	}
+	if len(result.DownPaths) != len(want) || result.UpPath != result.UpPaths[0] {
+		t.Fatalf("unexpected result paths: %#v", result)
+	}
+
+	files, err := listMigrationFiles(dir)
+	if err != nil {
+		t.Fatalf("listMigrationFiles failed: %v", err)
+	}
+	if last := files[len(files)-1]; last.Name != "init_foreign_keys" || last.Version != "20240101000000" {
+		t.Fatalf("expected the foreign key file to be applied last, got %#v", files)
+	}
+
+	tableUp, err := os.ReadFile(result.UpPaths[1])
+	if err != nil {
+		t.Fatalf("read table file failed: %v", err)
+	}
+	if strings.Contains(string(tableUp), "FOREIGN KEY") || !strings.HasPrefix(string(tableUp), "-- operation 1\nCREATE TABLE `test_user_groups`") {
+		t.Fatalf("expected only the table DDL in the table file, got:\n%s", tableUp)
+	}
+	fkUp, err := os.ReadFile(result.UpPaths[3])
+	if err != nil {
+		t.Fatalf("read foreign key file failed: %v", err)
+	}
+	if strings.Count(string(fkUp), "ADD CONSTRAINT") != 2 {
+		t.Fatalf("expected both join table constraints in the foreign key file, got:\n%s", fkUp)
+	}
+}
+
+type foreignKeysTable struct {
+	ID uint `gorm:"primaryKey"`
+}
+
+func (foreignKeysTable) TableName() string { return "user_foreign_keys" }
+
+func TestMakeMigrationsPerTableFilesRejectsForeignKeysFileName(t *testing.T) {
+	dir := t.TempDir()
+	_, err := MakeMigrationsWithOptions([]any{&foreignKeysTable{}}, dir, "init", "", Options{PerTableFiles: true})
+	if err == nil || !strings.Contains(err.Error(), "table `user_foreign_keys` would get a file named like the foreign_keys file") {
+		t.Fatalf("expected the clashing table file to be rejected, got %v", err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.sql")); len(files) != 0 {
+		t.Fatalf("expected no files to be written, got %v", files)
+	}
+}
+
+func TestRunMakeMigrationsCreatesSQLFiles(t *testing.T) {
+	dir := t.TempDir()
+	result, err := MakeMigrations(migrationModels(), dir, "init_schema", "")
+	if err != nil {
+		t.Fatalf("MakeMigrations failed: %v", err)
+	}
+	if !result.Changed {
+		t.Fatalf("expected initial migration to generate files")
+	}
+	upFiles, err := filepath.Glob(filepath.Join(dir, "*.up.sql"))
+	if err != nil {
+		t.Fatalf("glob up sql failed: %v", err)
+	}
+	downFiles, err := filepath.Glob(filepath.Join(dir, "*.down.sql"))
+	if err != nil {
+		t.Fatalf("glob down sql failed: %v", err)
+	}
+	if len(upFiles) != 1 || len(downFiles) != 1 {
+		t.Fatalf("expected one up and one down migration file, got up=%v down=%v", upFiles, downFiles)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".schema_state.json")); err != nil {
+		t.Fatalf("expected schema state file created, got: %v", err)
+	}
+}
+
+func assertContainsAll(t *testing.T, sql string, fragments []string) {
+	t.Helper()
+	for _, fragment := range fragments {
+		if strings.Contains(sql, fragment) {
+			continue
+		}
+		t.Fatalf("expected SQL fragment not found: %s\nall SQL:\n%s", fragment, sql)
+	}
+}
+
+func TestIndexClassPrefixAndKeyPrefix(t *testing.T) {
+	if got := indexClassPrefix("unique"); got != "UNIQUE " {
+		t.Fatalf("unexpected unique class prefix: %q", got)
+	}
+	if got := indexClassPrefix("fulltext"); got != "FULLTEXT " {
+		t.Fatalf("unexpected fulltext class prefix: %q", got)
+	}
+	if got := indexClassPrefix("spatial"); got != "SPATIAL " {
+		t.Fatalf("unexpected spatial class prefix: %q", got)
+	}
+	if got := indexClassPrefix("normal"); got != "" {
+		t.Fatalf("unexpected default class prefix: %q", got)
+	}
+
+	if got := indexClassKeyPrefix("unique"); got != "UNIQUE KEY" {
+		t.Fatalf("unexpected unique key prefix: %q", got)
+	}
+	if got := indexClassKeyPrefix("fulltext"); got != "FULLTEXT KEY" {
+		t.Fatalf("unexpected fulltext key prefix: %q", got)
+	}
+	if got := indexClassKeyPrefix("spatial"); got != "SPATIAL KEY" {
+		t.Fatalf("unexpected spatial key prefix: %q", got)
+	}
+	if got := indexClassKeyPrefix("normal"); got != "KEY" {
+		t.Fatalf("unexpected default key prefix: %q", got)
+	}
+}
+
+func TestIndexContainsDeclByColumnAndExpression(t *testing.T) {
+	idx := schema.Index{
+		Name: "idx_demo",
+		Fields: []schema.IndexOption{
+			{
 				Field: &schema.Field{DBName: "name"},
 			},
 			{
@@ -891,3 +1682,640 @@ func TestIndexContainsDeclByColumnAndExpression(t *testing.T) {
 		t.Fatalf("expected indexContainsDecl for missing column to be false")
 	}
 }
+
+func TestDiffTableRenamedIndexFollowsMySQLVersion(t *testing.T) {
+	idx := indexState{Class: "UNIQUE", Fields: []indexFieldState{{Column: "email"}}}
+	prev := tableState{
+		Columns: map[string]columnState{"email": {Definition: "varchar(64)"}},
+		Indexes: map[string]indexState{"idx_users_email": idx},
+	}
+	cur := tableState{
+		Columns: map[string]columnState{"email": {Definition: "varchar(64)"}},
+		Indexes: map[string]indexState{"users_email_idx": idx},
+	}
+
+	ops := diffTableWithOptions("users", prev, cur, Options{MySQLVersion: "8.0.36"})
+	if len(ops) != 1 || ops[0].kind != opRenameIndex {
+		t.Fatalf("expected one rename op, got %#v", ops)
+	}
+	if ops[0].up != "ALTER TABLE `users` RENAME INDEX `idx_users_email` TO `users_email_idx`;" {
+		t.Fatalf("unexpected 8.0 up SQL: %s", ops[0].up)
+	}
+	if ops[0].down != "ALTER TABLE `users` RENAME INDEX `users_email_idx` TO `idx_users_email`;" {
+		t.Fatalf("unexpected 8.0 down SQL: %s", ops[0].down)
+	}
+
+	for _, version := range []string{"5.7", ""} {
+		ops = diffTableWithOptions("users", prev, cur, Options{MySQLVersion: version})
+		if len(ops) != 1 || ops[0].kind != opRenameIndex {
+			t.Fatalf("version %q: expected one rename op, got %#v", version, ops)
+		}
+		wantUp := "CREATE UNIQUE INDEX `users_email_idx` ON `users` (`email`);\nDROP INDEX `idx_users_email` ON `users`;"
+		if ops[0].up != wantUp {
+			t.Fatalf("version %q: unexpected up SQL:\n%s", version, ops[0].up)
+		}
+		wantDown := "CREATE UNIQUE INDEX `idx_users_email` ON `users` (`email`);\nDROP INDEX `users_email_idx` ON `users`;"
+		if ops[0].down != wantDown {
+			t.Fatalf("version %q: unexpected down SQL:\n%s", version, ops[0].down)
+		}
+	}
+
+	prevState := schemaState{Tables: map[string]tableState{"users": prev}}
+	curState := schemaState{Tables: map[string]tableState{"users": cur}}
+	if err := verifyMigrationOps(prevState, curState, diffSchemas(prevState, curState, Options{}), Options{}); err != nil {
+		t.Fatalf("unexpected self-check failure: %v", err)
+	}
+	if err := validateMySQLVersion("eight"); err == nil {
+		t.Fatalf("expected error for invalid MySQL version")
+	}
+}
+
+type descIndexEvent struct {
+	ID        uint  `gorm:"primaryKey"`
+	CreatedAt int64 `gorm:"index:idx_events_created_at,sort:desc"`
+}
+
+func (descIndexEvent) TableName() string { return "desc_index_events" }
+
+func TestMakeMigrationsDescendingIndexFollowsMySQLVersion(t *testing.T) {
+	dir := t.TempDir()
+	logger := &recordingLogger{}
+	result, err := MakeMigrationsWithOptions([]any{&descIndexEvent{}}, dir, "events", "", Options{MySQLVersion: "5.7.44", Logger: logger, Version: "1"})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	if up := readMigration(t, result.UpPath); !strings.Contains(up, "  KEY `idx_events_created_at` (`created_at`)\n") {
+		t.Fatalf("expected the 5.7 index to be ascending, got:\n%s", up)
+	}
+	if got := strings.Join(logger.lines, "\n"); !strings.Contains(got, "MySQL 5.7.44 ignores DESC on created_at") {
+		t.Fatalf("expected the dropped DESC to be logged, got %q", got)
+	}
+	if again, err := MakeMigrationsWithOptions([]any{&descIndexEvent{}}, dir, "events", "", Options{MySQLVersion: "5.7", Version: "2"}); err != nil || again.Changed {
+		t.Fatalf("expected no migration on a 5.7 rerun, got %#v, %v", again, err)
+	}
+
+	// A state saved with DESC, e.g. before MySQLVersion was set, matches the
+	// models on 5.7 too instead of recreating the index.
+	state, err := buildCurrentStateWithOptions([]any{&descIndexEvent{}}, Options{MySQLVersion: "8.0"})
+	if err != nil {
+		t.Fatalf("buildCurrentStateWithOptions failed: %v", err)
+	}
+	if idx := state.Tables["desc_index_events"].Indexes["idx_events_created_at"]; idx.Fields[0].Sort != "DESC" {
+		t.Fatalf("expected 8.0 to keep DESC, got %#v", idx)
+	}
+	stateFile := filepath.Join(dir, ".schema_state.json")
+	if err := saveState(stateFile, state); err != nil {
+		t.Fatalf("saveState failed: %v", err)
+	}
+	if again, err := MakeMigrationsWithOptions([]any{&descIndexEvent{}}, dir, "events", "", Options{MySQLVersion: "5.7", Version: "3"}); err != nil || again.Changed {
+		t.Fatalf("expected a saved DESC to be ignored on 5.7, got %#v, %v", again, err)
+	}
+}
+
+func TestMakeMigrationsContextCanceled(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := MakeMigrationsContext(ctx, migrationModels(), dir, "init_schema", "", Options{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a canceled error, got %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read dir failed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected a canceled run to write nothing, got %v", entries)
+	}
+}
+
+func TestMarkedMigrationOpsNumberBothFiles(t *testing.T) {
+	ops := []migrationOp{
+		{kind: opTableEngine, table: "a", up: "ALTER TABLE `a` ENGINE=MyISAM;"},
+		{kind: opDropForeignKey, table: "b", down: "ALTER TABLE `b` ADD CONSTRAINT `fk_b_a` FOREIGN KEY (`a_id`) REFERENCES `a` (`id`);"},
+		{kind: opDropTable, table: "b", up: "DROP TABLE IF EXISTS `b`;", down: "CREATE TABLE `b` (\n  `a_id` bigint\n);"},
+		{kind: opAddForeignKey, table: "c"},
+	}
+	up, down := markedMigrationOps(ops)
+	wantUp := []string{"-- operation 1\nALTER TABLE `a` ENGINE=MyISAM;", "-- operation 2\nDROP TABLE IF EXISTS `b`;"}
+	wantDown := []string{"-- operation 2\nCREATE TABLE `b` (\n  `a_id` bigint\n);", "-- operation 2\nALTER TABLE `b` ADD CONSTRAINT `fk_b_a` FOREIGN KEY (`a_id`) REFERENCES `a` (`id`);"}
+	if !reflect.DeepEqual(up, wantUp) || !reflect.DeepEqual(down, wantDown) {
+		t.Fatalf("unexpected marked files:\nup: %#v\ndown: %#v", up, down)
+	}
+	blocks := pairMigrationBlocks(strings.Join(up, "\n\n"), strings.Join(down, "\n\n"))
+	if blocks[0].paired || !blocks[1].paired || len(blocks[1].down) != 2 {
+		t.Fatalf("expected Apply to pair the restored foreign key with the dropped table only, got %#v", blocks)
+	}
+}
+
+func TestMakeMigrationsAnnotations(t *testing.T) {
+	dir := t.TempDir()
+	result, err := MakeMigrationsWithOptions([]any{&e2eUserNoJoin{}, &e2eGroupNoJoin{}}, dir, "init", "", Options{
+		Annotations: []string{"ticket: PROJ-123", "reviewed by dba\nDROP TABLE `e2e_users`;"},
+	})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	for _, path := range []string{result.UpPath, result.DownPath} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read %s failed: %v", path, err)
+		}
+		content := string(data)
+		header := "-- ticket: PROJ-123\n-- reviewed by dba\n-- DROP TABLE `e2e_users`;\n\n"
+		if !strings.HasPrefix(content, header) {
+			t.Fatalf("expected annotation header in %s, got:\n%s", path, content)
+		}
+		blocks := splitSQLBlocks(content)
+		if len(blocks) != 2 {
+			t.Fatalf("expected annotations to add no statements to %s, got %#v", path, blocks)
+		}
+		for _, block := range blocks {
+			for _, stmt := range block {
+				if strings.Contains(stmt, "--") {
+					t.Fatalf("annotation leaked into statement %q", stmt)
+				}
+			}
+		}
+	}
+}
+
+func TestDiffSchemasAnnotateDataLoss(t *testing.T) {
+	prev := schemaState{Tables: map[string]tableState{
+		"people": {
+			Columns:     map[string]columnState{"id": {Definition: "bigint"}, "nickname": {Definition: "varchar(32)"}},
+			PrimaryKeys: []string{"id"},
+		},
+		"pets": {Columns: map[string]columnState{"id": {Definition: "bigint"}}},
+	}}
+	cur := schemaState{Tables: map[string]tableState{
+		"people": {Columns: map[string]columnState{"id": {Definition: "bigint"}}, PrimaryKeys: []string{"id"}},
+	}}
+
+	for _, op := range diffSchemas(prev, cur, Options{}) {
+		if strings.Contains(op.down, "data loss") {
+			t.Fatalf("expected no data loss note by default, got %q", op.down)
+		}
+	}
+
+	downs := map[string]string{}
+	for _, op := range diffSchemas(prev, cur, Options{AnnotateDataLoss: true}) {
+		downs[op.name] = op.down
+		if op.kind != opDropColumn && op.kind != opDropTable && strings.Contains(op.down, "data loss") {
+			t.Fatalf("unexpected data loss note on %s: %q", op.name, op.down)
+		}
+	}
+	if want := "-- data loss: cannot restore dropped column values\nALTER TABLE `people` ADD COLUMN `nickname` varchar(32);"; downs["nickname"] != want {
+		t.Fatalf("unexpected drop column down:\n%s", downs["nickname"])
+	}
+	if !strings.HasPrefix(downs["pets"], "-- data loss: cannot restore dropped table rows\nCREATE TABLE `pets`") {
+		t.Fatalf("unexpected drop table down:\n%s", downs["pets"])
+	}
+}
+
+func TestDiffSchemasAutoIncrementOnRollback(t *testing.T) {
+	prev := schemaState{Tables: map[string]tableState{
+		"orders": {
+			Columns:     map[string]columnState{"id": {Definition: "bigint unsigned AUTO_INCREMENT"}},
+			PrimaryKeys: []string{"id"},
+		},
+		"tags": {Columns: map[string]columnState{"name": {Definition: "varchar(32)"}}},
+	}}
+	cur := schemaState{Tables: map[string]tableState{}}
+
+	downs := func(opts Options) map[string]string {
+		out := map[string]string{}
+		for _, op := range diffSchemas(prev, cur, opts) {
+			out[op.name] = op.down
+		}
+		return out
+	}
+	if got := downs(Options{})["orders"]; strings.Contains(got, "AUTO_INCREMENT =") || strings.HasPrefix(got, "--") {
+		t.Fatalf("expected a plain CREATE TABLE by default, got:\n%s", got)
+	}
+
+	annotated := downs(Options{AnnotateAutoIncrementReset: true})
+	if !strings.HasPrefix(annotated["orders"], "-- rollback restarts the auto-increment counter of `orders`\nCREATE TABLE `orders`") {
+		t.Fatalf("unexpected annotated down:\n%s", annotated["orders"])
+	}
+	if strings.HasPrefix(annotated["tags"], "--") {
+		t.Fatalf("expected no note for a table without an auto-increment column, got:\n%s", annotated["tags"])
+	}
+
+	restored := downs(Options{AnnotateAutoIncrementReset: true, AutoIncrementHighWater: map[string]uint64{"orders": 1500}})
+	if !strings.HasPrefix(restored["orders"], "CREATE TABLE `orders`") || !strings.HasSuffix(restored["orders"], "\nALTER TABLE `orders` AUTO_INCREMENT = 1500;") {
+		t.Fatalf("expected the counter to be restored after the table is recreated, got:\n%s", restored["orders"])
+	}
+}
+
+func TestMakeMigrationsSQLModeGuard(t *testing.T) {
+	dir := t.TempDir()
+	result, err := MakeMigrationsWithOptions([]any{&e2eUserNoJoin{}}, dir, "init", "", Options{
+		SQLMode:     "STRICT_TRANS_TABLES",
+		Annotations: []string{"ticket: PROJ-1"},
+	})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	up, err := os.ReadFile(result.UpPath)
+	if err != nil {
+		t.Fatalf("read up failed: %v", err)
+	}
+	content := string(up)
+	wantPrefix := "-- ticket: PROJ-1\n\nSET @old_sql_mode = @@SESSION.sql_mode;\nSET SESSION sql_mode = 'STRICT_TRANS_TABLES';\n\n-- operation 1\nCREATE TABLE `e2e_users`"
+	if !strings.HasPrefix(content, wantPrefix) {
+		t.Fatalf("expected the sql_mode guard after the annotations, got:\n%s", content)
+	}
+	if !strings.HasSuffix(content, "\n\nSET SESSION sql_mode = @old_sql_mode;\n") {
+		t.Fatalf("expected the sql_mode to be restored at the end, got:\n%s", content)
+	}
+
+	plain, err := MakeMigrationsWithOptions([]any{&e2eUserNoJoin{}}, t.TempDir(), "init", "", Options{})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	if data, _ := os.ReadFile(plain.UpPath); strings.Contains(string(data), "sql_mode") {
+		t.Fatalf("expected no sql_mode guard by default, got:\n%s", data)
+	}
+}
+
+func TestDiffTableFulltextParserChangeRecreatesIndex(t *testing.T) {
+	columns := map[string]columnState{"body": {Definition: "text"}}
+	ngram := indexState{Class: "FULLTEXT", Option: "WITH PARSER ngram", Fields: []indexFieldState{{Column: "body"}}}
+	plain := indexState{Class: "FULLTEXT", Fields: []indexFieldState{{Column: "body"}}}
+	prev := tableState{Columns: columns, Indexes: map[string]indexState{"idx_posts_body": ngram}}
+	cur := tableState{Columns: columns, Indexes: map[string]indexState{"idx_posts_body": plain}}
+
+	ops := diffTable("posts", prev, cur)
+	if len(ops) != 1 || ops[0].kind != opModifyIndex {
+		t.Fatalf("expected one index recreate, got %#v", ops)
+	}
+	wantUp := "DROP INDEX `idx_posts_body` ON `posts`;\nCREATE FULLTEXT INDEX `idx_posts_body` ON `posts` (`body`);"
+	if ops[0].up != wantUp {
+		t.Fatalf("unexpected up SQL:\n%s", ops[0].up)
+	}
+	wantDown := "DROP INDEX `idx_posts_body` ON `posts`;\nCREATE FULLTEXT INDEX `idx_posts_body` ON `posts` (`body`) WITH PARSER ngram;"
+	if ops[0].down != wantDown {
+		t.Fatalf("unexpected down SQL:\n%s", ops[0].down)
+	}
+
+	respaced := tableState{Columns: columns, Indexes: map[string]indexState{"idx_posts_body": {
+		Class: "fulltext", Option: " with  parser ngram", Fields: []indexFieldState{{Column: "body"}},
+	}}}
+	if ops := diffTable("posts", prev, respaced); len(ops) != 0 {
+		t.Fatalf("expected parser spelling differences to be ignored, got %#v", ops)
+	}
+
+	create := createTableSQL("posts", prev)
+	if !strings.Contains(create, "FULLTEXT KEY `idx_posts_body` (`body`) WITH PARSER ngram") {
+		t.Fatalf("expected the parser in CREATE TABLE, got:\n%s", create)
+	}
+}
+
+type fulltextPostNgram struct {
+	ID   uint   `gorm:"primaryKey"`
+	Body string `gorm:"type:text;index:idx_posts_body,class:FULLTEXT,option:WITH PARSER ngram"`
+}
+
+func (fulltextPostNgram) TableName() string { return "fulltext_posts" }
+
+type fulltextPostMecab struct {
+	ID   uint   `gorm:"primaryKey"`
+	Body string `gorm:"type:text;index:idx_posts_body,class:FULLTEXT,option:WITH PARSER mecab"`
+}
+
+func (fulltextPostMecab) TableName() string { return "fulltext_posts" }
+
+type fulltextPostPlain struct {
+	ID   uint   `gorm:"primaryKey"`
+	Body string `gorm:"type:text"`
+}
+
+func (fulltextPostPlain) TableName() string { return "fulltext_posts" }
+
+func TestMakeMigrationsFulltextParserLifecycle(t *testing.T) {
+	dir := t.TempDir()
+	step := func(version string, model any) MakeMigrationsResult {
+		t.Helper()
+		result, err := MakeMigrationsWithOptions([]any{model}, dir, "posts", "", Options{Version: version})
+		if err != nil {
+			t.Fatalf("MakeMigrationsWithOptions %s failed: %v", version, err)
+		}
+		return result
+	}
+
+	created := step("1", &fulltextPostNgram{})
+	if up := readMigration(t, created.UpPath); !strings.Contains(up, "  FULLTEXT KEY `idx_posts_body` (`body`) WITH PARSER ngram\n") {
+		t.Fatalf("expected the parser in CREATE TABLE, got:\n%s", up)
+	}
+	state, err := loadState(created.StatePath)
+	if err != nil {
+		t.Fatalf("loadState failed: %v", err)
+	}
+	if idx := state.Tables["fulltext_posts"].Indexes["idx_posts_body"]; idx.Class != "FULLTEXT" || idx.Option != "WITH PARSER ngram" {
+		t.Fatalf("expected the parser to be saved, got %#v", idx)
+	}
+	if again := step("2", &fulltextPostNgram{}); again.Changed {
+		t.Fatalf("expected no migration after a state round trip, got %s", readMigration(t, again.UpPath))
+	}
+
+	changed := step("3", &fulltextPostMecab{})
+	if got, want := readMigration(t, changed.UpPath), "DROP INDEX `idx_posts_body` ON `fulltext_posts`;\nCREATE FULLTEXT INDEX `idx_posts_body` ON `fulltext_posts` (`body`) WITH PARSER mecab;"; got != want {
+		t.Fatalf("unexpected parser change up:\n%s", got)
+	}
+	if got, want := readMigration(t, changed.DownPath), "DROP INDEX `idx_posts_body` ON `fulltext_posts`;\nCREATE FULLTEXT INDEX `idx_posts_body` ON `fulltext_posts` (`body`) WITH PARSER ngram;"; got != want {
+		t.Fatalf("unexpected parser change down:\n%s", got)
+	}
+
+	dropped := step("4", &fulltextPostPlain{})
+	if got, want := readMigration(t, dropped.UpPath), "DROP INDEX `idx_posts_body` ON `fulltext_posts`;"; got != want {
+		t.Fatalf("unexpected drop up:\n%s", got)
+	}
+	if got, want := readMigration(t, dropped.DownPath), "CREATE FULLTEXT INDEX `idx_posts_body` ON `fulltext_posts` (`body`) WITH PARSER mecab;"; got != want {
+		t.Fatalf("unexpected drop down:\n%s", got)
+	}
+}
+
+type expressionIndexUser struct {
+	ID    uint   `gorm:"primaryKey"`
+	Email string `gorm:"size:128;index:idx_lower_email,expression:LOWER(email)"`
+}
+
+func (expressionIndexUser) TableName() string { return "expression_index_users" }
+
+type expressionIndexUserTrimmed struct {
+	ID    uint   `gorm:"primaryKey"`
+	Email string `gorm:"size:128;index:idx_lower_email,expression:LOWER(TRIM(email))"`
+}
+
+func (expressionIndexUserTrimmed) TableName() string { return "expression_index_users" }
+
+func TestMakeMigrationsExpressionIndexLifecycle(t *testing.T) {
+	dir := t.TempDir()
+	step := func(version string, model any) MakeMigrationsResult {
+		t.Helper()
+		result, err := MakeMigrationsWithOptions([]any{model}, dir, "users", "", Options{Version: version})
+		if err != nil {
+			t.Fatalf("MakeMigrationsWithOptions %s failed: %v", version, err)
+		}
+		return result
+	}
+
+	// MySQL wants a functional key part in its own parentheses.
+	created := step("1", &expressionIndexUser{})
+	if up := readMigration(t, created.UpPath); !strings.Contains(up, "  KEY `idx_lower_email` ((LOWER(email)))\n") {
+		t.Fatalf("expected the expression in CREATE TABLE, got:\n%s", up)
+	}
+	state, err := loadState(created.StatePath)
+	if err != nil {
+		t.Fatalf("loadState failed: %v", err)
+	}
+	if idx := state.Tables["expression_index_users"].Indexes["idx_lower_email"]; len(idx.Fields) != 1 || idx.Fields[0].Expression != "LOWER(email)" {
+		t.Fatalf("expected the expression to be saved, got %#v", idx)
+	}
+	if again := step("2", &expressionIndexUser{}); again.Changed {
+		t.Fatalf("expected no migration after a state round trip, got %s", readMigration(t, again.UpPath))
+	}
+
+	changed := step("3", &expressionIndexUserTrimmed{})
+	if got, want := readMigration(t, changed.UpPath), "DROP INDEX `idx_lower_email` ON `expression_index_users`;\nCREATE INDEX `idx_lower_email` ON `expression_index_users` ((LOWER(TRIM(email))));"; got != want {
+		t.Fatalf("unexpected expression change up:\n%s", got)
+	}
+	if got, want := readMigration(t, changed.DownPath), "DROP INDEX `idx_lower_email` ON `expression_index_users`;\nCREATE INDEX `idx_lower_email` ON `expression_index_users` ((LOWER(email)));"; got != want {
+		t.Fatalf("unexpected expression change down:\n%s", got)
+	}
+
+	idx := state.Tables["expression_index_users"].Indexes["idx_lower_email"]
+	if got, want := createIndexSQLFor(DialectPostgres, "expression_index_users", "idx_lower_email", idx), `CREATE INDEX "idx_lower_email" ON "expression_index_users" ((LOWER(email)));`; got != want {
+		t.Fatalf("unexpected Postgres expression index:\n%s", got)
+	}
+}
+
+func TestDiffTableIndexCommentOnlyChange(t *testing.T) {
+	columns := map[string]columnState{"email": {Definition: "varchar(64)"}}
+	prev := tableState{Columns: columns, Indexes: map[string]indexState{
+		"idx_users_email": {Comment: "lookup", Fields: []indexFieldState{{Column: "email"}}},
+	}}
+	cur := tableState{Columns: columns, Indexes: map[string]indexState{
+		"idx_users_email": {Comment: "login lookup", Fields: []indexFieldState{{Column: "email"}}},
+	}}
+
+	ops := diffTable("users", prev, cur)
+	if len(ops) != 1 || ops[0].kind != opModifyIndex {
+		t.Fatalf("expected an index recreate by default, got %#v", ops)
+	}
+	if !strings.HasSuffix(ops[0].up, "COMMENT 'login lookup';") || !strings.HasSuffix(ops[0].down, "COMMENT 'lookup';") {
+		t.Fatalf("unexpected recreate SQL:\n%s\n%s", ops[0].up, ops[0].down)
+	}
+	prevState := schemaState{Tables: map[string]tableState{"users": prev}}
+	curState := schemaState{Tables: map[string]tableState{"users": cur}}
+	if err := verifyMigrationOps(prevState, curState, nil, Options{}); err == nil {
+		t.Fatalf("expected the self-check to compare index comments")
+	}
+
+	opts := Options{IgnoreIndexComment: true}
+	if ops := diffTableWithOptions("users", prev, cur, opts); len(ops) != 0 {
+		t.Fatalf("expected comment-only index changes to be ignored, got %#v", ops)
+	}
+	if err := verifyMigrationOps(prevState, curState, nil, opts); err != nil {
+		t.Fatalf("expected the self-check to ignore index comments, got %v", err)
+	}
+}
+
+func TestDiffTableIndexUniquenessConversion(t *testing.T) {
+	columns := map[string]columnState{"email": {Definition: "varchar(255)"}, "tenant_id": {Definition: "bigint"}}
+	fields := []indexFieldState{{Column: "tenant_id"}, {Column: "email", Length: 64}}
+	plain := tableState{Columns: columns, Indexes: map[string]indexState{"idx_users_email": {Fields: fields}}}
+	unique := tableState{Columns: columns, Indexes: map[string]indexState{"idx_users_email": {Class: "UNIQUE", Fields: fields}}}
+
+	ops := diffTable("users", plain, unique)
+	if len(ops) != 1 || ops[0].kind != opModifyIndex || classifyUniquenessChange(plain.Indexes["idx_users_email"], unique.Indexes["idx_users_email"]) != uniquenessAdded {
+		t.Fatalf("expected one index recreate that adds uniqueness, got %#v", ops)
+	}
+	if len(ops[0].warnings) != 1 {
+		t.Fatalf("expected a duplicate rows warning, got %#v", ops[0].warnings)
+	}
+	wantQuery := "SELECT `tenant_id`, LEFT(`email`, 64), COUNT(*) FROM `users` WHERE `tenant_id` IS NOT NULL AND `email` IS NOT NULL GROUP BY `tenant_id`, LEFT(`email`, 64) HAVING COUNT(*) > 1;"
+	if ops[0].warnings[0].Query != wantQuery {
+		t.Fatalf("unexpected duplicate check query: %s", ops[0].warnings[0].Query)
+	}
+	if !strings.HasPrefix(ops[0].up, "-- WARNING: index `idx_users_email` on `users` becomes unique") ||
+		!strings.HasSuffix(ops[0].up, "DROP INDEX `idx_users_email` ON `users`;\nCREATE UNIQUE INDEX `idx_users_email` ON `users` (`tenant_id`, `email`(64));") {
+		t.Fatalf("unexpected up SQL:\n%s", ops[0].up)
+	}
+
+	ops = diffTable("users", unique, plain)
+	if len(ops) != 1 || ops[0].kind != opModifyIndex || classifyUniquenessChange(unique.Indexes["idx_users_email"], plain.Indexes["idx_users_email"]) != uniquenessRemoved {
+		t.Fatalf("expected one index recreate that removes uniqueness, got %#v", ops)
+	}
+	if len(ops[0].warnings) != 0 {
+		t.Fatalf("expected no warning when uniqueness is removed, got %#v", ops[0].warnings)
+	}
+	if ops[0].up != "DROP INDEX `idx_users_email` ON `users`;\nCREATE INDEX `idx_users_email` ON `users` (`tenant_id`, `email`(64));" {
+		t.Fatalf("unexpected up SQL:\n%s", ops[0].up)
+	}
+}
+
+type enumStatusBefore struct {
+	ID     uint   `gorm:"primaryKey"`
+	Status string `gorm:"type:enum('new','paid')"`
+	Flags  string `gorm:"type:set('a','b')"`
+}
+
+func (enumStatusBefore) TableName() string { return "enum_orders" }
+
+type enumStatusAfter struct {
+	ID     uint   `gorm:"primaryKey"`
+	Status string `gorm:"type:enum('new','paid','refunded')"`
+	Flags  string `gorm:"type:set('a','b','c')"`
+}
+
+func (enumStatusAfter) TableName() string { return "enum_orders" }
+
+func TestMakeMigrationsWarnsOnLossyEnumRollback(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := MakeMigrations([]any{&enumStatusBefore{}}, dir, "init", ""); err != nil {
+		t.Fatalf("initial MakeMigrations failed: %v", err)
+	}
+	result, err := MakeMigrationsWithOptions([]any{&enumStatusAfter{}}, dir, "grow", "", Options{Version: "20240101000001"})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	want := []SafetyWarning{
+		{
+			Table:    "enum_orders",
+			Name:     "flags",
+			Severity: SeverityRisky,
+			Message:  "rolling back removes set values 'c' from `enum_orders`.`flags`; rows holding them make the rollback fail",
+			Query:    "SELECT * FROM `enum_orders` WHERE FIND_IN_SET('c', `flags`) > 0;",
+			Rollback: true,
+		},
+		{
+			Table:    "enum_orders",
+			Name:     "status",
+			Severity: SeverityRisky,
+			Message:  "rolling back removes enum values 'refunded' from `enum_orders`.`status`; rows holding them make the rollback fail",
+			Query:    "SELECT * FROM `enum_orders` WHERE `status` IN ('refunded');",
+			Rollback: true,
+		},
+	}
+	if !reflect.DeepEqual(result.Warnings, want) {
+		t.Fatalf("unexpected warnings:\n%#v", result.Warnings)
+	}
+	if up := readMigration(t, result.UpPath); strings.Contains(up, "WARNING") {
+		t.Fatalf("expected the up migration to carry no warning, got:\n%s", up)
+	}
+	assertContainsAll(t, readMigration(t, result.DownPath), []string{
+		"-- WARNING: rolling back removes enum values 'refunded' from `enum_orders`.`status`; rows holding them make the rollback fail\n" +
+			"-- check with: SELECT * FROM `enum_orders` WHERE `status` IN ('refunded');\n" +
+			"ALTER TABLE `enum_orders` MODIFY COLUMN `status` enum('new','paid');",
+	})
+
+	// Removing a value again is not a lossy rollback but a narrowing.
+	ops := diffTable("enum_orders", tableState{Columns: map[string]columnState{"status": {Definition: "enum('new','paid','refunded')"}}},
+		tableState{Columns: map[string]columnState{"status": {Definition: "enum('new','paid')"}}})
+	if len(ops) != 1 || len(ops[0].warnings) != 1 || ops[0].warnings[0].Rollback ||
+		ops[0].warnings[0].Query != "SELECT * FROM `enum_orders` WHERE `status` IN ('refunded');" {
+		t.Fatalf("expected only a narrowing warning when values are removed, got %#v", ops)
+	}
+}
+
+type riskPeopleBefore struct {
+	ID     uint   `gorm:"primaryKey"`
+	Name   string `gorm:"size:128"`
+	Legacy string `gorm:"size:16"`
+}
+
+func (riskPeopleBefore) TableName() string { return "risk_people" }
+
+type riskPeopleAfter struct {
+	ID   uint   `gorm:"primaryKey"`
+	Name string `gorm:"size:32"`
+}
+
+func (riskPeopleAfter) TableName() string { return "risk_people" }
+
+type riskArchive struct {
+	ID uint `gorm:"primaryKey"`
+}
+
+func (riskArchive) TableName() string { return "risk_archive" }
+
+func TestMakeMigrationsReportsDestructiveChanges(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := MakeMigrations([]any{&riskPeopleBefore{}, &riskArchive{}}, dir, "init", ""); err != nil {
+		t.Fatalf("initial MakeMigrations failed: %v", err)
+	}
+	result, err := MakeMigrationsWithOptions([]any{&riskPeopleAfter{}}, dir, "shrink", "", Options{Version: "20240101000001"})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	want := []SafetyWarning{
+		{
+			Table:    "risk_archive",
+			Name:     "risk_archive",
+			Severity: SeverityDestructive,
+			Message:  "dropping table `risk_archive` discards its rows",
+		},
+		{
+			Table:    "risk_people",
+			Name:     "legacy",
+			Severity: SeverityDestructive,
+			Message:  "dropping column `risk_people`.`legacy` discards its values",
+		},
+		{
+			Table:    "risk_people",
+			Name:     "name",
+			Severity: SeverityDestructive,
+			Message:  "narrowing `risk_people`.`name` from varchar(128) to varchar(32) may truncate existing values",
+			Query:    "SELECT * FROM `risk_people` WHERE CHAR_LENGTH(`name`) > 32;",
+		},
+	}
+	if !reflect.DeepEqual(result.Warnings, want) {
+		t.Fatalf("unexpected warnings:\n%#v", result.Warnings)
+	}
+	if up := readMigration(t, result.UpPath); strings.Contains(up, "WARNING") {
+		t.Fatalf("expected destructive warnings to stay out of the file, got:\n%s", up)
+	}
+}
+
+func TestMakeMigrationsBlockDestructive(t *testing.T) {
+	dir := t.TempDir()
+	blocking := Options{BlockDestructive: true}
+	if _, err := MakeMigrationsWithOptions([]any{&riskPeopleBefore{}, &riskArchive{}}, dir, "init", "", blocking); err != nil {
+		t.Fatalf("expected an additive migration to pass, got %v", err)
+	}
+	stateFile := filepath.Join(dir, ".schema_state.json")
+	before, err := os.ReadFile(stateFile)
+	if err != nil {
+		t.Fatalf("read state: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+
+	_, err = MakeMigrationsWithOptions([]any{&riskPeopleAfter{}}, dir, "shrink", "", blocking)
+	if err == nil {
+		t.Fatalf("expected destructive changes to be blocked")
+	}
+	assertContainsAll(t, err.Error(), []string{
+		"migration has 3 destructive change(s); set Options.AllowDestructive to write it:",
+		"  dropping column `risk_people`.`legacy` discards its values:\n    ALTER TABLE `risk_people` DROP COLUMN `legacy`;",
+		"  narrowing `risk_people`.`name` from varchar(128) to varchar(32) may truncate existing values:\n    ALTER TABLE `risk_people` MODIFY COLUMN `name` varchar(32);",
+		"  dropping table `risk_archive` discards its rows:\n    DROP TABLE IF EXISTS `risk_archive`;",
+	})
+	if _, _, _, err := PreviewMigrationsWithOptions([]any{&riskPeopleAfter{}}, stateFile, blocking); err == nil || !strings.HasPrefix(err.Error(), "migration has 3 destructive change(s)") {
+		t.Fatalf("expected the preview to be blocked too, got %v", err)
+	}
+	after, err := os.ReadFile(stateFile)
+	if err != nil {
+		t.Fatalf("read state: %v", err)
+	}
+	if now, _ := os.ReadDir(dir); len(now) != len(entries) || string(after) != string(before) {
+		t.Fatalf("expected a blocked migration to write nothing")
+	}
+
+	blocking.AllowDestructive = true
+	result, err := MakeMigrationsWithOptions([]any{&riskPeopleAfter{}}, dir, "shrink", "", blocking)
+	if err != nil || !result.Changed {
+		t.Fatalf("expected AllowDestructive to write the migration, got %v", err)
+	}
+}
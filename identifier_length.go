@@ -0,0 +1,57 @@
+package gomigration
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// maxIdentifierLength is the longest identifier opts accepts:
+// MaxIdentifierLength when set, otherwise the dialect's limit.
+func (o Options) maxIdentifierLength() int {
+	if o.MaxIdentifierLength > 0 {
+		return o.MaxIdentifierLength
+	}
+	return maxIdentifierLength(o.Dialect)
+}
+
+// identifierLength counts characters, not bytes, as MySQL and Postgres
+// limits do for the UTF-8 names the models produce.
+func identifierLength(name string) int {
+	return utf8.RuneCountInString(name)
+}
+
+// validateIdentifierLengths rejects table, column, index and foreign key
+// names longer than the target accepts, so they fail here instead of when
+// the migration runs. The schema and the table of a schema-qualified
+// Postgres table are limited separately.
+func validateIdentifierLengths(state schemaState, opts Options) error {
+	limit := opts.maxIdentifierLength()
+	if limit == 0 {
+		return nil
+	}
+	for _, tableName := range sortedKeys(state.Tables) {
+		table := state.Tables[tableName]
+		parts := []string{tableName}
+		if opts.Dialect == DialectPostgres {
+			if schemaName, name, ok := splitPostgresTable(tableName); ok {
+				parts = []string{schemaName, name}
+			}
+		}
+		for _, part := range parts {
+			if identifierLength(part) > limit {
+				return fmt.Errorf("table `%s` exceeds %d characters", tableName, limit)
+			}
+		}
+		for _, name := range sortedKeys(table.Columns) {
+			if identifierLength(name) > limit {
+				return fmt.Errorf("table `%s` column `%s` exceeds %d characters", tableName, name, limit)
+			}
+		}
+		for _, name := range sortedKeys(table.Indexes) {
+			if identifierLength(name) > limit {
+				return fmt.Errorf("table `%s` index `%s` exceeds %d characters; name it in the index tag or with Options.IndexNamer", tableName, name, limit)
+			}
+		}
+	}
+	return validateForeignKeyNames(state, limit)
+}
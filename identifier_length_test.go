@@ -0,0 +1,61 @@
+package gomigration
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+type longIndexReport struct {
+	ID     uint   `gorm:"primaryKey"`
+	Region string `gorm:"size:32;index:idx_quarterly_revenue_reports_by_region_and_fiscal_period_lookups"`
+}
+
+func (longIndexReport) TableName() string { return "quarterly_revenue_reports" }
+
+func TestMakeMigrationsRejectsLongIdentifiers(t *testing.T) {
+	dir := t.TempDir()
+	_, err := MakeMigrationsWithOptions([]any{&longIndexReport{}}, dir, "reports", "", Options{Version: "1"})
+	if err == nil || !strings.Contains(err.Error(), "table `quarterly_revenue_reports` index `idx_quarterly_revenue_reports_by_region_and_fiscal_period_lookups` exceeds 64 characters") {
+		t.Fatalf("expected the over-long index name to be rejected, got %v", err)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+		t.Fatalf("expected no files to be written, got %v, %v", entries, err)
+	}
+
+	if _, err := buildCurrentStateWithOptions([]any{&longIndexReport{}}, Options{MaxIdentifierLength: 128}); err != nil {
+		t.Fatalf("expected a raised limit to accept the name, got %v", err)
+	}
+	_, err = buildCurrentStateWithOptions([]any{&longIndexReport{}}, Options{MaxIdentifierLength: 16})
+	if err == nil || !strings.Contains(err.Error(), "table `quarterly_revenue_reports` exceeds 16 characters") {
+		t.Fatalf("expected a lowered limit to reject the table name, got %v", err)
+	}
+	if _, err := buildCurrentStateWithOptions([]any{&longIndexReport{}}, Options{Dialect: DialectSQLite}); err != nil {
+		t.Fatalf("expected SQLite to have no limit, got %v", err)
+	}
+	if _, err := MakeMigrationsWithOptions([]any{&longIndexReport{}}, dir, "reports", "", Options{MaxIdentifierLength: -1}); err == nil {
+		t.Fatalf("expected a negative MaxIdentifierLength to be rejected")
+	}
+}
+
+func TestValidateIdentifierLengthsCountsCharacters(t *testing.T) {
+	state := func(tableName string) schemaState {
+		return schemaState{Tables: map[string]tableState{tableName: {Columns: map[string]columnState{"id": {Definition: "bigint"}}}}}
+	}
+	// 40 two-byte characters are 80 bytes but within MySQL's 64 characters.
+	if err := validateIdentifierLengths(state(strings.Repeat("é", 40)), Options{}); err != nil {
+		t.Fatalf("expected a multibyte name within the limit to pass, got %v", err)
+	}
+	if err := validateIdentifierLengths(state(strings.Repeat("é", 65)), Options{}); err == nil {
+		t.Fatalf("expected a 65 character name to be rejected")
+	}
+
+	qualified := strings.Repeat("s", 40) + "." + strings.Repeat("t", 40)
+	if err := validateIdentifierLengths(state(qualified), Options{Dialect: DialectPostgres}); err != nil {
+		t.Fatalf("expected the schema and table to be limited separately, got %v", err)
+	}
+	err := validateIdentifierLengths(state("billing."+strings.Repeat("t", 64)), Options{Dialect: DialectPostgres})
+	if err == nil || !strings.Contains(err.Error(), "exceeds 63 characters") {
+		t.Fatalf("expected the over-long table part to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package gomigration
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// IndexOrderProvider is implemented by models that choose the order in which
+// their indexes are created, e.g. to build the most selective index of a
+// large table first. The listed indexes are created first, in that order,
+// and take precedence over create_order tag options.
+type IndexOrderProvider interface {
+	IndexCreateOrder() []string
+}
+
+// applyIndexCreateOrder records the creation order hints of a model: the
+// create_order option of its index tags (`gorm:"index:idx_x,create_order:1"`)
+// and IndexCreateOrder. Indexes with a lower order are created first and
+// indexes without one last.
+func applyIndexCreateOrder(table *tableState, stmt *gorm.Statement) error {
+	sc := stmt.Schema
+	namer := stmt.DB.Config.NamingStrategy
+	if namer == nil {
+		namer = schema.NamingStrategy{}
+	}
+	for _, field := range sc.Fields {
+		decls, err := parseFieldIndexTagDecls(sc.Table, field, namer)
+		if err != nil {
+			return err
+		}
+		for _, decl := range decls {
+			if decl.CreateOrder == "" {
+				continue
+			}
+			order, err := strconv.Atoi(decl.CreateOrder)
+			if err != nil || order < 1 {
+				return fmt.Errorf("table `%s` index `%s` has create_order %q, want a positive integer", sc.Table, decl.Name, decl.CreateOrder)
+			}
+			idx, ok := table.Indexes[decl.Name]
+			if !ok {
+				continue
+			}
+			if idx.CreateOrder != 0 && idx.CreateOrder != order {
+				return fmt.Errorf("table `%s` index `%s` has conflicting create_order values %d and %d", sc.Table, decl.Name, idx.CreateOrder, order)
+			}
+			idx.CreateOrder = order
+			table.Indexes[decl.Name] = idx
+		}
+	}
+
+	if sc.ModelType == nil {
+		return nil
+	}
+	provider, ok := reflect.New(sc.ModelType).Interface().(IndexOrderProvider)
+	if !ok {
+		return nil
+	}
+	listed := provider.IndexCreateOrder()
+	order := make(map[string]int, len(listed))
+	for i, name := range listed {
+		name = strings.TrimSpace(name)
+		if _, ok := table.Indexes[name]; !ok {
+			return fmt.Errorf("table `%s` lists unknown index `%s` in IndexCreateOrder", sc.Table, name)
+		}
+		order[name] = i + 1
+	}
+	for name, idx := range table.Indexes {
+		if o, ok := order[name]; ok {
+			idx.CreateOrder = o
+		} else if idx.CreateOrder != 0 {
+			idx.CreateOrder += len(listed)
+		}
+		table.Indexes[name] = idx
+	}
+	return nil
+}
+
+// orderedIndexNames returns index names by creation order, ties and indexes
+// without an order sorted by name.
+func orderedIndexNames(indexes map[string]indexState) []string {
+	names := sortedKeys(indexes)
+	sort.SliceStable(names, func(i, j int) bool {
+		a, b := indexes[names[i]].CreateOrder, indexes[names[j]].CreateOrder
+		if a == 0 || b == 0 {
+			return a != 0 && b == 0
+		}
+		return a < b
+	})
+	return names
+}
@@ -0,0 +1,84 @@
+package gomigration
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+type orderedIndexModel struct {
+	ID      uint   `gorm:"primaryKey"`
+	Account string `gorm:"size:32;index:idx_account"`
+	Email   string `gorm:"size:64;uniqueIndex:idx_email,create_order:1"`
+	Status  string `gorm:"size:16;index:idx_status,create_order:2"`
+}
+
+func (orderedIndexModel) TableName() string { return "ordered_indexes" }
+
+type methodOrderedIndexModel struct {
+	ID      uint   `gorm:"primaryKey"`
+	Account string `gorm:"size:32;index:idx_account"`
+	Email   string `gorm:"size:64;uniqueIndex:idx_email,create_order:1"`
+	Status  string `gorm:"size:16;index:idx_status"`
+}
+
+func (methodOrderedIndexModel) TableName() string { return "ordered_indexes" }
+
+func (methodOrderedIndexModel) IndexCreateOrder() []string {
+	return []string{"idx_status", "idx_account"}
+}
+
+var createIndexNamePattern = regexp.MustCompile("(?m)(?:KEY|INDEX) `(idx_[a-z]+)`")
+
+func emittedIndexOrder(sql string) []string {
+	names := make([]string, 0)
+	for _, m := range createIndexNamePattern.FindAllStringSubmatch(sql, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+func TestIndexCreateOrder(t *testing.T) {
+	tagged, err := buildCurrentState([]any{&orderedIndexModel{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState failed: %v", err)
+	}
+	table := tagged.Tables["ordered_indexes"]
+	if got := emittedIndexOrder(createTableSQL("ordered_indexes", table)); !reflect.DeepEqual(got, []string{"idx_email", "idx_status", "idx_account"}) {
+		t.Fatalf("unexpected index order for tags: %v", got)
+	}
+
+	method, err := buildCurrentState([]any{&methodOrderedIndexModel{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState failed: %v", err)
+	}
+	methodTable := method.Tables["ordered_indexes"]
+	if got := emittedIndexOrder(createTableSQL("ordered_indexes", methodTable)); !reflect.DeepEqual(got, []string{"idx_status", "idx_account", "idx_email"}) {
+		t.Fatalf("unexpected index order for IndexCreateOrder: %v", got)
+	}
+	if ops := diffTable("ordered_indexes", table, methodTable); len(ops) != 0 {
+		t.Fatalf("expected a new creation order alone to produce no changes, got %#v", ops)
+	}
+
+	bare := cloneTableState(table)
+	bare.Indexes = map[string]indexState{}
+	up, _ := splitMigrationOps(diffTable("ordered_indexes", bare, table))
+	if got := emittedIndexOrder(strings.Join(up, "\n")); !reflect.DeepEqual(got, []string{"idx_email", "idx_status", "idx_account"}) {
+		t.Fatalf("unexpected order of index ops: %v", got)
+	}
+}
+
+type badIndexOrderModel struct {
+	ID    uint   `gorm:"primaryKey"`
+	Email string `gorm:"size:64;index:idx_email,create_order:first"`
+}
+
+func (badIndexOrderModel) TableName() string { return "bad_index_orders" }
+
+func TestIndexCreateOrderRejectsInvalidHint(t *testing.T) {
+	_, err := buildCurrentState([]any{&badIndexOrderModel{}})
+	if err == nil || !strings.Contains(err.Error(), "create_order \"first\"") {
+		t.Fatalf("expected an invalid create_order to be rejected, got %v", err)
+	}
+}
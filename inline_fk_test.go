@@ -0,0 +1,69 @@
+package gomigration
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInlineForeignKeysDeclaresReferencesInCreateTable(t *testing.T) {
+	up, down, _, err := PreviewMigrationsWithOptions([]any{&orderAOrder{}, &orderZUser{}}, filepath.Join(t.TempDir(), "state.json"), Options{InlineForeignKeys: true})
+	if err != nil {
+		t.Fatalf("PreviewMigrationsWithOptions failed: %v", err)
+	}
+	upSQL, downSQL := strings.Join(up, "\n"), strings.Join(down, "\n")
+	assertContainsAll(t, upSQL, []string{
+		"CREATE TABLE `a_orders` (",
+		"  CONSTRAINT `fk_a_orders_user` FOREIGN KEY (`user_id`) REFERENCES `z_users` (`id`)",
+	})
+	if strings.Contains(upSQL, "ALTER TABLE") || strings.Contains(downSQL, "DROP FOREIGN KEY") {
+		t.Fatalf("expected the inlined foreign key to need no ALTER TABLE:\n%s\n%s", upSQL, downSQL)
+	}
+	if strings.Index(downSQL, "DROP TABLE `a_orders`") > strings.Index(downSQL, "DROP TABLE `z_users`") {
+		t.Fatalf("expected a_orders to be dropped before z_users:\n%s", downSQL)
+	}
+}
+
+func TestInlineForeignKeysFallsBackToAlterForCycles(t *testing.T) {
+	references := func(ref string) tableState {
+		return tableState{
+			Columns:     map[string]columnState{"id": {Definition: "bigint NOT NULL"}, ref + "_id": {Definition: "bigint"}},
+			ColumnOrder: []string{"id", ref + "_id"},
+			PrimaryKeys: []string{"id"},
+			ForeignKeys: map[string]foreignKeyState{"fk_" + ref: {Columns: []string{ref + "_id"}, RefTable: ref, RefColumns: []string{"id"}}},
+		}
+	}
+	current := schemaState{Tables: map[string]tableState{
+		"b_cycle":    references("c_cycle"),
+		"c_cycle":    references("b_cycle"),
+		"d_external": references("existing"),
+	}}
+	for _, dialect := range []Dialect{DialectMySQL, DialectPostgres} {
+		opts := Options{Dialect: dialect, InlineForeignKeys: true}
+		up, down := splitMigrationOps(diffSchemas(schemaState{Tables: map[string]tableState{}}, current, opts))
+		upSQL, downSQL := strings.Join(up, "\n"), strings.Join(down, "\n")
+		if !strings.Contains(upSQL, "FOREIGN KEY") || strings.Count(upSQL, "ALTER TABLE") != 1 {
+			t.Fatalf("%s: expected one ALTER TABLE for the cycle:\n%s", dialect, upSQL)
+		}
+		for _, want := range []string{"fk_existing", "fk_b_cycle"} {
+			if line := lineContaining(upSQL, want); strings.HasPrefix(line, "ALTER TABLE") {
+				t.Fatalf("%s: expected %s to be declared in CREATE TABLE:\n%s", dialect, want, upSQL)
+			}
+		}
+		if line := lineContaining(upSQL, "fk_c_cycle"); !strings.HasPrefix(line, "ALTER TABLE") {
+			t.Fatalf("%s: expected fk_c_cycle to be added with ALTER TABLE:\n%s", dialect, upSQL)
+		}
+		if !strings.HasPrefix(down[0], "ALTER TABLE") || !strings.Contains(down[0], "fk_c_cycle") {
+			t.Fatalf("%s: expected the down to drop fk_c_cycle before the tables:\n%s", dialect, downSQL)
+		}
+	}
+}
+
+func lineContaining(text, substr string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if strings.Contains(line, substr) {
+			return strings.TrimSpace(line)
+		}
+	}
+	return ""
+}
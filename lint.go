@@ -0,0 +1,34 @@
+package gomigration
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// AnalyzeRedundantIndexes reports pairs of indexes on the same table whose
+// class and fields are identical, so one of them only costs space.
+func AnalyzeRedundantIndexes(state schemaState) []string {
+	issues := make([]string, 0)
+	for _, tableName := range sortedKeys(state.Tables) {
+		indexes := state.Tables[tableName].Indexes
+		names := sortedKeys(indexes)
+		for i, a := range names {
+			left := normalizeIndex(indexes[a])
+			for _, b := range names[i+1:] {
+				right := normalizeIndex(indexes[b])
+				if left.Class == right.Class && reflect.DeepEqual(left.Fields, right.Fields) {
+					issues = append(issues, fmt.Sprintf("table `%s`: indexes `%s` and `%s` are identical", tableName, a, b))
+				}
+			}
+		}
+	}
+	return issues
+}
+
+func AnalyzeRedundantIndexesInStateFile(path string) ([]string, error) {
+	state, err := loadState(path)
+	if err != nil {
+		return nil, err
+	}
+	return AnalyzeRedundantIndexes(state), nil
+}
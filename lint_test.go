@@ -0,0 +1,42 @@
+package gomigration
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAnalyzeRedundantIndexes(t *testing.T) {
+	state := schemaState{Tables: map[string]tableState{
+		"orders": {
+			Columns: map[string]columnState{
+				"user_id": {Definition: "bigint"},
+				"status":  {Definition: "varchar(16)"},
+			},
+			Indexes: map[string]indexState{
+				"idx_orders_user":     {Fields: []indexFieldState{{Column: "user_id"}}},
+				"orders_user_id_idx":  {Fields: []indexFieldState{{Column: " user_id "}}},
+				"uniq_orders_user":    {Class: "UNIQUE", Fields: []indexFieldState{{Column: "user_id"}}},
+				"idx_orders_status":   {Fields: []indexFieldState{{Column: "status"}, {Column: "user_id"}}},
+				"idx_orders_status_2": {Fields: []indexFieldState{{Column: "user_id"}, {Column: "status"}}},
+			},
+		},
+	}}
+
+	want := []string{"table `orders`: indexes `idx_orders_user` and `orders_user_id_idx` are identical"}
+	if got := AnalyzeRedundantIndexes(state); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected redundant index report.\nwant=%v\ngot=%v", want, got)
+	}
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := saveState(path, state); err != nil {
+		t.Fatalf("saveState failed: %v", err)
+	}
+	got, err := AnalyzeRedundantIndexesInStateFile(path)
+	if err != nil {
+		t.Fatalf("AnalyzeRedundantIndexesInStateFile failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected redundant index report from file.\nwant=%v\ngot=%v", want, got)
+	}
+}
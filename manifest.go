@@ -0,0 +1,144 @@
+package gomigration
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const manifestFile = "migrations.lock"
+
+type manifestEntry struct {
+	File string
+	Sum  string
+}
+
+// updateManifest records every migration file of dir in migrations.lock.
+// Files already listed keep their recorded checksum, so an edit to a shipped
+// migration is still reported by VerifyManifest after new migrations are
+// generated. Lines use the sha256sum format, ordered by version.
+func updateManifest(dir string) error {
+	recorded, err := loadManifest(dir)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]string, len(recorded))
+	for _, entry := range recorded {
+		known[entry.File] = entry.Sum
+	}
+	files, err := manifestFiles(dir)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, path := range files {
+		name := filepath.Base(path)
+		sum, ok := known[name]
+		if !ok {
+			if sum, err = fileChecksum(path); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(&buf, "%s  %s\n", sum, name)
+	}
+	return writeFileAtomic(filepath.Join(dir, manifestFile), buf.Bytes())
+}
+
+// VerifyManifest checks the migration files of dir against migrations.lock
+// and fails on the first file that was modified, removed or never recorded.
+func VerifyManifest(dir string) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(absDir, manifestFile)); err != nil {
+		return fmt.Errorf("read %s: %w", manifestFile, err)
+	}
+	recorded, err := loadManifest(absDir)
+	if err != nil {
+		return err
+	}
+	listed := make(map[string]bool, len(recorded))
+	for _, entry := range recorded {
+		listed[entry.File] = true
+		sum, err := fileChecksum(filepath.Join(absDir, entry.File))
+		if os.IsNotExist(err) {
+			return fmt.Errorf("migration file %s is listed in %s but missing", entry.File, manifestFile)
+		}
+		if err != nil {
+			return err
+		}
+		if sum != entry.Sum {
+			return fmt.Errorf("migration file %s was modified after it was recorded in %s", entry.File, manifestFile)
+		}
+	}
+	files, err := manifestFiles(absDir)
+	if err != nil {
+		return err
+	}
+	for _, path := range files {
+		if name := filepath.Base(path); !listed[name] {
+			return fmt.Errorf("migration file %s is not recorded in %s", name, manifestFile)
+		}
+	}
+	return nil
+}
+
+// manifestFiles lists the up/down pairs Apply reads and the combined files
+// of Options.CombinedFile, ordered by version.
+func manifestFiles(dir string) ([]string, error) {
+	migrations, err := listMigrationFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	combined, err := combinedMigrationFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := append(migrationFilePaths(migrations), combined...)
+	sort.SliceStable(files, func(i, j int) bool {
+		vi, _, _ := strings.Cut(filepath.Base(files[i]), "_")
+		vj, _, _ := strings.Cut(filepath.Base(files[j]), "_")
+		return compareVersions(vi, vj) < 0
+	})
+	return files, nil
+}
+
+func loadManifest(dir string) ([]manifestEntry, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]manifestEntry, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		sum, file, ok := strings.Cut(text, "  ")
+		if !ok || len(sum) != sha256.Size*2 || strings.TrimSpace(file) == "" {
+			return nil, fmt.Errorf("%s line %d is malformed", manifestFile, line)
+		}
+		entries = append(entries, manifestEntry{File: strings.TrimSpace(file), Sum: sum})
+	}
+	return entries, scanner.Err()
+}
+
+func fileChecksum(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,100 @@
+package gomigration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestManifestTracksGeneratedMigrations(t *testing.T) {
+	dir := t.TempDir()
+	if err := VerifyManifest(dir); err == nil {
+		t.Fatalf("expected error without a manifest")
+	}
+
+	first, err := MakeMigrationsWithOptions([]any{&e2eUserNoJoin{}, &e2eGroupNoJoin{}}, dir, "init", "", Options{Version: "20240101000000"})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	if _, err := MakeMigrationsWithOptions([]any{&e2eUserWithJoin{}, &e2eGroupWithJoin{}}, dir, "join", "", Options{Version: "20240102000000"}); err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	if err := VerifyManifest(dir); err != nil {
+		t.Fatalf("VerifyManifest failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		t.Fatalf("read manifest failed: %v", err)
+	}
+	var files []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		_, file, _ := strings.Cut(line, "  ")
+		files = append(files, file)
+	}
+	want := []string{
+		"20240101000000_init.up.sql",
+		"20240101000000_init.down.sql",
+		"20240102000000_join.up.sql",
+		"20240102000000_join.down.sql",
+	}
+	if strings.Join(files, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected manifest order: %v", files)
+	}
+
+	if err := os.WriteFile(first.UpPath, []byte("DROP TABLE `e2e_users`;\n"), 0o644); err != nil {
+		t.Fatalf("rewrite migration failed: %v", err)
+	}
+	err = VerifyManifest(dir)
+	if err == nil || !strings.Contains(err.Error(), "20240101000000_init.up.sql was modified") {
+		t.Fatalf("expected modified file error, got %v", err)
+	}
+
+	// Generating another migration must not re-record the edited file.
+	if _, err := MakeRebuild("e2e_users", dir, "rebuild"); err != nil {
+		t.Fatalf("MakeRebuild failed: %v", err)
+	}
+	if err := VerifyManifest(dir); err == nil || !strings.Contains(err.Error(), "20240101000000_init.up.sql") {
+		t.Fatalf("expected the edit to stay detectable, got %v", err)
+	}
+}
+
+func TestManifestTracksCombinedFiles(t *testing.T) {
+	dir := t.TempDir()
+	result, err := MakeMigrationsWithOptions([]any{&e2eUserNoJoin{}, &e2eGroupNoJoin{}}, dir, "init", "", Options{Version: "20240101000000", CombinedFile: true})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	if err := VerifyManifest(dir); err != nil {
+		t.Fatalf("VerifyManifest failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		t.Fatalf("read manifest failed: %v", err)
+	}
+	if !strings.HasSuffix(strings.TrimSpace(string(data)), "  20240101000000_init.sql") {
+		t.Fatalf("expected the combined file in the manifest, got:\n%s", data)
+	}
+
+	if err := os.WriteFile(result.Path, []byte("-- +goose Up\nDROP TABLE `e2e_users`;\n"), 0o644); err != nil {
+		t.Fatalf("rewrite migration failed: %v", err)
+	}
+	if err := VerifyManifest(dir); err == nil || !strings.Contains(err.Error(), "20240101000000_init.sql was modified") {
+		t.Fatalf("expected modified file error, got %v", err)
+	}
+}
+
+func TestVerifyManifestReportsUnrecordedFiles(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := MakeMigrationsWithOptions(migrationModels(), dir, "init", "", Options{Version: "20240101000000"}); err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "20240105000000_manual.up.sql"), []byte("SELECT 1;\n"), 0o644); err != nil {
+		t.Fatalf("write manual migration failed: %v", err)
+	}
+	err := VerifyManifest(dir)
+	if err == nil || !strings.Contains(err.Error(), "20240105000000_manual.up.sql is not recorded") {
+		t.Fatalf("expected unrecorded file error, got %v", err)
+	}
+}
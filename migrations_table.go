@@ -0,0 +1,132 @@
+package gomigration
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// appliedMigration is a row of the schema_migrations table.
+type appliedMigration struct {
+	Version  string
+	Name     string
+	Checksum string
+}
+
+// EnsureMigrationsTable creates the schema_migrations table Apply records
+// applied versions in, with their name and the checksum of their up files.
+// A table created by an older release, without the name or checksum column,
+// gets the missing ones added.
+func EnsureMigrationsTable(db *gorm.DB) error {
+	if db == nil {
+		return fmt.Errorf("db is required")
+	}
+	table, version, name, checksum := migrationsTableColumns(db)
+	if err := db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s varchar(64) NOT NULL, %s varchar(255) NOT NULL DEFAULT '', %s varchar(64) NOT NULL DEFAULT '', PRIMARY KEY (%s))", table, version, name, checksum, version)).Error; err != nil {
+		return err
+	}
+	// The columns are qualified: SQLite reads an unknown quoted column as a
+	// string literal. Each is checked on its own, since an upgrade that
+	// failed halfway leaves a table with only one of them.
+	for _, column := range []struct{ name, definition string }{
+		{name, "varchar(255) NOT NULL DEFAULT ''"},
+		{checksum, "varchar(64) NOT NULL DEFAULT ''"},
+	} {
+		if db.Exec(fmt.Sprintf("SELECT %s.%s FROM %s WHERE 1 = 0", table, column.name, table)).Error == nil {
+			continue
+		}
+		if err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column.name, column.definition)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecordApplied records version as applied, e.g. by an external runner, so
+// Apply skips it. checksum is the hex SHA-256 of the up file, or of the up
+// files of the version concatenated in the order Apply runs them; Apply
+// refuses to run once the files no longer match it. Down files are not
+// covered, so an edit to one is not detected. An empty checksum is not
+// checked. Call EnsureMigrationsTable first.
+func RecordApplied(db *gorm.DB, version, name, checksum string) error {
+	if db == nil {
+		return fmt.Errorf("db is required")
+	}
+	table, versionColumn, nameColumn, checksumColumn := migrationsTableColumns(db)
+	return db.Exec(fmt.Sprintf("INSERT INTO %s (%s, %s, %s) VALUES (?, ?, ?)", table, versionColumn, nameColumn, checksumColumn), version, name, checksum).Error
+}
+
+// AppliedVersions returns the versions recorded in schema_migrations, oldest
+// first. Call EnsureMigrationsTable first.
+func AppliedVersions(db *gorm.DB) ([]string, error) {
+	if db == nil {
+		return nil, fmt.Errorf("db is required")
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]string, len(applied))
+	for i, m := range applied {
+		versions[i] = m.Version
+	}
+	return versions, nil
+}
+
+func appliedMigrations(db *gorm.DB) ([]appliedMigration, error) {
+	table, version, name, checksum := migrationsTableColumns(db)
+	var applied []appliedMigration
+	if err := db.Raw(fmt.Sprintf("SELECT %s, %s, %s FROM %s", version, name, checksum, table)).Scan(&applied).Error; err != nil {
+		return nil, err
+	}
+	sort.Slice(applied, func(i, j int) bool { return compareVersions(applied[i].Version, applied[j].Version) < 0 })
+	return applied, nil
+}
+
+func deleteVersion(db *gorm.DB, version string) error {
+	table, column, _, _ := migrationsTableColumns(db)
+	return db.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s = ?", table, column), version).Error
+}
+
+func migrationsTableColumns(db *gorm.DB) (table, version, name, checksum string) {
+	dialect := dialectOf(db)
+	return quoteIdentifier(dialect, migrationsTable), quoteIdentifier(dialect, "version"),
+		quoteIdentifier(dialect, "name"), quoteIdentifier(dialect, "checksum")
+}
+
+// versionChecksum is the checksum RecordApplied documents for the up files
+// of one version.
+func versionChecksum(group []migrationFile) (string, error) {
+	h := sha256.New()
+	for _, file := range group {
+		data, err := os.ReadFile(file.UpPath)
+		if err != nil {
+			return "", err
+		}
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// versionName is the name a version is recorded with: the name of its file,
+// or the part the names of its per-table files share, e.g. "init" for
+// init_users and init_orders.
+func versionName(group []migrationFile) string {
+	name := group[0].Name
+	for _, file := range group[1:] {
+		for !strings.HasPrefix(file.Name, name) {
+			name = name[:len(name)-1]
+		}
+	}
+	if len(group) > 1 {
+		if i := strings.LastIndex(name, "_"); i >= 0 {
+			name = name[:i]
+		}
+	}
+	return name
+}
@@ -0,0 +1,123 @@
+package gomigration
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func openMigrationsTableDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite failed: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("db.DB failed: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	return db
+}
+
+func TestEnsureMigrationsTableAddsOnlyMissingColumns(t *testing.T) {
+	db := openMigrationsTableDB(t)
+	// An upgrade that stopped after adding the name column.
+	if err := db.Exec(`CREATE TABLE "schema_migrations" ("version" varchar(64) NOT NULL, "name" varchar(255) NOT NULL DEFAULT '', PRIMARY KEY ("version"))`).Error; err != nil {
+		t.Fatalf("create old table failed: %v", err)
+	}
+	if err := EnsureMigrationsTable(db); err != nil {
+		t.Fatalf("EnsureMigrationsTable failed: %v", err)
+	}
+	if err := RecordApplied(db, "1", "init", "abc"); err != nil {
+		t.Fatalf("RecordApplied failed: %v", err)
+	}
+}
+
+func TestMigrationsTableRecordsChecksums(t *testing.T) {
+	dir := t.TempDir()
+	writeMigrationPair(t, dir, "20240101000000_init",
+		[]string{`CREATE TABLE "a" ("id" integer);`},
+		[]string{`DROP TABLE IF EXISTS "a";`})
+	writeMigrationPair(t, dir, "9_external",
+		[]string{`CREATE TABLE "e" ("id" integer);`},
+		[]string{`DROP TABLE IF EXISTS "e";`})
+
+	db := openMigrationsTableDB(t)
+	// A table from an older release has only the version column.
+	if err := db.Exec(`CREATE TABLE "schema_migrations" ("version" varchar(64) NOT NULL, PRIMARY KEY ("version"))`).Error; err != nil {
+		t.Fatalf("create old table failed: %v", err)
+	}
+	if err := db.Exec(`INSERT INTO "schema_migrations" ("version") VALUES ('1')`).Error; err != nil {
+		t.Fatalf("insert old version failed: %v", err)
+	}
+	if err := EnsureMigrationsTable(db); err != nil {
+		t.Fatalf("EnsureMigrationsTable failed: %v", err)
+	}
+	if err := EnsureMigrationsTable(db); err != nil {
+		t.Fatalf("EnsureMigrationsTable is not idempotent: %v", err)
+	}
+	if err := RecordApplied(db, "9", "external", ""); err != nil {
+		t.Fatalf("RecordApplied failed: %v", err)
+	}
+	if err := Apply(db, dir); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	versions, err := AppliedVersions(db)
+	if err != nil || !reflect.DeepEqual(versions, []string{"1", "9", "20240101000000"}) {
+		t.Fatalf("expected the versions in numeric order, got %v, %v", versions, err)
+	}
+
+	var recorded appliedMigration
+	if err := db.Raw(`SELECT "version", "name", "checksum" FROM "schema_migrations" WHERE "version" = ?`, "20240101000000").Scan(&recorded).Error; err != nil {
+		t.Fatalf("query schema_migrations failed: %v", err)
+	}
+	upPath := filepath.Join(dir, "20240101000000_init.up.sql")
+	checksum, err := fileChecksum(upPath)
+	if err != nil {
+		t.Fatalf("fileChecksum failed: %v", err)
+	}
+	if recorded.Name != "init" || recorded.Checksum != checksum {
+		t.Fatalf("expected name init and checksum %s, got %+v", checksum, recorded)
+	}
+
+	// Editing an applied migration is refused, even with nothing pending.
+	if err := os.WriteFile(upPath, []byte(`CREATE TABLE "a" ("id" bigint);`+"\n"), 0o644); err != nil {
+		t.Fatalf("rewrite up file failed: %v", err)
+	}
+	writeMigrationPair(t, dir, "20240102000000_add_b",
+		[]string{`CREATE TABLE "b" ("id" integer);`},
+		[]string{`DROP TABLE IF EXISTS "b";`})
+	err = Apply(db, dir)
+	if err == nil || !strings.Contains(err.Error(), "migration 20240101000000 was changed after it was applied") {
+		t.Fatalf("expected the edited migration to be refused, got %v", err)
+	}
+	if versions, _ := AppliedVersions(db); len(versions) != 3 {
+		t.Fatalf("expected nothing to be applied after the drift, got %v", versions)
+	}
+}
+
+func TestVersionName(t *testing.T) {
+	cases := []struct {
+		names []string
+		want  string
+	}{
+		{[]string{"add_users"}, "add_users"},
+		{[]string{"init_orders", "init_users", "init_foreign_keys"}, "init"},
+		{[]string{"a", "b"}, ""},
+	}
+	for _, c := range cases {
+		group := make([]migrationFile, len(c.names))
+		for i, name := range c.names {
+			group[i] = migrationFile{Version: "1", Name: name}
+		}
+		if got := versionName(group); got != c.want {
+			t.Fatalf("versionName(%v) = %q, want %q", c.names, got, c.want)
+		}
+	}
+}
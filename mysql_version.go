@@ -0,0 +1,91 @@
+package gomigration
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseMySQLVersion reads the major and minor number of a server version
+// such as "5.7", "8.0.36" or "8.0.36-log".
+func parseMySQLVersion(version string) (int, int, error) {
+	version = strings.TrimSpace(version)
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf("MySQL version %q must look like MAJOR.MINOR", version)
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("MySQL version %q must look like MAJOR.MINOR", version)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("MySQL version %q must look like MAJOR.MINOR", version)
+	}
+	return major, minor, nil
+}
+
+func validateMySQLVersion(version string) error {
+	if strings.TrimSpace(version) == "" {
+		return nil
+	}
+	_, _, err := parseMySQLVersion(version)
+	return err
+}
+
+// mysqlVersionAtLeast reports whether opts targets at least major.minor. An
+// unset or invalid version targets no particular server and is never at
+// least anything, so only portable statements are emitted.
+func (o Options) mysqlVersionAtLeast(major, minor int) bool {
+	if strings.TrimSpace(o.MySQLVersion) == "" {
+		return false
+	}
+	gotMajor, gotMinor, err := parseMySQLVersion(o.MySQLVersion)
+	if err != nil {
+		return false
+	}
+	return gotMajor > major || (gotMajor == major && gotMinor >= minor)
+}
+
+// ignoresDescendingIndexes reports whether opts targets a MySQL server before
+// 8.0, which accepts DESC in an index definition but stores the key part
+// ascending.
+func (o Options) ignoresDescendingIndexes() bool {
+	return o.Dialect.isMySQL() && strings.TrimSpace(o.MySQLVersion) != "" && !o.mysqlVersionAtLeast(8, 0)
+}
+
+// stripDescendingIndexes records descending key parts as ascending, the way
+// a server before 8.0 stores them. Otherwise the state would say DESC while
+// the database has ASC, and every migration would recreate the index.
+func stripDescendingIndexes(state schemaState, version string, logger Logger) schemaState {
+	out := schemaState{Version: state.Version, Tables: make(map[string]tableState, len(state.Tables))}
+	for _, tableName := range sortedKeys(state.Tables) {
+		table := state.Tables[tableName]
+		if table.Indexes != nil {
+			indexes := make(map[string]indexState, len(table.Indexes))
+			for _, name := range sortedKeys(table.Indexes) {
+				idx := table.Indexes[name]
+				fields := make([]indexFieldState, len(idx.Fields))
+				for i, field := range idx.Fields {
+					if strings.EqualFold(strings.TrimSpace(field.Sort), "DESC") {
+						logf(logger, "table %s index %s: MySQL %s ignores DESC on %s; recording it ascending", tableName, name, version, indexFieldLabel(field))
+						field.Sort = ""
+					}
+					fields[i] = field
+				}
+				idx.Fields = fields
+				indexes[name] = idx
+			}
+			table.Indexes = indexes
+		}
+		out.Tables[tableName] = table
+	}
+	return out
+}
+
+func indexFieldLabel(field indexFieldState) string {
+	if strings.TrimSpace(field.Expression) != "" {
+		return "(" + strings.TrimSpace(field.Expression) + ")"
+	}
+	return field.Column
+}
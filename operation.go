@@ -0,0 +1,138 @@
+package gomigration
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+)
+
+// OperationKind categorizes an Operation.
+type OperationKind string
+
+const (
+	OperationCreateTable  OperationKind = "create_table"
+	OperationDropTable    OperationKind = "drop_table"
+	OperationRenameTable  OperationKind = "rename_table"
+	OperationAddColumn    OperationKind = "add_column"
+	OperationModifyColumn OperationKind = "modify_column"
+	// OperationChangeAutoIncrement adds or removes AUTO_INCREMENT and
+	// changes nothing else about the column.
+	OperationChangeAutoIncrement OperationKind = "change_auto_increment"
+	// OperationColumnComment changes only the comment of a column.
+	OperationColumnComment OperationKind = "column_comment"
+	// OperationChangeDefault changes only the default of a column.
+	OperationChangeDefault    OperationKind = "change_default"
+	OperationDropColumn       OperationKind = "drop_column"
+	OperationRenameColumn     OperationKind = "rename_column"
+	OperationChangePrimaryKey OperationKind = "change_primary_key"
+	OperationReorderColumns   OperationKind = "reorder_columns"
+	OperationCreateIndex      OperationKind = "create_index"
+	OperationModifyIndex      OperationKind = "modify_index"
+	OperationDropIndex        OperationKind = "drop_index"
+	OperationRenameIndex      OperationKind = "rename_index"
+	OperationAddForeignKey    OperationKind = "add_foreign_key"
+	OperationDropForeignKey   OperationKind = "drop_foreign_key"
+	OperationRenameForeignKey OperationKind = "rename_foreign_key"
+	OperationTableCharset     OperationKind = "table_charset"
+	OperationTableCollation   OperationKind = "table_collation"
+	OperationTableEngine      OperationKind = "table_engine"
+	OperationTableComment     OperationKind = "table_comment"
+	OperationTableTablespace  OperationKind = "table_tablespace"
+	OperationIndexTablespace  OperationKind = "index_tablespace"
+	// OperationRebuildTable rebuilds a table in place, see
+	// Options.RebuildTables.
+	OperationRebuildTable OperationKind = "rebuild_table"
+	// OperationRecreateTable copies a SQLite table into a new one to make
+	// a change ALTER TABLE cannot.
+	OperationRecreateTable OperationKind = "recreate_table"
+)
+
+var operationKinds = map[opKind]OperationKind{
+	opCreateTable:         OperationCreateTable,
+	opDropTable:           OperationDropTable,
+	opRenameTable:         OperationRenameTable,
+	opAddColumn:           OperationAddColumn,
+	opModifyColumn:        OperationModifyColumn,
+	opChangeAutoIncrement: OperationChangeAutoIncrement,
+	opColumnComment:       OperationColumnComment,
+	opChangeDefault:       OperationChangeDefault,
+	opDropColumn:          OperationDropColumn,
+	opRenameColumn:        OperationRenameColumn,
+	opChangePrimaryKey:    OperationChangePrimaryKey,
+	opReorderColumns:      OperationReorderColumns,
+	opCreateIndex:         OperationCreateIndex,
+	opModifyIndex:         OperationModifyIndex,
+	opDropIndex:           OperationDropIndex,
+	opRenameIndex:         OperationRenameIndex,
+	opAddForeignKey:       OperationAddForeignKey,
+	opDropForeignKey:      OperationDropForeignKey,
+	opRenameForeignKey:    OperationRenameForeignKey,
+	opTableCharset:        OperationTableCharset,
+	opTableCollation:      OperationTableCollation,
+	opTableEngine:         OperationTableEngine,
+	opTableComment:        OperationTableComment,
+	opTableTablespace:     OperationTableTablespace,
+	opIndexTablespace:     OperationIndexTablespace,
+	opRebuildTable:        OperationRebuildTable,
+	opRecreateTable:       OperationRecreateTable,
+}
+
+// Operation is one schema change of a migration. Up runs in slice order and
+// Down in reverse order, as in the files MakeMigrations writes; either may be
+// empty when that direction has nothing to run.
+type Operation struct {
+	Kind  OperationKind
+	Table string
+	// Name is the column, index or constraint the operation touches, or the
+	// table itself for table-level operations.
+	Name string
+	Up   string
+	Down string
+	// TypeChange classifies the type change of an OperationModifyColumn.
+	TypeChange TypeChange
+	Warnings   []SafetyWarning
+}
+
+// PlanMigrations returns the operations MakeMigrations would write for models
+// against stateFile, without writing any file or saving the state. An empty
+// stateFile is the default state file of MakeMigrations.
+func PlanMigrations(models []any, stateFile string) ([]Operation, error) {
+	return PlanMigrationsWithOptions(models, stateFile, Options{})
+}
+
+func PlanMigrationsWithOptions(models []any, stateFile string, opts Options) ([]Operation, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(stateFile) == "" {
+		stateFile = filepath.Join("database", "migrations", ".schema_state.json")
+	}
+	absStateFile, err := filepath.Abs(stateFile)
+	if err != nil {
+		return nil, err
+	}
+	ops, _, err := planMigration(context.Background(), models, absStateFile, opts)
+	if err != nil {
+		return nil, err
+	}
+	return operationsOf(ops), nil
+}
+
+func operationsOf(ops []migrationOp) []Operation {
+	out := make([]Operation, 0, len(ops))
+	for _, op := range ops {
+		if strings.TrimSpace(op.up) == "" && strings.TrimSpace(op.down) == "" {
+			continue
+		}
+		out = append(out, Operation{
+			Kind:       operationKinds[op.kind],
+			Table:      op.table,
+			Name:       op.name,
+			Up:         op.up,
+			Down:       op.down,
+			TypeChange: op.typeChange,
+			Warnings:   append([]SafetyWarning(nil), op.warnings...),
+		})
+	}
+	return out
+}
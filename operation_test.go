@@ -0,0 +1,95 @@
+package gomigration
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlanMigrationsMatchesPreview(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), ".schema_state.json")
+	ops, err := PlanMigrations(migrationModels(), stateFile)
+	if err != nil {
+		t.Fatalf("PlanMigrations failed: %v", err)
+	}
+	up, down, _, err := PreviewMigrations(migrationModels(), stateFile)
+	if err != nil {
+		t.Fatalf("PreviewMigrations failed: %v", err)
+	}
+
+	gotUp := make([]string, 0, len(ops))
+	gotDown := make([]string, 0, len(ops))
+	kinds := map[OperationKind]int{}
+	for i, op := range ops {
+		if op.Up != "" {
+			gotUp = append(gotUp, op.Up)
+		}
+		if last := ops[len(ops)-1-i]; last.Down != "" {
+			gotDown = append(gotDown, last.Down)
+		}
+		if op.Kind == "" || op.Table == "" {
+			t.Fatalf("operation %d has no kind or table: %#v", i, op)
+		}
+		kinds[op.Kind]++
+	}
+	// The preview blocks start with the operation markers of the up file.
+	unmarked := func(blocks []string) string {
+		out := make([]string, len(blocks))
+		for i, block := range blocks {
+			_, out[i], _ = strings.Cut(block, "\n")
+		}
+		return strings.Join(out, "\n\n")
+	}
+	up, down = []string{unmarked(up)}, []string{unmarked(down)}
+	if strings.Join(gotUp, "\n\n") != strings.Join(up, "\n\n") || strings.Join(gotDown, "\n\n") != strings.Join(down, "\n\n") {
+		t.Fatalf("operations differ from the preview:\n%s\n---\n%s", strings.Join(gotUp, "\n\n"), strings.Join(up, "\n\n"))
+	}
+	if kinds[OperationCreateTable] == 0 || kinds[OperationAddForeignKey] == 0 {
+		t.Fatalf("expected create table and add foreign key operations, got %v", kinds)
+	}
+}
+
+func TestOperationsReportTypeChanges(t *testing.T) {
+	prev := tableState{Columns: map[string]columnState{"id": {Definition: "int"}}}
+	cur := tableState{Columns: map[string]columnState{"id": {Definition: "bigint"}}}
+	ops := operationsOf(diffTable("people", prev, cur))
+	if len(ops) != 1 || ops[0].Kind != OperationModifyColumn || ops[0].TypeChange != TypeWiden {
+		t.Fatalf("expected a widening modify operation, got %#v", ops)
+	}
+}
+
+func TestOperationKindsCoverEveryOp(t *testing.T) {
+	for kind := opCreateTable; kind <= opRecreateTable; kind++ {
+		if operationKinds[kind] == "" {
+			t.Fatalf("op kind %d has no OperationKind", kind)
+		}
+	}
+}
+
+func TestMakeMigrationsOnOperation(t *testing.T) {
+	dir := t.TempDir()
+	var seen []Operation
+	result, err := MakeMigrationsWithOptions(migrationModels(), dir, "init", "", Options{
+		OnOperation: func(op Operation) { seen = append(seen, op) },
+	})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	planned, err := PlanMigrations(migrationModels(), filepath.Join(t.TempDir(), ".schema_state.json"))
+	if err != nil {
+		t.Fatalf("PlanMigrations failed: %v", err)
+	}
+	if len(seen) == 0 || len(seen) != len(planned) {
+		t.Fatalf("expected one callback per operation, got %d for %d operations", len(seen), len(planned))
+	}
+	up := make([]string, 0, len(seen))
+	for i, op := range seen {
+		if op.Kind != planned[i].Kind || op.Table != planned[i].Table {
+			t.Fatalf("callback %d got %s on %s, want %s on %s", i, op.Kind, op.Table, planned[i].Kind, planned[i].Table)
+		}
+		up = append(up, op.Up)
+	}
+	if got := readMigration(t, result.UpPath); got != strings.Join(up, "\n\n") {
+		t.Fatalf("callbacks differ from the written file:\n%s\n---\n%s", strings.Join(up, "\n\n"), got)
+	}
+}
@@ -0,0 +1,310 @@
+package gomigration
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PostgresEmitter renders DDL for PostgreSQL. It is the default Emitter when
+// Options.Dialect is DialectPostgres.
+type PostgresEmitter struct {
+	// QuoteMode selects which identifiers are quoted; the default quotes
+	// all of them.
+	QuoteMode QuoteMode
+	// IfExists guards CREATE TABLE, ADD COLUMN and CREATE INDEX with IF NOT
+	// EXISTS and DROP COLUMN and DROP CONSTRAINT with IF EXISTS. Adding a
+	// foreign key has no such guard.
+	IfExists bool
+}
+
+func (e PostgresEmitter) quote(name string) string {
+	return e.QuoteMode.quoteFor(DialectPostgres, name)
+}
+
+// table renders a table name, which may be qualified with its schema as in
+// "billing.accounts".
+func (e PostgresEmitter) table(name string) string {
+	return quotePostgresTable(e.QuoteMode, name)
+}
+
+// inSchemaOf qualifies name with the schema of table, for objects such as
+// indexes that live in the schema of their table.
+func (e PostgresEmitter) inSchemaOf(table, name string) string {
+	if schemaName, _, ok := splitPostgresTable(table); ok {
+		return e.quote(schemaName) + "." + e.quote(name)
+	}
+	return e.quote(name)
+}
+
+func quotePostgresTable(q QuoteMode, name string) string {
+	if schemaName, table, ok := splitPostgresTable(name); ok {
+		return q.quoteFor(DialectPostgres, schemaName) + "." + q.quoteFor(DialectPostgres, table)
+	}
+	return q.quoteFor(DialectPostgres, name)
+}
+
+// splitPostgresTable splits a schema-qualified table name into its schema
+// and table.
+func splitPostgresTable(name string) (string, string, bool) {
+	schemaName, table, ok := strings.Cut(strings.TrimSpace(name), ".")
+	if !ok || schemaName == "" || table == "" {
+		return "", name, false
+	}
+	return schemaName, table, true
+}
+
+func (e PostgresEmitter) columns(columns []string) string {
+	parts := make([]string, 0, len(columns))
+	for _, col := range columns {
+		parts = append(parts, e.quote(col))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// CreateTable creates the indexes with separate statements after the table,
+// since Postgres has no inline index definitions. Charset and collation are
+// not rendered.
+func (e PostgresEmitter) CreateTable(table TableDefinition) string {
+	defs := make([]string, 0, len(table.Columns)+1)
+	for _, col := range table.Columns {
+		defs = append(defs, fmt.Sprintf("  %s %s", e.quote(col.Name), col.Definition))
+	}
+	if len(table.PrimaryKeys) > 0 {
+		defs = append(defs, fmt.Sprintf("  PRIMARY KEY (%s)", e.columns(table.PrimaryKeys)))
+	}
+	for _, fk := range table.ForeignKeys {
+		defs = append(defs, "  "+e.foreignKeyConstraint(fk))
+	}
+	tablespace := ""
+	if table.Tablespace != "" {
+		tablespace = " TABLESPACE " + e.quote(table.Tablespace)
+	}
+	stmts := []string{fmt.Sprintf("CREATE TABLE %s%s (\n%s\n)%s;", ifNotExistsClause(e.IfExists), e.table(table.Name), strings.Join(defs, ",\n"), tablespace)}
+	if table.Comment != "" {
+		stmts = append(stmts, e.commentOnTable(table.Name, table.Comment))
+	}
+	for _, col := range table.Columns {
+		if col.Comment != "" {
+			stmts = append(stmts, e.commentOnColumn(table.Name, col.Name, col.Comment))
+		}
+	}
+	for _, idx := range table.Indexes {
+		stmts = append(stmts, e.CreateIndex(table.Name, idx))
+	}
+	return strings.Join(stmts, "\n")
+}
+
+func (e PostgresEmitter) DropTable(table string) string {
+	return fmt.Sprintf("DROP TABLE IF EXISTS %s;", e.table(table))
+}
+
+func (e PostgresEmitter) RenameTable(from, to string) string {
+	_, to, _ = splitPostgresTable(to)
+	return fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", e.table(from), e.quote(to))
+}
+
+func (e PostgresEmitter) AddColumn(table string, column ColumnDefinition) string {
+	sql := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s%s %s;", e.table(table), ifNotExistsClause(e.IfExists), e.quote(column.Name), column.Definition)
+	if column.Comment != "" {
+		sql += "\n" + e.commentOnColumn(table, column.Name, column.Comment)
+	}
+	return sql
+}
+
+// ModifyColumn sets the type, nullability and default of the column in one
+// statement, since Postgres changes each with its own ALTER COLUMN action.
+func (e PostgresEmitter) ModifyColumn(table string, column ColumnDefinition) string {
+	col := e.quote(column.Name)
+	typ, notNull, def := splitPostgresDefinition(column.Definition)
+	actions := []string{fmt.Sprintf("ALTER COLUMN %s TYPE %s USING %s::%s", col, typ, col, typ)}
+	if notNull {
+		actions = append(actions, fmt.Sprintf("ALTER COLUMN %s SET NOT NULL", col))
+	} else {
+		actions = append(actions, fmt.Sprintf("ALTER COLUMN %s DROP NOT NULL", col))
+	}
+	switch {
+	case def != "":
+		actions = append(actions, fmt.Sprintf("ALTER COLUMN %s SET DEFAULT %s", col, def))
+	case !isSerialType(columnBaseType(column.Definition)):
+		actions = append(actions, fmt.Sprintf("ALTER COLUMN %s DROP DEFAULT", col))
+	}
+	return fmt.Sprintf("ALTER TABLE %s %s;", e.table(table), strings.Join(actions, ", "))
+}
+
+func (e PostgresEmitter) DropColumn(table, column string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s%s;", e.table(table), ifExistsClause(e.IfExists), e.quote(column))
+}
+
+func (e PostgresEmitter) RenameColumn(table, from string, to ColumnDefinition) string {
+	rename := fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s;", e.table(table), e.quote(from), e.quote(to.Name))
+	return rename + "\n" + e.ModifyColumn(table, to)
+}
+
+func (e PostgresEmitter) CreateIndex(table string, index IndexDefinition) string {
+	sql := createPostgresIndexSQL(table, index.Name, index.state(), e.QuoteMode, e.IfExists)
+	if index.Comment != "" {
+		sql += fmt.Sprintf("\nCOMMENT ON INDEX %s IS %s;", e.inSchemaOf(table, index.Name), quoteSQLString(index.Comment))
+	}
+	return sql
+}
+
+// DropIndex ignores table: Postgres index names are unique per schema.
+func (e PostgresEmitter) DropIndex(table, index string) string {
+	return fmt.Sprintf("DROP INDEX IF EXISTS %s;", e.inSchemaOf(table, index))
+}
+
+func (e PostgresEmitter) RenameIndex(table, from, to string) string {
+	return fmt.Sprintf("ALTER INDEX %s RENAME TO %s;", e.inSchemaOf(table, from), e.quote(to))
+}
+
+func (e PostgresEmitter) AddForeignKey(table string, fk ForeignKeyDefinition) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD %s;", e.table(table), e.foreignKeyConstraint(fk))
+}
+
+func (e PostgresEmitter) foreignKeyConstraint(fk ForeignKeyDefinition) string {
+	state := normalizeForeignKey(fk.state())
+	parts := []string{
+		"CONSTRAINT " + e.quote(fk.Name),
+		fmt.Sprintf("FOREIGN KEY (%s)", e.columns(state.Columns)),
+		fmt.Sprintf("REFERENCES %s (%s)", e.table(state.RefTable), e.columns(state.RefColumns)),
+	}
+	if state.OnDelete != "" {
+		parts = append(parts, "ON DELETE "+state.OnDelete)
+	}
+	if state.OnUpdate != "" {
+		parts = append(parts, "ON UPDATE "+state.OnUpdate)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (e PostgresEmitter) DropForeignKey(table, constraint string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s%s;", e.table(table), ifExistsClause(e.IfExists), e.quote(constraint))
+}
+
+// ChangePrimaryKey drops the primary key by the name Postgres gives it when
+// the table is created, <table>_pkey.
+func (e PostgresEmitter) ChangePrimaryKey(tableName string, from, to []string) string {
+	actions := make([]string, 0, 2)
+	if len(from) > 0 {
+		_, table, _ := splitPostgresTable(tableName)
+		actions = append(actions, "DROP CONSTRAINT "+e.quote(table+"_pkey"))
+	}
+	if len(to) > 0 {
+		actions = append(actions, fmt.Sprintf("ADD PRIMARY KEY (%s)", e.columns(to)))
+	}
+	if len(actions) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("ALTER TABLE %s %s;", e.table(tableName), strings.Join(actions, ", "))
+}
+
+func (e PostgresEmitter) SetColumnDefault(table, column, value string) string {
+	if value == "" {
+		return fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP DEFAULT;", e.table(table), e.quote(column))
+	}
+	return fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET DEFAULT %s;", e.table(table), e.quote(column), value)
+}
+
+func (e PostgresEmitter) SetColumnComment(table string, column ColumnDefinition) string {
+	return e.commentOnColumn(table, column.Name, column.Comment)
+}
+
+// MoveColumn returns no SQL; Postgres cannot reorder columns.
+func (e PostgresEmitter) MoveColumn(table string, column ColumnDefinition) string {
+	return ""
+}
+
+// SetTableCharset returns no SQL; Postgres sets the encoding per database.
+func (e PostgresEmitter) SetTableCharset(table, charset, collation string) string {
+	return ""
+}
+
+// SetTableCollation returns no SQL; Postgres collations are per column.
+func (e PostgresEmitter) SetTableCollation(table, collation string) string {
+	return ""
+}
+
+// SetTableEngine returns no SQL; Postgres has no storage engines.
+func (e PostgresEmitter) SetTableEngine(table, engine string) string {
+	return ""
+}
+
+func (e PostgresEmitter) SetTableComment(table, comment string) string {
+	return e.commentOnTable(table, comment)
+}
+
+func (e PostgresEmitter) SetTableTablespace(table, tablespace string) string {
+	return fmt.Sprintf("ALTER TABLE %s SET TABLESPACE %s;", e.table(table), e.quote(orDefault(tablespace, postgresDefaultTablespace)))
+}
+
+func (e PostgresEmitter) SetIndexTablespace(table, index, tablespace string) string {
+	return fmt.Sprintf("ALTER INDEX %s SET TABLESPACE %s;", e.inSchemaOf(table, index), e.quote(orDefault(tablespace, postgresDefaultTablespace)))
+}
+
+// SetAutoIncrement returns no SQL: the counters of serial columns are
+// sequences, which a dropped table takes with it.
+func (e PostgresEmitter) SetAutoIncrement(table string, value uint64) string {
+	return ""
+}
+
+// postgresDefinitionKeywords end the type of a column definition.
+var postgresDefinitionKeywords = map[string]bool{
+	"NOT": true, "NULL": true, "DEFAULT": true, "UNIQUE": true, "PRIMARY": true,
+	"CHECK": true, "REFERENCES": true, "GENERATED": true, "COLLATE": true, "CONSTRAINT": true,
+}
+
+// splitPostgresDefinition returns the type of a column definition, whether
+// it is NOT NULL and its default. Serial types are returned as the integer
+// type they stand for, since ALTER COLUMN TYPE does not accept them.
+func splitPostgresDefinition(definition string) (string, bool, string) {
+	tokens := tokenizeDefinition(normalizeDefinition(definition))
+	typeEnd := 0
+	for typeEnd < len(tokens) && !postgresDefinitionKeywords[strings.ToUpper(tokens[typeEnd])] {
+		typeEnd++
+	}
+	typ := strings.Join(tokens[:typeEnd], " ")
+	switch strings.ToLower(typ) {
+	case "smallserial":
+		typ = "smallint"
+	case "serial":
+		typ = "integer"
+	case "bigserial":
+		typ = "bigint"
+	}
+	notNull := false
+	def := ""
+	for i := typeEnd; i < len(tokens); i++ {
+		switch {
+		case strings.EqualFold(tokens[i], "NOT") && i+1 < len(tokens) && strings.EqualFold(tokens[i+1], "NULL"):
+			notNull = true
+			i++
+		case strings.EqualFold(tokens[i], "DEFAULT") && i+1 < len(tokens):
+			def = tokens[i+1]
+			i++
+		}
+	}
+	return typ, notNull, def
+}
+
+func isSerialType(baseType string) bool {
+	return baseType == "smallserial" || baseType == "serial" || baseType == "bigserial"
+}
+
+func (o Options) validateDialect() error {
+	if err := validateDialect(o.Dialect); err != nil {
+		return err
+	}
+	if o.Dialect.isMySQL() {
+		return nil
+	}
+	if strings.TrimSpace(o.SQLMode) != "" {
+		return fmt.Errorf("SQLMode is only supported for MySQL")
+	}
+	if len(o.RebuildTables) > 0 {
+		return fmt.Errorf("RebuildTables is only supported for MySQL")
+	}
+	if o.SelfVerify && o.Dialect == DialectPostgres {
+		return fmt.Errorf("SelfVerify replays MySQL and SQLite DDL and is not supported for Postgres")
+	}
+	return nil
+}
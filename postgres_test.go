@@ -0,0 +1,166 @@
+package gomigration
+
+import (
+	"strings"
+	"testing"
+)
+
+type postgresArticle struct {
+	ID       uint   `gorm:"primaryKey"`
+	Title    string `gorm:"size:128;not null;index:idx_articles_title,where:deleted = false"`
+	Status   string `gorm:"size:16;default:'draft'"`
+	Deleted  bool
+	AuthorID uint
+}
+
+func (postgresArticle) TableName() string { return "articles" }
+
+func TestMakeMigrationsPostgres(t *testing.T) {
+	dir := t.TempDir()
+	result, err := MakeMigrationsWithOptions(migrationModels(), dir, "init_schema", "", Options{Dialect: DialectPostgres})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	up := readMigration(t, result.UpPath)
+	down := readMigration(t, result.DownPath)
+	if strings.Contains(up+down, "`") {
+		t.Fatalf("expected no MySQL quoting, got:\n%s\n%s", up, down)
+	}
+	assertContainsAll(t, up, []string{
+		"CREATE TABLE \"test_users\" (\n  \"id\" bigserial,\n  PRIMARY KEY (\"id\")\n);",
+		"CREATE TABLE \"test_user_groups\" (",
+		`ALTER TABLE "test_user_groups" ADD CONSTRAINT "fk_test_user_groups_relation_user" FOREIGN KEY ("relation_user_id") REFERENCES "test_users" ("id");`,
+	})
+	assertContainsAll(t, down, []string{
+		`ALTER TABLE "test_user_groups" DROP CONSTRAINT "fk_test_user_groups_relation_user";`,
+		`DROP TABLE IF EXISTS "test_users";`,
+	})
+
+	if _, err := MakeMigrationsWithOptions(migrationModels(), t.TempDir(), "init", "", Options{Dialect: "oracle"}); err == nil {
+		t.Fatalf("expected error for unknown dialect")
+	}
+	if _, err := MakeMigrationsWithOptions(migrationModels(), t.TempDir(), "init", "", Options{Dialect: DialectPostgres, SQLMode: "ANSI"}); err == nil {
+		t.Fatalf("expected error for SQLMode with Postgres")
+	}
+}
+
+func TestBuildCurrentStatePostgresPartialIndex(t *testing.T) {
+	opts := Options{Dialect: DialectPostgres}
+	state, err := buildCurrentStateWithOptions([]any{&postgresArticle{}}, opts)
+	if err != nil {
+		t.Fatalf("buildCurrentStateWithOptions failed: %v", err)
+	}
+	table := state.Tables["articles"]
+	if got := table.Columns["title"].Definition; got != "varchar(128) NOT NULL" {
+		t.Fatalf("unexpected title definition %q", got)
+	}
+	create := createTableSQLWithOptions("articles", table, opts)
+	if !strings.Contains(create, `CREATE INDEX "idx_articles_title" ON "articles" ("title") WHERE deleted = false;`) {
+		t.Fatalf("expected partial index after the table, got:\n%s", create)
+	}
+}
+
+func TestDiffTablePostgres(t *testing.T) {
+	prev := tableState{
+		Columns: map[string]columnState{
+			"id":        {Definition: "bigserial"},
+			"title":     {Definition: "varchar(64)"},
+			"status":    {Definition: "varchar(16) DEFAULT 'draft'"},
+			"author_id": {Definition: "bigint"},
+		},
+		Indexes:     map[string]indexState{"idx_title": {Fields: []indexFieldState{{Column: "title"}}}},
+		ForeignKeys: map[string]foreignKeyState{"fk_author": {Columns: []string{"author_id"}, RefTable: "authors", RefColumns: []string{"id"}}},
+		PrimaryKeys: []string{"id"},
+	}
+	cur := tableState{
+		Columns: map[string]columnState{
+			"id":        {Definition: "bigserial"},
+			"title":     {Definition: "varchar(128) NOT NULL"},
+			"status":    {Definition: "varchar(16)"},
+			"author_id": {Definition: "bigint"},
+		},
+		Indexes:     map[string]indexState{"idx_title_v2": {Fields: []indexFieldState{{Column: "title"}}}},
+		PrimaryKeys: []string{"id", "author_id"},
+	}
+	ops := diffTableWithOptions("articles", prev, cur, Options{Dialect: DialectPostgres})
+	up, down := splitMigrationOps(ops)
+	upSQL, downSQL := strings.Join(up, "\n"), strings.Join(down, "\n")
+	assertContainsAll(t, upSQL, []string{
+		`ALTER TABLE "articles" DROP CONSTRAINT "fk_author";`,
+		`ALTER TABLE "articles" DROP CONSTRAINT "articles_pkey", ADD PRIMARY KEY ("id", "author_id");`,
+		`ALTER TABLE "articles" ALTER COLUMN "status" TYPE varchar(16) USING "status"::varchar(16), ALTER COLUMN "status" DROP NOT NULL, ALTER COLUMN "status" DROP DEFAULT;`,
+		`ALTER TABLE "articles" ALTER COLUMN "title" TYPE varchar(128) USING "title"::varchar(128), ALTER COLUMN "title" SET NOT NULL, ALTER COLUMN "title" DROP DEFAULT;`,
+		`ALTER INDEX "idx_title" RENAME TO "idx_title_v2";`,
+	})
+	assertContainsAll(t, downSQL, []string{
+		`ALTER TABLE "articles" ADD CONSTRAINT "fk_author" FOREIGN KEY ("author_id") REFERENCES "authors" ("id");`,
+		`ALTER TABLE "articles" DROP CONSTRAINT "articles_pkey", ADD PRIMARY KEY ("id");`,
+		`ALTER COLUMN "status" SET DEFAULT 'draft';`,
+		`ALTER INDEX "idx_title_v2" RENAME TO "idx_title";`,
+	})
+	if strings.Contains(upSQL+downSQL, "`") || strings.Contains(upSQL+downSQL, "MODIFY COLUMN") {
+		t.Fatalf("expected Postgres syntax only, got:\n%s\n%s", upSQL, downSQL)
+	}
+}
+
+func TestSplitPostgresDefinition(t *testing.T) {
+	cases := []struct {
+		definition, typ, def string
+		notNull              bool
+	}{
+		{"bigserial", "bigint", "", false},
+		{"double precision NOT NULL DEFAULT 1.5", "double precision", "1.5", true},
+		{"varchar(32) UNIQUE DEFAULT 'a b'", "varchar(32)", "'a b'", false},
+	}
+	for _, tc := range cases {
+		typ, notNull, def := splitPostgresDefinition(tc.definition)
+		if typ != tc.typ || notNull != tc.notNull || def != tc.def {
+			t.Fatalf("%q: got (%q, %v, %q), want (%q, %v, %q)", tc.definition, typ, notNull, def, tc.typ, tc.notNull, tc.def)
+		}
+	}
+}
+
+type billingAccount struct {
+	ID   uint   `gorm:"primaryKey"`
+	Name string `gorm:"size:64;index"`
+}
+
+func (billingAccount) TableName() string { return "billing.accounts" }
+
+type crmContact struct {
+	ID        uint `gorm:"primaryKey"`
+	AccountID uint
+	Account   billingAccount
+}
+
+func (crmContact) TableName() string { return "crm.contacts" }
+
+func TestPostgresCrossSchemaForeignKey(t *testing.T) {
+	opts := Options{Dialect: DialectPostgres}
+	state, err := buildCurrentStateWithOptions([]any{&billingAccount{}, &crmContact{}}, opts)
+	if err != nil {
+		t.Fatalf("buildCurrentStateWithOptions failed: %v", err)
+	}
+	fk := state.Tables["crm.contacts"].ForeignKeys["fk_crm_contacts_account"]
+	if fk.RefTable != "billing.accounts" {
+		t.Fatalf("expected a schema-qualified referenced table, got %#v", fk)
+	}
+	up, down := splitMigrationOps(diffSchemas(schemaState{Tables: map[string]tableState{}}, state, opts))
+	assertContainsAll(t, strings.Join(up, "\n"), []string{
+		`CREATE TABLE "billing"."accounts" (`,
+		`CREATE INDEX "idx_billing_accounts_name" ON "billing"."accounts" ("name");`,
+		`ALTER TABLE "crm"."contacts" ADD CONSTRAINT "fk_crm_contacts_account" FOREIGN KEY ("account_id") REFERENCES "billing"."accounts" ("id");`,
+	})
+	assertContainsAll(t, strings.Join(down, "\n"), []string{
+		`ALTER TABLE "crm"."contacts" DROP CONSTRAINT "fk_crm_contacts_account";`,
+		`DROP TABLE IF EXISTS "billing"."accounts";`,
+	})
+
+	e := PostgresEmitter{QuoteMode: QuoteReservedOnly}
+	if got := e.DropIndex("billing.accounts", "idx_billing_accounts_name"); got != "DROP INDEX IF EXISTS billing.idx_billing_accounts_name;" {
+		t.Fatalf("expected the index to be qualified with the schema of its table, got %s", got)
+	}
+	if got := e.RenameTable("billing.accounts", "billing.ledgers"); got != "ALTER TABLE billing.accounts RENAME TO ledgers;" {
+		t.Fatalf("unexpected rename SQL: %s", got)
+	}
+}
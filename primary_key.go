@@ -0,0 +1,110 @@
+package gomigration
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+func primaryKeyChanged(prev, cur tableState) bool {
+	return strings.Join(sortedCopy(prev.PrimaryKeys), ",") != strings.Join(sortedCopy(cur.PrimaryKeys), ",")
+}
+
+// primaryKeyOp replaces the primary key of a table. MySQL refuses to drop a
+// primary key while one of its columns is AUTO_INCREMENT, so such columns
+// lose AUTO_INCREMENT first and get it back once the new key exists. In the
+// up direction column additions run before this op and modifications after
+// it; diffTableWithOptions leaves AUTO_INCREMENT off the definitions it emits
+// while a column is outside any key.
+func primaryKeyOp(tableName string, prev, cur tableState, opts Options) migrationOp {
+	op := migrationOp{
+		kind:  opChangePrimaryKey,
+		table: tableName,
+		name:  tableName,
+		apply: primaryKeyChange(tableName, cur.PrimaryKeys),
+	}
+	em := opts.emitter()
+	// During up, columns of the old key still have their previous
+	// definitions; during down, columns of the new key have been restored to
+	// their previous definitions unless they did not exist before.
+	upState := func(col string) string { return prev.Columns[col].Definition }
+	downState := func(col string) string {
+		if c, ok := prev.Columns[col]; ok {
+			return c.Definition
+		}
+		return cur.Columns[col].Definition
+	}
+	op.up = strings.Join(replacePrimaryKeySQL(em, tableName, prev.PrimaryKeys, cur.PrimaryKeys, upState, cur), "\n")
+	op.down = strings.Join(replacePrimaryKeySQL(em, tableName, cur.PrimaryKeys, prev.PrimaryKeys, downState, prev), "\n")
+	return op
+}
+
+func replacePrimaryKeySQL(em Emitter, tableName string, from, to []string, stateOf func(string) string, target tableState) []string {
+	stmts := make([]string, 0)
+	for _, col := range from {
+		if def := stateOf(col); hasAutoIncrement(def) {
+			stmts = append(stmts, em.ModifyColumn(tableName, ColumnDefinition{Name: col, Definition: withoutAutoIncrement(def)}))
+		}
+	}
+	if stmt := em.ChangePrimaryKey(tableName, from, to); stmt != "" {
+		stmts = append(stmts, stmt)
+	}
+	for _, col := range to {
+		if def := target.Columns[col].Definition; hasAutoIncrement(def) {
+			stmts = append(stmts, em.ModifyColumn(tableName, ColumnDefinition{Name: col, Definition: def}))
+		}
+	}
+	return stmts
+}
+
+// autoIncrementOnlyChange reports whether two column definitions differ only
+// in AUTO_INCREMENT.
+func autoIncrementOnlyChange(prev, cur string, opts Options) bool {
+	return hasAutoIncrement(prev) != hasAutoIncrement(cur) && opts.columnEqual(withoutAutoIncrement(prev), withoutAutoIncrement(cur))
+}
+
+func primaryKeyChange(tableName string, keys []string) func(map[string]tableState) {
+	return func(tables map[string]tableState) {
+		table := tables[tableName]
+		table.PrimaryKeys = append([]string{}, keys...)
+		tables[tableName] = table
+	}
+}
+
+func isAutoIncrementKey(table tableState, col string) bool {
+	return containsString(table.PrimaryKeys, col) && hasAutoIncrement(table.Columns[col].Definition)
+}
+
+// validateAutoIncrementKeys rejects AUTO_INCREMENT columns that are neither in
+// the primary key nor the first column of an index, which MySQL refuses.
+func validateAutoIncrementKeys(tableName string, table tableState) error {
+	leading := map[string]bool{}
+	for _, col := range table.PrimaryKeys {
+		leading[col] = true
+	}
+	for _, idx := range table.Indexes {
+		if len(idx.Fields) > 0 && idx.Fields[0].Column != "" {
+			leading[idx.Fields[0].Column] = true
+		}
+	}
+	cols := make([]string, 0)
+	for col, state := range table.Columns {
+		if hasAutoIncrement(state.Definition) && !leading[col] {
+			cols = append(cols, col)
+		}
+	}
+	if len(cols) == 0 {
+		return nil
+	}
+	sort.Strings(cols)
+	return fmt.Errorf("table `%s` column `%s` is AUTO_INCREMENT but not part of any key", tableName, cols[0])
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
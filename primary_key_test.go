@@ -0,0 +1,236 @@
+package gomigration
+
+import (
+	"strings"
+	"testing"
+)
+
+type pkOrdersBefore struct {
+	ID     uint   `gorm:"primaryKey"`
+	Number string `gorm:"size:32"`
+}
+
+func (pkOrdersBefore) TableName() string { return "pk_orders" }
+
+type pkOrdersAfter struct {
+	ID       uint   `gorm:"primaryKey"`
+	TenantID uint   `gorm:"primaryKey;autoIncrement:false"`
+	Number   string `gorm:"size:32"`
+}
+
+func (pkOrdersAfter) TableName() string { return "pk_orders" }
+
+type pkLooseAutoIncrement struct {
+	ID  uint `gorm:"primaryKey;autoIncrement:false"`
+	Seq uint `gorm:"autoIncrement"`
+}
+
+func TestDiffTablePrimaryKeyChangeKeepsAutoIncrementKeyed(t *testing.T) {
+	before, err := buildCurrentState([]any{&pkOrdersBefore{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState before failed: %v", err)
+	}
+	after, err := buildCurrentState([]any{&pkOrdersAfter{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState after failed: %v", err)
+	}
+
+	ops := diffSchemas(before, after, Options{})
+	up := make([]string, 0, len(ops))
+	down := make([]string, 0, len(ops))
+	for _, op := range ops {
+		up = append(up, op.up)
+		down = append([]string{op.down}, down...)
+	}
+	wantUp := strings.Join([]string{
+		"ALTER TABLE `pk_orders` ADD COLUMN `tenant_id` bigint unsigned;",
+		"ALTER TABLE `pk_orders` MODIFY COLUMN `id` bigint unsigned;",
+		"ALTER TABLE `pk_orders` DROP PRIMARY KEY, ADD PRIMARY KEY (`id`, `tenant_id`);",
+		"ALTER TABLE `pk_orders` MODIFY COLUMN `id` bigint unsigned AUTO_INCREMENT;",
+	}, "\n")
+	if got := strings.Join(up, "\n"); got != wantUp {
+		t.Fatalf("unexpected up SQL:\n%s", got)
+	}
+	wantDown := strings.Join([]string{
+		"ALTER TABLE `pk_orders` MODIFY COLUMN `id` bigint unsigned;",
+		"ALTER TABLE `pk_orders` DROP PRIMARY KEY, ADD PRIMARY KEY (`id`);",
+		"ALTER TABLE `pk_orders` MODIFY COLUMN `id` bigint unsigned AUTO_INCREMENT;",
+		"ALTER TABLE `pk_orders` DROP COLUMN `tenant_id`;",
+	}, "\n")
+	if got := strings.Join(down, "\n"); got != wantDown {
+		t.Fatalf("unexpected down SQL:\n%s", got)
+	}
+
+	if err := verifyMigrationOps(before, after, ops, Options{}); err != nil {
+		t.Fatalf("unexpected self-check failure: %v", err)
+	}
+	reverse := diffSchemas(after, before, Options{})
+	if err := verifyMigrationOps(after, before, reverse, Options{}); err != nil {
+		t.Fatalf("unexpected self-check failure for reverse diff: %v", err)
+	}
+}
+
+func TestBuildCurrentStateRejectsUnkeyedAutoIncrement(t *testing.T) {
+	_, err := buildCurrentState([]any{&pkLooseAutoIncrement{}})
+	if err == nil || !strings.Contains(err.Error(), "column `seq` is AUTO_INCREMENT but not part of any key") {
+		t.Fatalf("expected unkeyed AUTO_INCREMENT error, got %v", err)
+	}
+}
+
+func TestDiffTableAutoIncrementOnlyChange(t *testing.T) {
+	withAI := tableState{
+		Columns:     map[string]columnState{"id": {Definition: "bigint unsigned AUTO_INCREMENT"}, "name": {Definition: "varchar(32)"}},
+		PrimaryKeys: []string{"id"},
+	}
+	withoutAI := cloneTableState(withAI)
+	withoutAI.Columns["id"] = columnState{Definition: "bigint unsigned"}
+
+	for _, tc := range []struct {
+		name     string
+		prev     tableState
+		cur      tableState
+		up, down string
+	}{
+		{"remove", withAI, withoutAI, "ALTER TABLE `people` MODIFY COLUMN `id` bigint unsigned;", "ALTER TABLE `people` MODIFY COLUMN `id` bigint unsigned AUTO_INCREMENT;"},
+		{"add", withoutAI, withAI, "ALTER TABLE `people` MODIFY COLUMN `id` bigint unsigned AUTO_INCREMENT;", "ALTER TABLE `people` MODIFY COLUMN `id` bigint unsigned;"},
+	} {
+		ops := diffTable("people", tc.prev, tc.cur)
+		if len(ops) != 1 || ops[0].kind != opChangeAutoIncrement {
+			t.Fatalf("%s: expected one auto-increment op, got %#v", tc.name, ops)
+		}
+		if ops[0].up != tc.up || ops[0].down != tc.down {
+			t.Fatalf("%s: unexpected SQL:\n%s\n%s", tc.name, ops[0].up, ops[0].down)
+		}
+		prev := schemaState{Tables: map[string]tableState{"people": tc.prev}}
+		cur := schemaState{Tables: map[string]tableState{"people": tc.cur}}
+		if err := verifyMigrationOps(prev, cur, ops, Options{}); err != nil {
+			t.Fatalf("%s: unexpected self-check failure: %v", tc.name, err)
+		}
+	}
+
+	withoutAI.Columns["name"] = columnState{Definition: "varchar(64)"}
+	if ops := diffTable("people", withAI, withoutAI); len(ops) != 2 || ops[0].kind != opChangeAutoIncrement || ops[1].kind != opModifyColumn {
+		t.Fatalf("expected only the id change to be an auto-increment op, got %#v", ops)
+	}
+}
+
+func TestDiffTableMovesAutoIncrementAfterItsKey(t *testing.T) {
+	prev := tableState{
+		Columns:     map[string]columnState{"id": {Definition: "bigint unsigned AUTO_INCREMENT"}, "seq": {Definition: "bigint unsigned"}},
+		PrimaryKeys: []string{"id"},
+	}
+	cur := tableState{
+		Columns:     map[string]columnState{"id": {Definition: "bigint unsigned"}, "seq": {Definition: "bigint unsigned AUTO_INCREMENT"}},
+		Indexes:     map[string]indexState{"idx_seq": {Fields: []indexFieldState{{Column: "seq"}}}},
+		PrimaryKeys: []string{"id"},
+	}
+	up, down := splitMigrationOps(diffTable("people", prev, cur))
+	wantUp := []string{
+		"ALTER TABLE `people` MODIFY COLUMN `id` bigint unsigned;",
+		"CREATE INDEX `idx_seq` ON `people` (`seq`);",
+		"ALTER TABLE `people` MODIFY COLUMN `seq` bigint unsigned AUTO_INCREMENT;",
+	}
+	wantDown := []string{
+		"ALTER TABLE `people` MODIFY COLUMN `seq` bigint unsigned;",
+		"DROP INDEX `idx_seq` ON `people`;",
+		"ALTER TABLE `people` MODIFY COLUMN `id` bigint unsigned AUTO_INCREMENT;",
+	}
+	if strings.Join(up, "\n") != strings.Join(wantUp, "\n") || strings.Join(down, "\n") != strings.Join(wantDown, "\n") {
+		t.Fatalf("unexpected SQL:\n%s\n---\n%s", strings.Join(up, "\n"), strings.Join(down, "\n"))
+	}
+}
+
+func TestDiffTablePrimaryKeyAddDropAndSwitch(t *testing.T) {
+	columns := func(idDef string) map[string]columnState {
+		return map[string]columnState{"id": {Definition: idDef}, "code": {Definition: "varchar(32) NOT NULL"}}
+	}
+	keyless := tableState{Columns: columns("bigint unsigned NOT NULL")}
+	byID := tableState{Columns: columns("bigint unsigned AUTO_INCREMENT"), PrimaryKeys: []string{"id"}}
+	byCode := tableState{Columns: columns("bigint unsigned NOT NULL"), PrimaryKeys: []string{"code"}}
+
+	cases := []struct {
+		name      string
+		prev, cur tableState
+		up, down  []string
+	}{
+		{
+			name: "add",
+			prev: keyless, cur: byCode,
+			up:   []string{"ALTER TABLE `items` ADD PRIMARY KEY (`code`);"},
+			down: []string{"ALTER TABLE `items` DROP PRIMARY KEY;"},
+		},
+		{
+			name: "drop",
+			prev: byID, cur: keyless,
+			up: []string{
+				"ALTER TABLE `items` MODIFY COLUMN `id` bigint unsigned;\nALTER TABLE `items` DROP PRIMARY KEY;",
+				"ALTER TABLE `items` MODIFY COLUMN `id` bigint unsigned NOT NULL;",
+			},
+			down: []string{
+				"ALTER TABLE `items` MODIFY COLUMN `id` bigint unsigned;",
+				"ALTER TABLE `items` ADD PRIMARY KEY (`id`);\nALTER TABLE `items` MODIFY COLUMN `id` bigint unsigned AUTO_INCREMENT;",
+			},
+		},
+		{
+			name: "switch",
+			prev: byID, cur: byCode,
+			up: []string{
+				"ALTER TABLE `items` MODIFY COLUMN `id` bigint unsigned;\nALTER TABLE `items` DROP PRIMARY KEY, ADD PRIMARY KEY (`code`);",
+				"ALTER TABLE `items` MODIFY COLUMN `id` bigint unsigned NOT NULL;",
+			},
+			down: []string{
+				"ALTER TABLE `items` MODIFY COLUMN `id` bigint unsigned;",
+				"ALTER TABLE `items` DROP PRIMARY KEY, ADD PRIMARY KEY (`id`);\nALTER TABLE `items` MODIFY COLUMN `id` bigint unsigned AUTO_INCREMENT;",
+			},
+		},
+	}
+	for _, tc := range cases {
+		ops := diffTable("items", tc.prev, tc.cur)
+		up, down := splitMigrationOps(ops)
+		if strings.Join(up, "\n") != strings.Join(tc.up, "\n") || strings.Join(down, "\n") != strings.Join(tc.down, "\n") {
+			t.Fatalf("%s: unexpected SQL:\n%s\n---\n%s", tc.name, strings.Join(up, "\n"), strings.Join(down, "\n"))
+		}
+		prev := schemaState{Tables: map[string]tableState{"items": tc.prev}}
+		cur := schemaState{Tables: map[string]tableState{"items": tc.cur}}
+		if err := verifyMigrationOps(prev, cur, ops, Options{}); err != nil {
+			t.Fatalf("%s: unexpected self-check failure: %v", tc.name, err)
+		}
+	}
+}
+
+// Embedded structs must be exported for GORM to read their fields.
+type PKTenantBase struct {
+	TenantID  uint `gorm:"primaryKey;autoIncrement:false"`
+	CreatedAt int64
+}
+
+type PKAuditKey struct {
+	Revision  uint   `gorm:"primaryKey;autoIncrement:false"`
+	ChangedBy string `gorm:"size:32"`
+}
+
+type pkLedgerEntry struct {
+	PKTenantBase
+	PKAuditKey
+	Amount int
+}
+
+func TestBuildCurrentStateEmbeddedCompositePrimaryKey(t *testing.T) {
+	state, err := buildCurrentState([]any{&pkLedgerEntry{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState failed: %v", err)
+	}
+	table := state.Tables["pk_ledger_entries"]
+	if strings.Join(table.PrimaryKeys, ",") != "tenant_id,revision" {
+		t.Fatalf("expected the primary key in declared order, got %v", table.PrimaryKeys)
+	}
+	if create := createTableSQL("pk_ledger_entries", table); !strings.Contains(create, "  PRIMARY KEY (`tenant_id`, `revision`)\n") {
+		t.Fatalf("expected the declared primary key order in CREATE TABLE, got:\n%s", create)
+	}
+
+	sorted := cloneTableState(table)
+	sorted.PrimaryKeys = []string{"revision", "tenant_id"}
+	if ops := diffTable("pk_ledger_entries", sorted, table); len(ops) != 0 {
+		t.Fatalf("expected a state saved with sorted keys not to change the primary key, got %#v", ops)
+	}
+}
@@ -0,0 +1,151 @@
+package gomigration
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// QuoteMode controls which identifiers the generated SQL quotes.
+type QuoteMode string
+
+const (
+	QuoteAlways QuoteMode = "always"
+	// QuoteReservedOnly leaves identifiers bare unless they are reserved words
+	// of the dialect or contain characters that need quoting.
+	QuoteReservedOnly QuoteMode = "reserved-only"
+)
+
+func validateQuoteMode(mode QuoteMode) error {
+	switch mode {
+	case "", QuoteAlways, QuoteReservedOnly:
+		return nil
+	default:
+		return fmt.Errorf("unsupported quote mode %q", mode)
+	}
+}
+
+var bareIdentifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// quote renders a MySQL identifier.
+func (m QuoteMode) quote(name string) string {
+	return m.quoteFor(DialectMySQL, name)
+}
+
+func (m QuoteMode) quoteFor(dialect Dialect, name string) string {
+	name = strings.TrimSpace(name)
+	if m == QuoteReservedOnly && isBareIdentifier(dialect, name) {
+		return name
+	}
+	return quoteIdentifier(dialect, name)
+}
+
+// isBareIdentifier reports whether name means the same without quotes.
+// Postgres folds unquoted identifiers to lower case, so mixed case needs
+// quotes there.
+func isBareIdentifier(dialect Dialect, name string) bool {
+	if !bareIdentifierPattern.MatchString(name) || isReservedWord(dialect, name) {
+		return false
+	}
+	return dialect != DialectPostgres || name == strings.ToLower(name)
+}
+
+func (m QuoteMode) columns(columns []string) string {
+	parts := make([]string, 0, len(columns))
+	for _, col := range columns {
+		parts = append(parts, m.quote(col))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func isReservedWord(dialect Dialect, name string) bool {
+	switch dialect {
+	case DialectPostgres:
+		return postgresReservedWords[strings.ToLower(name)]
+	case DialectSQLite:
+		return sqliteReservedWords[strings.ToLower(name)]
+	}
+	return mysqlReservedWords[strings.ToLower(name)]
+}
+
+func wordSet(words string) map[string]bool {
+	set := map[string]bool{}
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+// mysqlReservedWords are the reserved keywords of MySQL 8.0, which include
+// those of 5.7.
+var mysqlReservedWords = wordSet(`
+accessible add all alter analyze and as asc asensitive before between bigint
+binary blob both by call cascade case change char character check collate
+column condition constraint continue convert create cross cube cume_dist
+current_date current_time current_timestamp current_user cursor database
+databases day_hour day_microsecond day_minute day_second dec decimal declare
+default delayed delete dense_rank desc describe deterministic distinct
+distinctrow div double drop dual each else elseif empty enclosed escaped
+except exists exit explain false fetch first_value float float4 float8 for
+force foreign from fulltext function generated get grant group grouping
+groups having high_priority hour_microsecond hour_minute hour_second if
+ignore in index infile inner inout insensitive insert int int1 int2 int3 int4
+int8 integer intersect interval into io_after_gtids io_before_gtids is
+iterate join json_table key keys kill lag last_value lateral lead leading
+leave left like limit linear lines load localtime localtimestamp lock long
+longblob longtext loop low_priority master_bind master_ssl_verify_server_cert
+match maxvalue mediumblob mediumint mediumtext middleint minute_microsecond
+minute_second mod modifies natural not no_write_to_binlog nth_value ntile
+null numeric of on optimize optimizer_costs option optionally or order out
+outer outfile over partition percent_rank precision primary procedure purge
+range rank read reads read_write real recursive references regexp release
+rename repeat replace require resignal restrict return revoke right rlike
+row row_number rows schema schemas second_microsecond select sensitive
+separator set show signal smallint spatial specific sql sqlexception
+sqlstate sqlwarning sql_big_result sql_calc_found_rows sql_small_result ssl
+starting stored straight_join system table terminated then tinyblob tinyint
+tinytext to trailing trigger true undo union unique unlock unsigned update
+usage use using utc_date utc_time utc_timestamp values varbinary varchar
+varcharacter varying virtual when where while window with write xor
+year_month zerofill
+`)
+
+// postgresReservedWords are the keywords PostgreSQL reserves, including those
+// it only allows as function or type names.
+var postgresReservedWords = wordSet(`
+all analyse analyze and any array as asc asymmetric authorization between
+bigint binary bit boolean both case cast char character check coalesce
+collate collation column concurrently constraint create cross current_catalog
+current_date current_role current_schema current_time current_timestamp
+current_user dec decimal default deferrable desc distinct do else end except
+exists extract false fetch float for foreign freeze from full grant greatest
+group grouping having ilike in initially inner inout int integer intersect
+interval into is isnull join json lateral leading least left like limit
+localtime localtimestamp national natural nchar none normalize not notnull
+null nullif numeric offset on only or order out outer overlaps overlay
+placing position precision primary real references returning right row
+select session_user setof similar smallint some substring symmetric system_user
+table tablesample then time timestamp to trailing treat trim true union unique
+user using values varchar variadic verbose when where window with xmlattributes
+xmlconcat xmlelement xmlexists xmlforest xmlnamespaces xmlparse xmlpi xmlroot
+xmlserialize xmltable
+`)
+
+// sqliteReservedWords are the SQLite keywords that cannot be used as bare
+// identifiers. SQLite accepts most of its other keywords unquoted.
+var sqliteReservedWords = wordSet(`
+abort action add after all alter always analyze and as asc attach
+autoincrement before begin between by cascade case cast check collate column
+commit conflict constraint create cross current current_date current_time
+current_timestamp database default deferrable deferred delete desc detach
+distinct do drop each else end escape except exclude exclusive exists explain
+fail filter first following for foreign from full generated glob group groups
+having if ignore immediate in index indexed initially inner insert instead
+intersect into is isnull join key last left like limit match materialized
+natural no not nothing notnull null nulls of offset on or order others outer
+over partition plan pragma preceding primary query raise range recursive
+references regexp reindex release rename replace restrict returning right
+rollback row rows savepoint select set table temp temporary then ties to
+transaction trigger unbounded union unique update using vacuum values view
+virtual when where window with without
+`)
@@ -0,0 +1,69 @@
+package gomigration
+
+import (
+	"strings"
+	"testing"
+)
+
+type reservedWordModel struct {
+	ID    uint   `gorm:"primaryKey"`
+	Order int    `gorm:"index"`
+	Key   string `gorm:"size:32"`
+	Title string `gorm:"size:64"`
+}
+
+func (reservedWordModel) TableName() string { return "reserved_word_models" }
+
+func TestQuoteModeReservedOnly(t *testing.T) {
+	cases := []struct {
+		dialect Dialect
+		name    string
+		want    string
+	}{
+		{DialectMySQL, "title", "title"},
+		{DialectMySQL, "order", "`order`"},
+		{DialectMySQL, "KEY", "`KEY`"},
+		{DialectMySQL, "user-id", "`user-id`"},
+		{DialectMySQL, "2fa", "`2fa`"},
+		{DialectPostgres, "title", "title"},
+		{DialectPostgres, "user", `"user"`},
+		{DialectPostgres, "Title", `"Title"`},
+	}
+	for _, tc := range cases {
+		if got := QuoteReservedOnly.quoteFor(tc.dialect, tc.name); got != tc.want {
+			t.Fatalf("%s %q: got %s, want %s", tc.dialect, tc.name, got, tc.want)
+		}
+	}
+	if got := QuoteMode("").quote("title"); got != "`title`" {
+		t.Fatalf("expected the default mode to quote everything, got %s", got)
+	}
+}
+
+func TestMakeMigrationsQuoteModeReservedOnly(t *testing.T) {
+	dir := t.TempDir()
+	result, err := MakeMigrationsWithOptions([]any{&reservedWordModel{}}, dir, "init", "", Options{QuoteMode: QuoteReservedOnly})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	up := readMigration(t, result.UpPath)
+	for _, want := range []string{
+		"CREATE TABLE reserved_word_models (",
+		"  id bigint unsigned",
+		"  `key` varchar(32)",
+		"  `order` bigint",
+		"  title varchar(64)",
+		"  PRIMARY KEY (id)",
+		"KEY idx_reserved_word_models_order (`order`)",
+	} {
+		if !strings.Contains(up, want) {
+			t.Fatalf("expected %q in:\n%s", want, up)
+		}
+	}
+	if down := readMigration(t, result.DownPath); down != "DROP TABLE IF EXISTS reserved_word_models;" {
+		t.Fatalf("unexpected down SQL: %q", down)
+	}
+
+	if _, err := MakeMigrationsWithOptions([]any{&reservedWordModel{}}, t.TempDir(), "init", "", Options{QuoteMode: "never"}); err == nil {
+		t.Fatalf("expected error for unknown quote mode")
+	}
+}
@@ -0,0 +1,98 @@
+package gomigration
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MakeRebuild writes a maintenance migration that rebuilds table in place
+// with ALTER TABLE ... FORCE, which reclaims space and applies row format
+// changes. The schema state is not touched. A rebuild changes no schema, so
+// there is nothing to undo; the down migration rebuilds the table again.
+func MakeRebuild(table, dir, name string) (MakeMigrationsResult, error) {
+	return MakeRebuildWithOptions(table, dir, name, Options{})
+}
+
+// MakeRebuildWithOptions is MakeRebuild versioning the migration as
+// MakeMigrationsWithOptions does, by Options.Version, SequentialVersions or
+// the current time, and applying the file options such as QuoteMode and
+// SQLMode. It always writes an up/down pair.
+func MakeRebuildWithOptions(table, dir, name string, opts Options) (MakeMigrationsResult, error) {
+	result := MakeMigrationsResult{}
+	table = strings.TrimSpace(table)
+	if table == "" {
+		return result, fmt.Errorf("table is required")
+	}
+	if strings.TrimSpace(name) == "" {
+		return result, fmt.Errorf("--name is required")
+	}
+	if err := opts.validate(); err != nil {
+		return result, err
+	}
+	if !opts.Dialect.isMySQL() {
+		return result, fmt.Errorf("MakeRebuild is only supported for MySQL")
+	}
+	if strings.TrimSpace(dir) == "" {
+		dir = filepath.Join("database", "migrations")
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return result, err
+	}
+	if err := os.MkdirAll(absDir, 0o755); err != nil {
+		return result, err
+	}
+
+	version, err := opts.newVersion(absDir)
+	if err != nil {
+		return result, err
+	}
+	up, down := markedMigrationOps([]migrationOp{rebuildTableOp(table, opts.QuoteMode)})
+	upPath, downPath, err := writeMigrationFiles(absDir, version, name, opts.wrapFileSQL(up), opts.wrapFileSQL(down), opts.FileEncoding)
+	if err != nil {
+		return result, err
+	}
+	if err := updateManifest(absDir); err != nil {
+		return result, err
+	}
+	result.Changed = true
+	result.Version = version
+	result.UpPath = upPath
+	result.DownPath = downPath
+	result.UpPaths, result.DownPaths = []string{upPath}, []string{downPath}
+	return result, nil
+}
+
+// rebuildTableOp rebuilds table in both directions.
+func rebuildTableOp(table string, q QuoteMode) migrationOp {
+	sql := rebuildTableSQL(table, q)
+	return migrationOp{kind: opRebuildTable, table: table, name: table, up: sql, down: sql}
+}
+
+func rebuildTableSQL(table string, q QuoteMode) string {
+	return fmt.Sprintf("ALTER TABLE %s FORCE;", q.quote(table))
+}
+
+// rebuildTableOps returns rebuild ops for tables that exist before and after
+// the migration; a table created by the same migration needs no rebuild.
+func rebuildTableOps(previous, current schemaState, tables []string, q QuoteMode) ([]migrationOp, error) {
+	ops := make([]migrationOp, 0, len(tables))
+	seen := map[string]bool{}
+	for _, table := range tables {
+		table = strings.TrimSpace(table)
+		if table == "" || seen[table] {
+			continue
+		}
+		seen[table] = true
+		if _, ok := current.Tables[table]; !ok {
+			return nil, fmt.Errorf("cannot rebuild table `%s`: it is not defined by the models", table)
+		}
+		if _, ok := previous.Tables[table]; !ok {
+			continue
+		}
+		ops = append(ops, rebuildTableOp(table, q))
+	}
+	return ops, nil
+}
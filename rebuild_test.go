@@ -0,0 +1,125 @@
+package gomigration
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMakeRebuildWritesForceMigration(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := MakeRebuild("", dir, "rebuild"); err == nil {
+		t.Fatalf("expected error for empty table")
+	}
+	if _, err := MakeRebuild("test_users", dir, " "); err == nil {
+		t.Fatalf("expected error for empty name")
+	}
+
+	result, err := MakeRebuild("test_users", dir, "rebuild_users")
+	if err != nil {
+		t.Fatalf("MakeRebuild failed: %v", err)
+	}
+	if !result.Changed || !strings.HasSuffix(result.UpPath, "_rebuild_users.up.sql") {
+		t.Fatalf("unexpected result: %#v", result)
+	}
+	up, err := os.ReadFile(result.UpPath)
+	if err != nil {
+		t.Fatalf("read up failed: %v", err)
+	}
+	if string(up) != "-- operation 1\nALTER TABLE `test_users` FORCE;\n" {
+		t.Fatalf("unexpected up SQL: %q", up)
+	}
+	down, err := os.ReadFile(result.DownPath)
+	if err != nil {
+		t.Fatalf("read down failed: %v", err)
+	}
+	if string(down) != string(up) {
+		t.Fatalf("expected the down to rebuild the table again, got %q", down)
+	}
+}
+
+func TestMakeRebuildAllocatesVersionsLikeMakeMigrations(t *testing.T) {
+	dir := t.TempDir()
+	opts := Options{SequentialVersions: true}
+	first, err := MakeRebuildWithOptions("test_users", dir, "rebuild_users", opts)
+	if err != nil {
+		t.Fatalf("MakeRebuildWithOptions failed: %v", err)
+	}
+	second, err := MakeRebuildWithOptions("test_users", dir, "rebuild_users", opts)
+	if err != nil {
+		t.Fatalf("MakeRebuildWithOptions failed: %v", err)
+	}
+	if first.Version != "000001" || second.Version != "000002" {
+		t.Fatalf("expected sequential versions, got %s and %s", first.Version, second.Version)
+	}
+
+	stamped := t.TempDir()
+	a, err := MakeRebuild("test_users", stamped, "rebuild_users")
+	if err != nil {
+		t.Fatalf("MakeRebuild failed: %v", err)
+	}
+	b, err := MakeRebuild("test_users", stamped, "rebuild_users")
+	if err != nil {
+		t.Fatalf("MakeRebuild failed: %v", err)
+	}
+	if compareVersions(a.Version, b.Version) >= 0 {
+		t.Fatalf("expected a later version for the second rebuild, got %s and %s", a.Version, b.Version)
+	}
+
+	if _, err := MakeRebuildWithOptions("test_users", dir, "again", Options{Version: "000002"}); err == nil || !strings.Contains(err.Error(), "already used") {
+		t.Fatalf("expected a used version to be rejected, got %v", err)
+	}
+	if _, err := MakeRebuildWithOptions("test_users", dir, "pg", Options{Dialect: DialectPostgres}); err == nil {
+		t.Fatalf("expected MakeRebuild to reject Postgres")
+	}
+}
+
+func TestMakeMigrationsRebuildTablesRunAfterStructuralChanges(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := SyncSchemaState([]any{&e2eUserNoJoin{}, &e2eGroupNoJoin{}}, dir, ""); err != nil {
+		t.Fatalf("SyncSchemaState failed: %v", err)
+	}
+
+	result, err := MakeMigrationsWithOptions([]any{&e2eUserNoJoin{}, &e2eGroupNoJoin{}}, dir, "rebuild_only", "", Options{
+		Version:       "20240101000000",
+		RebuildTables: []string{"e2e_users"},
+	})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	if !result.Changed {
+		t.Fatalf("expected a rebuild migration without model changes")
+	}
+	up, err := os.ReadFile(result.UpPath)
+	if err != nil {
+		t.Fatalf("read up failed: %v", err)
+	}
+	if string(up) != "-- operation 1\nALTER TABLE `e2e_users` FORCE;\n" {
+		t.Fatalf("unexpected rebuild-only up SQL: %q", up)
+	}
+
+	result, err = MakeMigrationsWithOptions([]any{&e2eUserWithJoin{}, &e2eGroupWithJoin{}}, dir, "add_join", "", Options{
+		Version:       "20240102000000",
+		RebuildTables: []string{"e2e_users", "e2e_user_groups"},
+	})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	up, err = os.ReadFile(result.UpPath)
+	if err != nil {
+		t.Fatalf("read up failed: %v", err)
+	}
+	upSQL := strings.TrimSpace(string(up))
+	if !strings.HasPrefix(upSQL, "-- operation 1\nCREATE TABLE `e2e_user_groups`") || !strings.HasSuffix(upSQL, "ALTER TABLE `e2e_users` FORCE;") {
+		t.Fatalf("expected structural changes before the rebuild, got:\n%s", upSQL)
+	}
+	if strings.Contains(upSQL, "`e2e_user_groups` FORCE") {
+		t.Fatalf("expected no rebuild of a table created by the same migration, got:\n%s", upSQL)
+	}
+
+	if _, err := MakeMigrationsWithOptions([]any{&e2eUserWithJoin{}, &e2eGroupWithJoin{}}, dir, "bad", "", Options{
+		RebuildTables: []string{"missing"},
+	}); err == nil || !strings.Contains(err.Error(), "`missing`") {
+		t.Fatalf("expected error for unknown table, got %v", err)
+	}
+}
@@ -0,0 +1,906 @@
+package gomigration
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ReconstructState rebuilds the schema state from the .up.sql files in dir,
+// replayed in the order Apply runs them, for migrations written before the
+// project had a state file. It understands the MySQL DDL MakeMigrations
+// writes: CREATE TABLE, DROP TABLE, RENAME TABLE, CREATE INDEX, DROP INDEX
+// and the ALTER TABLE clauses for columns, keys, indexes and table options,
+// and the SQLite DDL of DialectSQLite. Postgres migrations are not
+// supported: their ALTER COLUMN ... TYPE and COMMENT ON statements fail.
+// Other statements, such as data changes, are skipped, while an ALTER TABLE
+// clause it cannot follow is an error rather than a silently wrong state.
+// The result is approximate: model-only details such as the creation order
+// of indexes are not in the SQL, and the column order is the one of the
+// tables, which only follows the models with ColumnOrderingDeclared.
+func ReconstructState(dir string) (schemaState, error) {
+	state := schemaState{Version: stateVersion, Tables: map[string]tableState{}}
+	if strings.TrimSpace(dir) == "" {
+		dir = filepath.Join("database", "migrations")
+	}
+	files, err := listMigrationFiles(dir)
+	if err != nil {
+		return state, err
+	}
+	for _, file := range files {
+		upSQL, err := readSQLFile(file.UpPath)
+		if err != nil {
+			return state, err
+		}
+		for _, stmt := range splitSQLStatements(upSQL) {
+			err := replayStatement(state.Tables, stmt)
+			if err == nil && hasKeywords(tokenizeDefinition(stmt), "COMMENT", "ON") {
+				// Postgres sets comments apart from the definitions they
+				// belong to, which the state would then lack.
+				err = fmt.Errorf("cannot follow %q", stmt)
+			}
+			if err != nil {
+				return state, fmt.Errorf("%s: %w (ReconstructState follows MySQL and SQLite DDL only)", filepath.Base(file.UpPath), err)
+			}
+		}
+	}
+	return state, nil
+}
+
+// SyncSchemaStateFromMigrations is SyncSchemaState for a directory of
+// existing migrations: it saves ReconstructState(dir) to stateFile, by
+// default .schema_state.json in dir, so the next MakeMigrations only writes
+// what the models add to them.
+func SyncSchemaStateFromMigrations(dir, stateFile string) (string, error) {
+	if strings.TrimSpace(dir) == "" {
+		dir = filepath.Join("database", "migrations")
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(stateFile) == "" {
+		stateFile = filepath.Join(absDir, ".schema_state.json")
+	}
+	absStateFile, err := filepath.Abs(stateFile)
+	if err != nil {
+		return "", err
+	}
+	state, err := ReconstructState(absDir)
+	if err != nil {
+		return "", err
+	}
+	if err := saveState(absStateFile, state); err != nil {
+		return "", err
+	}
+	return absStateFile, nil
+}
+
+func replayStatement(tables map[string]tableState, stmt string) error {
+	tokens := tokenizeDefinition(strings.TrimSuffix(strings.TrimSpace(stmt), ";"))
+	switch {
+	case hasKeywords(tokens, "CREATE", "TABLE"):
+		return replayCreateTable(tables, skipKeywords(tokens[2:], "IF", "NOT", "EXISTS"))
+	case hasKeywords(tokens, "DROP", "TABLE"):
+		for _, name := range identifierList(skipKeywords(tokens[2:], "IF", "EXISTS")) {
+			delete(tables, name)
+		}
+		return nil
+	case hasKeywords(tokens, "RENAME", "TABLE"):
+		for _, pair := range splitTopLevel(strings.Join(tokens[2:], " ")) {
+			parts := tokenizeDefinition(pair)
+			if len(parts) != 3 || !strings.EqualFold(parts[1], "TO") {
+				return fmt.Errorf("cannot follow %q", stmt)
+			}
+			if err := renameTable(tables, unquoteIdentifier(parts[0]), unquoteIdentifier(parts[2])); err != nil {
+				return err
+			}
+		}
+		return nil
+	case hasKeywords(tokens, "ALTER", "TABLE") && len(tokens) > 3:
+		return replayAlterTable(tables, unquoteIdentifier(tokens[2]), splitTopLevel(strings.Join(tokens[3:], " ")))
+	case len(tokens) > 2 && strings.EqualFold(tokens[0], "CREATE") && (strings.EqualFold(tokens[1], "INDEX") || strings.EqualFold(tokens[2], "INDEX")):
+		return replayCreateIndex(tables, tokens[1:])
+	case hasKeywords(tokens, "DROP", "INDEX") && len(tokens) == 5 && strings.EqualFold(tokens[3], "ON"):
+		table, err := replayedTable(tables, unquoteIdentifier(tokens[4]))
+		if err != nil {
+			return err
+		}
+		delete(table.Indexes, unquoteIdentifier(tokens[2]))
+		return nil
+	case hasKeywords(tokens, "DROP", "INDEX"):
+		// SQLite index names are unique in the database, so DROP INDEX
+		// names no table.
+		if rest := skipKeywords(tokens[2:], "IF", "EXISTS"); len(rest) == 1 {
+			for _, table := range tables {
+				delete(table.Indexes, unquoteIdentifier(rest[0]))
+			}
+			return nil
+		}
+		return fmt.Errorf("cannot follow %q", stmt)
+	}
+	return nil
+}
+
+func replayCreateTable(tables map[string]tableState, tokens []string) error {
+	if len(tokens) == 0 {
+		return fmt.Errorf("CREATE TABLE without a name")
+	}
+	name, body := splitNameAndGroup(tokens[0])
+	rest := tokens[1:]
+	if body == "" && len(rest) > 0 {
+		body, rest = rest[0], rest[1:]
+	}
+	name = unquoteIdentifier(name)
+	if !strings.HasPrefix(body, "(") {
+		return fmt.Errorf("CREATE TABLE `%s` has no column list", name)
+	}
+	table := tableState{
+		Columns:     map[string]columnState{},
+		Indexes:     map[string]indexState{},
+		ForeignKeys: map[string]foreignKeyState{},
+		PrimaryKeys: make([]string, 0),
+	}
+	// A column annotated by Options.AnnotateCreateOnly carries the note
+	// after its comma.
+	lines := strings.Split(groupContent(body), "\n")
+	createOnly := map[string]bool{}
+	for i, line := range lines {
+		code, comment := cutLineComment(line)
+		lines[i] = code
+		if strings.TrimSpace("--"+comment) == createOnlyComment {
+			if def := tokenizeDefinition(code); len(def) > 0 {
+				createOnly[unquoteIdentifier(def[0])] = true
+			}
+		}
+	}
+	for _, element := range splitTopLevel(strings.Join(lines, "\n")) {
+		def := tokenizeDefinition(element)
+		switch {
+		case hasKeywords(def, "PRIMARY", "KEY") && len(def) > 2:
+			table.PrimaryKeys = identifierList([]string{groupContent(def[2])})
+		case hasKeywords(def, "CONSTRAINT") || hasKeywords(def, "FOREIGN", "KEY"):
+			fkName, fk, err := parseForeignKey(def)
+			if err != nil {
+				return fmt.Errorf("table `%s`: %w", name, err)
+			}
+			table.ForeignKeys[fkName] = fk
+		case isIndexKeyword(def[0]):
+			idxName, idx, err := parseIndexDefinition(def)
+			if err != nil {
+				return fmt.Errorf("table `%s`: %w", name, err)
+			}
+			table.Indexes[idxName] = idx
+		default:
+			col := unquoteIdentifier(def[0])
+			table.Columns[col] = replayedColumn(def[1:])
+			if containsKeywords(def[1:], "PRIMARY", "KEY") {
+				table.PrimaryKeys = []string{col}
+			}
+			if createOnly[col] {
+				state := table.Columns[col]
+				state.CreateOnly = true
+				table.Columns[col] = state
+			}
+			table.ColumnOrder = append(table.ColumnOrder, col)
+		}
+	}
+	if err := applyTableOptions(&table, rest, false); err != nil {
+		return fmt.Errorf("table `%s`: %w", name, err)
+	}
+	tables[name] = table
+	return nil
+}
+
+func replayAlterTable(tables map[string]tableState, name string, clauses []string) error {
+	table, err := replayedTable(tables, name)
+	if err != nil {
+		return err
+	}
+	for _, clause := range clauses {
+		c := tokenizeDefinition(clause)
+		if len(c) < 2 {
+			if err := applyTableOptions(&table, c, true); err != nil {
+				return fmt.Errorf("table `%s`: %w", name, err)
+			}
+			continue
+		}
+		switch strings.ToUpper(c[0]) {
+		case "ADD":
+			err = replayAdd(&table, c[1:])
+		case "DROP":
+			err = replayDrop(&table, c[1:])
+		case "MODIFY":
+			c = skipKeywords(c[1:], "COLUMN")
+			if len(c) < 2 {
+				return fmt.Errorf("table `%s`: cannot follow %q", name, clause)
+			}
+			err = replaceColumn(tables, name, &table, unquoteIdentifier(c[0]), unquoteIdentifier(c[0]), c[1:])
+		case "CHANGE":
+			c = skipKeywords(c[1:], "COLUMN")
+			if len(c) < 3 {
+				return fmt.Errorf("table `%s`: cannot follow %q", name, clause)
+			}
+			err = replaceColumn(tables, name, &table, unquoteIdentifier(c[0]), unquoteIdentifier(c[1]), c[2:])
+		case "RENAME":
+			switch {
+			case hasKeywords(c[1:], "COLUMN") && len(c) == 5:
+				col := unquoteIdentifier(c[2])
+				if _, ok := table.Columns[col]; !ok {
+					return fmt.Errorf("table `%s` has no column `%s` to rename", name, col)
+				}
+				renameColumn(tables, name, &table, col, unquoteIdentifier(c[4]))
+			case (hasKeywords(c[1:], "INDEX") || hasKeywords(c[1:], "KEY")) && len(c) == 5:
+				from, to := unquoteIdentifier(c[2]), unquoteIdentifier(c[4])
+				idx, ok := table.Indexes[from]
+				if !ok {
+					return fmt.Errorf("table `%s` has no index `%s` to rename", name, from)
+				}
+				delete(table.Indexes, from)
+				table.Indexes[to] = idx
+			default:
+				rest := skipKeywords(skipKeywords(c[1:], "TO"), "AS")
+				if len(rest) != 1 {
+					return fmt.Errorf("table `%s`: cannot follow %q", name, clause)
+				}
+				to := unquoteIdentifier(rest[0])
+				tables[name] = table
+				if err := renameTable(tables, name, to); err != nil {
+					return err
+				}
+				name, table = to, tables[to]
+			}
+		case "ALTER":
+			err = replayAlterColumnDefault(&table, skipKeywords(c[1:], "COLUMN"))
+		default:
+			err = applyTableOptions(&table, c, true)
+		}
+		if err != nil {
+			return fmt.Errorf("table `%s`: %w", name, err)
+		}
+	}
+	tables[name] = table
+	return nil
+}
+
+func replayAdd(table *tableState, c []string) error {
+	switch {
+	case hasKeywords(c, "CONSTRAINT") || hasKeywords(c, "FOREIGN"):
+		name, fk, err := parseForeignKey(c)
+		if err != nil {
+			return err
+		}
+		table.ForeignKeys[name] = fk
+	case hasKeywords(c, "PRIMARY", "KEY") && len(c) > 2:
+		table.PrimaryKeys = identifierList([]string{groupContent(c[2])})
+	case isIndexKeyword(c[0]):
+		name, idx, err := parseIndexDefinition(c)
+		if err != nil {
+			return err
+		}
+		table.Indexes[name] = idx
+	case hasKeywords(c, "CHECK") || hasKeywords(c, "PARTITION"):
+		return fmt.Errorf("cannot follow ADD %s", strings.Join(c, " "))
+	default:
+		c = skipKeywords(c, "COLUMN")
+		if len(c) < 2 {
+			return fmt.Errorf("cannot follow ADD %s", strings.Join(c, " "))
+		}
+		col := unquoteIdentifier(c[0])
+		def, first, after := cutColumnPlacement(c[1:])
+		table.Columns[col] = replayedColumn(def)
+		table.ColumnOrder = reorderColumn(table.ColumnOrder, col, first, after)
+	}
+	return nil
+}
+
+func replayDrop(table *tableState, c []string) error {
+	switch {
+	case hasKeywords(c, "PRIMARY", "KEY"):
+		table.PrimaryKeys = make([]string, 0)
+	case hasKeywords(c, "FOREIGN", "KEY") && len(c) == 3:
+		delete(table.ForeignKeys, unquoteIdentifier(c[2]))
+	case (hasKeywords(c, "INDEX") || hasKeywords(c, "KEY")) && len(c) == 2:
+		delete(table.Indexes, unquoteIdentifier(c[1]))
+	default:
+		c = skipKeywords(c, "COLUMN")
+		if len(c) != 1 {
+			return fmt.Errorf("cannot follow DROP %s", strings.Join(c, " "))
+		}
+		dropColumn(table, unquoteIdentifier(c[0]))
+	}
+	return nil
+}
+
+// replaceColumn replays MODIFY COLUMN and CHANGE COLUMN, which restate the
+// whole definition and may move the column.
+func replaceColumn(tables map[string]tableState, tableName string, table *tableState, from, to string, tokens []string) error {
+	prev, ok := table.Columns[from]
+	if !ok {
+		return fmt.Errorf("table `%s` has no column `%s`", tableName, from)
+	}
+	if from != to {
+		renameColumn(tables, tableName, table, from, to)
+	}
+	def, first, after := cutColumnPlacement(tokens)
+	col := replayedColumn(def)
+	col.CreateOnly = prev.CreateOnly
+	table.Columns[to] = col
+	if first || after != "" {
+		table.ColumnOrder = reorderColumn(table.ColumnOrder, to, first, after)
+	}
+	return nil
+}
+
+func replayAlterColumnDefault(table *tableState, c []string) error {
+	if len(c) < 3 {
+		return fmt.Errorf("cannot follow ALTER COLUMN %s", strings.Join(c, " "))
+	}
+	name := unquoteIdentifier(c[0])
+	col, ok := table.Columns[name]
+	if !ok {
+		return fmt.Errorf("no column `%s`", name)
+	}
+	definition := withoutDefault(col.Definition)
+	switch {
+	case hasKeywords(c[1:], "DROP", "DEFAULT"):
+	case hasKeywords(c[1:], "SET", "DEFAULT") && len(c) == 4:
+		// GORM writes DEFAULT after NOT NULL and before COMMENT.
+		tokens := tokenizeDefinition(definition)
+		at := len(tokens)
+		for i, token := range tokens {
+			if i > 0 && strings.EqualFold(token, "COMMENT") {
+				at = i
+				break
+			}
+		}
+		tokens = append(tokens[:at], append([]string{"DEFAULT", c[3]}, tokens[at:]...)...)
+		definition = strings.Join(tokens, " ")
+	default:
+		return fmt.Errorf("cannot follow ALTER COLUMN %s", strings.Join(c, " "))
+	}
+	col.Definition = definition
+	table.Columns[name] = col
+	return nil
+}
+
+func replayCreateIndex(tables map[string]tableState, tokens []string) error {
+	// tokens is "[class] INDEX name ON table (fields) ...". It becomes
+	// "[class] INDEX name (fields) ..." for parseIndexDefinition.
+	on := -1
+	for i, token := range tokens {
+		if strings.EqualFold(token, "ON") {
+			on = i
+			break
+		}
+	}
+	if on < 0 || on+1 >= len(tokens) {
+		return fmt.Errorf("CREATE INDEX without a table")
+	}
+	tableName, fields := splitNameAndGroup(tokens[on+1])
+	rest := tokens[on+2:]
+	if fields != "" {
+		rest = append([]string{fields}, rest...)
+	}
+	def := append(removeKeywords(tokens[:on], "IF", "NOT", "EXISTS"), rest...)
+	table, err := replayedTable(tables, unquoteIdentifier(tableName))
+	if err != nil {
+		return err
+	}
+	name, idx, err := parseIndexDefinition(def)
+	if err != nil {
+		return err
+	}
+	table.Indexes[name] = idx
+	return nil
+}
+
+// parseIndexDefinition parses "[UNIQUE|FULLTEXT|SPATIAL] [KEY|INDEX] name
+// (fields) [USING type] [COMMENT 'text'] [option]".
+func parseIndexDefinition(tokens []string) (string, indexState, error) {
+	idx := indexState{}
+	i := 0
+	if i < len(tokens) && indexClassPrefix(tokens[i]) != "" {
+		idx.Class = normalizeIndexClass(tokens[i])
+		i++
+	}
+	if i < len(tokens) && (strings.EqualFold(tokens[i], "KEY") || strings.EqualFold(tokens[i], "INDEX")) {
+		i++
+	}
+	if i >= len(tokens) {
+		return "", idx, fmt.Errorf("index without a name")
+	}
+	name, fields := splitNameAndGroup(tokens[i])
+	i++
+	if fields == "" && i < len(tokens) {
+		fields = tokens[i]
+		i++
+	}
+	name = unquoteIdentifier(name)
+	if !strings.HasPrefix(fields, "(") {
+		return "", idx, fmt.Errorf("index `%s` has no key parts", name)
+	}
+	for _, part := range splitTopLevel(groupContent(fields)) {
+		field, err := parseIndexField(tokenizeDefinition(part))
+		if err != nil {
+			return "", idx, fmt.Errorf("index `%s`: %w", name, err)
+		}
+		idx.Fields = append(idx.Fields, field)
+	}
+	options := make([]string, 0)
+	for ; i < len(tokens); i++ {
+		switch {
+		case strings.EqualFold(tokens[i], "USING") && i+1 < len(tokens):
+			idx.Type = tokens[i+1]
+			i++
+		case strings.EqualFold(tokens[i], "COMMENT") && i+1 < len(tokens):
+			idx.Comment = unquoteSQLString(tokens[i+1])
+			i++
+		default:
+			options = append(options, tokens[i])
+		}
+	}
+	idx.Option = normalizeIndexOption(strings.Join(options, " "))
+	return name, normalizeIndex(idx), nil
+}
+
+func parseIndexField(tokens []string) (indexFieldState, error) {
+	field := indexFieldState{}
+	if len(tokens) == 0 {
+		return field, fmt.Errorf("empty key part")
+	}
+	if strings.HasPrefix(tokens[0], "(") {
+		field.Expression = strings.TrimSpace(groupContent(tokens[0]))
+	} else {
+		name, length := splitNameAndGroup(tokens[0])
+		field.Column = unquoteIdentifier(name)
+		if length != "" {
+			n, err := strconv.Atoi(strings.TrimSpace(groupContent(length)))
+			if err != nil {
+				return field, fmt.Errorf("key part %s has an invalid prefix length", tokens[0])
+			}
+			field.Length = n
+		}
+	}
+	for i := 1; i < len(tokens); i++ {
+		switch strings.ToUpper(tokens[i]) {
+		case "COLLATE":
+			if i+1 < len(tokens) {
+				field.Collate = tokens[i+1]
+				i++
+			}
+		case "ASC", "DESC":
+			field.Sort = strings.ToUpper(tokens[i])
+		default:
+			return field, fmt.Errorf("cannot follow key part %s", strings.Join(tokens, " "))
+		}
+	}
+	return field, nil
+}
+
+// parseForeignKey parses "[CONSTRAINT name] FOREIGN KEY (columns) REFERENCES
+// table (columns) [ON DELETE action] [ON UPDATE action]".
+func parseForeignKey(tokens []string) (string, foreignKeyState, error) {
+	fk := foreignKeyState{}
+	name := ""
+	if hasKeywords(tokens, "CONSTRAINT") && len(tokens) > 1 {
+		name = unquoteIdentifier(tokens[1])
+		tokens = tokens[2:]
+	}
+	if !hasKeywords(tokens, "FOREIGN", "KEY") || len(tokens) < 5 {
+		return "", fk, fmt.Errorf("cannot follow foreign key %s", strings.Join(tokens, " "))
+	}
+	if name == "" {
+		return "", fk, fmt.Errorf("foreign key %s has no constraint name", strings.Join(tokens, " "))
+	}
+	fk.Columns = identifierList([]string{groupContent(tokens[2])})
+	if !strings.EqualFold(tokens[3], "REFERENCES") {
+		return "", fk, fmt.Errorf("foreign key `%s` has no REFERENCES clause", name)
+	}
+	refTable, refColumns := splitNameAndGroup(tokens[4])
+	rest := tokens[5:]
+	if refColumns == "" && len(rest) > 0 {
+		refColumns, rest = rest[0], rest[1:]
+	}
+	fk.RefTable = unquoteIdentifier(refTable)
+	fk.RefColumns = identifierList([]string{groupContent(refColumns)})
+	for i := 0; i+1 < len(rest); {
+		if !strings.EqualFold(rest[i], "ON") {
+			return "", fk, fmt.Errorf("foreign key `%s`: cannot follow %s", name, strings.Join(rest[i:], " "))
+		}
+		event := strings.ToUpper(rest[i+1])
+		end := i + 2
+		for end < len(rest) && !strings.EqualFold(rest[end], "ON") {
+			end++
+		}
+		action := strings.Join(rest[i+2:end], " ")
+		switch event {
+		case "DELETE":
+			fk.OnDelete = action
+		case "UPDATE":
+			fk.OnUpdate = action
+		default:
+			return "", fk, fmt.Errorf("foreign key `%s`: unknown ON %s", name, event)
+		}
+		i = end
+	}
+	return name, normalizeForeignKey(fk), nil
+}
+
+// applyTableOptions replays table options such as ENGINE=InnoDB, DEFAULT
+// CHARSET=utf8mb4, COLLATE = x, COMMENT='text' and TABLESPACE x. Options the
+// state has no room for are skipped; strict rejects unknown ones, since in
+// an ALTER TABLE they may be a clause that changes the schema.
+func applyTableOptions(table *tableState, tokens []string, strict bool) error {
+	tokens = splitOptionAssignments(tokens)
+	for i := 0; i < len(tokens); {
+		key := strings.ToUpper(tokens[i])
+		i++
+		switch key {
+		case "DEFAULT", "CONVERT", "TO", "=":
+			continue
+		case "FORCE":
+			continue
+		case "CHARACTER":
+			if i < len(tokens) && strings.EqualFold(tokens[i], "SET") {
+				i++
+			}
+			key = "CHARSET"
+		}
+		if i < len(tokens) && tokens[i] == "=" {
+			i++
+		}
+		if i >= len(tokens) {
+			return fmt.Errorf("table option %s has no value", key)
+		}
+		value := tokens[i]
+		i++
+		switch key {
+		case "ENGINE":
+			table.Engine = value
+		case "CHARSET":
+			table.Charset = value
+		case "COLLATE":
+			table.Collation = value
+		case "COMMENT":
+			table.Comment = unquoteSQLString(value)
+		case "TABLESPACE":
+			table.Tablespace = unquoteIdentifier(value)
+		case "AUTO_INCREMENT", "ROW_FORMAT", "KEY_BLOCK_SIZE", "ALGORITHM", "LOCK":
+		default:
+			if strict {
+				return fmt.Errorf("cannot follow %s %s", key, value)
+			}
+		}
+	}
+	return nil
+}
+
+// splitOptionAssignments splits tokens such as ENGINE=InnoDB into ENGINE, =
+// and InnoDB.
+func splitOptionAssignments(tokens []string) []string {
+	out := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		key, value, ok := strings.Cut(token, "=")
+		if !ok || strings.ContainsAny(key, "'\"`(") {
+			out = append(out, token)
+			continue
+		}
+		if key != "" {
+			out = append(out, key)
+		}
+		out = append(out, "=")
+		if value != "" {
+			out = append(out, value)
+		}
+	}
+	return out
+}
+
+func replayedTable(tables map[string]tableState, name string) (tableState, error) {
+	table, ok := tables[name]
+	if !ok {
+		return table, fmt.Errorf("table `%s` is altered before it is created", name)
+	}
+	if table.Indexes == nil {
+		table.Indexes = map[string]indexState{}
+	}
+	if table.ForeignKeys == nil {
+		table.ForeignKeys = map[string]foreignKeyState{}
+	}
+	return table, nil
+}
+
+func replayedColumn(tokens []string) columnState {
+	definition := normalizeDefinition(strings.Join(tokens, " "))
+	return columnState{
+		Definition:       definition,
+		Comment:          definitionComment(definition),
+		Generated:        generatedColumnExpression(definition),
+		GeneratedStorage: generatedColumnStorage(definition),
+	}
+}
+
+// renameTable moves a table and the foreign keys that reference it.
+func renameTable(tables map[string]tableState, from, to string) error {
+	table, ok := tables[from]
+	if !ok {
+		return fmt.Errorf("table `%s` is renamed before it is created", from)
+	}
+	delete(tables, from)
+	tables[to] = table
+	for _, other := range tables {
+		for name, fk := range other.ForeignKeys {
+			if fk.RefTable == from {
+				fk.RefTable = to
+				other.ForeignKeys[name] = fk
+			}
+		}
+	}
+	return nil
+}
+
+// renameColumn renames a column together with the keys, indexes and
+// foreign keys that cover it, as MySQL does.
+func renameColumn(tables map[string]tableState, tableName string, table *tableState, from, to string) {
+	table.Columns[to] = table.Columns[from]
+	delete(table.Columns, from)
+	rename := func(cols []string) {
+		for i, col := range cols {
+			if col == from {
+				cols[i] = to
+			}
+		}
+	}
+	rename(table.PrimaryKeys)
+	rename(table.ColumnOrder)
+	for _, idx := range table.Indexes {
+		for i := range idx.Fields {
+			if idx.Fields[i].Column == from {
+				idx.Fields[i].Column = to
+			}
+		}
+	}
+	for _, fk := range table.ForeignKeys {
+		rename(fk.Columns)
+	}
+	for name, other := range tables {
+		if name == tableName {
+			continue
+		}
+		for _, fk := range other.ForeignKeys {
+			if fk.RefTable == tableName {
+				rename(fk.RefColumns)
+			}
+		}
+	}
+	for _, fk := range table.ForeignKeys {
+		if fk.RefTable == tableName {
+			rename(fk.RefColumns)
+		}
+	}
+}
+
+// dropColumn removes a column and its key parts; an index left without
+// key parts goes with it, as in MySQL.
+func dropColumn(table *tableState, col string) {
+	delete(table.Columns, col)
+	table.PrimaryKeys = removeString(table.PrimaryKeys, col)
+	table.ColumnOrder = removeString(table.ColumnOrder, col)
+	for name, idx := range table.Indexes {
+		fields := make([]indexFieldState, 0, len(idx.Fields))
+		for _, field := range idx.Fields {
+			if field.Column != col {
+				fields = append(fields, field)
+			}
+		}
+		if len(fields) == 0 {
+			delete(table.Indexes, name)
+			continue
+		}
+		idx.Fields = fields
+		table.Indexes[name] = idx
+	}
+}
+
+// cutColumnPlacement splits a trailing FIRST or AFTER column off a column
+// definition.
+func cutColumnPlacement(tokens []string) ([]string, bool, string) {
+	n := len(tokens)
+	if n > 1 && strings.EqualFold(tokens[n-1], "FIRST") {
+		return tokens[:n-1], true, ""
+	}
+	if n > 2 && strings.EqualFold(tokens[n-2], "AFTER") {
+		return tokens[:n-2], false, unquoteIdentifier(tokens[n-1])
+	}
+	return tokens, false, ""
+}
+
+// reorderColumn moves col to the front of order, after another column or,
+// when neither is given, to the end.
+func reorderColumn(order []string, col string, first bool, after string) []string {
+	order = removeString(order, col)
+	switch {
+	case first:
+		return append([]string{col}, order...)
+	case after != "":
+		for i, existing := range order {
+			if existing == after {
+				return append(order[:i+1], append([]string{col}, order[i+1:]...)...)
+			}
+		}
+	}
+	return append(order, col)
+}
+
+func removeString(values []string, value string) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != value {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func isIndexKeyword(token string) bool {
+	switch strings.ToUpper(token) {
+	case "KEY", "INDEX", "UNIQUE", "FULLTEXT", "SPATIAL":
+		return true
+	default:
+		return false
+	}
+}
+
+// hasKeywords reports whether tokens start with keywords, in any case.
+func hasKeywords(tokens []string, keywords ...string) bool {
+	if len(tokens) < len(keywords) {
+		return false
+	}
+	for i, keyword := range keywords {
+		if !strings.EqualFold(tokens[i], keyword) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsKeywords reports whether keywords appear in tokens in a row, in
+// any case.
+func containsKeywords(tokens []string, keywords ...string) bool {
+	for i := range tokens {
+		if hasKeywords(tokens[i:], keywords...) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipKeywords drops the leading keywords of tokens that match keywords in
+// order, e.g. the IF NOT EXISTS of CREATE TABLE IF NOT EXISTS.
+func skipKeywords(tokens []string, keywords ...string) []string {
+	if hasKeywords(tokens, keywords...) {
+		return tokens[len(keywords):]
+	}
+	return tokens
+}
+
+// removeKeywords drops keywords wherever they appear in tokens.
+func removeKeywords(tokens []string, keywords ...string) []string {
+	out := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		keep := true
+		for _, keyword := range keywords {
+			if strings.EqualFold(token, keyword) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			out = append(out, token)
+		}
+	}
+	return out
+}
+
+// identifierList unquotes a comma-separated list of identifiers spread over
+// tokens.
+func identifierList(tokens []string) []string {
+	names := make([]string, 0)
+	for _, part := range splitTopLevel(strings.Join(tokens, " ")) {
+		names = append(names, unquoteIdentifier(part))
+	}
+	return names
+}
+
+func unquoteIdentifier(name string) string {
+	name = strings.TrimSpace(name)
+	if len(name) >= 2 && (name[0] == '`' || name[0] == '"') && name[len(name)-1] == name[0] {
+		q := name[:1]
+		return strings.ReplaceAll(name[1:len(name)-1], q+q, q)
+	}
+	return name
+}
+
+// splitNameAndGroup splits a token such as `t`(`id`) or `name`(10) into
+// the name and the parenthesized group that follows it without a space.
+func splitNameAndGroup(token string) (string, string) {
+	start := 0
+	if len(token) > 0 && (token[0] == '`' || token[0] == '"') {
+		if end := strings.IndexByte(token[1:], token[0]); end >= 0 {
+			start = end + 2
+		}
+	}
+	if i := strings.IndexByte(token[start:], '('); i > 0 || (i == 0 && start > 0) {
+		return token[:start+i], token[start+i:]
+	}
+	return token, ""
+}
+
+// groupContent returns what a parenthesized token encloses.
+func groupContent(group string) string {
+	group = strings.TrimSpace(group)
+	if strings.HasPrefix(group, "(") && strings.HasSuffix(group, ")") {
+		return group[1 : len(group)-1]
+	}
+	return group
+}
+
+// splitTopLevel splits s on the commas outside parentheses, quoted strings
+// and quoted identifiers, and trims the parts.
+func splitTopLevel(s string) []string {
+	parts := make([]string, 0)
+	depth := 0
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	parts = append(parts, s[start:])
+	out := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// cutLineComment splits a line at a -- comment outside quotes.
+func cutLineComment(line string) (string, string) {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '-' && i+1 < len(line) && line[i+1] == '-':
+			return line[:i], line[i+2:]
+		}
+	}
+	return line, ""
+}
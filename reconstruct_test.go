@@ -0,0 +1,157 @@
+package gomigration
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type reconstructUser struct {
+	ID      uint   `gorm:"primaryKey"`
+	Name    string `gorm:"size:64;not null;comment:display name"`
+	Email   string `gorm:"size:191;uniqueIndex"`
+	Status  string `gorm:"size:16;default:'active'"`
+	Created int64  `gorm:"<-:create"`
+}
+
+func (reconstructUser) TableName() string { return "reconstruct_users" }
+
+func (reconstructUser) TableOptions() TableOptions {
+	return TableOptions{Engine: "InnoDB", Comment: "people's accounts"}
+}
+
+type reconstructOrder struct {
+	ID     uint            `gorm:"primaryKey"`
+	UserID uint            `gorm:"index:idx_reconstruct_orders_user_total,priority:1"`
+	Total  int             `gorm:"index:idx_reconstruct_orders_user_total,priority:2,sort:desc"`
+	User   reconstructUser `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+}
+
+func (reconstructOrder) TableName() string { return "reconstruct_orders" }
+
+type reconstructUserV2 struct {
+	ID          uint   `gorm:"primaryKey"`
+	DisplayName string `gorm:"size:64;not null;comment:display name;renamed_from:name"`
+	Email       string `gorm:"size:191;uniqueIndex"`
+	Status      string `gorm:"size:16;default:'pending'"`
+	Created     int64  `gorm:"<-:create"`
+	Bio         string `gorm:"size:255;index:,length:32"`
+}
+
+func (reconstructUserV2) TableName() string { return "reconstruct_users" }
+
+func (reconstructUserV2) TableOptions() TableOptions {
+	return TableOptions{Engine: "InnoDB", Comment: "people's accounts"}
+}
+
+func assertReconstructedState(t *testing.T, dir, stateFile string) {
+	t.Helper()
+	want, err := loadState(stateFile)
+	if err != nil {
+		t.Fatalf("loadState failed: %v", err)
+	}
+	got, err := ReconstructState(dir)
+	if err != nil {
+		t.Fatalf("ReconstructState failed: %v", err)
+	}
+	wantJSON, _ := json.MarshalIndent(want, "", "  ")
+	gotJSON, _ := json.MarshalIndent(got, "", "  ")
+	if string(gotJSON) != string(wantJSON) {
+		t.Fatalf("reconstructed state differs from the saved one:\n%s\n---\n%s", gotJSON, wantJSON)
+	}
+}
+
+func TestReconstructStateReplaysMigrations(t *testing.T) {
+	dir := t.TempDir()
+	stateFile := filepath.Join(dir, ".schema_state.json")
+	opts := Options{AnnotateCreateOnly: true, TrackColumnOrder: true, ColumnOrdering: ColumnOrderingDeclared}
+
+	opts.Version = "1"
+	if _, err := MakeMigrationsWithOptions([]any{&reconstructUser{}, &reconstructOrder{}}, dir, "init", "", opts); err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	assertReconstructedState(t, dir, stateFile)
+
+	opts.Version = "2"
+	if _, err := MakeMigrationsWithOptions([]any{&reconstructUserV2{}, &reconstructOrder{}}, dir, "profile", "", opts); err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	assertReconstructedState(t, dir, stateFile)
+
+	opts.Version = "3"
+	if _, err := MakeMigrationsWithOptions([]any{&reconstructUserV2{}}, dir, "drop_orders", "", opts); err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	assertReconstructedState(t, dir, stateFile)
+
+	// With the state file gone, the rebuilt one lets the next migration
+	// start where the history ends.
+	if err := os.Remove(stateFile); err != nil {
+		t.Fatalf("remove state failed: %v", err)
+	}
+	if _, err := SyncSchemaStateFromMigrations(dir, ""); err != nil {
+		t.Fatalf("SyncSchemaStateFromMigrations failed: %v", err)
+	}
+	result, err := MakeMigrationsWithOptions([]any{&reconstructUserV2{}}, dir, "noop", "", Options{Version: "4"})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	if result.Changed {
+		t.Fatalf("expected no changes after reconstructing the state, got %s", readMigration(t, result.UpPath))
+	}
+}
+
+func TestReconstructStateHandWrittenDDL(t *testing.T) {
+	dir := t.TempDir()
+	writeMigrationPair(t, dir, "1_init", []string{
+		"CREATE TABLE IF NOT EXISTS accounts(\n  id bigint unsigned AUTO_INCREMENT, -- surrogate key\n  `email` varchar(191) NOT NULL,\n  PRIMARY KEY (id),\n  UNIQUE KEY uk_email(email)\n) ENGINE = InnoDB DEFAULT CHARSET=utf8mb4;",
+		"INSERT INTO accounts (email) VALUES ('a@example.com');",
+	}, nil)
+	writeMigrationPair(t, dir, "2_more", []string{
+		"ALTER TABLE accounts ADD COLUMN nickname varchar(32) AFTER id, ADD INDEX idx_nickname (nickname(8)), RENAME INDEX uk_email TO uk_accounts_email;",
+		"ALTER TABLE accounts ALTER COLUMN nickname SET DEFAULT 'anon';",
+		"RENAME TABLE accounts TO members;",
+	}, nil)
+
+	state, err := ReconstructState(dir)
+	if err != nil {
+		t.Fatalf("ReconstructState failed: %v", err)
+	}
+	table, ok := state.Tables["members"]
+	if !ok || len(state.Tables) != 1 {
+		t.Fatalf("expected only the renamed table, got %v", sortedKeys(state.Tables))
+	}
+	if got := strings.Join(table.ColumnOrder, ","); got != "id,nickname,email" {
+		t.Fatalf("unexpected column order %s", got)
+	}
+	if got := table.Columns["nickname"].Definition; got != "varchar(32) DEFAULT 'anon'" {
+		t.Fatalf("unexpected nickname definition %q", got)
+	}
+	if _, ok := table.Indexes["uk_accounts_email"]; !ok || table.Indexes["idx_nickname"].Fields[0].Length != 8 {
+		t.Fatalf("unexpected indexes %#v", table.Indexes)
+	}
+	if table.Engine != "InnoDB" || table.Charset != "utf8mb4" || strings.Join(table.PrimaryKeys, ",") != "id" {
+		t.Fatalf("unexpected table options %#v", table)
+	}
+
+	writeMigrationPair(t, dir, "3_check", []string{"ALTER TABLE members ADD CHECK (id > 0);"}, nil)
+	if _, err := ReconstructState(dir); err == nil || !strings.Contains(err.Error(), "3_check.up.sql: table `members`") {
+		t.Fatalf("expected an unsupported clause to be reported, got %v", err)
+	}
+}
+
+func TestReconstructStateRejectsWhatItCannotFollow(t *testing.T) {
+	for _, stmt := range []string{
+		"ALTER TABLE accounts RENAME TO;",
+		`COMMENT ON COLUMN "accounts"."id" IS 'key';`,
+	} {
+		dir := t.TempDir()
+		writeMigrationPair(t, dir, "1_init", []string{"CREATE TABLE accounts (id bigint);", stmt}, nil)
+		_, err := ReconstructState(dir)
+		if err == nil || !strings.Contains(err.Error(), "cannot follow") || !strings.Contains(err.Error(), "MySQL and SQLite DDL only") {
+			t.Fatalf("expected %q to be rejected, got %v", stmt, err)
+		}
+	}
+}
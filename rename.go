@@ -0,0 +1,245 @@
+package gomigration
+
+// renameColumnOps turns the column renames of a table into CHANGE COLUMN ops
+// and returns prev as it looks after the renames. MySQL carries renamed
+// columns through indexes, foreign keys and the primary key on its own, so
+// the renamed state references the new names everywhere and later diffs do
+// not recreate them.
+func renameColumnOps(tableName string, prev, cur tableState, opts Options) ([]migrationOp, tableState) {
+	em := opts.emitter()
+	renames := columnRenames(tableName, prev, cur, opts)
+	ops := make([]migrationOp, 0)
+	for _, oldName := range sortedKeys(renames) {
+		newName := renames[oldName]
+		col := prev.Columns[oldName]
+		ops = append(ops, migrationOp{
+			kind:  opRenameColumn,
+			table: tableName,
+			name:  newName,
+			up:    em.RenameColumn(tableName, oldName, ColumnDefinition{Name: newName, Definition: col.Definition}),
+			down:  em.RenameColumn(tableName, newName, ColumnDefinition{Name: oldName, Definition: col.Definition}),
+			apply: renameColumnChange(tableName, oldName, newName),
+		})
+		prev = renameColumnInTable(cloneTableState(prev), oldName, newName)
+	}
+	return ops, prev
+}
+
+// columnRenames maps old to new column names for a table. A hint is
+// ignored once the old column is gone, which keeps it harmless after the
+// rename has been applied. Hints from
+// Options.RenameColumns win over renamed_from tags, and both over renames
+// found by DetectRenames.
+func columnRenames(tableName string, prev, cur tableState, opts Options) map[string]string {
+	renames := map[string]string{}
+	targets := map[string]bool{}
+	add := func(oldName, newName string) {
+		if _, ok := renames[oldName]; ok || targets[newName] {
+			return
+		}
+		if _, ok := prev.Columns[oldName]; !ok || newName == "" || newName == oldName {
+			return
+		}
+		if _, exists := prev.Columns[newName]; exists {
+			return
+		}
+		if _, wanted := cur.Columns[newName]; !wanted {
+			return
+		}
+		renames[oldName] = newName
+		targets[newName] = true
+	}
+	for _, oldName := range sortedKeys(opts.RenameColumns[tableName]) {
+		add(oldName, opts.RenameColumns[tableName][oldName])
+	}
+	for _, newName := range sortedKeys(cur.Columns) {
+		if oldName := cur.Columns[newName].RenamedFrom; oldName != "" {
+			add(oldName, newName)
+		}
+	}
+	if !opts.DetectRenames {
+		return renames
+	}
+
+	dropped := make([]string, 0)
+	added := make([]string, 0)
+	for _, col := range sortedKeys(prev.Columns) {
+		if _, kept := cur.Columns[col]; !kept && renames[col] == "" {
+			dropped = append(dropped, col)
+		}
+	}
+	for _, col := range sortedKeys(cur.Columns) {
+		if _, existed := prev.Columns[col]; !existed && !targets[col] {
+			added = append(added, col)
+		}
+	}
+	matches := func(candidates []string, def string, defs map[string]columnState) []string {
+		out := make([]string, 0, 1)
+		for _, col := range candidates {
+			if opts.columnEqual(def, defs[col].Definition) {
+				out = append(out, col)
+			}
+		}
+		return out
+	}
+	for _, oldName := range dropped {
+		def := prev.Columns[oldName].Definition
+		newNames := matches(added, def, cur.Columns)
+		if len(newNames) != 1 || len(matches(dropped, def, prev.Columns)) != 1 {
+			continue
+		}
+		add(oldName, newNames[0])
+	}
+	return renames
+}
+
+func renameColumnChange(tableName, oldName, newName string) func(map[string]tableState) {
+	return func(tables map[string]tableState) {
+		tables[tableName] = renameColumnInTable(tables[tableName], oldName, newName)
+	}
+}
+
+// renameColumnInTable rewrites every reference to oldName in table. It
+// modifies the table's maps in place.
+func renameColumnInTable(table tableState, oldName, newName string) tableState {
+	rename := func(names []string) {
+		for i, name := range names {
+			if name == oldName {
+				names[i] = newName
+			}
+		}
+	}
+	if col, ok := table.Columns[oldName]; ok {
+		delete(table.Columns, oldName)
+		table.Columns[newName] = col
+	}
+	rename(table.ColumnOrder)
+	rename(table.PrimaryKeys)
+	for name, idx := range table.Indexes {
+		fields := append([]indexFieldState{}, idx.Fields...)
+		for i := range fields {
+			if fields[i].Column == oldName {
+				fields[i].Column = newName
+			}
+		}
+		idx.Fields = fields
+		table.Indexes[name] = idx
+	}
+	for name, fk := range table.ForeignKeys {
+		fk.Columns = append([]string{}, fk.Columns...)
+		rename(fk.Columns)
+		table.ForeignKeys[name] = fk
+	}
+	return table
+}
+
+// tableRenames maps previous table names to current ones: the renames of
+// Options.RenameTables that still apply, and the deprecation renames of
+// Options.DeprecateBeforeDrop.
+func tableRenames(previous, current schemaState, opts Options) map[string]string {
+	renames := map[string]string{}
+	if opts.DeprecateBeforeDrop {
+		renames = deprecationRenames(previous, current)
+	}
+	for _, from := range sortedKeys(opts.RenameTables) {
+		to := opts.RenameTables[from]
+		if _, ok := previous.Tables[from]; !ok || to == "" || to == from {
+			continue
+		}
+		if _, ok := current.Tables[from]; ok {
+			continue
+		}
+		if _, ok := previous.Tables[to]; ok {
+			continue
+		}
+		if _, ok := current.Tables[to]; ok {
+			renames[from] = to
+		}
+	}
+	return renames
+}
+
+// renameTableReferences returns state with foreign keys that reference
+// from pointing at to instead, as they do once the database renamed the
+// table.
+func renameTableReferences(state schemaState, from, to string) schemaState {
+	out := cloneSchemaState(state)
+	for _, table := range out.Tables {
+		renameReferencedTable(table, from, to)
+	}
+	return out
+}
+
+// renameReferencedTable modifies the table's foreign keys in place.
+func renameReferencedTable(table tableState, from, to string) {
+	for name, fk := range table.ForeignKeys {
+		if fk.RefTable == from {
+			fk.RefTable = to
+			table.ForeignKeys[name] = fk
+		}
+	}
+}
+
+// referencedColumnRenameOps handles foreign keys that reference a renamed
+// column: they are dropped before any table is altered and added back with
+// the new column name after all tables are. kept maps the current name of
+// every table that exists on both sides to its previous name. The returned
+// state has those foreign keys in their final form already, so the diffs of
+// their tables leave them alone.
+func referencedColumnRenameOps(previous, current schemaState, kept map[string]string, opts Options) ([]migrationOp, []migrationOp, schemaState) {
+	em := opts.emitter()
+	drops := make([]migrationOp, 0)
+	adds := make([]migrationOp, 0)
+	cloned := false
+	for _, refTable := range sortedKeys(kept) {
+		renames := columnRenames(refTable, previous.Tables[kept[refTable]], current.Tables[refTable], opts)
+		if len(renames) == 0 {
+			continue
+		}
+		for _, curName := range sortedKeys(kept) {
+			prevName := kept[curName]
+			for _, fkName := range sortedKeys(previous.Tables[prevName].ForeignKeys) {
+				fk := previous.Tables[prevName].ForeignKeys[fkName]
+				if fk.RefTable != refTable || !referencesAny(fk.RefColumns, renames) {
+					continue
+				}
+				if !cloned {
+					previous = cloneSchemaState(previous)
+					cloned = true
+				}
+				drops = append(drops, migrationOp{
+					kind:  opDropForeignKey,
+					table: curName,
+					name:  fkName,
+					up:    em.DropForeignKey(curName, fkName),
+					down:  em.AddForeignKey(curName, foreignKeyDefinitionOf(fkName, fk)),
+					apply: dropForeignKeyChange(curName, fkName),
+				})
+				target, ok := current.Tables[curName].ForeignKeys[fkName]
+				if !ok {
+					delete(previous.Tables[prevName].ForeignKeys, fkName)
+					continue
+				}
+				previous.Tables[prevName].ForeignKeys[fkName] = target
+				adds = append(adds, migrationOp{
+					kind:  opAddForeignKey,
+					table: curName,
+					name:  fkName,
+					up:    em.AddForeignKey(curName, foreignKeyDefinitionOf(fkName, target)),
+					down:  em.DropForeignKey(curName, fkName),
+					apply: setForeignKeyChange(curName, fkName, target),
+				})
+			}
+		}
+	}
+	return drops, adds, previous
+}
+
+func referencesAny(columns []string, renames map[string]string) bool {
+	for _, col := range columns {
+		if _, ok := renames[col]; ok {
+			return true
+		}
+	}
+	return false
+}
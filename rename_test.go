@@ -0,0 +1,298 @@
+package gomigration
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+type renameAuthor struct {
+	ID uint `gorm:"primaryKey"`
+}
+
+func (renameAuthor) TableName() string { return "rename_authors" }
+
+type renamePostBefore struct {
+	ID       uint         `gorm:"primaryKey"`
+	AuthorID uint         `gorm:"index:idx_rename_posts_author"`
+	Author   renameAuthor `gorm:"foreignKey:AuthorID;constraint:OnDelete:CASCADE"`
+}
+
+func (renamePostBefore) TableName() string { return "rename_posts" }
+
+type renamePostAfter struct {
+	ID       uint         `gorm:"primaryKey"`
+	WriterID uint         `gorm:"index:idx_rename_posts_author"`
+	Author   renameAuthor `gorm:"foreignKey:WriterID;constraint:OnDelete:CASCADE"`
+}
+
+func (renamePostAfter) TableName() string { return "rename_posts" }
+
+func TestRenameIndexedForeignKeyColumn(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := SyncSchemaState([]any{&renamePostBefore{}}, dir, ""); err != nil {
+		t.Fatalf("SyncSchemaState failed: %v", err)
+	}
+
+	opts := Options{
+		Version:       "20240101000000",
+		RenameColumns: map[string]map[string]string{"rename_posts": {"author_id": "writer_id"}},
+		SelfVerify:    true,
+	}
+	result, err := MakeMigrationsWithOptions([]any{&renamePostAfter{}}, dir, "rename_author", "", opts)
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	up, err := os.ReadFile(result.UpPath)
+	if err != nil {
+		t.Fatalf("read up failed: %v", err)
+	}
+	if string(up) != "-- operation 1\nALTER TABLE `rename_posts` CHANGE COLUMN `author_id` `writer_id` bigint unsigned;\n" {
+		t.Fatalf("expected only the rename, without index or foreign key churn, got:\n%s", up)
+	}
+	down, err := os.ReadFile(result.DownPath)
+	if err != nil {
+		t.Fatalf("read down failed: %v", err)
+	}
+	if string(down) != "-- operation 1\nALTER TABLE `rename_posts` CHANGE COLUMN `writer_id` `author_id` bigint unsigned;\n" {
+		t.Fatalf("unexpected down SQL:\n%s", down)
+	}
+
+	// The hint is stale once applied and must not produce anything further.
+	opts.Version = "20240102000000"
+	result, err = MakeMigrationsWithOptions([]any{&renamePostAfter{}}, dir, "again", "", opts)
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	if result.Changed {
+		t.Fatalf("expected no changes after the rename was recorded")
+	}
+}
+
+func TestRenameColumnInTableRewritesReferences(t *testing.T) {
+	table := tableState{
+		Columns:     map[string]columnState{"a": {Definition: "int"}, "b": {Definition: "int"}},
+		Indexes:     map[string]indexState{"idx_ab": {Fields: []indexFieldState{{Column: "a"}, {Column: "b"}}}},
+		ForeignKeys: map[string]foreignKeyState{"fk_a": {Columns: []string{"a"}, RefTable: "t", RefColumns: []string{"a"}}},
+		PrimaryKeys: []string{"a"},
+		ColumnOrder: []string{"a", "b"},
+	}
+	renamed := renameColumnInTable(cloneTableState(table), "a", "z")
+	if _, ok := renamed.Columns["z"]; !ok {
+		t.Fatalf("expected column z, got %v", renamed.Columns)
+	}
+	if renamed.Indexes["idx_ab"].Fields[0].Column != "z" || renamed.ForeignKeys["fk_a"].Columns[0] != "z" {
+		t.Fatalf("expected index and foreign key columns to be renamed, got %+v", renamed)
+	}
+	if renamed.ForeignKeys["fk_a"].RefColumns[0] != "a" {
+		t.Fatalf("expected referenced columns to stay untouched, got %+v", renamed.ForeignKeys["fk_a"])
+	}
+	if renamed.PrimaryKeys[0] != "z" || renamed.ColumnOrder[0] != "z" {
+		t.Fatalf("expected primary key and order to be renamed, got %+v", renamed)
+	}
+	if table.Indexes["idx_ab"].Fields[0].Column != "a" {
+		t.Fatalf("expected the original table to stay untouched")
+	}
+}
+
+type renameContactBefore struct {
+	ID    uint   `gorm:"primaryKey"`
+	Email string `gorm:"size:64"`
+	Phone string `gorm:"size:32"`
+	Fax   string `gorm:"size:32"`
+}
+
+func (renameContactBefore) TableName() string { return "rename_contacts" }
+
+type renameContactAfter struct {
+	ID           uint   `gorm:"primaryKey"`
+	EmailAddress string `gorm:"size:64"`
+	Mobile       string `gorm:"size:32"`
+}
+
+func (renameContactAfter) TableName() string { return "rename_contacts" }
+
+type renameContactTagged struct {
+	ID           uint   `gorm:"primaryKey"`
+	EmailAddress string `gorm:"size:64"`
+	Mobile       string `gorm:"size:32;renamed_from:phone"`
+}
+
+func (renameContactTagged) TableName() string { return "rename_contacts" }
+
+func TestDetectRenamesPairsUnambiguousColumns(t *testing.T) {
+	before, err := buildCurrentState([]any{&renameContactBefore{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState before failed: %v", err)
+	}
+	after, err := buildCurrentState([]any{&renameContactAfter{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState after failed: %v", err)
+	}
+	prev, cur := before.Tables["rename_contacts"], after.Tables["rename_contacts"]
+
+	opts := Options{DetectRenames: true}
+	ops := diffTableWithOptions("rename_contacts", prev, cur, opts)
+	up, down := splitMigrationOps(ops)
+	// phone and fax share a definition, so neither is paired with mobile.
+	wantUp := []string{
+		"ALTER TABLE `rename_contacts` CHANGE COLUMN `email` `email_address` varchar(64);",
+		"ALTER TABLE `rename_contacts` ADD COLUMN `mobile` varchar(32);",
+		"ALTER TABLE `rename_contacts` DROP COLUMN `fax`;",
+		"ALTER TABLE `rename_contacts` DROP COLUMN `phone`;",
+	}
+	if strings.Join(up, "\n") != strings.Join(wantUp, "\n") {
+		t.Fatalf("unexpected up SQL:\n%s", strings.Join(up, "\n"))
+	}
+	if got := down[len(down)-1]; got != "ALTER TABLE `rename_contacts` CHANGE COLUMN `email_address` `email` varchar(64);" {
+		t.Fatalf("expected the down to restore the original name last, got %s", got)
+	}
+	if err := verifyMigrationOps(before, after, ops, opts); err != nil {
+		t.Fatalf("unexpected self-check failure: %v", err)
+	}
+
+	if ops := diffTable("rename_contacts", prev, cur); ops[0].kind == opRenameColumn {
+		t.Fatalf("expected no rename detection by default, got %#v", ops[0])
+	}
+}
+
+func TestRenamedFromTagHint(t *testing.T) {
+	before, err := buildCurrentState([]any{&renameContactBefore{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState before failed: %v", err)
+	}
+	after, err := buildCurrentState([]any{&renameContactTagged{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState after failed: %v", err)
+	}
+	up, down := splitMigrationOps(diffTable("rename_contacts", before.Tables["rename_contacts"], after.Tables["rename_contacts"]))
+	if up[0] != "ALTER TABLE `rename_contacts` CHANGE COLUMN `phone` `mobile` varchar(32);" {
+		t.Fatalf("expected the tagged column to be renamed first, got:\n%s", strings.Join(up, "\n"))
+	}
+	if down[len(down)-1] != "ALTER TABLE `rename_contacts` CHANGE COLUMN `mobile` `phone` varchar(32);" {
+		t.Fatalf("unexpected down SQL:\n%s", strings.Join(down, "\n"))
+	}
+}
+
+type renameOwnerBefore struct {
+	ID uint `gorm:"primaryKey"`
+}
+
+func (renameOwnerBefore) TableName() string { return "rename_owners" }
+
+type renamePetBefore struct {
+	ID      uint              `gorm:"primaryKey"`
+	OwnerID uint              `gorm:"index"`
+	Owner   renameOwnerBefore `gorm:"foreignKey:OwnerID"`
+}
+
+func (renamePetBefore) TableName() string { return "rename_pets" }
+
+type renameOwnerAfter struct {
+	ID uint `gorm:"primaryKey"`
+}
+
+func (renameOwnerAfter) TableName() string { return "rename_members" }
+
+type renamePetAfter struct {
+	ID      uint             `gorm:"primaryKey"`
+	OwnerID uint             `gorm:"index"`
+	Owner   renameOwnerAfter `gorm:"foreignKey:OwnerID"`
+}
+
+func (renamePetAfter) TableName() string { return "rename_pets" }
+
+func TestRenameTablesKeepsRowsAndReferences(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := SyncSchemaState([]any{&renameOwnerBefore{}, &renamePetBefore{}}, dir, ""); err != nil {
+		t.Fatalf("SyncSchemaState failed: %v", err)
+	}
+
+	opts := Options{
+		Version:      "20240101000000",
+		RenameTables: map[string]string{"rename_owners": "rename_members"},
+		SelfVerify:   true,
+	}
+	models := []any{&renameOwnerAfter{}, &renamePetAfter{}}
+	result, err := MakeMigrationsWithOptions(models, dir, "rename_owners", "", opts)
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	if up := readMigration(t, result.UpPath); up != "RENAME TABLE `rename_owners` TO `rename_members`;" {
+		t.Fatalf("expected only the table rename, without foreign key churn, got:\n%s", up)
+	}
+	if down := readMigration(t, result.DownPath); down != "RENAME TABLE `rename_members` TO `rename_owners`;" {
+		t.Fatalf("unexpected down SQL:\n%s", down)
+	}
+
+	opts.Version = "20240102000000"
+	result, err = MakeMigrationsWithOptions(models, dir, "again", "", opts)
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	if result.Changed {
+		t.Fatalf("expected no changes after the rename was recorded")
+	}
+}
+
+type refUserBefore struct {
+	ID uint `gorm:"primaryKey"`
+}
+
+func (refUserBefore) TableName() string { return "ref_users" }
+
+type refOrderBefore struct {
+	ID     uint          `gorm:"primaryKey"`
+	UserID uint          `gorm:"index"`
+	User   refUserBefore `gorm:"foreignKey:UserID"`
+}
+
+func (refOrderBefore) TableName() string { return "ref_orders" }
+
+type refUserAfter struct {
+	Key uint `gorm:"primaryKey;column:user_id"`
+}
+
+func (refUserAfter) TableName() string { return "ref_users" }
+
+type refOrderAfter struct {
+	ID     uint         `gorm:"primaryKey"`
+	UserID uint         `gorm:"index"`
+	User   refUserAfter `gorm:"foreignKey:UserID;references:Key"`
+}
+
+func (refOrderAfter) TableName() string { return "ref_orders" }
+
+func TestRenameReferencedColumnRecreatesDependentForeignKeys(t *testing.T) {
+	before, err := buildCurrentState([]any{&refUserBefore{}, &refOrderBefore{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState before failed: %v", err)
+	}
+	after, err := buildCurrentState([]any{&refUserAfter{}, &refOrderAfter{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState after failed: %v", err)
+	}
+
+	opts := Options{RenameColumns: map[string]map[string]string{"ref_users": {"id": "user_id"}}}
+	ops := diffSchemas(before, after, opts)
+	up, down := splitMigrationOps(ops)
+	wantUp := []string{
+		"ALTER TABLE `ref_orders` DROP FOREIGN KEY `fk_ref_orders_user`;",
+		"ALTER TABLE `ref_users` CHANGE COLUMN `id` `user_id` bigint unsigned AUTO_INCREMENT;",
+		"ALTER TABLE `ref_orders` ADD CONSTRAINT `fk_ref_orders_user` FOREIGN KEY (`user_id`) REFERENCES `ref_users` (`user_id`);",
+	}
+	if strings.Join(up, "\n") != strings.Join(wantUp, "\n") {
+		t.Fatalf("unexpected up SQL:\n%s", strings.Join(up, "\n"))
+	}
+	wantDown := []string{
+		"ALTER TABLE `ref_orders` DROP FOREIGN KEY `fk_ref_orders_user`;",
+		"ALTER TABLE `ref_users` CHANGE COLUMN `user_id` `id` bigint unsigned AUTO_INCREMENT;",
+		"ALTER TABLE `ref_orders` ADD CONSTRAINT `fk_ref_orders_user` FOREIGN KEY (`user_id`) REFERENCES `ref_users` (`id`);",
+	}
+	if strings.Join(down, "\n") != strings.Join(wantDown, "\n") {
+		t.Fatalf("unexpected down SQL:\n%s", strings.Join(down, "\n"))
+	}
+	if err := verifyMigrationOps(before, after, ops, opts); err != nil {
+		t.Fatalf("unexpected self-check failure: %v", err)
+	}
+}
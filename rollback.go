@@ -0,0 +1,116 @@
+package gomigration
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// Rollback reverts the latest applied migration by running its down files
+// and removing its version from schema_migrations.
+func Rollback(db *gorm.DB, dir string) error {
+	return RollbackWithOptions(db, dir, ApplyOptions{})
+}
+
+// RollbackWithOptions reverts the versions after opts.Target, newest first,
+// or only the latest applied version when Target is empty.
+func RollbackWithOptions(db *gorm.DB, dir string, opts ApplyOptions) error {
+	return RollbackContext(context.Background(), db, dir, opts)
+}
+
+// RollbackContext is RollbackWithOptions with cancellation. ctx is checked
+// before every statement; once it is done no further version is reverted.
+// Postgres and SQLite revert each version in a transaction. On MySQL a
+// failed down file is left partially applied and its version stays recorded.
+func RollbackContext(ctx context.Context, db *gorm.DB, dir string, opts ApplyOptions) error {
+	if db == nil {
+		return fmt.Errorf("db is required")
+	}
+	if err := validateVersion(opts.Target); err != nil {
+		return fmt.Errorf("target: %w", err)
+	}
+	files, err := listMigrationFiles(dir)
+	if err != nil {
+		return err
+	}
+	return db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		conn = conn.Session(&gorm.Session{})
+		return keepSQLiteForeignKeys(ctx, conn, func() error {
+			return rollbackMigrationFiles(ctx, conn, files, opts)
+		})
+	})
+}
+
+func rollbackMigrationFiles(ctx context.Context, db *gorm.DB, files []migrationFile, opts ApplyOptions) error {
+	if err := EnsureMigrationsTable(db); err != nil {
+		return err
+	}
+	applied, err := AppliedVersions(db)
+	if err != nil {
+		return err
+	}
+	sort.Slice(applied, func(i, j int) bool { return compareVersions(applied[i], applied[j]) > 0 })
+	if opts.Target == "" && len(applied) > 1 {
+		applied = applied[:1]
+	}
+	groups := map[string][]migrationFile{}
+	for _, group := range groupMigrationFiles(files) {
+		groups[group[0].Version] = group
+	}
+
+	for _, version := range applied {
+		if opts.Target != "" && compareVersions(version, opts.Target) <= 0 {
+			break
+		}
+		group, ok := groups[version]
+		if !ok {
+			return fmt.Errorf("applied migration %s has no files to roll it back with", version)
+		}
+		if err := revertVersion(ctx, db, group, opts.Logger); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revertVersion runs the down files of one version in the reverse order of
+// their up files and removes the version from schema_migrations.
+func revertVersion(ctx context.Context, db *gorm.DB, group []migrationFile, logger Logger) error {
+	version := group[0].Version
+	downs := make([]migrationFile, 0, len(group))
+	stmts := make([][]string, 0, len(group))
+	safe := true
+	for i := len(group) - 1; i >= 0; i-- {
+		downSQL, err := readSQLFile(group[i].DownPath)
+		if err != nil {
+			return fmt.Errorf("migration %s_%s cannot be rolled back: %w", group[i].Version, group[i].Name, err)
+		}
+		downs = append(downs, group[i])
+		stmts = append(stmts, splitSQLStatements(downSQL))
+		safe = safe && transactionSafe(stmts[len(stmts)-1])
+	}
+
+	run := func(tx *gorm.DB) error {
+		for i, file := range downs {
+			if n, err := execStatements(ctx, tx, stmts[i]); err != nil {
+				return fmt.Errorf("rolling back migration %s_%s failed at statement %d: %w", file.Version, file.Name, n+1, err)
+			}
+		}
+		return deleteVersion(tx, version)
+	}
+	if safe && transactionalDDL(dialectOf(db)) {
+		if err := db.Transaction(run); err != nil {
+			logf(logger, "%v", err)
+			return fmt.Errorf("%w (transaction rolled back)", err)
+		}
+	} else if err := run(db); err != nil {
+		logf(logger, "%v", err)
+		return fmt.Errorf("%w; version %s is still recorded as applied", err, version)
+	}
+	for _, file := range downs {
+		logf(logger, "rolled back migration %s_%s", file.Version, file.Name)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package gomigration
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func writeRollbackFixtures(t *testing.T, dir string) {
+	t.Helper()
+	writeMigrationPair(t, dir, "20240101000000_init",
+		[]string{"CREATE TABLE `a` (\n  `id` bigint\n);"},
+		[]string{"DROP TABLE IF EXISTS `a`;"})
+	writeMigrationPair(t, dir, "20240102000000_add_b",
+		[]string{"ALTER TABLE `a` ADD COLUMN `b` int;"},
+		[]string{"ALTER TABLE `a` DROP COLUMN `b`;"})
+	writeMigrationPair(t, dir, "20240103000000_add_c",
+		[]string{"ALTER TABLE `a` ADD COLUMN `c` int;"},
+		[]string{"ALTER TABLE `a` DROP COLUMN `c`;"})
+}
+
+func TestApplyStopsAtTarget(t *testing.T) {
+	dir := t.TempDir()
+	writeRollbackFixtures(t, dir)
+
+	db, mock := newMockDB(t)
+	expectMigrationsTable(mock, "20240101000000")
+	mock.ExpectExec("ALTER TABLE `a` ADD COLUMN `b` int;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO `schema_migrations` (`version`, `name`, `checksum`) VALUES (?, ?, ?)").
+		WithArgs("20240102000000", "add_b", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if err := ApplyWithOptions(db, dir, ApplyOptions{Target: "20240102000000"}); err != nil {
+		t.Fatalf("ApplyWithOptions failed: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+	if err := ApplyWithOptions(db, dir, ApplyOptions{Target: "latest"}); err == nil {
+		t.Fatalf("expected a non-numeric target to be rejected")
+	}
+}
+
+func TestApplyOrdersMixedWidthVersionsNumerically(t *testing.T) {
+	dir := t.TempDir()
+	for _, v := range []string{"9", "10", "100"} {
+		writeMigrationPair(t, dir, v+"_step",
+			[]string{"ALTER TABLE `a` ADD COLUMN `c" + v + "` int;"},
+			[]string{"ALTER TABLE `a` DROP COLUMN `c" + v + "`;"})
+	}
+	files, err := listMigrationFiles(dir)
+	if err != nil {
+		t.Fatalf("listMigrationFiles failed: %v", err)
+	}
+	if got := []string{files[0].Version, files[1].Version, files[2].Version}; strings.Join(got, ",") != "9,10,100" {
+		t.Fatalf("expected numeric order, got %v", got)
+	}
+
+	db, mock := newMockDB(t)
+	expectMigrationsTable(mock)
+	mock.ExpectExec("ALTER TABLE `a` ADD COLUMN `c9` int;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO `schema_migrations` (`version`, `name`, `checksum`) VALUES (?, ?, ?)").
+		WithArgs("9", "step", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("ALTER TABLE `a` ADD COLUMN `c10` int;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO `schema_migrations` (`version`, `name`, `checksum`) VALUES (?, ?, ?)").
+		WithArgs("10", "step", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if err := ApplyWithOptions(db, dir, ApplyOptions{Target: "10"}); err != nil {
+		t.Fatalf("ApplyWithOptions failed: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestRollbackRevertsLatestOrDownToTarget(t *testing.T) {
+	dir := t.TempDir()
+	writeRollbackFixtures(t, dir)
+
+	db, mock := newMockDB(t)
+	expectMigrationsTable(mock, "20240101000000", "20240103000000", "20240102000000")
+	mock.ExpectExec("ALTER TABLE `a` DROP COLUMN `c`;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM `schema_migrations` WHERE `version` = ?").
+		WithArgs("20240103000000").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := Rollback(db, dir); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+
+	expectMigrationsTable(mock, "20240101000000", "20240102000000")
+	mock.ExpectExec("ALTER TABLE `a` DROP COLUMN `b`;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM `schema_migrations` WHERE `version` = ?").
+		WithArgs("20240102000000").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DROP TABLE IF EXISTS `a`;").WillReturnError(errors.New("boom"))
+	err := RollbackWithOptions(db, dir, ApplyOptions{Target: "0"})
+	if err == nil || !strings.Contains(err.Error(), "rolling back migration 20240101000000_init failed at statement 1: boom; version 20240101000000 is still recorded as applied") {
+		t.Fatalf("expected the failed rollback to be reported, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+
+	expectMigrationsTable(mock, "20240101000000", "20240104000000")
+	if err := Rollback(db, dir); err == nil || !strings.Contains(err.Error(), "applied migration 20240104000000 has no files") {
+		t.Fatalf("expected a version without files to be rejected, got %v", err)
+	}
+}
+
+func TestApplyAndRollbackUseTransactionsOnSQLite(t *testing.T) {
+	dir := t.TempDir()
+	writeMigrationPair(t, dir, "20240101000000_init",
+		[]string{`CREATE TABLE "a" ("id" integer);`},
+		[]string{`DROP TABLE IF EXISTS "a";`})
+	writeMigrationPair(t, dir, "20240102000000_broken",
+		[]string{`CREATE TABLE "b" ("id" integer);`, `ALTER TABLE "missing" ADD COLUMN "x" integer;`},
+		[]string{`DROP TABLE IF EXISTS "b";`, `DROP TABLE IF EXISTS "b";`})
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite failed: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("db.DB failed: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	hasTable := func(name string) bool {
+		t.Helper()
+		var count int64
+		if err := db.Raw(`SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name).Scan(&count).Error; err != nil {
+			t.Fatalf("query sqlite_master failed: %v", err)
+		}
+		return count > 0
+	}
+
+	err = Apply(db, dir)
+	if err == nil || !strings.Contains(err.Error(), "migration 20240102000000_broken failed at statement 2") || !strings.Contains(err.Error(), "transaction rolled back") {
+		t.Fatalf("expected the broken migration to be rolled back, got %v", err)
+	}
+	if !hasTable("a") || hasTable("b") {
+		t.Fatalf("expected only the first migration to be applied")
+	}
+	versions, err := AppliedVersions(db)
+	if err != nil || len(versions) != 1 || versions[0] != "20240101000000" {
+		t.Fatalf("expected only the first version to be recorded, got %v, %v", versions, err)
+	}
+
+	if err := Rollback(db, dir); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if hasTable("a") {
+		t.Fatalf("expected the rollback to drop the table")
+	}
+	if versions, err := AppliedVersions(db); err != nil || len(versions) != 0 {
+		t.Fatalf("expected no recorded versions, got %v, %v", versions, err)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	if compareVersions("000010", "9") <= 0 || compareVersions("20240101000000", "0") <= 0 || compareVersions("000001", "1") != 0 {
+		t.Fatalf("expected numeric version order")
+	}
+}
@@ -0,0 +1,316 @@
+package gomigration
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Severity classifies a SafetyWarning.
+type Severity string
+
+const (
+	// SeverityRisky marks a change that can fail on existing data.
+	SeverityRisky Severity = "risky"
+	// SeverityDestructive marks a change that discards existing data.
+	SeverityDestructive Severity = "destructive"
+)
+
+// SafetyWarning flags a generated change that can fail on existing data or
+// discard it.
+type SafetyWarning struct {
+	Table string
+	// Name is the column or constraint the warning is about, or the table
+	// itself for table-level changes.
+	Name     string
+	Severity Severity
+	Message  string
+	// Query selects the existing rows that would make the change fail or
+	// lose data. It is empty when every row is affected.
+	Query string
+	// Rollback is set when the down migration, not the up, can fail.
+	Rollback bool
+}
+
+// foreignKeyTargetWarning warns when a foreign key now references a different
+// table or different columns, since rows valid under the old constraint can
+// violate the new one.
+func foreignKeyTargetWarning(tableName, name string, prev, cur foreignKeyState, dialect Dialect) (SafetyWarning, bool) {
+	if strings.EqualFold(prev.RefTable, cur.RefTable) && reflect.DeepEqual(prev.RefColumns, cur.RefColumns) {
+		return SafetyWarning{}, false
+	}
+	return SafetyWarning{
+		Table:    tableName,
+		Name:     name,
+		Severity: SeverityRisky,
+		Message:  fmt.Sprintf("foreign key `%s` on `%s` now references `%s`; existing rows may violate the new constraint", name, tableName, cur.RefTable),
+		Query:    orphanedRowsQuery(tableName, cur, dialect),
+	}, true
+}
+
+// orphanedRowsQuery selects the rows of tableName that have no match for fk
+// in the referenced table. Rows with a NULL in any foreign key column are
+// not checked by the database and are left out.
+func orphanedRowsQuery(tableName string, fk foreignKeyState, dialect Dialect) string {
+	quote := func(name string) string { return quoteIdentifier(dialect, name) }
+	on := make([]string, 0, len(fk.Columns))
+	where := make([]string, 0, len(fk.Columns)+1)
+	for i, col := range fk.Columns {
+		if i < len(fk.RefColumns) {
+			on = append(on, fmt.Sprintf("p.%s = c.%s", quote(fk.RefColumns[i]), quote(col)))
+		}
+		where = append(where, fmt.Sprintf("c.%s IS NOT NULL", quote(col)))
+	}
+	if len(fk.RefColumns) > 0 {
+		where = append(where, fmt.Sprintf("p.%s IS NULL", quote(fk.RefColumns[0])))
+	}
+	return fmt.Sprintf("SELECT c.* FROM %s AS c LEFT JOIN %s AS p ON %s WHERE %s;",
+		quote(tableName), quote(fk.RefTable), strings.Join(on, " AND "), strings.Join(where, " AND "))
+}
+
+// uniquenessChange classifies an index change by whether the index becomes
+// unique or stops being unique.
+type uniquenessChange string
+
+const (
+	uniquenessUnchanged uniquenessChange = ""
+	uniquenessAdded     uniquenessChange = "added"
+	uniquenessRemoved   uniquenessChange = "removed"
+)
+
+func classifyUniquenessChange(prev, cur indexState) uniquenessChange {
+	wasUnique := normalizeIndexClass(prev.Class) == "UNIQUE"
+	isUnique := normalizeIndexClass(cur.Class) == "UNIQUE"
+	switch {
+	case !wasUnique && isUnique:
+		return uniquenessAdded
+	case wasUnique && !isUnique:
+		return uniquenessRemoved
+	}
+	return uniquenessUnchanged
+}
+
+// uniqueIndexWarning warns when an existing index becomes unique, since the
+// rows it already covers may hold duplicates.
+func uniqueIndexWarning(tableName, name string, prev, cur indexState, dialect Dialect) (SafetyWarning, bool) {
+	if classifyUniquenessChange(prev, cur) != uniquenessAdded {
+		return SafetyWarning{}, false
+	}
+	return SafetyWarning{
+		Table:    tableName,
+		Name:     name,
+		Severity: SeverityRisky,
+		Message:  fmt.Sprintf("index `%s` on `%s` becomes unique; existing duplicate rows will make the change fail", name, tableName),
+		Query:    duplicateRowsQuery(tableName, cur, dialect),
+	}, true
+}
+
+// duplicateRowsQuery selects the values of idx that more than one row of
+// tableName holds. Rows with a NULL in an indexed column never conflict and
+// are left out; prefix lengths are compared on the prefix only.
+func duplicateRowsQuery(tableName string, idx indexState, dialect Dialect) string {
+	keys := make([]string, 0, len(idx.Fields))
+	where := make([]string, 0, len(idx.Fields))
+	for _, f := range idx.Fields {
+		if f.Expression != "" {
+			keys = append(keys, "("+f.Expression+")")
+			continue
+		}
+		col := quoteIdentifier(dialect, f.Column)
+		where = append(where, col+" IS NOT NULL")
+		if f.Length > 0 && dialect.isMySQL() {
+			col = fmt.Sprintf("LEFT(%s, %d)", col, f.Length)
+		}
+		keys = append(keys, col)
+	}
+	sql := fmt.Sprintf("SELECT %s, COUNT(*) FROM %s", strings.Join(keys, ", "), quoteIdentifier(dialect, tableName))
+	if len(where) > 0 {
+		sql += " WHERE " + strings.Join(where, " AND ")
+	}
+	return fmt.Sprintf("%s GROUP BY %s HAVING COUNT(*) > 1;", sql, strings.Join(keys, ", "))
+}
+
+// enumRollbackWarning warns when values are added to an enum or set column:
+// the down migration removes them again, which fails on rows holding one.
+func enumRollbackWarning(tableName, column, prevDef, curDef string, dialect Dialect) (SafetyWarning, bool) {
+	from, to := parseColumnType(prevDef), parseColumnType(curDef)
+	if !dialect.isMySQL() || (to.base != "enum" && to.base != "set") || from.base != to.base {
+		return SafetyWarning{}, false
+	}
+	added := make([]string, 0)
+	for _, v := range to.params {
+		if !containsString(from.params, v) {
+			added = append(added, v)
+		}
+	}
+	if len(added) == 0 {
+		return SafetyWarning{}, false
+	}
+	return SafetyWarning{
+		Table:    tableName,
+		Name:     column,
+		Severity: SeverityRisky,
+		Message:  fmt.Sprintf("rolling back removes %s values %s from `%s`.`%s`; rows holding them make the rollback fail", to.base, strings.Join(added, ", "), tableName, column),
+		Query:    valueListRowsQuery(tableName, column, to.base, added, dialect),
+		Rollback: true,
+	}, true
+}
+
+// valueListRowsQuery selects the rows of an enum or set column holding one
+// of values, which are quoted.
+func valueListRowsQuery(tableName, column, base string, values []string, dialect Dialect) string {
+	col := quoteIdentifier(dialect, column)
+	where := fmt.Sprintf("%s IN (%s)", col, strings.Join(values, ", "))
+	if base == "set" {
+		conds := make([]string, 0, len(values))
+		for _, v := range values {
+			conds = append(conds, fmt.Sprintf("FIND_IN_SET(%s, %s) > 0", v, col))
+		}
+		where = strings.Join(conds, " OR ")
+	}
+	return fmt.Sprintf("SELECT * FROM %s WHERE %s;", quoteIdentifier(dialect, tableName), where)
+}
+
+func droppedTableWarning(tableName string) SafetyWarning {
+	return SafetyWarning{
+		Table:    tableName,
+		Name:     tableName,
+		Severity: SeverityDestructive,
+		Message:  fmt.Sprintf("dropping table `%s` discards its rows", tableName),
+	}
+}
+
+func droppedColumnWarning(tableName, column string) SafetyWarning {
+	return SafetyWarning{
+		Table:    tableName,
+		Name:     column,
+		Severity: SeverityDestructive,
+		Message:  fmt.Sprintf("dropping column `%s`.`%s` discards its values", tableName, column),
+	}
+}
+
+// narrowingWarning warns when a column type narrows, e.g. varchar(128) to
+// varchar(32), since existing values may be truncated or rejected. Only
+// character, enum and set columns get a check query.
+func narrowingWarning(tableName, column, prevDef, curDef string, change TypeChange, dialect Dialect) (SafetyWarning, bool) {
+	if change != TypeNarrow {
+		return SafetyWarning{}, false
+	}
+	from, to := parseColumnType(prevDef), parseColumnType(curDef)
+	warning := SafetyWarning{
+		Table:    tableName,
+		Name:     column,
+		Severity: SeverityDestructive,
+		Message:  fmt.Sprintf("narrowing `%s`.`%s` from %s to %s may truncate existing values", tableName, column, typeOf(prevDef), typeOf(curDef)),
+	}
+	switch {
+	case isCharType(to.base) && (isCharType(from.base) || isTextType(from.base)):
+		warning.Query = fmt.Sprintf("SELECT * FROM %s WHERE CHAR_LENGTH(%s) > %d;", quoteIdentifier(dialect, tableName), quoteIdentifier(dialect, column), typeCapacity(to))
+	case (to.base == "enum" || to.base == "set") && from.base == to.base:
+		removed := make([]string, 0)
+		for _, v := range from.params {
+			if !containsString(to.params, v) {
+				removed = append(removed, v)
+			}
+		}
+		if len(removed) > 0 {
+			warning.Query = valueListRowsQuery(tableName, column, to.base, removed, dialect)
+		}
+	}
+	return warning, true
+}
+
+// typeOf returns the type token of a definition, e.g. varchar(32).
+func typeOf(definition string) string {
+	tokens := tokenizeDefinition(definition)
+	if len(tokens) == 0 {
+		return definition
+	}
+	return tokens[0]
+}
+
+// destructiveOpsError lists the ops with a SeverityDestructive warning and
+// their up statements, or returns nil when there are none.
+func destructiveOpsError(ops []migrationOp) error {
+	var b strings.Builder
+	count := 0
+	for _, op := range ops {
+		for _, w := range op.warnings {
+			if w.Severity != SeverityDestructive {
+				continue
+			}
+			count++
+			fmt.Fprintf(&b, "\n  %s:", w.Message)
+			for _, line := range strings.Split(op.up, "\n") {
+				b.WriteString("\n    " + line)
+			}
+		}
+	}
+	if count == 0 {
+		return nil
+	}
+	return fmt.Errorf("migration has %d destructive change(s); set Options.AllowDestructive to write it:%s", count, b.String())
+}
+
+func withSafetyWarnings(sql string, warnings []SafetyWarning) string {
+	notes := make([]string, 0, len(warnings)+1)
+	for _, w := range warnings {
+		notes = append(notes, "-- WARNING: "+w.Message, "-- check with: "+w.Query)
+	}
+	return strings.Join(append(notes, sql), "\n")
+}
+
+// collectSafetyWarnings returns the warnings of ops ordered by table, name
+// and message.
+func collectSafetyWarnings(ops []migrationOp) []SafetyWarning {
+	warnings := make([]SafetyWarning, 0)
+	for _, op := range ops {
+		warnings = append(warnings, op.warnings...)
+	}
+	sort.SliceStable(warnings, func(i, j int) bool {
+		a, b := warnings[i], warnings[j]
+		if a.Table != b.Table {
+			return a.Table < b.Table
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Message < b.Message
+	})
+	return warnings
+}
+
+// The data loss notes precede down statements that recreate a dropped column
+// or table; the schema comes back but the data does not.
+const (
+	droppedColumnDataLossNote = "-- data loss: cannot restore dropped column values"
+	droppedTableDataLossNote  = "-- data loss: cannot restore dropped table rows"
+)
+
+// withAutoIncrementRestore follows the recreation of a dropped table with
+// the statement that sets its counter back to the known high-water mark, or
+// warns that the counter starts over when the mark is unknown.
+func withAutoIncrementRestore(create, tableName string, table tableState, opts Options) string {
+	if !tableHasAutoIncrement(table) {
+		return create
+	}
+	if mark, ok := opts.AutoIncrementHighWater[tableName]; ok {
+		if restore := opts.emitter().SetAutoIncrement(tableName, mark); restore != "" {
+			return create + "\n" + restore
+		}
+	}
+	if opts.AnnotateAutoIncrementReset {
+		return fmt.Sprintf("-- rollback restarts the auto-increment counter of `%s`", tableName) + "\n" + create
+	}
+	return create
+}
+
+func tableHasAutoIncrement(table tableState) bool {
+	for _, col := range table.Columns {
+		if hasAutoIncrement(col.Definition) || isSerialType(columnBaseType(col.Definition)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package gomigration
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultSequentialWidth = 6
+
+func (o Options) sequentialWidth() int {
+	if o.SequentialWidth > 0 {
+		return o.SequentialWidth
+	}
+	return defaultSequentialWidth
+}
+
+func (o Options) validateSequentialVersions() error {
+	if o.SequentialWidth < 0 {
+		return fmt.Errorf("SequentialWidth must not be negative, got %d", o.SequentialWidth)
+	}
+	if o.SequentialWidth > 0 && !o.SequentialVersions {
+		return fmt.Errorf("SequentialWidth requires SequentialVersions")
+	}
+	if o.SequentialVersions && strings.TrimSpace(o.Version) != "" {
+		return fmt.Errorf("SequentialVersions cannot be used with Version")
+	}
+	return nil
+}
+
+// nextSequentialVersion returns the version after the highest one of the
+// .sql files in dir, padded with zeros to width digits. A timestamp version
+// in dir is an error: the next number would sort before it.
+func nextSequentialVersion(dir string, width int) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var highest uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".sql") {
+			continue
+		}
+		version, _, ok := strings.Cut(name, "_")
+		if !ok || version == "" || validateVersion(version) != nil {
+			continue
+		}
+		if isTimestampVersion(version) {
+			return "", fmt.Errorf("%s mixes sequential and timestamp versions: %s has a timestamp version; rename the existing migrations or turn off SequentialVersions", dir, name)
+		}
+		n, err := strconv.ParseUint(version, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("version of %s: %w", name, err)
+		}
+		if n > highest {
+			highest = n
+		}
+	}
+	return fmt.Sprintf("%0*d", width, highest+1), nil
+}
+
+func isTimestampVersion(version string) bool {
+	if len(version) != len(versionLayout) {
+		return false
+	}
+	_, err := time.Parse(versionLayout, version)
+	return err == nil
+}
@@ -0,0 +1,65 @@
+package gomigration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type sequentialUser struct {
+	ID uint `gorm:"primaryKey"`
+}
+
+func (sequentialUser) TableName() string { return "sequential_users" }
+
+type sequentialUserNamed struct {
+	ID   uint   `gorm:"primaryKey"`
+	Name string `gorm:"size:64"`
+}
+
+func (sequentialUserNamed) TableName() string { return "sequential_users" }
+
+func TestMakeMigrationsSequentialVersions(t *testing.T) {
+	dir := t.TempDir()
+	result, err := MakeMigrationsWithOptions([]any{&sequentialUser{}}, dir, "init", "", Options{SequentialVersions: true})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	if result.Version != "000001" || filepath.Base(result.UpPath) != "000001_init.up.sql" || filepath.Base(result.DownPath) != "000001_init.down.sql" {
+		t.Fatalf("expected 000001_init files, got %s and %s", result.UpPath, result.DownPath)
+	}
+
+	// Numbering continues from the highest version, whatever its width.
+	if err := os.WriteFile(filepath.Join(dir, "41_external.up.sql"), []byte("SELECT 1;\n"), 0o644); err != nil {
+		t.Fatalf("write file failed: %v", err)
+	}
+	result, err = MakeMigrationsWithOptions([]any{&sequentialUserNamed{}}, dir, "add_name", "", Options{SequentialVersions: true, SequentialWidth: 4})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	if result.Version != "0042" || filepath.Base(result.UpPath) != "0042_add_name.up.sql" {
+		t.Fatalf("expected version 0042, got %s", result.UpPath)
+	}
+}
+
+func TestMakeMigrationsSequentialVersionsRejectsTimestamps(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := MakeMigrationsWithOptions([]any{&sequentialUser{}}, dir, "init", "", Options{Version: "20240101000000"}); err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	_, err := MakeMigrationsWithOptions([]any{&sequentialUserNamed{}}, dir, "add_name", "", Options{SequentialVersions: true})
+	if err == nil || !strings.Contains(err.Error(), "mixes sequential and timestamp versions: 20240101000000_init.down.sql has a timestamp version") {
+		t.Fatalf("expected timestamp versions to be rejected, got %v", err)
+	}
+
+	for _, opts := range []Options{
+		{SequentialVersions: true, Version: "7"},
+		{SequentialWidth: 4},
+		{SequentialVersions: true, SequentialWidth: -1},
+	} {
+		if err := opts.validate(); err == nil {
+			t.Fatalf("expected %+v to be rejected", opts)
+		}
+	}
+}
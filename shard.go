@@ -0,0 +1,70 @@
+package gomigration
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// shardTablesByBase resolves the models of Options.ShardTables to the table
+// name their TableName returns at parse time.
+func shardTablesByBase(db *gorm.DB, shards map[any][]string) (map[string][]string, error) {
+	out := make(map[string][]string, len(shards))
+	for model, names := range shards {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+		if stmt.Schema == nil {
+			continue
+		}
+		out[stmt.Schema.Table] = append(out[stmt.Schema.Table], names...)
+	}
+	return out, nil
+}
+
+// expandShardTables replaces each sharded table with an identical table per
+// shard name. Foreign key names are global in MySQL, so the base table name
+// inside a constraint name is replaced by the shard name.
+func expandShardTables(state schemaState, shards map[string][]string) (schemaState, error) {
+	for _, base := range sortedKeys(shards) {
+		table, ok := state.Tables[base]
+		if !ok {
+			return schemaState{}, fmt.Errorf("sharded table `%s` does not belong to any of the models", base)
+		}
+		names := append([]string{}, shards[base]...)
+		sort.Strings(names)
+		if len(names) == 0 {
+			return schemaState{}, fmt.Errorf("sharded table `%s` has no shard names", base)
+		}
+		delete(state.Tables, base)
+		for _, name := range names {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				return schemaState{}, fmt.Errorf("sharded table `%s` has an empty shard name", base)
+			}
+			if _, exists := state.Tables[name]; exists {
+				return schemaState{}, fmt.Errorf("shard `%s` of table `%s` is already defined", name, base)
+			}
+			shard := cloneTableState(table)
+			shard.ForeignKeys = make(map[string]foreignKeyState, len(table.ForeignKeys))
+			for fkName, fk := range table.ForeignKeys {
+				if !strings.Contains(fkName, base) {
+					return schemaState{}, fmt.Errorf("sharded table `%s` foreign key `%s` does not contain the table name, so it cannot be renamed per shard", base, fkName)
+				}
+				shard.ForeignKeys[strings.Replace(fkName, base, name, 1)] = fk
+			}
+			state.Tables[name] = shard
+		}
+	}
+	for _, tableName := range sortedKeys(state.Tables) {
+		for _, fkName := range sortedKeys(state.Tables[tableName].ForeignKeys) {
+			if _, sharded := shards[state.Tables[tableName].ForeignKeys[fkName].RefTable]; sharded {
+				return schemaState{}, fmt.Errorf("table `%s` foreign key `%s` references sharded table `%s`", tableName, fkName, state.Tables[tableName].ForeignKeys[fkName].RefTable)
+			}
+		}
+	}
+	return state, nil
+}
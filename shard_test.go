@@ -0,0 +1,45 @@
+package gomigration
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type shardedEvent struct {
+	ID      uint   `gorm:"primaryKey"`
+	Kind    string `gorm:"size:32;index:idx_events_kind"`
+	Payload string `gorm:"type:text"`
+}
+
+func (shardedEvent) TableName() string { return "events" }
+
+func TestBuildCurrentStateShardTables(t *testing.T) {
+	opts := Options{ShardTables: map[any][]string{&shardedEvent{}: {"events_2025", "events_2024"}}}
+	state, err := buildCurrentStateWithOptions([]any{&shardedEvent{}}, opts)
+	if err != nil {
+		t.Fatalf("buildCurrentStateWithOptions failed: %v", err)
+	}
+	if got := sortedKeys(state.Tables); !reflect.DeepEqual(got, []string{"events_2024", "events_2025"}) {
+		t.Fatalf("expected one table per shard, got %v", got)
+	}
+	if !reflect.DeepEqual(state.Tables["events_2024"], state.Tables["events_2025"]) {
+		t.Fatalf("expected identical shard structure")
+	}
+
+	previous := state
+	opts.ShardTables = map[any][]string{&shardedEvent{}: {"events_2024", "events_2025", "events_2026"}}
+	current, err := buildCurrentStateWithOptions([]any{&shardedEvent{}}, opts)
+	if err != nil {
+		t.Fatalf("buildCurrentStateWithOptions failed: %v", err)
+	}
+	up, _ := splitMigrationOps(diffSchemas(previous, current, Options{}))
+	if len(up) != 1 || !strings.HasPrefix(up[0], "CREATE TABLE `events_2026`") {
+		t.Fatalf("expected only the new shard to be created, got %v", up)
+	}
+
+	_, err = buildCurrentStateWithOptions([]any{&e2eUserNoJoin{}}, opts)
+	if err == nil || !strings.Contains(err.Error(), "sharded table `events` does not belong to any of the models") {
+		t.Fatalf("expected error for a shard model outside the model set, got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package gomigration
+
+import "fmt"
+
+func isSpatialType(baseType string) bool {
+	switch baseType {
+	case "geometry", "point", "linestring", "polygon", "multipoint", "multilinestring", "multipolygon",
+		"geometrycollection", "geomcollection":
+		return true
+	default:
+		return false
+	}
+}
+
+// spatialIndexesLosingNotNull returns the SPATIAL indexes of prev that cur
+// drops while their column becomes nullable. They are dropped before the
+// column is modified, since MySQL refuses a nullable column in a SPATIAL
+// index; the down recreates them after the column is NOT NULL again.
+func spatialIndexesLosingNotNull(prev, cur tableState) []string {
+	names := make([]string, 0)
+	for _, name := range sortedKeys(prev.Indexes) {
+		idx := prev.Indexes[name]
+		if _, kept := cur.Indexes[name]; kept || normalizeIndexClass(idx.Class) != "SPATIAL" || len(idx.Fields) != 1 {
+			continue
+		}
+		col, ok := cur.Columns[idx.Fields[0].Column]
+		if ok && isNullableDefinition(col.Definition) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// validateSpatialIndexes rejects MySQL SPATIAL indexes the server refuses:
+// one must cover a single NOT NULL spatial column, without a prefix length.
+func validateSpatialIndexes(tableName string, table tableState) error {
+	for _, name := range sortedKeys(table.Indexes) {
+		idx := table.Indexes[name]
+		if normalizeIndexClass(idx.Class) != "SPATIAL" {
+			continue
+		}
+		if len(idx.Fields) != 1 || idx.Fields[0].Column == "" {
+			return fmt.Errorf("table `%s` SPATIAL index `%s` must cover exactly one column", tableName, name)
+		}
+		field := idx.Fields[0]
+		col, ok := table.Columns[field.Column]
+		if !ok {
+			continue
+		}
+		if baseType := columnBaseType(col.Definition); !isSpatialType(baseType) {
+			return fmt.Errorf("table `%s` SPATIAL index `%s` covers `%s` of type %s; it needs a spatial type such as geometry or point", tableName, name, field.Column, baseType)
+		}
+		if isNullableDefinition(col.Definition) {
+			return fmt.Errorf("table `%s` SPATIAL index `%s` covers nullable column `%s`; MySQL requires NOT NULL, e.g. gorm:\"type:geometry;not null\"", tableName, name, field.Column)
+		}
+		if field.Length > 0 {
+			return fmt.Errorf("table `%s` SPATIAL index `%s` cannot use a prefix length on `%s`", tableName, name, field.Column)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package gomigration
+
+import (
+	"strings"
+	"testing"
+)
+
+type spatialPlace struct {
+	ID       uint   `gorm:"primaryKey"`
+	Area     string `gorm:"type:geometry;not null;index:,class:SPATIAL"`
+	Location string `gorm:"type:point SRID 4326;not null;index:idx_spatial_places_location,class:SPATIAL"`
+}
+
+func (spatialPlace) TableName() string { return "spatial_places" }
+
+type spatialPlaceNullable struct {
+	ID   uint   `gorm:"primaryKey"`
+	Area string `gorm:"type:geometry;index:,class:SPATIAL"`
+}
+
+func (spatialPlaceNullable) TableName() string { return "spatial_places" }
+
+type spatialPlaceUnindexed struct {
+	ID       uint   `gorm:"primaryKey"`
+	Area     string `gorm:"type:geometry"`
+	Location string `gorm:"type:point SRID 4326;not null;index:idx_spatial_places_location,class:SPATIAL"`
+}
+
+func (spatialPlaceUnindexed) TableName() string { return "spatial_places" }
+
+func TestSpatialIndexCreateTable(t *testing.T) {
+	state, err := buildCurrentState([]any{&spatialPlace{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState failed: %v", err)
+	}
+	create := createTableSQL("spatial_places", state.Tables["spatial_places"])
+	want := "CREATE TABLE `spatial_places` (\n" +
+		"  `area` geometry NOT NULL,\n" +
+		"  `id` bigint unsigned AUTO_INCREMENT,\n" +
+		"  `location` point SRID 4326 NOT NULL,\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  SPATIAL KEY `idx_spatial_places_area` (`area`),\n" +
+		"  SPATIAL KEY `idx_spatial_places_location` (`location`)\n" +
+		");"
+	if create != want {
+		t.Fatalf("unexpected CREATE TABLE:\n%s", create)
+	}
+
+	if _, err := buildCurrentState([]any{&spatialPlaceNullable{}}); err == nil || !strings.Contains(err.Error(), "covers nullable column `area`; MySQL requires NOT NULL") {
+		t.Fatalf("expected a nullable SPATIAL index column to be rejected, got %v", err)
+	}
+	if _, err := buildCurrentStateWithOptions([]any{&spatialPlaceNullable{}}, Options{Dialect: DialectSQLite}); err != nil {
+		t.Fatalf("expected the NOT NULL check to be MySQL only, got %v", err)
+	}
+}
+
+func TestDiffTableSpatialIndexOrdering(t *testing.T) {
+	before, err := buildCurrentState([]any{&spatialPlaceUnindexed{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState failed: %v", err)
+	}
+	after, err := buildCurrentState([]any{&spatialPlace{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState failed: %v", err)
+	}
+	prev, cur := before.Tables["spatial_places"], after.Tables["spatial_places"]
+
+	// The column becomes NOT NULL before the index is created, and the
+	// index is dropped before the column becomes nullable again.
+	wantUp := []string{
+		"ALTER TABLE `spatial_places` MODIFY COLUMN `area` geometry NOT NULL;",
+		"CREATE SPATIAL INDEX `idx_spatial_places_area` ON `spatial_places` (`area`);",
+	}
+	wantDown := []string{
+		"DROP INDEX `idx_spatial_places_area` ON `spatial_places`;",
+		"ALTER TABLE `spatial_places` MODIFY COLUMN `area` geometry;",
+	}
+	up, down := splitMigrationOps(diffTable("spatial_places", prev, cur))
+	if strings.Join(up, "\n") != strings.Join(wantUp, "\n") || strings.Join(down, "\n") != strings.Join(wantDown, "\n") {
+		t.Fatalf("unexpected SQL:\n%s\n---\n%s", strings.Join(up, "\n"), strings.Join(down, "\n"))
+	}
+
+	up, down = splitMigrationOps(diffTable("spatial_places", cur, prev))
+	if strings.Join(up, "\n") != strings.Join(wantDown, "\n") || strings.Join(down, "\n") != strings.Join(wantUp, "\n") {
+		t.Fatalf("unexpected SQL when removing the index:\n%s\n---\n%s", strings.Join(up, "\n"), strings.Join(down, "\n"))
+	}
+}
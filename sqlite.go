@@ -0,0 +1,314 @@
+package gomigration
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SQLiteEmitter renders DDL for SQLite. It is the default Emitter when
+// Options.Dialect is DialectSQLite.
+//
+// SQLite cannot change a column or a constraint in place, so the generator
+// never calls ModifyColumn, AddForeignKey or DropForeignKey for existing
+// tables; it rebuilds the table instead, see sqliteRebuildTableOp. Foreign
+// keys are declared in CREATE TABLE.
+type SQLiteEmitter struct {
+	// QuoteMode selects which identifiers are quoted; the default quotes
+	// all of them.
+	QuoteMode QuoteMode
+	// IfExists guards CREATE TABLE and CREATE INDEX with IF NOT EXISTS.
+	// SQLite has no such guard for adding or dropping columns.
+	IfExists bool
+}
+
+func (e SQLiteEmitter) quote(name string) string {
+	return e.QuoteMode.quoteFor(DialectSQLite, name)
+}
+
+func (e SQLiteEmitter) columns(columns []string) string {
+	parts := make([]string, 0, len(columns))
+	for _, col := range columns {
+		parts = append(parts, e.quote(col))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// CreateTable creates the indexes with separate statements after the table.
+// A primary key declared on the column itself, as GORM does for
+// AUTOINCREMENT columns, is not repeated as a table constraint.
+func (e SQLiteEmitter) CreateTable(table TableDefinition) string {
+	defs := make([]string, 0, len(table.Columns)+len(table.ForeignKeys)+1)
+	inlineKey := false
+	for _, col := range table.Columns {
+		defs = append(defs, fmt.Sprintf("  %s %s", e.quote(col.Name), col.Definition))
+		if strings.Contains(strings.ToUpper(col.Definition), "PRIMARY KEY") {
+			inlineKey = true
+		}
+	}
+	if len(table.PrimaryKeys) > 0 && !inlineKey {
+		defs = append(defs, fmt.Sprintf("  PRIMARY KEY (%s)", e.columns(table.PrimaryKeys)))
+	}
+	for _, fk := range table.ForeignKeys {
+		defs = append(defs, "  "+e.foreignKeyConstraint(fk))
+	}
+	stmts := []string{fmt.Sprintf("CREATE TABLE %s%s (\n%s\n);", ifNotExistsClause(e.IfExists), e.quote(table.Name), strings.Join(defs, ",\n"))}
+	for _, idx := range table.Indexes {
+		stmts = append(stmts, e.CreateIndex(table.Name, idx))
+	}
+	return strings.Join(stmts, "\n")
+}
+
+func (e SQLiteEmitter) foreignKeyConstraint(fk ForeignKeyDefinition) string {
+	state := normalizeForeignKey(fk.state())
+	sql := fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)",
+		e.quote(fk.Name), e.columns(state.Columns), e.quote(state.RefTable), e.columns(state.RefColumns))
+	if state.OnDelete != "" {
+		sql += " ON DELETE " + state.OnDelete
+	}
+	if state.OnUpdate != "" {
+		sql += " ON UPDATE " + state.OnUpdate
+	}
+	return sql
+}
+
+func (e SQLiteEmitter) DropTable(table string) string {
+	return fmt.Sprintf("DROP TABLE IF EXISTS %s;", e.quote(table))
+}
+
+func (e SQLiteEmitter) RenameTable(from, to string) string {
+	return fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", e.quote(from), e.quote(to))
+}
+
+func (e SQLiteEmitter) AddColumn(table string, column ColumnDefinition) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", e.quote(table), e.quote(column.Name), column.Definition)
+}
+
+// ModifyColumn returns no SQL; SQLite has no statement for it.
+func (e SQLiteEmitter) ModifyColumn(table string, column ColumnDefinition) string {
+	return ""
+}
+
+// DropColumn needs SQLite 3.35 or later. The generator rebuilds the table
+// instead, which works on every version.
+func (e SQLiteEmitter) DropColumn(table, column string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", e.quote(table), e.quote(column))
+}
+
+// RenameColumn keeps the column definition; SQLite cannot change it.
+func (e SQLiteEmitter) RenameColumn(table, from string, to ColumnDefinition) string {
+	return fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s;", e.quote(table), e.quote(from), e.quote(to.Name))
+}
+
+// CreateIndex renders UNIQUE and plain indexes and partial indexes. Index
+// types, options, comments, prefix lengths and the FULLTEXT and SPATIAL
+// classes are MySQL features and are left out.
+func (e SQLiteEmitter) CreateIndex(table string, index IndexDefinition) string {
+	idx := normalizeIndex(index.state())
+	prefix := ""
+	if idx.Class == "UNIQUE" {
+		prefix = "UNIQUE "
+	}
+	parts := make([]string, 0, len(idx.Fields))
+	for _, field := range idx.Fields {
+		parts = append(parts, e.indexField(field))
+	}
+	sql := fmt.Sprintf("CREATE %sINDEX %s%s ON %s (%s)", prefix, ifNotExistsClause(e.IfExists), e.quote(index.Name), e.quote(table), strings.Join(parts, ", "))
+	if idx.Where != "" {
+		sql += " WHERE " + idx.Where
+	}
+	return sql + ";"
+}
+
+func (e SQLiteEmitter) indexField(field indexFieldState) string {
+	base := strings.TrimSpace(field.Expression)
+	if base == "" {
+		base = e.quote(field.Column)
+	}
+	if collate := strings.TrimSpace(field.Collate); collate != "" {
+		base += " COLLATE " + collate
+	}
+	if sort := strings.TrimSpace(field.Sort); sort != "" {
+		base += " " + strings.ToUpper(sort)
+	}
+	return base
+}
+
+// DropIndex ignores table: SQLite index names are unique per database.
+func (e SQLiteEmitter) DropIndex(table, index string) string {
+	return fmt.Sprintf("DROP INDEX IF EXISTS %s;", e.quote(index))
+}
+
+// RenameIndex is not supported by SQLite; the generator drops and recreates
+// the index instead.
+func (e SQLiteEmitter) RenameIndex(table, from, to string) string {
+	return ""
+}
+
+// AddForeignKey returns no SQL; the constraint is part of CREATE TABLE.
+func (e SQLiteEmitter) AddForeignKey(table string, fk ForeignKeyDefinition) string {
+	return ""
+}
+
+// DropForeignKey returns no SQL; the constraint goes with its table.
+func (e SQLiteEmitter) DropForeignKey(table, constraint string) string {
+	return ""
+}
+
+// ChangePrimaryKey returns no SQL; the generator rebuilds the table.
+func (e SQLiteEmitter) ChangePrimaryKey(table string, from, to []string) string {
+	return ""
+}
+
+// SetColumnDefault returns no SQL; the generator rebuilds the table.
+func (e SQLiteEmitter) SetColumnDefault(table, column, value string) string {
+	return ""
+}
+
+// SetColumnComment returns no SQL; SQLite has no comments.
+func (e SQLiteEmitter) SetColumnComment(table string, column ColumnDefinition) string {
+	return ""
+}
+
+// MoveColumn returns no SQL; SQLite cannot reorder columns.
+func (e SQLiteEmitter) MoveColumn(table string, column ColumnDefinition) string {
+	return ""
+}
+
+// SetTableCharset returns no SQL; SQLite sets the encoding per database.
+func (e SQLiteEmitter) SetTableCharset(table, charset, collation string) string {
+	return ""
+}
+
+// SetTableCollation returns no SQL; SQLite collations are per column.
+func (e SQLiteEmitter) SetTableCollation(table, collation string) string {
+	return ""
+}
+
+// SetTableEngine returns no SQL; SQLite has no storage engines.
+func (e SQLiteEmitter) SetTableEngine(table, engine string) string {
+	return ""
+}
+
+// SetTableComment returns no SQL; SQLite has no comments.
+func (e SQLiteEmitter) SetTableComment(table, comment string) string {
+	return ""
+}
+
+// SetTableTablespace returns no SQL; SQLite has no tablespaces.
+func (e SQLiteEmitter) SetTableTablespace(table, tablespace string) string {
+	return ""
+}
+
+// SetIndexTablespace returns no SQL; SQLite has no tablespaces.
+func (e SQLiteEmitter) SetIndexTablespace(table, index, tablespace string) string {
+	return ""
+}
+
+// SetAutoIncrement returns no SQL; SQLite only changes counters through its
+// sqlite_sequence table.
+func (e SQLiteEmitter) SetAutoIncrement(table string, value uint64) string {
+	return ""
+}
+
+// validateSQLiteOps rejects operations SQLite would run one side of, or
+// neither, because SQLiteEmitter has no statement for them. Only foreign key
+// operations may carry no SQL: SQLite declares foreign keys in CREATE TABLE
+// and changes them by rebuilding the table.
+func validateSQLiteOps(ops []migrationOp) error {
+	for _, op := range ops {
+		up, down := strings.TrimSpace(op.up) != "", strings.TrimSpace(op.down) != ""
+		if up && down {
+			continue
+		}
+		switch op.kind {
+		case opAddForeignKey, opDropForeignKey, opRenameForeignKey:
+			if !up && !down {
+				continue
+			}
+		}
+		return fmt.Errorf("table `%s` %s `%s`: SQLite has no statement for this change in both directions; generate for another dialect or change the model so the table is rebuilt", op.table, operationKinds[op.kind], op.name)
+	}
+	return nil
+}
+
+// sqliteNeedsRebuild reports whether a change to an existing table goes
+// beyond what SQLite can alter in place: adding columns and changing
+// indexes.
+func sqliteNeedsRebuild(prev, cur tableState, opts Options) bool {
+	for col, prevCol := range prev.Columns {
+		curCol, ok := cur.Columns[col]
+		if !ok || !opts.columnEqual(prevCol.Definition, curCol.Definition) {
+			return true
+		}
+	}
+	if primaryKeyChanged(prev, cur) || len(prev.ForeignKeys) != len(cur.ForeignKeys) {
+		return true
+	}
+	for name, fk := range prev.ForeignKeys {
+		curFK, ok := cur.ForeignKeys[name]
+		if !ok || !opts.foreignKeyEqual(fk, curFK) {
+			return true
+		}
+	}
+	return false
+}
+
+// sqliteRebuildTableOp replaces a table with a copy that has the new
+// definition: the copy is created under a temporary name, the rows of the
+// columns both definitions share are copied over, and the old table is
+// dropped before the copy takes its name and gets its indexes. SQLite
+// drops a table's indexes with it, so creating them last avoids name
+// clashes. Foreign key enforcement is turned off around it, since dropping
+// the old table would otherwise cascade into or fail on the tables that
+// reference it, and PRAGMA foreign_key_check then reports rows the new
+// definition no longer accepts; Apply fails the migration on any.
+func sqliteRebuildTableOp(tableName string, prev, cur tableState, opts Options) migrationOp {
+	op := migrationOp{
+		kind:  opRecreateTable,
+		table: tableName,
+		name:  tableName,
+		up:    sqliteRebuildTableSQL(tableName, prev, cur, opts),
+		down:  sqliteRebuildTableSQL(tableName, cur, prev, opts),
+		apply: func(tables map[string]tableState) {
+			tables[tableName] = cloneTableState(cur)
+		},
+	}
+	for _, col := range sortedKeys(prev.Columns) {
+		if _, ok := cur.Columns[col]; !ok {
+			op.warnings = append(op.warnings, droppedColumnWarning(tableName, col))
+		}
+	}
+	return op
+}
+
+func sqliteRebuildTableSQL(tableName string, from, to tableState, opts Options) string {
+	em := opts.emitter()
+	tmpName := "_" + tableName + "_new"
+	def := tableDefinitionOf(tmpName, to, opts)
+	indexes := def.Indexes
+	def.Indexes = nil
+
+	shared := make([]string, 0, len(to.Columns))
+	for _, col := range orderedColumns(to, opts.ColumnOrdering) {
+		if _, ok := from.Columns[col]; ok {
+			shared = append(shared, col)
+		}
+	}
+	q := SQLiteEmitter{QuoteMode: opts.QuoteMode}
+	stmts := []string{em.CreateTable(def)}
+	if len(shared) > 0 {
+		stmts = append(stmts, fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s;", q.quote(tmpName), q.columns(shared), q.columns(shared), q.quote(tableName)))
+	}
+	stmts = append(stmts, em.DropTable(tableName), em.RenameTable(tmpName, tableName))
+	for _, idx := range indexes {
+		stmts = append(stmts, em.CreateIndex(tableName, idx))
+	}
+	stmts = append([]string{sqliteForeignKeysOff}, stmts...)
+	stmts = append(stmts, fmt.Sprintf("PRAGMA foreign_key_check(%s);", q.quote(tableName)), sqliteForeignKeysOn)
+	return strings.Join(stmts, "\n")
+}
+
+const (
+	sqliteForeignKeysOff = "PRAGMA foreign_keys = OFF;"
+	sqliteForeignKeysOn  = "PRAGMA foreign_keys = ON;"
+)
@@ -0,0 +1,176 @@
+package gomigration
+
+import (
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type sqliteNoteBefore struct {
+	ID    uint   `gorm:"primaryKey"`
+	Title string `gorm:"size:64;index:idx_notes_title,length:10"`
+	Body  string
+	Draft bool
+}
+
+func (sqliteNoteBefore) TableName() string { return "notes" }
+
+type sqliteNoteAfter struct {
+	ID     uint   `gorm:"primaryKey"`
+	Title  string `gorm:"size:64;not null;default:'';index:idx_notes_title,length:10"`
+	Body   string
+	Rating int
+}
+
+func (sqliteNoteAfter) TableName() string { return "notes" }
+
+func TestMakeMigrationsSQLite(t *testing.T) {
+	result, err := MakeMigrationsWithOptions(migrationModels(), t.TempDir(), "init_schema", "", Options{Dialect: DialectSQLite, SelfVerify: true})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	up := readMigration(t, result.UpPath)
+	if strings.Contains(up, "`") || strings.Contains(up, "ADD CONSTRAINT") {
+		t.Fatalf("expected SQLite DDL with inline foreign keys, got:\n%s", up)
+	}
+	assertContainsAll(t, up, []string{
+		"CREATE TABLE \"test_users\" (\n  \"id\" integer PRIMARY KEY AUTOINCREMENT\n);",
+		`  CONSTRAINT "fk_test_user_groups_relation_user" FOREIGN KEY ("relation_user_id") REFERENCES "test_users" ("id")`,
+	})
+
+	if _, err := MakeMigrationsWithOptions(migrationModels(), t.TempDir(), "init", "", Options{Dialect: DialectSQLite, RebuildTables: []string{"test_users"}}); err == nil {
+		t.Fatalf("expected error for RebuildTables with SQLite")
+	}
+}
+
+func TestSQLiteEmitterCreateIndex(t *testing.T) {
+	idx := IndexDefinition{
+		Name:    "idx_notes_title",
+		Class:   "UNIQUE",
+		Type:    "BTREE",
+		Comment: "lookup",
+		Where:   "draft = 0",
+		Fields:  []IndexField{{Column: "title", Length: 10}, {Column: "id", Sort: "desc"}},
+	}
+	want := `CREATE UNIQUE INDEX "idx_notes_title" ON "notes" ("title", "id" DESC) WHERE draft = 0;`
+	if got := (SQLiteEmitter{}).CreateIndex("notes", idx); got != want {
+		t.Fatalf("unexpected index SQL:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestSQLiteRebuildsTableForUnsupportedAlter(t *testing.T) {
+	opts := Options{Dialect: DialectSQLite}
+	before, err := buildCurrentStateWithOptions([]any{&sqliteNoteBefore{}}, opts)
+	if err != nil {
+		t.Fatalf("buildCurrentStateWithOptions before failed: %v", err)
+	}
+	after, err := buildCurrentStateWithOptions([]any{&sqliteNoteAfter{}}, opts)
+	if err != nil {
+		t.Fatalf("buildCurrentStateWithOptions after failed: %v", err)
+	}
+
+	ops := diffSchemas(before, after, opts)
+	if len(ops) != 1 || ops[0].kind != opRecreateTable {
+		t.Fatalf("expected a single table rebuild, got %#v", ops)
+	}
+	if err := verifyMigrationOps(before, after, ops, opts); err != nil {
+		t.Fatalf("unexpected self-check failure: %v", err)
+	}
+	assertContainsAll(t, ops[0].up, []string{
+		`CREATE TABLE "_notes_new" (`,
+		`INSERT INTO "_notes_new" ("body", "id", "title") SELECT "body", "id", "title" FROM "notes";`,
+		`DROP TABLE IF EXISTS "notes";`,
+		`ALTER TABLE "_notes_new" RENAME TO "notes";`,
+		`CREATE INDEX "idx_notes_title" ON "notes" ("title");`,
+	})
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite failed: %v", err)
+	}
+	up, down := splitMigrationOps(diffSchemas(schemaState{Tables: map[string]tableState{}}, before, opts))
+	run := func(sql []string) {
+		t.Helper()
+		for _, stmt := range splitSQLStatements(strings.Join(sql, "\n")) {
+			if err := db.Exec(stmt).Error; err != nil {
+				t.Fatalf("exec %s: %v", stmt, err)
+			}
+		}
+	}
+	run(up)
+	if err := db.Exec(`INSERT INTO "notes" ("id", "title", "body", "draft") VALUES (1, 'first', 'hello', 1)`).Error; err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	run([]string{ops[0].up})
+	var title string
+	if err := db.Raw(`SELECT "title" FROM "notes" WHERE "id" = 1 AND "rating" IS NULL`).Scan(&title).Error; err != nil || title != "first" {
+		t.Fatalf("expected the row to survive the rebuild, got %q, %v", title, err)
+	}
+	run([]string{ops[0].down})
+	if err := db.Exec(`SELECT "draft" FROM "notes"`).Error; err != nil {
+		t.Fatalf("expected the down to restore the dropped column: %v", err)
+	}
+	run(down)
+}
+
+func TestValidateSQLiteOpsRejectsOneSidedOperations(t *testing.T) {
+	ops := []migrationOp{
+		{kind: opAddForeignKey, table: "posts", name: "fk_posts_user"},
+		{kind: opCreateIndex, table: "posts", name: "idx_posts_title", up: `CREATE INDEX "idx_posts_title" ON "posts" ("title");`, down: `DROP INDEX IF EXISTS "idx_posts_title";`},
+	}
+	if err := validateSQLiteOps(ops); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ops = append(ops, migrationOp{kind: opRenameIndex, table: "posts", name: "idx_posts_title", down: `DROP INDEX IF EXISTS "idx_posts_title";`})
+	if err := validateSQLiteOps(ops); err == nil || !strings.Contains(err.Error(), "SQLite has no statement for this change") {
+		t.Fatalf("expected the one-sided operation to be rejected, got %v", err)
+	}
+}
+
+func TestApplyFailsSQLiteRebuildThatBreaksForeignKeys(t *testing.T) {
+	dir := t.TempDir()
+	writeMigrationPair(t, dir, "20240101000000_init",
+		[]string{
+			`CREATE TABLE "parents" ("id" integer PRIMARY KEY);`,
+			`CREATE TABLE "children" ("id" integer PRIMARY KEY, "parent_id" integer);`,
+			`INSERT INTO "children" ("id", "parent_id") VALUES (1, 7);`,
+		},
+		[]string{`DROP TABLE IF EXISTS "children";`, `DROP TABLE IF EXISTS "parents";`})
+	rebuild := strings.Join([]string{
+		sqliteForeignKeysOff,
+		`CREATE TABLE "_children_new" ("id" integer PRIMARY KEY, "parent_id" integer REFERENCES "parents" ("id"));`,
+		`INSERT INTO "_children_new" ("id", "parent_id") SELECT "id", "parent_id" FROM "children";`,
+		`DROP TABLE IF EXISTS "children";`,
+		`ALTER TABLE "_children_new" RENAME TO "children";`,
+		`PRAGMA foreign_key_check("children");`,
+		sqliteForeignKeysOn,
+	}, "\n")
+	writeMigrationPair(t, dir, "20240102000000_add_fk", []string{rebuild}, []string{rebuild})
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite failed: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("db.DB failed: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.Exec("PRAGMA foreign_keys = ON").Error; err != nil {
+		t.Fatalf("enable foreign keys failed: %v", err)
+	}
+
+	err = Apply(db, dir)
+	if err == nil || !strings.Contains(err.Error(), `PRAGMA foreign_key_check("children"): foreign key violations: 1`) {
+		t.Fatalf("expected the foreign key check to fail the migration, got %v", err)
+	}
+	var enabled int
+	if err := db.Raw("PRAGMA foreign_keys").Scan(&enabled).Error; err != nil || enabled != 1 {
+		t.Fatalf("expected foreign keys to be enabled again, got %d, %v", enabled, err)
+	}
+	if versions, err := AppliedVersions(db); err != nil || len(versions) != 1 {
+		t.Fatalf("expected only the first version to be recorded, got %v, %v", versions, err)
+	}
+}
@@ -0,0 +1,183 @@
+package gomigration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const squashArchiveDir = "archive"
+
+var squashHeaderPattern = regexp.MustCompile(`^-- Squashed \d+ to \d+\. Databases that applied \d+ recorded checksum ([0-9a-f]{64})\.$`)
+
+// SquashResult is the MakeMigrationsResult of the baseline migration.
+type SquashResult struct {
+	MakeMigrationsResult
+	// Squashed lists the versions the baseline replaces, oldest first.
+	Squashed []string
+	// ArchiveDir is the directory their files were moved to.
+	ArchiveDir string
+}
+
+// Squash replaces the migrations in dir with one baseline migration that
+// creates every table of the saved state, with its keys, indexes and
+// foreign keys, and drops them all in its down. The old files are moved to
+// dir/archive. The baseline takes the version of the newest old migration,
+// so Apply skips it on databases that ran the old files and runs it on new
+// ones. It fails if the models have changes MakeMigrations has not written
+// yet, which the baseline would otherwise hide from existing databases, and
+// moves the old files back when the baseline cannot be written. The
+// arguments come in the order MakeMigrations takes them: name before
+// stateFile.
+func Squash(models []any, dir, name, stateFile string) (SquashResult, error) {
+	return SquashWithOptions(models, dir, name, stateFile, Options{})
+}
+
+// SquashWithOptions is Squash with options for the baseline, such as its
+// Dialect. CombinedFile and PerTableFiles are rejected, since the baseline
+// is a single up and down pair.
+func SquashWithOptions(models []any, dir, name, stateFile string, opts Options) (SquashResult, error) {
+	result := SquashResult{}
+	if err := opts.validate(); err != nil {
+		return result, err
+	}
+	if opts.CombinedFile || opts.PerTableFiles {
+		return result, fmt.Errorf("Squash writes one up/down pair and cannot be used with CombinedFile or PerTableFiles")
+	}
+	if strings.TrimSpace(name) == "" {
+		return result, fmt.Errorf("--name is required")
+	}
+	if strings.TrimSpace(dir) == "" {
+		dir = filepath.Join("database", "migrations")
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return result, err
+	}
+	if strings.TrimSpace(stateFile) == "" {
+		stateFile = filepath.Join(absDir, ".schema_state.json")
+	}
+	absStateFile, err := filepath.Abs(stateFile)
+	if err != nil {
+		return result, err
+	}
+	result.StatePath = absStateFile
+
+	ops, saved, err := planMigration(context.Background(), models, absStateFile, opts)
+	if err != nil {
+		return result, err
+	}
+	if up, _ := splitMigrationOps(ops); len(up) > 0 {
+		return result, fmt.Errorf("the models have %d changes without a migration; run MakeMigrations before squashing", len(up))
+	}
+	files, err := listMigrationFiles(absDir)
+	if err != nil {
+		return result, err
+	}
+	if len(files) == 0 {
+		return result, fmt.Errorf("no migrations to squash in %s", absDir)
+	}
+	groups := groupMigrationFiles(files)
+	first, last := groups[0][0].Version, groups[len(groups)-1]
+	version := last[0].Version
+	lastChecksum, err := versionChecksum(last)
+	if err != nil {
+		return result, err
+	}
+
+	archiveDir := filepath.Join(absDir, squashArchiveDir)
+	moves := make(map[string]string, 2*len(files))
+	for _, path := range migrationFilePaths(files) {
+		target := filepath.Join(archiveDir, filepath.Base(path))
+		if _, err := os.Stat(target); err == nil {
+			return result, fmt.Errorf("%s is already archived in %s", filepath.Base(path), archiveDir)
+		}
+		moves[path] = target
+	}
+	if err := os.MkdirAll(archiveDir, 0o755); err != nil {
+		return result, err
+	}
+	manifestPath := filepath.Join(absDir, manifestFile)
+	manifest, manifestErr := os.ReadFile(manifestPath)
+	moved := make([]string, 0, len(moves))
+	// unarchive puts dir back the way it was when a later step fails, so a
+	// failed squash never leaves it without migrations.
+	unarchive := func(failure error, written ...string) error {
+		removeFiles(written)
+		for _, path := range moved {
+			if err := os.Rename(moves[path], path); err != nil {
+				return fmt.Errorf("%w; moving %s back from %s failed: %v", failure, filepath.Base(path), archiveDir, err)
+			}
+		}
+		switch {
+		case manifestErr == nil:
+			if err := writeFileAtomic(manifestPath, manifest); err != nil {
+				return fmt.Errorf("%w; restoring %s failed: %v", failure, manifestFile, err)
+			}
+		case os.IsNotExist(manifestErr):
+			removeFiles([]string{manifestPath})
+		}
+		return failure
+	}
+	for _, path := range sortedKeys(moves) {
+		if err := os.Rename(path, moves[path]); err != nil {
+			return result, unarchive(err)
+		}
+		moved = append(moved, path)
+	}
+
+	upSQL, downSQL := markedMigrationOps(diffSchemas(schemaState{Tables: map[string]tableState{}}, saved, opts))
+	header := fmt.Sprintf("-- Squashed %s to %s. Databases that applied %s recorded checksum %s.", first, version, version, lastChecksum)
+	upPath, downPath, err := writeMigrationFiles(absDir, version, name, append([]string{header}, opts.wrapFileSQL(upSQL)...), opts.wrapFileSQL(downSQL), opts.FileEncoding)
+	if err != nil {
+		return result, unarchive(err)
+	}
+	if err := updateManifest(absDir); err != nil {
+		return result, unarchive(err, upPath, downPath)
+	}
+	if err := saveStateFiles(absStateFile, opts.StateFiles, saved); err != nil {
+		return result, unarchive(err, upPath, downPath)
+	}
+
+	result.Changed = true
+	result.Version = version
+	result.UpPath, result.DownPath = upPath, downPath
+	result.UpPaths, result.DownPaths = []string{upPath}, []string{downPath}
+	for _, group := range groups {
+		result.Squashed = append(result.Squashed, group[0].Version)
+	}
+	result.ArchiveDir = archiveDir
+	return result, nil
+}
+
+// migrationFilePaths lists the up files of files and the down files that
+// exist.
+func migrationFilePaths(files []migrationFile) []string {
+	paths := make([]string, 0, 2*len(files))
+	for _, file := range files {
+		paths = append(paths, file.UpPath)
+		if _, err := os.Stat(file.DownPath); err == nil {
+			paths = append(paths, file.DownPath)
+		}
+	}
+	return paths
+}
+
+// squashedChecksum returns the checksum that databases which applied the
+// migrations a Squash baseline replaces recorded for its version, or an
+// empty string for any other migration.
+func squashedChecksum(group []migrationFile) (string, error) {
+	upSQL, err := readSQLFile(group[0].UpPath)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(upSQL, "\n") {
+		if m := squashHeaderPattern.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			return m[1], nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,156 @@
+package gomigration
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type squashUser struct {
+	ID   uint   `gorm:"primaryKey"`
+	Name string `gorm:"size:64;not null"`
+}
+
+func (squashUser) TableName() string { return "squash_users" }
+
+type squashOrder struct {
+	ID     uint `gorm:"primaryKey"`
+	UserID uint `gorm:"index"`
+	User   squashUser
+}
+
+func (squashOrder) TableName() string { return "squash_orders" }
+
+type squashUserEmail struct {
+	ID    uint   `gorm:"primaryKey"`
+	Name  string `gorm:"size:64;not null"`
+	Email string `gorm:"size:191"`
+}
+
+func (squashUserEmail) TableName() string { return "squash_users" }
+
+func sqliteTables(t *testing.T, db *gorm.DB) []string {
+	t.Helper()
+	var names []string
+	if err := db.Raw(`SELECT name FROM sqlite_master WHERE type = 'table' AND name LIKE 'squash_%' ORDER BY name`).Scan(&names).Error; err != nil {
+		t.Fatalf("query sqlite_master failed: %v", err)
+	}
+	return names
+}
+
+func TestSquash(t *testing.T) {
+	dir := t.TempDir()
+	opts := Options{Dialect: DialectSQLite}
+	opts.Version = "1"
+	if _, err := MakeMigrationsWithOptions([]any{&squashUser{}}, dir, "users", "", opts); err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	opts.Version = "2"
+	if _, err := MakeMigrationsWithOptions([]any{&squashUser{}, &squashOrder{}}, dir, "orders", "", opts); err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	migrated := openMigrationsTableDB(t)
+	if err := Apply(migrated, dir); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	if _, err := SquashWithOptions([]any{&squashUserEmail{}, &squashOrder{}}, dir, "baseline", "", Options{Dialect: DialectSQLite}); err == nil || !strings.Contains(err.Error(), "run MakeMigrations before squashing") {
+		t.Fatalf("expected pending model changes to be rejected, got %v", err)
+	}
+
+	result, err := SquashWithOptions([]any{&squashUser{}, &squashOrder{}}, dir, "baseline", "", Options{Dialect: DialectSQLite})
+	if err != nil {
+		t.Fatalf("SquashWithOptions failed: %v", err)
+	}
+	if result.Version != "2" || filepath.Base(result.UpPath) != "2_baseline.up.sql" || !reflect.DeepEqual(result.Squashed, []string{"1", "2"}) {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	remaining, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil || len(remaining) != 2 {
+		t.Fatalf("expected only the baseline pair in the directory, got %v", remaining)
+	}
+	for _, name := range []string{"1_users.up.sql", "1_users.down.sql", "2_orders.up.sql", "2_orders.down.sql"} {
+		if _, err := os.Stat(filepath.Join(result.ArchiveDir, name)); err != nil {
+			t.Fatalf("expected %s to be archived: %v", name, err)
+		}
+	}
+	if err := VerifyManifest(dir); err != nil {
+		t.Fatalf("expected the manifest to list the baseline only: %v", err)
+	}
+
+	up := readMigration(t, result.UpPath)
+	if !strings.HasPrefix(up, "-- Squashed 1 to 2. Databases that applied 2 recorded checksum ") ||
+		strings.Index(up, `CREATE TABLE "squash_users"`) > strings.Index(up, `CREATE TABLE "squash_orders"`) {
+		t.Fatalf("unexpected baseline:\n%s", up)
+	}
+	assertContainsAll(t, up, []string{`CREATE TABLE "squash_orders"`, `CREATE TABLE "squash_users"`, `CREATE INDEX "idx_squash_orders_user_id"`, `REFERENCES "squash_users"`})
+	down := readMigration(t, result.DownPath)
+	if strings.Index(down, `DROP TABLE IF EXISTS "squash_orders"`) > strings.Index(down, `DROP TABLE IF EXISTS "squash_users"`) {
+		t.Fatalf("expected the down to drop the referencing table first:\n%s", down)
+	}
+
+	// The database that ran the old files accepts the baseline as applied;
+	// a new one gets the same tables from it.
+	if err := Apply(migrated, dir); err != nil {
+		t.Fatalf("Apply after squashing failed: %v", err)
+	}
+	fresh := openMigrationsTableDB(t)
+	if err := Apply(fresh, dir); err != nil {
+		t.Fatalf("Apply of the baseline failed: %v", err)
+	}
+	if got, want := sqliteTables(t, fresh), sqliteTables(t, migrated); !reflect.DeepEqual(got, want) || len(got) != 2 {
+		t.Fatalf("expected the baseline to create %v, got %v", want, got)
+	}
+	if err := Rollback(fresh, dir); err != nil {
+		t.Fatalf("Rollback of the baseline failed: %v", err)
+	}
+	if got := sqliteTables(t, fresh); len(got) != 0 {
+		t.Fatalf("expected the baseline down to drop every table, got %v", got)
+	}
+
+	// Editing the baseline is still caught where it was applied.
+	if err := Apply(fresh, dir); err != nil {
+		t.Fatalf("Apply of the baseline failed: %v", err)
+	}
+	if err := os.WriteFile(result.UpPath, []byte(up+"\n-- edited\n"), 0o644); err != nil {
+		t.Fatalf("rewrite baseline failed: %v", err)
+	}
+	if err := Apply(fresh, dir); err == nil || !strings.Contains(err.Error(), "migration 2 was changed after it was applied") {
+		t.Fatalf("expected an edited baseline to be refused, got %v", err)
+	}
+}
+
+func TestSquashMovesFilesBackWhenTheBaselineFails(t *testing.T) {
+	dir := t.TempDir()
+	opts := Options{Dialect: DialectSQLite}
+	opts.Version = "1"
+	if _, err := MakeMigrationsWithOptions([]any{&squashUser{}}, dir, "users", "", opts); err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	// A directory in the way of the baseline's down file fails the write.
+	if err := os.Mkdir(filepath.Join(dir, "1_baseline.down.sql"), 0o755); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+
+	if _, err := SquashWithOptions([]any{&squashUser{}}, dir, "baseline", "", Options{Dialect: DialectSQLite}); err == nil {
+		t.Fatalf("expected the baseline write to fail")
+	}
+	for _, name := range []string{"1_users.up.sql", "1_users.down.sql"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("expected %s to be moved back: %v", name, err)
+		}
+	}
+	if archived, _ := filepath.Glob(filepath.Join(dir, squashArchiveDir, "*.sql")); len(archived) != 0 {
+		t.Fatalf("expected nothing left in the archive, got %v", archived)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "1_baseline.up.sql")); !os.IsNotExist(err) {
+		t.Fatalf("expected no baseline up file, got %v", err)
+	}
+	if err := VerifyManifest(dir); err != nil {
+		t.Fatalf("expected the manifest to be unchanged: %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package gomigration
+
+import "fmt"
+
+// stateVersion is the state file format saveState writes. Version 0 is a
+// state file written before the format was versioned.
+const stateVersion = 2
+
+// stateUpgrades[v] upgrades a state of version v to version v+1.
+var stateUpgrades = []func(schemaState) schemaState{
+	upgradeStateV0,
+	upgradeStateV1,
+}
+
+// upgradeState brings a loaded state to the current format in memory, so an
+// older state file does not produce changes its models do not have. The file
+// itself is rewritten with the next saveState.
+func upgradeState(state schemaState) (schemaState, error) {
+	if state.Version < 0 || state.Version > stateVersion {
+		return schemaState{}, fmt.Errorf("state file format version %d is not supported, this version of go-migration reads up to version %d; upgrade go-migration to read it", state.Version, stateVersion)
+	}
+	for state.Version < stateVersion {
+		state = stateUpgrades[state.Version](state)
+		state.Version++
+	}
+	return state, nil
+}
+
+// upgradeStateV0 records the column comments that version 0 only kept in
+// MySQL definitions.
+func upgradeStateV0(state schemaState) schemaState {
+	for tableName, table := range state.Tables {
+		if table.Columns == nil {
+			table.Columns = map[string]columnState{}
+		}
+		for name, col := range table.Columns {
+			if col.Comment == "" {
+				col.Comment = definitionComment(col.Definition)
+				table.Columns[name] = col
+			}
+		}
+		state.Tables[tableName] = table
+	}
+	return state
+}
+
+// upgradeStateV1 records the generation expression and storage of generated
+// columns, which version 1 only kept in their definitions.
+func upgradeStateV1(state schemaState) schemaState {
+	for _, table := range state.Tables {
+		for name, col := range table.Columns {
+			if col.Generated == "" {
+				col.Generated = generatedColumnExpression(col.Definition)
+				col.GeneratedStorage = generatedColumnStorage(col.Definition)
+				table.Columns[name] = col
+			}
+		}
+	}
+	return state
+}
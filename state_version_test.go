@@ -0,0 +1,65 @@
+package gomigration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadStateUpgradesVersion0(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".schema_state.json")
+	v0 := `{
+  "tables": {
+    "comment_people": {
+      "columns": {
+        "id": {"definition": "bigint unsigned AUTO_INCREMENT"},
+        "name": {"definition": "varchar(64) COMMENT 'display name'"}
+      },
+      "primary_keys": ["id"]
+    }
+  }
+}`
+	if err := os.WriteFile(path, []byte(v0), 0o644); err != nil {
+		t.Fatalf("write state: %v", err)
+	}
+	state, err := loadState(path)
+	if err != nil {
+		t.Fatalf("loadState failed: %v", err)
+	}
+	if state.Version != stateVersion {
+		t.Fatalf("expected version %d after loading, got %d", stateVersion, state.Version)
+	}
+	if got := state.Tables["comment_people"].Columns["name"].Comment; got != "display name" {
+		t.Fatalf("expected the column comment to be upgraded, got %q", got)
+	}
+
+	current, err := buildCurrentState([]any{&commentBefore{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState failed: %v", err)
+	}
+	if ops := diffSchemas(state, current, Options{}); len(ops) != 0 {
+		t.Fatalf("expected no ops against an upgraded state, got %#v", ops)
+	}
+
+	if err := saveState(path, state); err != nil {
+		t.Fatalf("saveState failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read state: %v", err)
+	}
+	if !strings.Contains(string(data), `"version": 2,`) {
+		t.Fatalf("expected the saved state to carry its version, got %s", data)
+	}
+}
+
+func TestLoadStateRejectsNewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".schema_state.json")
+	if err := os.WriteFile(path, []byte(`{"version": 99, "tables": {}}`), 0o644); err != nil {
+		t.Fatalf("write state: %v", err)
+	}
+	if _, err := loadState(path); err == nil || !strings.Contains(err.Error(), "upgrade go-migration") {
+		t.Fatalf("expected an upgrade hint for a newer state format, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package gomigration
+
+import "fmt"
+
+func (o Options) selectsTables() bool {
+	return len(o.Tables) > 0 || len(o.ExcludeTables) > 0
+}
+
+// tableSelected reports whether Options.Tables and Options.ExcludeTables
+// leave tableName in the migration.
+func (o Options) tableSelected(tableName string) bool {
+	if len(o.Tables) > 0 && !containsString(o.Tables, tableName) {
+		return false
+	}
+	return !containsString(o.ExcludeTables, tableName)
+}
+
+func selectTables(state schemaState, opts Options) schemaState {
+	out := schemaState{Version: state.Version, Tables: map[string]tableState{}}
+	for name, table := range state.Tables {
+		if opts.tableSelected(name) {
+			out.Tables[name] = table
+		}
+	}
+	return out
+}
+
+// withUnselectedTables adds the tables left out of the migration to saved as
+// they were in previous, so their changes wait for a later migration.
+func withUnselectedTables(previous, saved schemaState, opts Options) schemaState {
+	out := schemaState{Version: saved.Version, Tables: map[string]tableState{}}
+	for name, table := range previous.Tables {
+		if !opts.tableSelected(name) {
+			out.Tables[name] = table
+		}
+	}
+	for name, table := range saved.Tables {
+		out.Tables[name] = table
+	}
+	return out
+}
+
+// validateTableSelection rejects foreign keys that cross the boundary of the
+// selected tables to a table the database will not have: a selected table
+// referencing a left out one that is not in the saved state yet, or a left
+// out table referencing a selected one the migration drops.
+func validateTableSelection(previous, current schemaState, opts Options) error {
+	for _, name := range sortedKeys(current.Tables) {
+		if !opts.tableSelected(name) {
+			continue
+		}
+		fks := current.Tables[name].ForeignKeys
+		for _, fkName := range sortedKeys(fks) {
+			ref := fks[fkName].RefTable
+			if _, saved := previous.Tables[ref]; opts.tableSelected(ref) || saved {
+				continue
+			}
+			return fmt.Errorf("table `%s` foreign key `%s` references `%s`, which is left out of the migration and not in the saved state; select `%s` too", name, fkName, ref, ref)
+		}
+	}
+	for _, name := range sortedKeys(previous.Tables) {
+		if opts.tableSelected(name) {
+			continue
+		}
+		fks := previous.Tables[name].ForeignKeys
+		for _, fkName := range sortedKeys(fks) {
+			ref := fks[fkName].RefTable
+			if _, kept := current.Tables[ref]; !opts.tableSelected(ref) || kept {
+				continue
+			}
+			return fmt.Errorf("table `%s` is dropped but foreign key `%s` of `%s`, which is left out of the migration, references it; select `%s` too", ref, fkName, name, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package gomigration
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type filterUser struct {
+	ID uint `gorm:"primaryKey"`
+}
+
+func (filterUser) TableName() string { return "filter_users" }
+
+type filterOrder struct {
+	ID     uint `gorm:"primaryKey"`
+	UserID uint
+	User   filterUser `gorm:"foreignKey:UserID"`
+}
+
+func (filterOrder) TableName() string { return "filter_orders" }
+
+type filterAudit struct {
+	ID   uint   `gorm:"primaryKey"`
+	Note string `gorm:"size:64"`
+}
+
+func (filterAudit) TableName() string { return "filter_audits" }
+
+func filterModels() []any {
+	return []any{&filterUser{}, &filterOrder{}, &filterAudit{}}
+}
+
+func TestMakeMigrationsSelectedTables(t *testing.T) {
+	dir := t.TempDir()
+	stateFile := filepath.Join(dir, ".schema_state.json")
+
+	result, err := MakeMigrationsWithOptions(filterModels(), dir, "audits", "", Options{Tables: []string{"filter_audits"}, Version: "1"})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	up := readMigration(t, result.UpPath)
+	if !strings.Contains(up, "CREATE TABLE `filter_audits`") || strings.Contains(up, "filter_users") || strings.Contains(up, "filter_orders") {
+		t.Fatalf("expected only filter_audits in the migration, got:\n%s", up)
+	}
+	state, err := loadState(stateFile)
+	if err != nil {
+		t.Fatalf("loadState failed: %v", err)
+	}
+	if got := sortedKeys(state.Tables); !reflect.DeepEqual(got, []string{"filter_audits"}) {
+		t.Fatalf("expected only filter_audits in the saved state, got %v", got)
+	}
+
+	// filter_orders references filter_users, which neither the selection
+	// nor the saved state has.
+	_, err = MakeMigrationsWithOptions(filterModels(), dir, "orders", "", Options{Tables: []string{"filter_orders"}, Version: "2"})
+	if err == nil || !strings.Contains(err.Error(), "references `filter_users`, which is left out of the migration") {
+		t.Fatalf("expected a foreign key crossing the selection to be rejected, got %v", err)
+	}
+
+	result, err = MakeMigrationsWithOptions(filterModels(), dir, "orders", "", Options{ExcludeTables: []string{"filter_audits"}, Version: "3"})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	assertContainsAll(t, readMigration(t, result.UpPath), []string{"CREATE TABLE `filter_users`", "CREATE TABLE `filter_orders`", "FOREIGN KEY (`user_id`) REFERENCES `filter_users`"})
+
+	// The excluded table keeps its saved state.
+	state, err = loadState(stateFile)
+	if err != nil {
+		t.Fatalf("loadState failed: %v", err)
+	}
+	if got := sortedKeys(state.Tables); !reflect.DeepEqual(got, []string{"filter_audits", "filter_orders", "filter_users"}) {
+		t.Fatalf("expected every table in the saved state, got %v", got)
+	}
+
+	// Dropping filter_users alone would break the foreign key of
+	// filter_orders.
+	_, err = MakeMigrationsWithOptions([]any{&filterAudit{}}, dir, "drop_users", "", Options{Tables: []string{"filter_users"}, Version: "5"})
+	if err == nil || !strings.Contains(err.Error(), "table `filter_users` is dropped but foreign key") {
+		t.Fatalf("expected dropping a table referenced from outside the selection to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package gomigration
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm/schema"
+)
+
+// IndexSpec declares an index in code, for indexes GORM tags cannot express.
+// It is the same description emitters receive.
+type IndexSpec = IndexDefinition
+
+// TableIndexesProvider is implemented by models that declare indexes beyond
+// their field tags. The indexes are merged with the tag-parsed ones; a name
+// used by both is an error.
+type TableIndexesProvider interface {
+	TableIndexes() []IndexSpec
+}
+
+func applyModelTableIndexes(table *tableState, sc *schema.Schema, dialect Dialect) error {
+	if table == nil || sc == nil || sc.ModelType == nil {
+		return nil
+	}
+	provider, ok := reflect.New(sc.ModelType).Interface().(TableIndexesProvider)
+	if !ok {
+		return nil
+	}
+	for _, spec := range provider.TableIndexes() {
+		name := strings.TrimSpace(spec.Name)
+		if name == "" {
+			return fmt.Errorf("table `%s` declares an index without a name in TableIndexes", sc.Table)
+		}
+		if _, exists := table.Indexes[name]; exists {
+			return fmt.Errorf("table `%s` index `%s` from TableIndexes conflicts with an existing index of the same name", sc.Table, name)
+		}
+		idx := normalizeIndex(spec.state())
+		if idx.Where != "" {
+			return fmt.Errorf("table `%s` index `%s` uses where=%q, which is unsupported for MySQL migrations", sc.Table, name, idx.Where)
+		}
+		if len(idx.Fields) == 0 {
+			return fmt.Errorf("table `%s` index `%s` from TableIndexes has no fields", sc.Table, name)
+		}
+		for _, field := range idx.Fields {
+			if field.Column == "" && field.Expression == "" {
+				return fmt.Errorf("table `%s` index `%s` from TableIndexes has a field without column or expression", sc.Table, name)
+			}
+			if _, ok := table.Columns[field.Column]; field.Column != "" && !ok {
+				return fmt.Errorf("table `%s` index `%s` from TableIndexes references unknown column `%s`", sc.Table, name, field.Column)
+			}
+		}
+		if limit := maxIndexFields(dialect); len(idx.Fields) > limit {
+			return fmt.Errorf("table `%s` index `%s` has %d fields, exceeding the %s limit of %d", sc.Table, name, len(idx.Fields), dialect, limit)
+		}
+		table.Indexes[name] = idx
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package gomigration
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type coveringIndexModel struct {
+	ID       uint   `gorm:"primaryKey"`
+	TenantID uint   `gorm:"index:idx_covering_tenant"`
+	Status   string `gorm:"size:16"`
+	Created  int64
+}
+
+func (coveringIndexModel) TableName() string { return "covering_models" }
+
+func (coveringIndexModel) TableIndexes() []IndexSpec {
+	return []IndexSpec{{
+		Name:   "idx_covering_tenant_status_created",
+		Fields: []IndexField{{Column: "tenant_id"}, {Column: "status"}, {Column: "created", Sort: "desc"}},
+	}}
+}
+
+type conflictingIndexModel struct {
+	ID       uint `gorm:"primaryKey"`
+	TenantID uint `gorm:"index:idx_conflict_tenant"`
+}
+
+func (conflictingIndexModel) TableName() string { return "conflicting_models" }
+
+func (conflictingIndexModel) TableIndexes() []IndexSpec {
+	return []IndexSpec{{Name: "idx_conflict_tenant", Fields: []IndexField{{Column: "tenant_id"}}}}
+}
+
+type unknownColumnIndexModel struct {
+	ID uint `gorm:"primaryKey"`
+}
+
+func (unknownColumnIndexModel) TableName() string { return "unknown_column_models" }
+
+func (unknownColumnIndexModel) TableIndexes() []IndexSpec {
+	return []IndexSpec{{Name: "idx_missing", Fields: []IndexField{{Column: "missing"}}}}
+}
+
+func TestBuildCurrentStateMergesTableIndexes(t *testing.T) {
+	state, err := buildCurrentState([]any{&coveringIndexModel{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState failed: %v", err)
+	}
+	indexes := state.Tables["covering_models"].Indexes
+	if _, ok := indexes["idx_covering_tenant"]; !ok {
+		t.Fatalf("expected the tag-parsed index to remain, got %v", sortedKeys(indexes))
+	}
+	want := indexState{Fields: []indexFieldState{{Column: "tenant_id"}, {Column: "status"}, {Column: "created", Sort: "DESC"}}}
+	if got := indexes["idx_covering_tenant_status_created"]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected declared index: %#v", got)
+	}
+	create := createTableSQL("covering_models", state.Tables["covering_models"])
+	if !strings.Contains(create, "KEY `idx_covering_tenant_status_created` (`tenant_id`, `status`, `created` DESC)") {
+		t.Fatalf("expected the declared index in CREATE TABLE, got:\n%s", create)
+	}
+
+	_, err = buildCurrentState([]any{&conflictingIndexModel{}})
+	if err == nil || !strings.Contains(err.Error(), "index `idx_conflict_tenant` from TableIndexes conflicts") {
+		t.Fatalf("expected duplicate name error, got %v", err)
+	}
+	_, err = buildCurrentState([]any{&unknownColumnIndexModel{}})
+	if err == nil || !strings.Contains(err.Error(), "unknown column `missing`") {
+		t.Fatalf("expected unknown column error, got %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+package gomigration
+
+import (
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm/schema"
+)
+
+// TableOptions are table-level settings a model declares by implementing
+// TableOptionsProvider.
+type TableOptions struct {
+	// Engine is the MySQL storage engine, e.g. InnoDB.
+	Engine  string
+	Charset string
+	Collate string
+	// Tablespace places the table in a named tablespace on MySQL and
+	// Postgres.
+	Tablespace string
+	Comment    string
+}
+
+type TableOptionsProvider interface {
+	TableOptions() TableOptions
+}
+
+func applyModelTableOptions(table *tableState, sc *schema.Schema) {
+	if table == nil || sc == nil || sc.ModelType == nil {
+		return
+	}
+	provider, ok := reflect.New(sc.ModelType).Interface().(TableOptionsProvider)
+	if !ok {
+		return
+	}
+	opts := provider.TableOptions()
+	table.Engine = strings.TrimSpace(opts.Engine)
+	table.Charset = strings.TrimSpace(opts.Charset)
+	table.Collation = strings.TrimSpace(opts.Collate)
+	table.Tablespace = strings.TrimSpace(opts.Tablespace)
+	table.Comment = strings.TrimSpace(opts.Comment)
+}
+
+func tableOptionsSQL(table tableState) string {
+	parts := make([]string, 0)
+	if table.Engine != "" {
+		parts = append(parts, "ENGINE="+table.Engine)
+	}
+	if table.Charset != "" {
+		parts = append(parts, "DEFAULT CHARSET="+table.Charset)
+	}
+	if table.Collation != "" {
+		parts = append(parts, "COLLATE="+table.Collation)
+	}
+	if table.Comment != "" {
+		parts = append(parts, "COMMENT="+quoteSQLString(table.Comment))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " " + strings.Join(parts, " ")
+}
+
+// diffTableCharset changes the table default charset with ALTER TABLE ...
+// DEFAULT CHARACTER SET and converts the textual columns that inherited the
+// old default with MODIFY COLUMN, rather than CONVERT TO CHARACTER SET,
+// which would also convert the columns that pin their own CHARACTER SET.
+// A charset the state does not record, before the model declared one or
+// after it stopped, is the server default (see mysqlDefaultCharset). The
+// conversions use the previous definition; any definition change is
+// emitted separately by diffTable.
+func diffTableCharset(tableName string, prev, cur tableState, opts Options) []migrationOp {
+	if strings.EqualFold(prev.Charset, cur.Charset) {
+		return nil
+	}
+	em := opts.emitter()
+	from, to := orDefault(prev.Charset, opts.mysqlDefaultCharset()), orDefault(cur.Charset, opts.mysqlDefaultCharset())
+	ops := []migrationOp{{
+		kind:  opTableCharset,
+		table: tableName,
+		name:  tableName,
+		up:    em.SetTableCharset(tableName, to, cur.Collation),
+		down:  em.SetTableCharset(tableName, from, prev.Collation),
+		apply: tableOptionsChange(tableName, cur.Charset, cur.Collation),
+	}}
+	for _, col := range sortedKeys(prev.Columns) {
+		curCol, ok := cur.Columns[col]
+		if !ok {
+			continue
+		}
+		prevDef := prev.Columns[col].Definition
+		if !inheritsTableCharset(prevDef) || !inheritsTableCharset(curCol.Definition) {
+			continue
+		}
+		ops = append(ops, migrationOp{
+			kind:  opTableCharset,
+			table: tableName,
+			name:  col,
+			up:    em.ModifyColumn(tableName, ColumnDefinition{Name: col, Definition: withColumnCharset(prevDef, to)}),
+			down:  em.ModifyColumn(tableName, ColumnDefinition{Name: col, Definition: withColumnCharset(prevDef, from)}),
+		})
+	}
+	return ops
+}
+
+func tableCharsetClause(table tableState) string {
+	clause := "DEFAULT CHARACTER SET " + table.Charset
+	if table.Collation != "" {
+		clause += " COLLATE " + table.Collation
+	}
+	return clause
+}
+
+// diffTableCollation handles a collation change within an unchanged charset,
+// e.g. utf8mb4_general_ci to utf8mb4_0900_ai_ci during a MySQL 8 upgrade.
+// Charset changes carry their collation in diffTableCharset instead. A
+// collation the state does not record is the default of the charset, which
+// restating the charset without COLLATE restores.
+func diffTableCollation(tableName string, prev, cur tableState, opts Options) []migrationOp {
+	if !strings.EqualFold(prev.Charset, cur.Charset) || strings.EqualFold(prev.Collation, cur.Collation) {
+		return nil
+	}
+	em := opts.emitter()
+	charset := orDefault(cur.Charset, opts.mysqlDefaultCharset())
+	set := func(collation string) string {
+		if collation == "" {
+			return em.SetTableCharset(tableName, charset, "")
+		}
+		return em.SetTableCollation(tableName, collation)
+	}
+	return []migrationOp{{
+		kind:  opTableCollation,
+		table: tableName,
+		name:  tableName,
+		up:    set(cur.Collation),
+		down:  set(prev.Collation),
+		apply: tableOptionsChange(tableName, prev.Charset, cur.Collation),
+	}}
+}
+
+// mysqlDefaultCharset is the server default charset: utf8mb4 since MySQL
+// 8.0, and latin1 for an older Options.MySQLVersion.
+func (o Options) mysqlDefaultCharset() string {
+	if strings.TrimSpace(o.MySQLVersion) != "" && !o.mysqlVersionAtLeast(8, 0) {
+		return "latin1"
+	}
+	return "utf8mb4"
+}
+
+// mysqlDefaultEngine is the engine of a table whose state records none.
+const mysqlDefaultEngine = "InnoDB"
+
+// diffTableEngine moves the table to the storage engine its model declares.
+// A model without one leaves the engine alone. A table without a recorded
+// engine is taken to use the default, so the down moves it back there.
+func diffTableEngine(tableName string, prev, cur tableState, em Emitter) []migrationOp {
+	from := orDefault(prev.Engine, mysqlDefaultEngine)
+	if cur.Engine == "" || strings.EqualFold(from, cur.Engine) {
+		return nil
+	}
+	return []migrationOp{{
+		kind:  opTableEngine,
+		table: tableName,
+		name:  tableName,
+		up:    em.SetTableEngine(tableName, cur.Engine),
+		down:  em.SetTableEngine(tableName, from),
+		apply: tableEngineChange(tableName, cur.Engine),
+	}}
+}
+
+func inheritsTableCharset(definition string) bool {
+	return isTextualType(columnBaseType(definition)) && definitionCharset(definition) == ""
+}
+
+// withColumnCharset places an explicit CHARACTER SET right after the type,
+// where MySQL expects it.
+func withColumnCharset(definition, charset string) string {
+	tokens := tokenizeDefinition(normalizeDefinition(definition))
+	if len(tokens) == 0 {
+		return definition
+	}
+	out := append([]string{tokens[0], "CHARACTER", "SET", charset}, tokens[1:]...)
+	return strings.Join(out, " ")
+}
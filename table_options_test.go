@@ -0,0 +1,227 @@
+package gomigration
+
+import (
+	"strings"
+	"testing"
+)
+
+type charsetModel struct {
+	ID     uint   `gorm:"primaryKey"`
+	Title  string `gorm:"size:64"`
+	Legacy string `gorm:"type:varchar(32) CHARACTER SET latin1"`
+}
+
+func (charsetModel) TableName() string { return "charset_models" }
+
+func (charsetModel) TableOptions() TableOptions {
+	return TableOptions{Charset: "utf8mb4"}
+}
+
+func TestBuildCurrentStateCapturesTableCharset(t *testing.T) {
+	state, err := buildCurrentState([]any{&charsetModel{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState failed: %v", err)
+	}
+	table := state.Tables["charset_models"]
+	if table.Charset != "utf8mb4" {
+		t.Fatalf("expected table charset utf8mb4, got %q", table.Charset)
+	}
+	create := createTableSQL("charset_models", table)
+	if !strings.HasSuffix(create, ") DEFAULT CHARSET=utf8mb4;") {
+		t.Fatalf("expected charset table option in create SQL, got: %s", create)
+	}
+}
+
+func TestDiffTableCharsetConvertsOnlyInheritedColumns(t *testing.T) {
+	prev := tableState{
+		Columns: map[string]columnState{
+			"id":     {Definition: "bigint unsigned AUTO_INCREMENT"},
+			"title":  {Definition: "varchar(64)"},
+			"legacy": {Definition: "varchar(32) CHARACTER SET latin1"},
+		},
+		PrimaryKeys: []string{"id"},
+		Charset:     "utf8",
+	}
+	cur := prev
+	cur.Charset = "utf8mb4"
+
+	ops := diffTable("charset_models", prev, cur)
+	up := make([]string, 0, len(ops))
+	down := make([]string, 0, len(ops))
+	for _, op := range ops {
+		up = append(up, op.up)
+		down = append(down, op.down)
+	}
+	upJoined := strings.Join(up, "\n")
+	downJoined := strings.Join(down, "\n")
+
+	assertContainsAll(t, upJoined, []string{
+		"ALTER TABLE `charset_models` DEFAULT CHARACTER SET utf8mb4;",
+		"ALTER TABLE `charset_models` MODIFY COLUMN `title` varchar(64) CHARACTER SET utf8mb4;",
+	})
+	assertContainsAll(t, downJoined, []string{
+		"ALTER TABLE `charset_models` DEFAULT CHARACTER SET utf8;",
+		"ALTER TABLE `charset_models` MODIFY COLUMN `title` varchar(64) CHARACTER SET utf8;",
+	})
+	if strings.Contains(upJoined, "`legacy`") || strings.Contains(upJoined, "`id`") {
+		t.Fatalf("expected pinned and non-textual columns to stay put, got:\n%s", upJoined)
+	}
+	if !strings.HasPrefix(up[0], "ALTER TABLE `charset_models` DEFAULT CHARACTER SET") {
+		t.Fatalf("expected table default change before column conversions, got: %v", up)
+	}
+}
+
+func TestDefinitionCharset(t *testing.T) {
+	cases := map[string]string{
+		"varchar(32) CHARACTER SET latin1":               "latin1",
+		"varchar(32) CHARSET utf8 COLLATE utf8_bin":      "utf8",
+		"varchar(32) NOT NULL COMMENT 'CHARACTER SET x'": "",
+		"text": "",
+	}
+	for in, want := range cases {
+		if got := definitionCharset(in); got != want {
+			t.Fatalf("definitionCharset(%q) mismatch: want=%q got=%q", in, want, got)
+		}
+	}
+}
+
+func TestDiffTableCollationOnlyChange(t *testing.T) {
+	prev := tableState{
+		Columns:   map[string]columnState{"name": {Definition: "varchar(64)"}},
+		Charset:   "utf8mb4",
+		Collation: "utf8mb4_general_ci",
+	}
+	cur := prev
+	cur.Collation = "utf8mb4_0900_ai_ci"
+
+	ops := diffTable("people", prev, cur)
+	if len(ops) != 1 {
+		t.Fatalf("expected a single collation op, got %#v", ops)
+	}
+	if ops[0].up != "ALTER TABLE `people` COLLATE = utf8mb4_0900_ai_ci;" {
+		t.Fatalf("unexpected up SQL: %s", ops[0].up)
+	}
+	if ops[0].down != "ALTER TABLE `people` COLLATE = utf8mb4_general_ci;" {
+		t.Fatalf("unexpected down SQL: %s", ops[0].down)
+	}
+
+	create := createTableSQL("people", cur)
+	if !strings.HasSuffix(create, ") DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;") {
+		t.Fatalf("expected charset and collation table options, got: %s", create)
+	}
+}
+
+func TestDiffTableCharsetChangeCarriesCollation(t *testing.T) {
+	prev := tableState{Columns: map[string]columnState{}, Charset: "utf8", Collation: "utf8_general_ci"}
+	cur := tableState{Columns: map[string]columnState{}, Charset: "utf8mb4", Collation: "utf8mb4_0900_ai_ci"}
+
+	ops := diffTable("people", prev, cur)
+	if len(ops) != 1 {
+		t.Fatalf("expected a single charset op, got %#v", ops)
+	}
+	if ops[0].up != "ALTER TABLE `people` DEFAULT CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci;" {
+		t.Fatalf("unexpected up SQL: %s", ops[0].up)
+	}
+	if ops[0].down != "ALTER TABLE `people` DEFAULT CHARACTER SET utf8 COLLATE utf8_general_ci;" {
+		t.Fatalf("unexpected down SQL: %s", ops[0].down)
+	}
+}
+
+type engineModel struct {
+	ID uint `gorm:"primaryKey"`
+}
+
+func (engineModel) TableName() string { return "engine_models" }
+
+func (engineModel) TableOptions() TableOptions {
+	return TableOptions{Engine: "InnoDB", Charset: "utf8mb4"}
+}
+
+func TestTableEngineCreateAndDiff(t *testing.T) {
+	state, err := buildCurrentState([]any{&engineModel{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState failed: %v", err)
+	}
+	cur := state.Tables["engine_models"]
+	if create := createTableSQL("engine_models", cur); !strings.HasSuffix(create, ") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;") {
+		t.Fatalf("expected the engine before the charset, got: %s", create)
+	}
+
+	prev := cloneTableState(cur)
+	prev.Engine = "MyISAM"
+	ops := diffTable("engine_models", prev, cur)
+	if len(ops) != 1 || ops[0].kind != opTableEngine {
+		t.Fatalf("expected one engine op, got %#v", ops)
+	}
+	if ops[0].up != "ALTER TABLE `engine_models` ENGINE=InnoDB;" || ops[0].down != "ALTER TABLE `engine_models` ENGINE=MyISAM;" {
+		t.Fatalf("unexpected engine SQL:\n%s\n%s", ops[0].up, ops[0].down)
+	}
+	if err := verifyMigrationOps(schemaState{Tables: map[string]tableState{"engine_models": prev}}, state, ops, Options{}); err != nil {
+		t.Fatalf("unexpected self-check failure: %v", err)
+	}
+
+	if ops := diffTable("engine_models", cur, prev); len(ops) != 1 {
+		t.Fatalf("expected the reverse engine change, got %#v", ops)
+	}
+	unset := cloneTableState(cur)
+	unset.Engine = ""
+	if ops := diffTable("engine_models", cur, unset); len(ops) != 0 {
+		t.Fatalf("expected no op when the model declares no engine, got %#v", ops)
+	}
+	if ops := diffTableWithOptions("engine_models", prev, cur, Options{Dialect: DialectPostgres}); len(ops) != 0 {
+		t.Fatalf("expected Postgres to skip the engine, got %#v", ops)
+	}
+}
+
+func TestDiffTableEngineFromUnrecordedEngine(t *testing.T) {
+	prev := tableState{Columns: map[string]columnState{}}
+	cur := tableState{Columns: map[string]columnState{}, Engine: "MyISAM"}
+	ops := diffTable("logs", prev, cur)
+	if len(ops) != 1 || ops[0].up != "ALTER TABLE `logs` ENGINE=MyISAM;" || ops[0].down != "ALTER TABLE `logs` ENGINE=InnoDB;" {
+		t.Fatalf("expected the down to restore the default engine, got %#v", ops)
+	}
+	cur.Engine = "innodb"
+	if ops := diffTable("logs", prev, cur); len(ops) != 0 {
+		t.Fatalf("expected declaring the default engine to change nothing, got %#v", ops)
+	}
+}
+
+func TestDiffTableCharsetFromAndToTheDefault(t *testing.T) {
+	columns := map[string]columnState{"title": {Definition: "varchar(64)"}}
+	unset := tableState{Columns: columns}
+	declared := tableState{Columns: columns, Charset: "utf8"}
+
+	up, down := splitMigrationOps(diffTable("posts", unset, declared))
+	assertContainsAll(t, strings.Join(up, "\n"), []string{
+		"ALTER TABLE `posts` DEFAULT CHARACTER SET utf8;",
+		"ALTER TABLE `posts` MODIFY COLUMN `title` varchar(64) CHARACTER SET utf8;",
+	})
+	assertContainsAll(t, strings.Join(down, "\n"), []string{
+		"ALTER TABLE `posts` DEFAULT CHARACTER SET utf8mb4;",
+		"ALTER TABLE `posts` MODIFY COLUMN `title` varchar(64) CHARACTER SET utf8mb4;",
+	})
+	if len(up) != len(down) {
+		t.Fatalf("expected every up to have a down, got %d and %d", len(up), len(down))
+	}
+
+	up, down = splitMigrationOps(diffTable("posts", declared, unset))
+	assertContainsAll(t, strings.Join(up, "\n"), []string{"ALTER TABLE `posts` DEFAULT CHARACTER SET utf8mb4;"})
+	assertContainsAll(t, strings.Join(down, "\n"), []string{"ALTER TABLE `posts` DEFAULT CHARACTER SET utf8;"})
+
+	up, _ = splitMigrationOps(diffTableWithOptions("posts", declared, unset, Options{MySQLVersion: "5.7"}))
+	assertContainsAll(t, strings.Join(up, "\n"), []string{"ALTER TABLE `posts` DEFAULT CHARACTER SET latin1;"})
+}
+
+func TestDiffTableCollationFromAndToTheDefault(t *testing.T) {
+	unset := tableState{Columns: map[string]columnState{}, Charset: "utf8mb4"}
+	declared := tableState{Columns: map[string]columnState{}, Charset: "utf8mb4", Collation: "utf8mb4_bin"}
+
+	ops := diffTable("people", unset, declared)
+	if len(ops) != 1 || ops[0].up != "ALTER TABLE `people` COLLATE = utf8mb4_bin;" || ops[0].down != "ALTER TABLE `people` DEFAULT CHARACTER SET utf8mb4;" {
+		t.Fatalf("expected the down to restore the charset default collation, got %#v", ops)
+	}
+	ops = diffTable("people", declared, unset)
+	if len(ops) != 1 || ops[0].up != "ALTER TABLE `people` DEFAULT CHARACTER SET utf8mb4;" || ops[0].down != "ALTER TABLE `people` COLLATE = utf8mb4_bin;" {
+		t.Fatalf("expected clearing the collation to restore the default, got %#v", ops)
+	}
+}
@@ -0,0 +1,72 @@
+package gomigration
+
+import "sort"
+
+// tableCreationOrder orders names so that every table comes after the tables
+// among names that its foreign keys reference, which dialects declaring
+// foreign keys in CREATE TABLE need. Ties are broken by name. Tables in a
+// reference cycle cannot all come after each other; the first of them by
+// name goes first, and MySQL adds their foreign keys afterwards with ALTER
+// TABLE anyway.
+func tableCreationOrder(tables map[string]tableState, names []string) []string {
+	pending := make(map[string]bool, len(names))
+	for _, name := range names {
+		pending[name] = true
+	}
+	waiting := func(table string) bool {
+		fks := tables[table].ForeignKeys
+		for _, fk := range fks {
+			if fk.RefTable != table && pending[fk.RefTable] {
+				return true
+			}
+		}
+		return false
+	}
+	sorted := append([]string{}, names...)
+	sort.Strings(sorted)
+	ordered := make([]string, 0, len(names))
+	for len(ordered) < len(sorted) {
+		next := ""
+		for _, name := range sorted {
+			if pending[name] && !waiting(name) {
+				next = name
+				break
+			}
+		}
+		if next == "" {
+			for _, name := range sorted {
+				if pending[name] {
+					next = name
+					break
+				}
+			}
+		}
+		pending[next] = false
+		ordered = append(ordered, next)
+	}
+	return ordered
+}
+
+// inlinedForeignKeys returns, per new table in creation order, the foreign
+// keys Options.InlineForeignKeys declares in its CREATE TABLE: those whose
+// referenced table is not new, is the table itself or is created before it.
+// SQLite declares all of them already.
+func inlinedForeignKeys(tables map[string]tableState, order []string, opts Options) map[string][]string {
+	inlined := map[string][]string{}
+	if !opts.InlineForeignKeys || opts.Dialect == DialectSQLite {
+		return inlined
+	}
+	position := make(map[string]int, len(order))
+	for i, name := range order {
+		position[name] = i
+	}
+	for i, tableName := range order {
+		fks := tables[tableName].ForeignKeys
+		for _, name := range sortedKeys(fks) {
+			if ref, isNew := position[fks[name].RefTable]; !isNew || ref <= i {
+				inlined[tableName] = append(inlined[tableName], name)
+			}
+		}
+	}
+	return inlined
+}
@@ -0,0 +1,61 @@
+package gomigration
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type orderZUser struct {
+	ID uint `gorm:"primaryKey"`
+}
+
+func (orderZUser) TableName() string { return "z_users" }
+
+type orderAOrder struct {
+	ID     uint `gorm:"primaryKey"`
+	UserID uint
+	User   orderZUser
+}
+
+func (orderAOrder) TableName() string { return "a_orders" }
+
+func TestTableCreationOrder(t *testing.T) {
+	references := func(refs ...string) tableState {
+		table := tableState{ForeignKeys: map[string]foreignKeyState{}}
+		for _, ref := range refs {
+			table.ForeignKeys["fk_"+ref] = foreignKeyState{Columns: []string{ref + "_id"}, RefTable: ref, RefColumns: []string{"id"}}
+		}
+		return table
+	}
+	tables := map[string]tableState{
+		"a_items":    references("m_orders", "a_items"),
+		"m_orders":   references("z_users"),
+		"z_users":    references(),
+		"b_cycle":    references("c_cycle"),
+		"c_cycle":    references("b_cycle"),
+		"d_external": references("existing"),
+	}
+	got := tableCreationOrder(tables, sortedKeys(tables))
+	want := []string{"d_external", "z_users", "m_orders", "a_items", "b_cycle", "c_cycle"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("tableCreationOrder = %v, want %v", got, want)
+	}
+}
+
+func TestMakeMigrationsCreatesReferencedTablesFirst(t *testing.T) {
+	for _, dialect := range []Dialect{DialectMySQL, DialectSQLite} {
+		up, down, _, err := PreviewMigrationsWithOptions([]any{&orderAOrder{}, &orderZUser{}}, filepath.Join(t.TempDir(), "state.json"), Options{Dialect: dialect})
+		if err != nil {
+			t.Fatalf("%s: PreviewMigrationsWithOptions failed: %v", dialect, err)
+		}
+		upSQL, downSQL := strings.Join(up, "\n"), strings.Join(down, "\n")
+		if strings.Index(upSQL, "z_users") > strings.Index(upSQL, "a_orders") {
+			t.Fatalf("%s: expected z_users to be created first:\n%s", dialect, upSQL)
+		}
+		if strings.LastIndex(downSQL, "z_users") < strings.LastIndex(downSQL, "a_orders") {
+			t.Fatalf("%s: expected z_users to be dropped last:\n%s", dialect, downSQL)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package gomigration
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Default tablespaces a table moves back to when a migration that placed it
+// elsewhere is rolled back.
+const (
+	mysqlDefaultTablespace    = "innodb_file_per_table"
+	postgresDefaultTablespace = "pg_default"
+)
+
+// applyIndexTablespaces records the tablespace option of index tags
+// (`gorm:"index:idx_x,tablespace:fast"`). Index tablespaces, including those
+// from TableIndexes, are only supported for Postgres.
+func applyIndexTablespaces(table *tableState, stmt *gorm.Statement, dialect Dialect) error {
+	sc := stmt.Schema
+	namer := stmt.DB.Config.NamingStrategy
+	if namer == nil {
+		namer = schema.NamingStrategy{}
+	}
+	for _, field := range sc.Fields {
+		decls, err := parseFieldIndexTagDecls(sc.Table, field, namer)
+		if err != nil {
+			return err
+		}
+		for _, decl := range decls {
+			idx, ok := table.Indexes[decl.Name]
+			if decl.Tablespace == "" || !ok {
+				continue
+			}
+			if idx.Tablespace != "" && idx.Tablespace != decl.Tablespace {
+				return fmt.Errorf("table `%s` index `%s` has conflicting tablespaces %q and %q", sc.Table, decl.Name, idx.Tablespace, decl.Tablespace)
+			}
+			idx.Tablespace = decl.Tablespace
+			table.Indexes[decl.Name] = idx
+		}
+	}
+	if dialect == DialectPostgres {
+		return nil
+	}
+	for _, name := range sortedKeys(table.Indexes) {
+		if tablespace := table.Indexes[name].Tablespace; tablespace != "" {
+			return fmt.Errorf("table `%s` index `%s` uses tablespace %q, which is only supported for Postgres migrations", sc.Table, name, tablespace)
+		}
+	}
+	return nil
+}
+
+// diffTableTablespace moves a table to the tablespace its model declares. A
+// model without one leaves the table where it is, so a state synced from a
+// database that reports tablespaces does not produce a move.
+func diffTableTablespace(tableName string, prev, cur tableState, opts Options) []migrationOp {
+	if cur.Tablespace == "" || prev.Tablespace == cur.Tablespace || opts.Dialect == DialectSQLite {
+		return nil
+	}
+	em := opts.emitter()
+	return []migrationOp{{
+		kind:  opTableTablespace,
+		table: tableName,
+		name:  tableName,
+		up:    em.SetTableTablespace(tableName, cur.Tablespace),
+		down:  em.SetTableTablespace(tableName, prev.Tablespace),
+		apply: tableTablespaceChange(tableName, cur.Tablespace),
+	}}
+}
+
+// indexTablespaceOp moves an otherwise unchanged Postgres index to the
+// tablespace it declares.
+func indexTablespaceOp(tableName, indexName string, prev, cur indexState, opts Options) (migrationOp, bool) {
+	if opts.Dialect != DialectPostgres || cur.Tablespace == "" || prev.Tablespace == cur.Tablespace {
+		return migrationOp{}, false
+	}
+	em := opts.emitter()
+	return migrationOp{
+		kind:  opIndexTablespace,
+		table: tableName,
+		name:  indexName,
+		up:    em.SetIndexTablespace(tableName, indexName, cur.Tablespace),
+		down:  em.SetIndexTablespace(tableName, indexName, prev.Tablespace),
+		apply: setIndexChange(tableName, indexName, cur),
+	}, true
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,121 @@
+package gomigration
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type tablespaceModel struct {
+	ID        uint   `gorm:"primaryKey"`
+	Code      string `gorm:"size:32;index:idx_tablespace_models_code,tablespace:fast_idx"`
+	CreatedAt int64  `gorm:"index"`
+}
+
+func (tablespaceModel) TableName() string { return "tablespace_models" }
+
+func (tablespaceModel) TableOptions() TableOptions {
+	return TableOptions{Tablespace: "archive"}
+}
+
+type tablespaceTableOnly struct {
+	ID uint `gorm:"primaryKey"`
+}
+
+func (tablespaceTableOnly) TableName() string { return "tablespace_models" }
+
+func (tablespaceTableOnly) TableOptions() TableOptions {
+	return TableOptions{Tablespace: "archive"}
+}
+
+func TestTablespaceCreateSQL(t *testing.T) {
+	pg := Options{Dialect: DialectPostgres}
+	state, err := buildCurrentStateWithOptions([]any{&tablespaceModel{}}, pg)
+	if err != nil {
+		t.Fatalf("buildCurrentStateWithOptions failed: %v", err)
+	}
+	table := state.Tables["tablespace_models"]
+	if table.Tablespace != "archive" || table.Indexes["idx_tablespace_models_code"].Tablespace != "fast_idx" {
+		t.Fatalf("expected table and index tablespaces to be captured, got %#v", table)
+	}
+	assertContainsAll(t, createTableSQLWithOptions("tablespace_models", table, pg), []string{
+		`) TABLESPACE "archive";`,
+		`CREATE INDEX "idx_tablespace_models_code" ON "tablespace_models" ("code") TABLESPACE "fast_idx";`,
+		`CREATE INDEX "idx_tablespace_models_created_at" ON "tablespace_models" ("created_at");`,
+	})
+
+	state, err = buildCurrentState([]any{&tablespaceTableOnly{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState failed: %v", err)
+	}
+	if create := createTableSQL("tablespace_models", state.Tables["tablespace_models"]); !strings.HasSuffix(create, ") TABLESPACE `archive`;") {
+		t.Fatalf("expected MySQL table tablespace, got: %s", create)
+	}
+	if _, err := buildCurrentState([]any{&tablespaceModel{}}); err == nil || !strings.Contains(err.Error(), "only supported for Postgres") {
+		t.Fatalf("expected MySQL to reject an index tablespace, got %v", err)
+	}
+}
+
+func TestDiffTableTablespace(t *testing.T) {
+	prev := tableState{
+		Columns:     map[string]columnState{"id": {Definition: "bigint"}, "code": {Definition: "varchar(32)"}},
+		Indexes:     map[string]indexState{"idx_code": {Fields: []indexFieldState{{Column: "code"}}}},
+		PrimaryKeys: []string{"id"},
+	}
+	cur := cloneTableState(prev)
+	cur.Tablespace = "archive"
+	cur.Indexes["idx_code"] = indexState{Fields: []indexFieldState{{Column: "code"}}, Tablespace: "fast_idx"}
+
+	up, down := splitMigrationOps(diffTable("people", prev, cur))
+	if strings.Join(up, "\n") != "ALTER TABLE `people` TABLESPACE `archive`;" ||
+		strings.Join(down, "\n") != "ALTER TABLE `people` TABLESPACE `innodb_file_per_table`;" {
+		t.Fatalf("unexpected MySQL SQL:\n%s\n%s", strings.Join(up, "\n"), strings.Join(down, "\n"))
+	}
+
+	opts := Options{Dialect: DialectPostgres}
+	ops := diffTableWithOptions("people", prev, cur, opts)
+	up, down = splitMigrationOps(ops)
+	wantUp := []string{
+		`ALTER TABLE "people" SET TABLESPACE "archive";`,
+		`ALTER INDEX "idx_code" SET TABLESPACE "fast_idx";`,
+	}
+	wantDown := []string{
+		`ALTER INDEX "idx_code" SET TABLESPACE "pg_default";`,
+		`ALTER TABLE "people" SET TABLESPACE "pg_default";`,
+	}
+	if strings.Join(up, "\n") != strings.Join(wantUp, "\n") || strings.Join(down, "\n") != strings.Join(wantDown, "\n") {
+		t.Fatalf("unexpected Postgres SQL:\n%s\n%s", strings.Join(up, "\n"), strings.Join(down, "\n"))
+	}
+	previous := schemaState{Tables: map[string]tableState{"people": prev}}
+	current := schemaState{Tables: map[string]tableState{"people": cur}}
+	if err := verifyMigrationOps(previous, current, diffTable("people", prev, cur), Options{}); err != nil {
+		t.Fatalf("unexpected self-check failure: %v", err)
+	}
+
+	// A state synced from a database reports tablespaces the models do not
+	// declare; those are left alone.
+	if ops := diffTableWithOptions("people", cur, prev, opts); len(ops) != 0 {
+		t.Fatalf("expected no ops when the model declares no tablespace, got %#v", ops)
+	}
+}
+
+func TestTablespaceStateRoundTrip(t *testing.T) {
+	state, err := buildCurrentStateWithOptions([]any{&tablespaceModel{}}, Options{Dialect: DialectPostgres})
+	if err != nil {
+		t.Fatalf("buildCurrentStateWithOptions failed: %v", err)
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	var loaded schemaState
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if ops := diffSchemas(loaded, state, Options{Dialect: DialectPostgres}); len(ops) != 0 {
+		t.Fatalf("expected no ops after a state round trip, got %#v", ops)
+	}
+	if loaded.Tables["tablespace_models"].Indexes["idx_tablespace_models_code"].Tablespace != "fast_idx" {
+		t.Fatalf("expected the index tablespace to be saved, got %s", data)
+	}
+}
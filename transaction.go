@@ -0,0 +1,48 @@
+package gomigration
+
+import (
+	"fmt"
+	"strings"
+)
+
+// mysqlImplicitCommitNote follows START TRANSACTION in MySQL files that
+// contain DDL.
+const mysqlImplicitCommitNote = "-- note: MySQL commits implicitly before and after each CREATE, ALTER, DROP and RENAME statement, so this transaction does not make them atomic"
+
+// withTransaction encloses sql in a transaction, START TRANSACTION for MySQL
+// and BEGIN for Postgres and SQLite. The statements stay in their own blocks
+// so Apply still pairs the up and down operations.
+func withTransaction(sql []string, dialect Dialect) []string {
+	begin := "BEGIN;"
+	if dialect.isMySQL() {
+		begin = "START TRANSACTION;"
+		if containsImplicitCommit(sql) {
+			begin += "\n" + mysqlImplicitCommitNote
+		}
+	}
+	out := make([]string, 0, len(sql)+2)
+	out = append(out, begin)
+	out = append(out, sql...)
+	return append(out, "COMMIT;")
+}
+
+// containsImplicitCommit reports whether any statement of sql is DDL that
+// MySQL commits implicitly.
+func containsImplicitCommit(sql []string) bool {
+	for _, block := range sql {
+		for _, stmt := range splitSQLStatements(block) {
+			switch keyword, _, _ := strings.Cut(strings.ToUpper(stmt), " "); keyword {
+			case "CREATE", "ALTER", "DROP", "RENAME", "TRUNCATE":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (o Options) validateWrapInTransaction() error {
+	if o.WrapInTransaction && o.Dialect == DialectVitess {
+		return fmt.Errorf("WrapInTransaction is not supported for Vitess online DDL")
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package gomigration
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMakeMigrationsWrapInTransaction(t *testing.T) {
+	result, err := MakeMigrationsWithOptions(migrationModels(), t.TempDir(), "init", "", Options{
+		WrapInTransaction: true,
+		SQLMode:           "STRICT_ALL_TABLES",
+	})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	for _, path := range []string{result.UpPath, result.DownPath} {
+		content := readMigration(t, path)
+		blocks := strings.Split(content, "\n\n")
+		if !strings.HasPrefix(blocks[1], "START TRANSACTION;\n"+mysqlImplicitCommitNote) || blocks[len(blocks)-2] != "COMMIT;" {
+			t.Fatalf("expected the statements enclosed in a transaction inside the sql_mode guard, got:\n%s", content)
+		}
+	}
+
+	result, err = MakeMigrationsWithOptions(migrationModels(), t.TempDir(), "init", "", Options{
+		Dialect:           DialectPostgres,
+		WrapInTransaction: true,
+	})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions for Postgres failed: %v", err)
+	}
+	up := readMigration(t, result.UpPath)
+	if !strings.HasPrefix(up, "BEGIN;\n\nCREATE TABLE") || !strings.HasSuffix(up, "\n\nCOMMIT;") || strings.Contains(up, "-- note:") {
+		t.Fatalf("expected a plain BEGIN/COMMIT transaction, got:\n%s", up)
+	}
+
+	if _, err := MakeMigrationsWithOptions(migrationModels(), t.TempDir(), "init", "", Options{
+		Dialect:           DialectVitess,
+		WrapInTransaction: true,
+	}); err == nil {
+		t.Fatalf("expected WrapInTransaction to be rejected for Vitess")
+	}
+}
@@ -0,0 +1,268 @@
+package gomigration
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ddlObject is a schema object a statement creates or drops: a table, or an
+// index, column, foreign key, constraint or primary key of table. Names keep
+// the quoting of the statement they come from.
+type ddlObject struct {
+	kind  string
+	table string
+	name  string
+}
+
+// same compares identifiers without their quoting. A Postgres DROP INDEX
+// names no table, so an index without one matches the index of any table.
+func (o ddlObject) same(other ddlObject) bool {
+	sameName := func(a, b string) bool {
+		return strings.EqualFold(unquoteIdentifier(a), unquoteIdentifier(b))
+	}
+	if o.kind != other.kind || !sameName(o.name, other.name) {
+		return false
+	}
+	return (o.kind == "index" && (o.table == "" || other.table == "")) || sameName(o.table, other.table)
+}
+
+// ddlChange is an object a statement creates, or drops when created is false.
+type ddlChange struct {
+	object  ddlObject
+	created bool
+}
+
+// undoStatements returns the statements that undo ran, the statements of a
+// partially applied operation that succeeded before one of them failed, in
+// the order to run them. Objects ran created are dropped again, objects it
+// dropped are created again by the statement of down, the down block of the
+// operation, that creates them, renames are reversed and SET statements
+// need no undo. Any other statement, such as MODIFY COLUMN or a data
+// change, makes it fail.
+func undoStatements(dialect Dialect, ran, down []string) ([]string, error) {
+	undo := make([]string, 0, len(ran))
+	for i := len(ran) - 1; i >= 0; i-- {
+		stmts, err := inverseStatement(dialect, ran[i], down)
+		if err != nil {
+			return nil, err
+		}
+		undo = append(undo, stmts...)
+	}
+	return undo, nil
+}
+
+func inverseStatement(dialect Dialect, stmt string, down []string) ([]string, error) {
+	tokens := tokenizeDefinition(strings.TrimSuffix(strings.TrimSpace(stmt), ";"))
+	if hasKeywords(tokens, "SET") {
+		return nil, nil
+	}
+	if rename := inverseRename(tokens); rename != "" {
+		return []string{rename}, nil
+	}
+	changes, ok := statementChanges(dialect, tokens)
+	if !ok {
+		return nil, fmt.Errorf("no inverse for %q", stmt)
+	}
+	undo := make([]string, 0, len(changes))
+	for i := len(changes) - 1; i >= 0; i-- {
+		sql := ""
+		if changes[i].created {
+			sql = dropObjectSQL(dialect, changes[i].object)
+		} else {
+			sql = recreateStatement(dialect, changes[i].object, down)
+		}
+		if sql == "" {
+			return nil, fmt.Errorf("no inverse for %q", stmt)
+		}
+		undo = append(undo, sql)
+	}
+	return undo, nil
+}
+
+// inverseRename returns the statement that reverses a table, column or
+// index rename, or "" when tokens rename nothing.
+func inverseRename(tokens []string) string {
+	switch {
+	case hasKeywords(tokens, "RENAME", "TABLE") && len(tokens) == 5 && strings.EqualFold(tokens[3], "TO"):
+		return fmt.Sprintf("RENAME TABLE %s TO %s;", tokens[4], tokens[2])
+	case hasKeywords(tokens, "ALTER", "INDEX") && len(tokens) == 6 && hasKeywords(tokens[3:], "RENAME", "TO"):
+		return fmt.Sprintf("ALTER INDEX %s RENAME TO %s;", tokens[5], tokens[2])
+	case !hasKeywords(tokens, "ALTER", "TABLE") || len(tokens) < 5 || !strings.EqualFold(tokens[3], "RENAME"):
+		return ""
+	}
+	table, c := tokens[2], tokens[4:]
+	switch {
+	case len(c) == 4 && (hasKeywords(c, "COLUMN") || hasKeywords(c, "INDEX") || hasKeywords(c, "KEY")) && strings.EqualFold(c[2], "TO"):
+		return fmt.Sprintf("ALTER TABLE %s RENAME %s %s TO %s;", table, strings.ToUpper(c[0]), c[3], c[1])
+	case len(c) == 3 && strings.EqualFold(c[1], "TO"):
+		return fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s;", table, c[2], c[0])
+	case len(c) == 2 && (strings.EqualFold(c[0], "TO") || strings.EqualFold(c[0], "AS")):
+		return fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", c[1], table)
+	case len(c) == 1:
+		return fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", c[0], table)
+	}
+	return ""
+}
+
+// statementChanges lists the objects the statement of tokens creates and
+// drops, in order. It reports false for a statement it cannot follow.
+func statementChanges(dialect Dialect, tokens []string) ([]ddlChange, bool) {
+	switch {
+	case hasKeywords(tokens, "CREATE", "TABLE"):
+		tokens = skipKeywords(tokens[2:], "IF", "NOT", "EXISTS")
+		if len(tokens) == 0 {
+			return nil, false
+		}
+		name, _ := splitNameAndGroup(tokens[0])
+		return []ddlChange{{object: ddlObject{kind: "table", name: name}, created: true}}, true
+	case hasKeywords(tokens, "DROP", "TABLE"):
+		tokens = skipKeywords(tokens[2:], "IF", "EXISTS")
+		if len(tokens) != 1 {
+			return nil, false
+		}
+		return []ddlChange{{object: ddlObject{kind: "table", name: tokens[0]}}}, true
+	case hasKeywords(tokens, "CREATE"):
+		tokens = tokens[1:]
+		if len(tokens) > 0 && indexClassPrefix(tokens[0]) != "" {
+			tokens = tokens[1:]
+		}
+		if !hasKeywords(tokens, "INDEX") {
+			return nil, false
+		}
+		tokens = skipKeywords(skipKeywords(tokens[1:], "CONCURRENTLY"), "IF", "NOT", "EXISTS")
+		if len(tokens) < 3 || !strings.EqualFold(tokens[1], "ON") {
+			return nil, false
+		}
+		table, _ := splitNameAndGroup(tokens[2])
+		return []ddlChange{{object: ddlObject{kind: "index", table: table, name: tokens[0]}, created: true}}, true
+	case hasKeywords(tokens, "DROP", "INDEX"):
+		tokens = skipKeywords(skipKeywords(tokens[2:], "CONCURRENTLY"), "IF", "EXISTS")
+		switch {
+		case len(tokens) == 1:
+			return []ddlChange{{object: ddlObject{kind: "index", name: tokens[0]}}}, true
+		case len(tokens) == 3 && strings.EqualFold(tokens[1], "ON"):
+			return []ddlChange{{object: ddlObject{kind: "index", table: tokens[2], name: tokens[0]}}}, true
+		}
+		return nil, false
+	case hasKeywords(tokens, "ALTER", "TABLE") && len(tokens) > 3:
+		changes := make([]ddlChange, 0)
+		for _, clause := range splitTopLevel(strings.Join(tokens[3:], " ")) {
+			change, ok := clauseChange(dialect, tokens[2], tokenizeDefinition(clause))
+			if !ok {
+				return nil, false
+			}
+			changes = append(changes, change)
+		}
+		return changes, true
+	}
+	return nil, false
+}
+
+// clauseChange is statementChanges for one ADD or DROP clause of ALTER
+// TABLE table. Outside MySQL, named foreign keys, unique keys and primary
+// keys are constraints, as the DROP CONSTRAINT that removes them says.
+func clauseChange(dialect Dialect, table string, c []string) (ddlChange, bool) {
+	if len(c) < 2 {
+		return ddlChange{}, false
+	}
+	created := strings.EqualFold(c[0], "ADD")
+	if !created && !strings.EqualFold(c[0], "DROP") {
+		return ddlChange{}, false
+	}
+	c = c[1:]
+	object := ddlObject{table: table}
+	switch {
+	case hasKeywords(c, "PRIMARY", "KEY"):
+		object.kind = "primary key"
+	case created && hasKeywords(c, "CONSTRAINT") && len(c) > 2:
+		object.name = c[1]
+		switch {
+		case strings.EqualFold(c[2], "PRIMARY") && dialect.isMySQL():
+			object.kind, object.name = "primary key", ""
+		case strings.EqualFold(c[2], "FOREIGN") && dialect.isMySQL():
+			object.kind = "foreign key"
+		case strings.EqualFold(c[2], "UNIQUE") && dialect.isMySQL():
+			object.kind = "index"
+		default:
+			object.kind = "constraint"
+		}
+	case !created && hasKeywords(c, "FOREIGN", "KEY") && len(c) == 3:
+		object.kind, object.name = "foreign key", c[2]
+	case !created && hasKeywords(c, "CONSTRAINT"):
+		c = skipKeywords(c[1:], "IF", "EXISTS")
+		if len(c) != 1 {
+			return ddlChange{}, false
+		}
+		object.kind, object.name = "constraint", c[0]
+	case isIndexKeyword(c[0]):
+		if indexClassPrefix(c[0]) != "" {
+			c = c[1:]
+		}
+		if hasKeywords(c, "INDEX") || hasKeywords(c, "KEY") {
+			c = c[1:]
+		}
+		if len(c) == 0 {
+			return ddlChange{}, false
+		}
+		name, _ := splitNameAndGroup(c[0])
+		if name == "" || strings.HasPrefix(name, "(") {
+			return ddlChange{}, false
+		}
+		object.kind, object.name = "index", name
+	case hasKeywords(c, "CHECK") || hasKeywords(c, "FOREIGN") || hasKeywords(c, "PARTITION"):
+		return ddlChange{}, false
+	default:
+		c = skipKeywords(c, "COLUMN")
+		if created {
+			c = skipKeywords(c, "IF", "NOT", "EXISTS")
+		} else {
+			c = skipKeywords(c, "IF", "EXISTS")
+		}
+		if len(c) == 0 || (!created && len(c) != 1) {
+			return ddlChange{}, false
+		}
+		object.kind, object.name = "column", c[0]
+	}
+	return ddlChange{object: object, created: created}, true
+}
+
+// dropObjectSQL drops an object a statement created, or returns "" when the
+// dialect cannot drop it by the names the statement gave.
+func dropObjectSQL(dialect Dialect, o ddlObject) string {
+	switch o.kind {
+	case "table":
+		return fmt.Sprintf("DROP TABLE %s;", o.name)
+	case "index":
+		if dialect.isMySQL() {
+			return fmt.Sprintf("DROP INDEX %s ON %s;", o.name, o.table)
+		}
+		return fmt.Sprintf("DROP INDEX %s;", o.name)
+	case "column":
+		return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", o.table, o.name)
+	case "foreign key":
+		return fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s;", o.table, o.name)
+	case "constraint":
+		return fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s;", o.table, o.name)
+	case "primary key":
+		if dialect.isMySQL() {
+			return fmt.Sprintf("ALTER TABLE %s DROP PRIMARY KEY;", o.table)
+		}
+	}
+	return ""
+}
+
+// recreateStatement returns the statement of down that creates o and
+// nothing else, or "" when there is none.
+func recreateStatement(dialect Dialect, o ddlObject, down []string) string {
+	for _, stmt := range down {
+		tokens := tokenizeDefinition(strings.TrimSuffix(strings.TrimSpace(stmt), ";"))
+		if inverseRename(tokens) != "" {
+			continue
+		}
+		changes, ok := statementChanges(dialect, tokens)
+		if ok && len(changes) == 1 && changes[0].created && changes[0].object.same(o) {
+			return stmt
+		}
+	}
+	return ""
+}
@@ -0,0 +1,285 @@
+package gomigration
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// The helpers below build the logical effect of a migrationOp on an
+// in-memory schema. They expect tables produced by cloneSchemaState, whose
+// nested maps are never nil and never shared with the original state.
+
+func createTableChange(tableName string, table tableState) func(map[string]tableState) {
+	return func(tables map[string]tableState) {
+		created := cloneTableState(table)
+		created.ForeignKeys = map[string]foreignKeyState{}
+		tables[tableName] = created
+	}
+}
+
+func dropTableChange(tableName string) func(map[string]tableState) {
+	return func(tables map[string]tableState) {
+		delete(tables, tableName)
+	}
+}
+
+func setColumnChange(tableName, column string, col columnState) func(map[string]tableState) {
+	return func(tables map[string]tableState) {
+		table := tables[tableName]
+		if _, exists := table.Columns[column]; !exists {
+			table.ColumnOrder = append(table.ColumnOrder, column)
+		}
+		table.Columns[column] = col
+		tables[tableName] = table
+	}
+}
+
+func dropColumnChange(tableName, column string) func(map[string]tableState) {
+	return func(tables map[string]tableState) {
+		table := tables[tableName]
+		delete(table.Columns, column)
+		order := make([]string, 0, len(table.ColumnOrder))
+		for _, c := range table.ColumnOrder {
+			if c != column {
+				order = append(order, c)
+			}
+		}
+		table.ColumnOrder = order
+		tables[tableName] = table
+	}
+}
+
+func setIndexChange(tableName, indexName string, idx indexState) func(map[string]tableState) {
+	return func(tables map[string]tableState) {
+		tables[tableName].Indexes[indexName] = idx
+	}
+}
+
+func dropIndexChange(tableName, indexName string) func(map[string]tableState) {
+	return func(tables map[string]tableState) {
+		delete(tables[tableName].Indexes, indexName)
+	}
+}
+
+func setForeignKeyChange(tableName, name string, fk foreignKeyState) func(map[string]tableState) {
+	return func(tables map[string]tableState) {
+		tables[tableName].ForeignKeys[name] = fk
+	}
+}
+
+func dropForeignKeyChange(tableName, name string) func(map[string]tableState) {
+	return func(tables map[string]tableState) {
+		delete(tables[tableName].ForeignKeys, name)
+	}
+}
+
+func tableOptionsChange(tableName, charset, collation string) func(map[string]tableState) {
+	return func(tables map[string]tableState) {
+		table := tables[tableName]
+		table.Charset = charset
+		table.Collation = collation
+		tables[tableName] = table
+	}
+}
+
+func tableTablespaceChange(tableName, tablespace string) func(map[string]tableState) {
+	return func(tables map[string]tableState) {
+		table := tables[tableName]
+		table.Tablespace = tablespace
+		tables[tableName] = table
+	}
+}
+
+func tableEngineChange(tableName, engine string) func(map[string]tableState) {
+	return func(tables map[string]tableState) {
+		table := tables[tableName]
+		table.Engine = engine
+		tables[tableName] = table
+	}
+}
+
+func tableCommentChange(tableName, comment string) func(map[string]tableState) {
+	return func(tables map[string]tableState) {
+		table := tables[tableName]
+		table.Comment = comment
+		tables[tableName] = table
+	}
+}
+
+func columnOrderChange(tableName string, order []string) func(map[string]tableState) {
+	return func(tables map[string]tableState) {
+		table := tables[tableName]
+		table.ColumnOrder = append([]string{}, order...)
+		tables[tableName] = table
+	}
+}
+
+// verifyMigrationOps replays the up SQL of ops onto previous with the
+// statement parser of ReconstructState and reports where the result differs
+// from current, so a wrong statement of an Emitter fails the check.
+// Column definitions are compared with opts.ColumnEqual and indexes with
+// opts.indexEqual; column order, create-only flags and an unset current
+// charset or collation are not compared since the generator never emits
+// SQL for them on their own.
+func verifyMigrationOps(previous, current schemaState, ops []migrationOp, opts Options) error {
+	replayed := cloneSchemaState(previous)
+	for _, op := range ops {
+		for _, stmt := range splitSQLStatements(op.up) {
+			if err := replayStatement(replayed.Tables, stmt); err != nil {
+				return fmt.Errorf("self-check failed: cannot replay %q: %w", stmt, err)
+			}
+		}
+	}
+	if mismatch := schemaMismatch(replayed, current, opts); mismatch != "" {
+		return fmt.Errorf("self-check failed: generated migration does not reach the current schema: %s", mismatch)
+	}
+	return nil
+}
+
+func replayMigrationOps(previous schemaState, ops []migrationOp) schemaState {
+	replayed := cloneSchemaState(previous)
+	for _, op := range ops {
+		if op.apply != nil {
+			op.apply(replayed.Tables)
+		}
+	}
+	return replayed
+}
+
+func schemaMismatch(got, want schemaState, opts Options) string {
+	for _, tableName := range sortedKeys(want.Tables) {
+		if _, ok := got.Tables[tableName]; !ok {
+			return fmt.Sprintf("table `%s` is missing", tableName)
+		}
+	}
+	for _, tableName := range sortedKeys(got.Tables) {
+		wantTable, ok := want.Tables[tableName]
+		if !ok {
+			return fmt.Sprintf("table `%s` was not dropped", tableName)
+		}
+		if mismatch := tableMismatch(got.Tables[tableName], wantTable, opts); mismatch != "" {
+			return fmt.Sprintf("table `%s` %s", tableName, mismatch)
+		}
+	}
+	return ""
+}
+
+func tableMismatch(got, want tableState, opts Options) string {
+	for _, col := range sortedKeys(want.Columns) {
+		gotCol, ok := got.Columns[col]
+		if !ok {
+			return fmt.Sprintf("is missing column `%s`", col)
+		}
+		if !opts.columnEqual(gotCol.Definition, want.Columns[col].Definition) {
+			return fmt.Sprintf("column `%s` is %q, want %q", col, gotCol.Definition, want.Columns[col].Definition)
+		}
+	}
+	for _, col := range sortedKeys(got.Columns) {
+		if _, ok := want.Columns[col]; !ok {
+			return fmt.Sprintf("still has column `%s`", col)
+		}
+	}
+	if !reflect.DeepEqual(sortedCopy(got.PrimaryKeys), sortedCopy(want.PrimaryKeys)) {
+		return fmt.Sprintf("primary key is %v, want %v", got.PrimaryKeys, want.PrimaryKeys)
+	}
+	if want.Charset != "" && !strings.EqualFold(got.Charset, want.Charset) {
+		return fmt.Sprintf("charset is %q, want %q", got.Charset, want.Charset)
+	}
+	if want.Collation != "" && !strings.EqualFold(got.Collation, want.Collation) {
+		return fmt.Sprintf("collation is %q, want %q", got.Collation, want.Collation)
+	}
+	if want.Engine != "" && !strings.EqualFold(got.Engine, want.Engine) {
+		return fmt.Sprintf("engine is %q, want %q", got.Engine, want.Engine)
+	}
+	if want.Tablespace != "" && got.Tablespace != want.Tablespace {
+		return fmt.Sprintf("tablespace is %q, want %q", got.Tablespace, want.Tablespace)
+	}
+	for _, name := range unionKeys(got.Indexes, want.Indexes) {
+		gotIdx, gotOK := got.Indexes[name]
+		wantIdx, wantOK := want.Indexes[name]
+		if gotOK != wantOK || !opts.indexEqual(opts.statedIndex(gotIdx), opts.statedIndex(wantIdx)) {
+			return fmt.Sprintf("index `%s` does not match", name)
+		}
+	}
+	for _, name := range unionKeys(got.ForeignKeys, want.ForeignKeys) {
+		gotFK, gotOK := got.ForeignKeys[name]
+		wantFK, wantOK := want.ForeignKeys[name]
+		if gotOK != wantOK || !opts.foreignKeyEqual(gotFK, wantFK) {
+			return fmt.Sprintf("foreign key `%s` does not match", name)
+		}
+	}
+	return ""
+}
+
+// statedIndex keeps what the SQL of an index states: not the column the
+// model gives a key part that indexes an expression, nor a prefix length
+// outside MySQL, the only dialect that has them.
+func (o Options) statedIndex(idx indexState) indexState {
+	fields := make([]indexFieldState, len(idx.Fields))
+	for i, field := range idx.Fields {
+		if field.Expression != "" {
+			field.Column = ""
+		}
+		if !o.Dialect.isMySQL() {
+			field.Length = 0
+		}
+		fields[i] = field
+	}
+	idx.Fields = fields
+	return idx
+}
+
+func cloneSchemaState(state schemaState) schemaState {
+	out := schemaState{Tables: make(map[string]tableState, len(state.Tables))}
+	for name, table := range state.Tables {
+		out.Tables[name] = cloneTableState(table)
+	}
+	return out
+}
+
+func cloneTableState(table tableState) tableState {
+	out := tableState{
+		Columns:     make(map[string]columnState, len(table.Columns)),
+		Indexes:     make(map[string]indexState, len(table.Indexes)),
+		ForeignKeys: make(map[string]foreignKeyState, len(table.ForeignKeys)),
+		PrimaryKeys: append([]string{}, table.PrimaryKeys...),
+		Charset:     table.Charset,
+		Collation:   table.Collation,
+		ColumnOrder: append([]string{}, table.ColumnOrder...),
+		Tablespace:  table.Tablespace,
+		Engine:      table.Engine,
+		Comment:     table.Comment,
+	}
+	for name, col := range table.Columns {
+		out.Columns[name] = col
+	}
+	for name, idx := range table.Indexes {
+		idx.Fields = append([]indexFieldState{}, idx.Fields...)
+		out.Indexes[name] = idx
+	}
+	for name, fk := range table.ForeignKeys {
+		fk.Columns = append([]string{}, fk.Columns...)
+		fk.RefColumns = append([]string{}, fk.RefColumns...)
+		out.ForeignKeys[name] = fk
+	}
+	return out
+}
+
+func sortedCopy(values []string) []string {
+	out := append([]string{}, values...)
+	sort.Strings(out)
+	return out
+}
+
+func unionKeys[T any](a, b map[string]T) []string {
+	set := make(map[string]bool, len(a)+len(b))
+	for k := range a {
+		set[k] = true
+	}
+	for k := range b {
+		set[k] = true
+	}
+	return sortedKeys(set)
+}
@@ -0,0 +1,122 @@
+package gomigration
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyMigrationOpsAcceptsGeneratedDiffs(t *testing.T) {
+	empty := schemaState{Tables: map[string]tableState{}}
+	withJoin, err := buildCurrentState([]any{&e2eUserWithJoin{}, &e2eGroupWithJoin{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState with join failed: %v", err)
+	}
+	noJoin, err := buildCurrentState([]any{&e2eUserNoJoin{}, &e2eGroupNoJoin{}})
+	if err != nil {
+		t.Fatalf("buildCurrentState without join failed: %v", err)
+	}
+
+	prevTable := tableState{
+		Columns: map[string]columnState{
+			"id":       {Definition: "bigint unsigned AUTO_INCREMENT"},
+			"name":     {Definition: "varchar(32)"},
+			"old_flag": {Definition: "tinyint"},
+		},
+		Indexes:     map[string]indexState{"idx_old_flag": {Fields: []indexFieldState{{Column: "old_flag"}}}},
+		PrimaryKeys: []string{"id"},
+		Charset:     "utf8",
+	}
+	curTable := tableState{
+		Columns: map[string]columnState{
+			"id":     {Definition: "bigint unsigned AUTO_INCREMENT"},
+			"name":   {Definition: "varchar(128)"},
+			"status": {Definition: "tinyint DEFAULT 1"},
+		},
+		Indexes:     map[string]indexState{"idx_status": {Class: "UNIQUE", Fields: []indexFieldState{{Column: "status"}}}},
+		PrimaryKeys: []string{"id"},
+		Charset:     "utf8mb4",
+		Collation:   "utf8mb4_0900_ai_ci",
+	}
+	prevAltered := schemaState{Tables: map[string]tableState{"people": prevTable}}
+	curAltered := schemaState{Tables: map[string]tableState{"people": curTable}}
+
+	cases := []struct {
+		name      string
+		prev, cur schemaState
+	}{
+		{"create all", empty, withJoin},
+		{"drop all", withJoin, empty},
+		{"add join table", noJoin, withJoin},
+		{"drop join table", withJoin, noJoin},
+		{"alter table", prevAltered, curAltered},
+		{"revert table", curAltered, prevAltered},
+	}
+	for _, tc := range cases {
+		ops := diffSchemas(tc.prev, tc.cur, Options{})
+		if err := verifyMigrationOps(tc.prev, tc.cur, ops, Options{}); err != nil {
+			t.Fatalf("%s: unexpected self-check failure: %v", tc.name, err)
+		}
+	}
+}
+
+func TestVerifyMigrationOpsReportsMissingOperation(t *testing.T) {
+	prev := schemaState{Tables: map[string]tableState{"people": {
+		Columns: map[string]columnState{"id": {Definition: "bigint"}},
+	}}}
+	cur := schemaState{Tables: map[string]tableState{"people": {
+		Columns: map[string]columnState{"id": {Definition: "bigint"}, "name": {Definition: "varchar(64)"}},
+		Indexes: map[string]indexState{"idx_name": {Fields: []indexFieldState{{Column: "name"}}}},
+	}}}
+	ops := diffSchemas(prev, cur, Options{})
+	if len(ops) != 2 {
+		t.Fatalf("expected column and index ops, got %#v", ops)
+	}
+
+	err := verifyMigrationOps(prev, cur, ops[:1], Options{})
+	if err == nil || !strings.Contains(err.Error(), "index `idx_name` does not match") {
+		t.Fatalf("expected missing index to fail the self-check, got %v", err)
+	}
+	err = verifyMigrationOps(prev, cur, ops[1:], Options{})
+	if err == nil || !strings.Contains(err.Error(), "table `people` is missing column `name`") {
+		t.Fatalf("expected missing column to fail the self-check, got %v", err)
+	}
+}
+
+func TestMakeMigrationsSelfVerify(t *testing.T) {
+	dir := t.TempDir()
+	result, err := MakeMigrationsWithOptions(migrationModels(), dir, "init_schema", "", Options{SelfVerify: true})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	if !result.Changed {
+		t.Fatalf("expected initial migration to generate files")
+	}
+}
+
+// truncatingEmitter adds every column as an int, whatever the model says.
+type truncatingEmitter struct {
+	MySQLEmitter
+}
+
+func (e truncatingEmitter) AddColumn(table string, column ColumnDefinition) string {
+	column.Definition = "int"
+	return e.MySQLEmitter.AddColumn(table, column)
+}
+
+func TestVerifyMigrationOpsReplaysTheEmittedSQL(t *testing.T) {
+	prev := schemaState{Tables: map[string]tableState{"people": {
+		Columns: map[string]columnState{"id": {Definition: "bigint"}},
+	}}}
+	cur := schemaState{Tables: map[string]tableState{"people": {
+		Columns: map[string]columnState{"id": {Definition: "bigint"}, "name": {Definition: "varchar(64)"}},
+	}}}
+	opts := Options{Emitter: truncatingEmitter{}}
+	err := verifyMigrationOps(prev, cur, diffSchemas(prev, cur, opts), opts)
+	if err == nil || !strings.Contains(err.Error(), "column `name` is \"int\", want \"varchar(64)\"") {
+		t.Fatalf("expected the self-check to catch the emitted definition, got %v", err)
+	}
+
+	if _, err := MakeMigrationsWithOptions(migrationModels(), t.TempDir(), "init", "", Options{Dialect: DialectPostgres, SelfVerify: true}); err == nil {
+		t.Fatalf("expected SelfVerify to be rejected for Postgres")
+	}
+}
@@ -0,0 +1,76 @@
+package gomigration
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestMakeMigrationsVitess(t *testing.T) {
+	prev := schemaState{Tables: map[string]tableState{
+		"people": {
+			Columns:     map[string]columnState{"id": {Definition: "bigint"}, "name": {Definition: "varchar(32)"}},
+			Indexes:     map[string]indexState{"idx_name": {Fields: []indexFieldState{{Column: "name"}}}},
+			PrimaryKeys: []string{"id"},
+		},
+	}}
+	cur := schemaState{Tables: map[string]tableState{
+		"people": {
+			Columns:     map[string]columnState{"id": {Definition: "bigint"}, "name": {Definition: "varchar(32)"}},
+			Indexes:     map[string]indexState{"idx_people_name": {Class: "UNIQUE", Fields: []indexFieldState{{Column: "name"}}}},
+			PrimaryKeys: []string{"id"},
+		},
+	}}
+	up, down := splitMigrationOps(diffSchemas(prev, cur, Options{Dialect: DialectVitess}))
+	assertContainsAll(t, strings.Join(up, "\n"), []string{
+		"ALTER TABLE `people` DROP INDEX `idx_name`;",
+		"ALTER TABLE `people` ADD UNIQUE KEY `idx_people_name` (`name`);",
+	})
+	assertContainsAll(t, strings.Join(down, "\n"), []string{
+		"ALTER TABLE `people` DROP INDEX `idx_people_name`;",
+		"ALTER TABLE `people` ADD KEY `idx_name` (`name`);",
+	})
+	if got := (VitessEmitter{}).RenameTable("a", "b"); got != "ALTER TABLE `a` RENAME TO `b`;" {
+		t.Fatalf("unexpected rename SQL: %s", got)
+	}
+
+	result, err := MakeMigrationsWithOptions([]any{&reorderAfter{}}, t.TempDir(), "init", "", Options{Dialect: DialectVitess})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	for _, path := range []string{result.UpPath, result.DownPath} {
+		sql := readMigration(t, path)
+		if !strings.HasPrefix(sql, "SET @old_ddl_strategy = @@ddl_strategy;\nSET @@ddl_strategy = 'vitess';\n\n") || !strings.HasSuffix(sql, "\n\nSET @@ddl_strategy = @old_ddl_strategy;") {
+			t.Fatalf("expected ddl_strategy guard in %s, got:\n%s", path, sql)
+		}
+	}
+
+	_, err = MakeMigrationsWithOptions(migrationModels(), t.TempDir(), "init", "", Options{Dialect: DialectVitess})
+	if err == nil || !strings.Contains(err.Error(), "does not support foreign key constraints") {
+		t.Fatalf("expected foreign keys to be rejected, got %v", err)
+	}
+}
+
+func TestApplyDoesNotCompensateOnlineDDL(t *testing.T) {
+	dir := t.TempDir()
+	up := withVitessDDLStrategy([]string{"ALTER TABLE `a` ADD COLUMN `x` int;", "ALTER TABLE `a` ADD COLUMN `y` int;"})
+	down := withVitessDDLStrategy([]string{"ALTER TABLE `a` DROP COLUMN `y`;", "ALTER TABLE `a` DROP COLUMN `x`;"})
+	writeMigrationPair(t, dir, "20240101000000_online", up, down)
+
+	db, mock := newMockDB(t)
+	expectMigrationsTable(mock)
+	mock.ExpectExec("SET @old_ddl_strategy = @@ddl_strategy;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SET @@ddl_strategy = 'vitess';").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE `a` ADD COLUMN `x` int;").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE `a` ADD COLUMN `y` int;").WillReturnError(errors.New("boom"))
+
+	err := Apply(db, dir)
+	if err == nil || !strings.Contains(err.Error(), "not reverted: the file runs Vitess online DDL") {
+		t.Fatalf("expected the online DDL file to be left unreverted, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
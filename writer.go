@@ -0,0 +1,130 @@
+package gomigration
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+type FileEncoding string
+
+const (
+	FileEncodingUTF8    FileEncoding = "utf-8"
+	FileEncodingUTF8BOM FileEncoding = "utf-8-bom"
+	// The UTF-16 encodings always start with a byte order mark so readers,
+	// including Apply, can detect them.
+	FileEncodingUTF16LE FileEncoding = "utf-16le"
+	FileEncodingUTF16BE FileEncoding = "utf-16be"
+)
+
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+)
+
+func validateFileEncoding(enc FileEncoding) error {
+	switch enc {
+	case "", FileEncodingUTF8, FileEncodingUTF8BOM, FileEncodingUTF16LE, FileEncodingUTF16BE:
+		return nil
+	default:
+		return fmt.Errorf("unsupported file encoding %q", enc)
+	}
+}
+
+func encodeFileContent(content string, enc FileEncoding) ([]byte, error) {
+	switch enc {
+	case "", FileEncodingUTF8:
+		return []byte(content), nil
+	case FileEncodingUTF8BOM:
+		return append(append([]byte{}, utf8BOM...), content...), nil
+	case FileEncodingUTF16LE, FileEncodingUTF16BE:
+		var order binary.AppendByteOrder = binary.LittleEndian
+		bom := utf16LEBOM
+		if enc == FileEncodingUTF16BE {
+			order = binary.BigEndian
+			bom = utf16BEBOM
+		}
+		units := utf16.Encode([]rune(content))
+		out := make([]byte, len(bom), len(bom)+2*len(units))
+		copy(out, bom)
+		for _, u := range units {
+			out = order.AppendUint16(out, u)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unsupported file encoding %q", enc)
+	}
+}
+
+// decodeFileContent reverses encodeFileContent by sniffing the byte order
+// mark; content without one is read as UTF-8.
+func decodeFileContent(data []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(data, utf8BOM):
+		data = data[len(utf8BOM):]
+	case bytes.HasPrefix(data, utf16LEBOM), bytes.HasPrefix(data, utf16BEBOM):
+		var order binary.ByteOrder = binary.LittleEndian
+		if bytes.HasPrefix(data, utf16BEBOM) {
+			order = binary.BigEndian
+		}
+		data = data[2:]
+		if len(data)%2 != 0 {
+			return "", fmt.Errorf("truncated UTF-16 content")
+		}
+		units := make([]uint16, 0, len(data)/2)
+		for i := 0; i < len(data); i += 2 {
+			units = append(units, order.Uint16(data[i:]))
+		}
+		return string(utf16.Decode(units)), nil
+	}
+	if !utf8.Valid(data) {
+		return "", fmt.Errorf("content is not valid UTF-8")
+	}
+	return string(data), nil
+}
+
+func writeSQLFile(path, content string, enc FileEncoding) error {
+	data, err := encodeFileContent(content, enc)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// into place, so an interrupted write never leaves a truncated file behind.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func readSQLFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	content, err := decodeFileContent(data)
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", path, err)
+	}
+	return content, nil
+}
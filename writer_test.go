@@ -0,0 +1,76 @@
+package gomigration
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+type commentedUnicodeModel struct {
+	ID   uint   `gorm:"primaryKey"`
+	Name string `gorm:"size:64;comment:用户名称"`
+}
+
+func (commentedUnicodeModel) TableName() string { return "unicode_comment_models" }
+
+func TestFileEncodingRoundTrip(t *testing.T) {
+	content := "ALTER TABLE `t` MODIFY COLUMN `name` varchar(64) COMMENT '用户名称 😀';\n"
+	for _, enc := range []FileEncoding{"", FileEncodingUTF8, FileEncodingUTF8BOM, FileEncodingUTF16LE, FileEncodingUTF16BE} {
+		data, err := encodeFileContent(content, enc)
+		if err != nil {
+			t.Fatalf("encode %q failed: %v", enc, err)
+		}
+		got, err := decodeFileContent(data)
+		if err != nil {
+			t.Fatalf("decode %q failed: %v", enc, err)
+		}
+		if got != content {
+			t.Fatalf("round trip %q mismatch.\nwant=%q\ngot=%q", enc, content, got)
+		}
+	}
+}
+
+func TestMakeMigrationsWritesRequestedEncoding(t *testing.T) {
+	dir := t.TempDir()
+	result, err := MakeMigrationsWithOptions([]any{&commentedUnicodeModel{}}, dir, "init", "", Options{FileEncoding: FileEncodingUTF8BOM})
+	if err != nil {
+		t.Fatalf("MakeMigrationsWithOptions failed: %v", err)
+	}
+	data, err := os.ReadFile(result.UpPath)
+	if err != nil {
+		t.Fatalf("read up file failed: %v", err)
+	}
+	if !bytes.HasPrefix(data, utf8BOM) {
+		t.Fatalf("expected UTF-8 BOM prefix, got % x", data[:3])
+	}
+	content, err := readSQLFile(result.UpPath)
+	if err != nil {
+		t.Fatalf("readSQLFile failed: %v", err)
+	}
+	if !strings.Contains(content, "COMMENT '用户名称'") {
+		t.Fatalf("expected multi-byte comment to survive encoding, got: %s", content)
+	}
+}
+
+func TestMakeMigrationsDefaultEncodingHasNoBOM(t *testing.T) {
+	dir := t.TempDir()
+	result, err := MakeMigrations([]any{&commentedUnicodeModel{}}, dir, "init", "")
+	if err != nil {
+		t.Fatalf("MakeMigrations failed: %v", err)
+	}
+	data, err := os.ReadFile(result.UpPath)
+	if err != nil {
+		t.Fatalf("read up file failed: %v", err)
+	}
+	if bytes.HasPrefix(data, utf8BOM) {
+		t.Fatalf("expected default output without BOM")
+	}
+}
+
+func TestMakeMigrationsRejectsUnknownEncoding(t *testing.T) {
+	_, err := MakeMigrationsWithOptions(migrationModels(), t.TempDir(), "init", "", Options{FileEncoding: "latin1"})
+	if err == nil || !strings.Contains(err.Error(), "unsupported file encoding") {
+		t.Fatalf("expected unsupported encoding error, got: %v", err)
+	}
+}